@@ -0,0 +1,62 @@
+package cmds
+
+import (
+	"os"
+
+	"github.com/go-go-golems/parka/pkg/export"
+	"github.com/go-go-golems/parka/pkg/handlers"
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Renders the routes of a config file to static files",
+	Long: `Renders the routes of a config file to static files, which can be served from any
+directory or object store. The links between the exported pages are rewritten to relative paths.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configFile, err := cmd.Flags().GetString("config")
+		cobra.CheckErr(err)
+		out, err := cmd.Flags().GetString("out")
+		cobra.CheckErr(err)
+		baseURL, err := cmd.Flags().GetString("base-url")
+		cobra.CheckErr(err)
+		downloadFormats, err := cmd.Flags().GetStringSlice("download-formats")
+		cobra.CheckErr(err)
+		keepGoing, err := cmd.Flags().GetBool("keep-going")
+		cobra.CheckErr(err)
+
+		data, err := os.ReadFile(configFile)
+		cobra.CheckErr(err)
+		cfg, err := config.ParseConfig(data)
+		cobra.CheckErr(err)
+
+		loader := &TemplateCommandLoader{}
+		cfh := handlers.NewConfigFileHandler(cfg,
+			handlers.WithConfigFileLocation(configFile),
+			handlers.WithRepositoryFactory(handlers.NewRepositoryFactoryFromReaderLoaders(loader)),
+			handlers.WithCommandLoader(loader),
+		)
+		exporter, err := export.NewConfigFileExporter(cfh, out,
+			export.WithBaseURL(baseURL),
+			export.WithDownloadFormats(downloadFormats...),
+			export.WithKeepGoing(keepGoing),
+		)
+		cobra.CheckErr(err)
+
+		files, err := exporter.Run(cmd.Context())
+		cobra.CheckErr(err)
+
+		log.Info().Int("files", len(files)).Str("out", out).Msg("Exported site")
+	},
+}
+
+func init() {
+	ExportCmd.Flags().String("config", "parka.yaml", "Config file to export")
+	ExportCmd.Flags().String("out", "site", "Directory to write the exported files to")
+	ExportCmd.Flags().String("base-url", export.DefaultBaseURL, "URL the site is published at, used in the sitemap and the feed")
+	ExportCmd.Flags().StringSlice("download-formats", []string{"csv", "json"}, "Formats of the command downloads to export")
+	ExportCmd.Flags().Bool("keep-going", false, "Export the other pages and succeed when pages fail to render")
+}
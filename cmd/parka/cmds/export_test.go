@@ -0,0 +1,48 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCmdCommandDirectory(t *testing.T) {
+	repositoryDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(repositoryDir, "greetings"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repositoryDir, "greetings", "hello.yaml"), []byte(`
+name: hello
+short: Says hello
+flags:
+  - name: who
+    type: string
+    default: world
+template: "Hello {{ .who }}"
+`), 0o644))
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "parka.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+routes:
+  - path: /commands
+    commandDirectory:
+      repositories: [`+repositoryDir+`]
+      includeDefaultRepositories: false
+`), 0o644))
+
+	out := filepath.Join(dir, "site")
+	// template commands are not glazed commands, so their datatables page can't be rendered and is skipped
+	ExportCmd.SetArgs([]string{"--config", configFile, "--out", out, "--keep-going"})
+	require.NoError(t, ExportCmd.ExecuteContext(context.Background()))
+
+	index, err := os.ReadFile(filepath.Join(out, "commands", "index.html"))
+	require.NoError(t, err)
+	assert.Contains(t, string(index), "hello")
+
+	text, err := os.ReadFile(filepath.Join(out, "commands", "text", "greetings", "hello.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(text), "Hello world")
+}
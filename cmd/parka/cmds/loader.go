@@ -0,0 +1,45 @@
+package cmds
+
+import (
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/alias"
+	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
+)
+
+// TemplateCommandLoader loads the glazed template commands (and command aliases) of YAML files.
+// It is the loader parka uses for the commandDirectory and command routes of a config file,
+// applications like sqleton provide their own.
+type TemplateCommandLoader struct{}
+
+var _ loaders.CommandLoader = (*TemplateCommandLoader)(nil)
+
+func (l *TemplateCommandLoader) LoadCommands(
+	f fs.FS, entryName string,
+	options []cmds.CommandDescriptionOption,
+	aliasOptions []alias.Option,
+) ([]cmds.Command, error) {
+	s, err := f.Open(entryName)
+	if err != nil {
+		return nil, err
+	}
+	defer func(s fs.File) {
+		_ = s.Close()
+	}(s)
+
+	return loaders.LoadCommandOrAliasFromReader(
+		s,
+		func(r io.Reader, options []cmds.CommandDescriptionOption, _ []alias.Option) ([]cmds.Command, error) {
+			return (&cmds.TemplateCommandLoader{}).LoadCommandFromYAML(r, options...)
+		},
+		options,
+		aliasOptions,
+	)
+}
+
+func (l *TemplateCommandLoader) IsFileSupported(f fs.FS, fileName string) bool {
+	return strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml")
+}
@@ -10,7 +10,9 @@ import (
 	output_file "github.com/go-go-golems/parka/pkg/glazed/handlers/output-file"
 	"github.com/go-go-golems/parka/pkg/render"
 	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/go-go-golems/parka/pkg/server/livereload"
 	"github.com/go-go-golems/parka/pkg/utils/fs"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"io"
@@ -19,6 +21,13 @@ import (
 	"os/signal"
 )
 
+// The assets and templates embedded by pkg/server, which dev mode serves from disk
+// when parka is run from the root of the repository.
+const (
+	devAssetsDir   = "pkg/server/web/dist"
+	devTemplateDir = "pkg/server/web/src/templates"
+)
+
 var ServeCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Starts the server",
@@ -34,6 +43,7 @@ var ServeCmd = &cobra.Command{
 			server.WithAddress(host),
 		}
 		defaultLookups := []render.TemplateLookup{}
+		var watchedLookup *render.LookupTemplateFromWatchedDirectory
 
 		dev, _ := cmd.Flags().GetBool("dev")
 		templateDir, err := cmd.Flags().GetString("template-dir")
@@ -41,20 +51,25 @@ var ServeCmd = &cobra.Command{
 
 		if dev {
 			log.Info().
-				Str("assetsDir", "pkg/web/dist").
-				Str("templateDir", "pkg/web/src/templates").
+				Str("assetsDir", devAssetsDir).
+				Str("templateDir", devTemplateDir).
 				Msg("Using assets from disk")
 			serverOptions = append(serverOptions,
-				server.WithStaticPaths(fs.NewStaticPath(os.DirFS("pkg/web/dist"), "/dist")),
+				server.WithStaticPaths(fs.NewStaticPath(os.DirFS(devAssetsDir), "/dist")),
 			)
-			defaultLookups = append(defaultLookups, render.NewLookupTemplateFromDirectory("pkg/web/src/templates"))
+			defaultLookups = append(defaultLookups, render.NewLookupTemplateFromDirectory(devTemplateDir))
 		} else {
 			serverOptions = append(serverOptions, server.WithDefaultParkaStaticPaths())
 		}
 
 		if templateDir != "" {
 			if dev {
-				defaultLookups = append(defaultLookups, render.NewLookupTemplateFromDirectory(templateDir))
+				watchedLookup, err = render.NewLookupTemplateFromWatchedDirectory(
+					templateDir,
+					render.WithWatchedPatterns("**/*.tmpl"),
+				)
+				cobra.CheckErr(err)
+				defaultLookups = append(defaultLookups, watchedLookup)
 			} else {
 				lookup := render.NewLookupTemplateFromFS(
 					render.WithFS(os.DirFS(templateDir)),
@@ -64,15 +79,27 @@ var ServeCmd = &cobra.Command{
 			}
 		}
 
+		var liveReload *livereload.LiveReload
+		if dev {
+			liveReload = livereload.NewLiveReload(livereload.WithPaths(devAssetsDir, devTemplateDir))
+			liveReload.AddPaths(templateDir)
+		}
+
 		serverOptions = append(serverOptions,
-			server.WithDefaultParkaRenderer(render.WithPrependTemplateLookups(defaultLookups...)),
+			server.WithDefaultParkaRenderer(
+				render.WithPrependTemplateLookups(defaultLookups...),
+				render.WithLiveReload(dev),
+				render.WithDevMode(dev),
+			),
 		)
 		s, _ := server.NewServer(serverOptions...)
 
 		// NOTE(manuel, 2023-05-26) This could also be done with a simple Command config file struct once
 		// implemented as part of sqleton serve
 		s.Group.GET("/api/example", json2.CreateJSONQueryHandler(NewExampleCommand()))
-		s.Group.GET("/example", datatables.CreateDataTablesHandler(NewExampleCommand(), "", "example"))
+		s.Group.GET("/example", datatables.CreateDataTablesHandler(NewExampleCommand(), "", "example",
+			datatables.WithLiveReload(dev),
+		))
 		s.Group.GET("/download/example.csv", output_file.CreateGlazedFileHandler(NewExampleCommand(), "example.csv"))
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -80,6 +107,26 @@ var ServeCmd = &cobra.Command{
 		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
 		defer stop()
 
+		if liveReload != nil {
+			liveReload.Register(s.Group)
+			go func() {
+				err := liveReload.Watch(ctx)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					log.Error().Err(err).Msg("Failed to watch files for live reload")
+				}
+			}()
+		}
+
+		if watchedLookup != nil {
+			s.Group.GET(render.DevTemplateErrorsPath, render.NewTemplateErrorsHandler(watchedLookup))
+			go func() {
+				err := watchedLookup.Watch(ctx)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					log.Error().Err(err).Msg("Failed to watch template directory")
+				}
+			}()
+		}
+
 		err = s.Run(ctx)
 
 		cobra.CheckErr(err)
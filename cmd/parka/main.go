@@ -15,6 +15,7 @@ func init() {
 
 	rootCmd.AddCommand(cmds.ServeCmd)
 	rootCmd.AddCommand(cmds.LsServerCmd)
+	rootCmd.AddCommand(cmds.ExportCmd)
 }
 
 func main() {
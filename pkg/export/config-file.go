@@ -0,0 +1,142 @@
+package export
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-go-golems/parka/pkg/handlers"
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// NewConfigFileExporter serves the routes of the config file handler on a new server, and returns an
+// exporter for its pages.
+//
+// The export starts from `/` and the pages of each route:
+//   - command routes are exported with their default parameters and the parameter combinations
+//     declared in the `export` section of the config file, together with their CSV and JSON downloads
+//   - command directory routes are exported from their index page
+//   - template directory routes are exported with all their pages, their sitemap and their feed
+//   - static directory routes are exported with all their files
+//
+// Routes with path parameters and proxy routes are not exported.
+func NewConfigFileExporter(
+	cfh *handlers.ConfigFileHandler,
+	outputDirectory string,
+	options ...ExporterOption,
+) (*Exporter, error) {
+	cfg := cfh.Config
+
+	serverOptions := []server.ServerOption{}
+	if *cfg.Defaults.Renderer.UseDefaultParkaRenderer {
+		serverOptions = append(serverOptions, server.WithDefaultParkaRenderer())
+	}
+	s, err := server.NewServer(serverOptions...)
+	if err != nil {
+		return nil, err
+	}
+	err = cfh.Serve(s)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []string{"/"}
+	downloadPrefixes := []string{}
+	skipPrefixes := []string{}
+
+	if *cfg.Defaults.UseParkaStaticFiles {
+		// some of the files are loaded by scripts, and are not linked from the pages
+		files, err := walkFiles(server.GetParkaStaticFS(), "web/dist")
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			urls = append(urls, "/dist/"+f)
+		}
+	}
+
+	for _, route := range cfg.Routes {
+		p := strings.TrimSuffix(route.Path, "/")
+		if strings.ContainsAny(route.Path, ":*") {
+			log.Warn().Str("path", route.Path).Msg("Skipping route with path parameters")
+			continue
+		}
+
+		switch {
+		case route.Command != nil:
+			urls = append(urls, route.Path)
+			downloadPrefixes = append(downloadPrefixes, p+"/download/")
+		case route.CommandDirectory != nil:
+			urls = append(urls, p+"/")
+			downloadPrefixes = append(downloadPrefixes, p+"/download/")
+		case route.Static != nil:
+			files, err := walkFiles(os.DirFS(route.Static.LocalPath), ".")
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to list the files of %s", route.Static.LocalPath)
+			}
+			for _, f := range files {
+				urls = append(urls, p+"/"+f)
+			}
+		case route.Proxy != nil:
+			log.Warn().Str("path", route.Path).Msg("Skipping proxy route")
+			skipPrefixes = append(skipPrefixes, route.Path)
+		case route.TemplateDirectory != nil:
+			// the pages are added from the handlers below
+		case route.Dashboard != nil,
+			route.Template != nil,
+			route.StaticFile != nil,
+			route.Redirect != nil:
+			urls = append(urls, route.Path)
+		}
+	}
+
+	for _, tdh := range cfh.TemplateDirectoryHandlers() {
+		if tdh.PageTree == nil {
+			continue
+		}
+		urls = append(urls, tdh.PageTree.URLs()...)
+		basePath := strings.TrimSuffix(tdh.PageTree.BasePath, "/")
+		urls = append(urls, basePath+"/"+render.SitemapName, basePath+"/"+render.FeedName)
+	}
+
+	if cfg.Export != nil {
+		for _, c := range cfg.Export.Commands {
+			urls = append(urls, c.URLs()...)
+		}
+	}
+
+	options_ := []ExporterOption{
+		WithURLs(urls...),
+		WithDownloadPrefixes(downloadPrefixes...),
+		WithSkipPrefixes(skipPrefixes...),
+	}
+	options_ = append(options_, options...)
+
+	return NewExporter(s.Handler(), outputDirectory, options_...)
+}
+
+// walkFiles returns the paths of the files under dir in fs_, relative to dir.
+func walkFiles(fs_ fs.FS, dir string) ([]string, error) {
+	ret := []string{}
+	err := fs.WalkDir(fs_, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if dir != "." {
+			p = strings.TrimPrefix(p, dir+"/")
+		}
+		ret = append(ret, path.Clean(p))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
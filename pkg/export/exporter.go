@@ -0,0 +1,375 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultBaseURL is the URL the pages are requested from, if none is given with WithBaseURL.
+const DefaultBaseURL = "http://localhost"
+
+// Exporter renders the pages of a server to static files, so that they can be read without the server.
+//
+// Starting from the URLs given with WithURLs, it requests the pages from the handler of the server,
+// writes them to the output directory and follows the links (`href` and `src` attributes) of the
+// HTML pages to the other pages of the server. Once all the pages are exported, the links of the
+// HTML pages to exported pages are rewritten to relative paths, so that the export works from any
+// directory or object store. See filePath for how URLs are mapped to files.
+//
+// Redirects are exported as HTML pages redirecting to their target. Pages that fail to render
+// are skipped, and links to them are kept as they are. Run exports the other pages, and then fails
+// with the list of the pages that failed, unless WithKeepGoing is set.
+type Exporter struct {
+	handler         http.Handler
+	outputDirectory string
+	baseURL         *url.URL
+
+	urls []string
+	// downloadPrefixes are the paths of the download endpoints, whose links are only
+	// followed for the downloadFormats.
+	downloadPrefixes []string
+	downloadFormats  []string
+	// skipPrefixes are the paths whose links are not followed, for example proxies.
+	skipPrefixes []string
+	// keepGoing makes Run succeed when pages fail to render, see WithKeepGoing.
+	keepGoing bool
+
+	// files are the exported files, by URL key
+	files map[string]string
+	// fileURLs are the URL keys of the exported files, to detect conflicts
+	fileURLs map[string]string
+	pages    []*exportedPage
+	// written are the written files, relative to the output directory
+	written []string
+	// failed are the pages that failed to render, with the reason
+	failed []string
+}
+
+// exportedPage is an HTML page or a redirect, written once all the pages are known.
+type exportedPage struct {
+	url  *url.URL
+	file string
+	body []byte
+	// location is the target of a redirect
+	location string
+}
+
+type ExporterOption func(e *Exporter) error
+
+// WithBaseURL sets the scheme and host the pages are requested with, which is used for example
+// in the absolute URLs of sitemaps and feeds.
+func WithBaseURL(baseURL string) ExporterOption {
+	return func(e *Exporter) error {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return errors.Wrapf(err, "invalid base URL %s", baseURL)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("base URL %s must have a scheme and a host", baseURL)
+		}
+		e.baseURL = u
+		return nil
+	}
+}
+
+// WithURLs adds URLs to export, for example `/` or `/reports/sales?region=north`.
+func WithURLs(urls ...string) ExporterOption {
+	return func(e *Exporter) error {
+		e.urls = append(e.urls, urls...)
+		return nil
+	}
+}
+
+// WithDownloadPrefixes sets the paths of the download endpoints. Links to downloads are only followed
+// for the formats given with WithDownloadFormats.
+func WithDownloadPrefixes(prefixes ...string) ExporterOption {
+	return func(e *Exporter) error {
+		e.downloadPrefixes = append(e.downloadPrefixes, prefixes...)
+		return nil
+	}
+}
+
+// WithDownloadFormats sets the extensions of the downloads that are exported, `csv` and `json` by default.
+func WithDownloadFormats(formats ...string) ExporterOption {
+	return func(e *Exporter) error {
+		e.downloadFormats = []string{}
+		for _, f := range formats {
+			e.downloadFormats = append(e.downloadFormats, "."+strings.TrimPrefix(f, "."))
+		}
+		return nil
+	}
+}
+
+// WithSkipPrefixes sets paths whose links are not followed.
+func WithSkipPrefixes(prefixes ...string) ExporterOption {
+	return func(e *Exporter) error {
+		e.skipPrefixes = append(e.skipPrefixes, prefixes...)
+		return nil
+	}
+}
+
+// WithKeepGoing makes Run succeed when pages fail to render. The failed pages are only reported in the logs.
+func WithKeepGoing(keepGoing bool) ExporterOption {
+	return func(e *Exporter) error {
+		e.keepGoing = keepGoing
+		return nil
+	}
+}
+
+func NewExporter(handler http.Handler, outputDirectory string, options ...ExporterOption) (*Exporter, error) {
+	e := &Exporter{
+		handler:         handler,
+		outputDirectory: outputDirectory,
+		downloadFormats: []string{".csv", ".json"},
+		files:           map[string]string{},
+		fileURLs:        map[string]string{},
+	}
+	err := WithBaseURL(DefaultBaseURL)(e)
+	if err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		err := option(e)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Run exports the pages, and returns the paths of the written files, relative to the output directory.
+// If pages failed to render, the written files are returned together with an error listing the failed
+// pages, unless WithKeepGoing is set.
+func (e *Exporter) Run(ctx context.Context) ([]string, error) {
+	queue := []*url.URL{}
+	queued := map[string]bool{}
+	enqueue := func(u *url.URL) {
+		key := urlKey(u)
+		if queued[key] {
+			return
+		}
+		queued[key] = true
+		queue = append(queue, u)
+	}
+
+	for _, u := range e.urls {
+		u_, err := url.Parse(u)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid URL %s", u)
+		}
+		enqueue(e.baseURL.ResolveReference(u_))
+	}
+
+	for len(queue) > 0 {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		u := queue[0]
+		queue = queue[1:]
+
+		links, err := e.exportURL(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if e.follow(link) {
+				enqueue(link)
+			}
+		}
+	}
+
+	// the links can only be rewritten once all the pages are known
+	for _, p := range e.pages {
+		var body []byte
+		if p.location != "" {
+			body = e.redirectPage(p)
+		} else {
+			var err error
+			body, err = rewriteLinks(p.body, func(link string) string {
+				return e.rewriteLink(p, link)
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to rewrite the links of %s", p.url)
+			}
+		}
+		err := e.writeFile(p.file, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info().Int("files", len(e.written)).Str("directory", e.outputDirectory).Msg("Exported pages")
+
+	if len(e.failed) > 0 && !e.keepGoing {
+		return e.written, errors.Errorf("failed to export %d pages: %s", len(e.failed), strings.Join(e.failed, ", "))
+	}
+
+	return e.written, nil
+}
+
+// exportURL requests u, writes it unless it is an HTML page or a redirect, and returns its links.
+func (e *Exporter) exportURL(ctx context.Context, u *url.URL) ([]*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = e.baseURL.Host
+	if e.baseURL.Scheme == "https" {
+		req.Header.Set("X-Forwarded-Proto", "https")
+	}
+	resp := httptest.NewRecorder()
+	e.handler.ServeHTTP(resp, req)
+
+	contentType := resp.Header().Get("Content-Type")
+	if contentType == "" {
+		// net/http sniffs the content type of responses without one, which the recorder doesn't do
+		// when the handler writes the header first
+		contentType = http.DetectContentType(resp.Body.Bytes())
+	}
+	switch {
+	case resp.Code >= 300 && resp.Code < 400 && resp.Header().Get("Location") != "":
+		location, err := u.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			log.Warn().Err(err).Str("url", u.String()).Msg("Skipping redirect with invalid location")
+			e.failed = append(e.failed, fmt.Sprintf("%s (invalid redirect location)", u.RequestURI()))
+			return nil, nil
+		}
+		file := e.addFile(u, "text/html")
+		e.pages = append(e.pages, &exportedPage{url: u, file: file, location: location.String()})
+		if l, ok := e.resolve(u, location.String()); ok {
+			return []*url.URL{l}, nil
+		}
+		return nil, nil
+
+	case resp.Code != http.StatusOK:
+		log.Warn().Str("url", u.String()).Int("status", resp.Code).Msg("Skipping page that could not be rendered")
+		e.failed = append(e.failed, fmt.Sprintf("%s (status %d)", u.RequestURI(), resp.Code))
+		return nil, nil
+	}
+
+	file := e.addFile(u, contentType)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" {
+		return nil, e.writeFile(file, resp.Body.Bytes())
+	}
+
+	p := &exportedPage{url: u, file: file, body: resp.Body.Bytes()}
+	e.pages = append(e.pages, p)
+
+	links := []*url.URL{}
+	_, err = rewriteLinks(p.body, func(link string) string {
+		if l, ok := e.resolve(u, link); ok {
+			links = append(links, l)
+		}
+		return link
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the links of %s", u)
+	}
+
+	return links, nil
+}
+
+// addFile returns the file u is exported to, making it unique if another URL already uses it.
+func (e *Exporter) addFile(u *url.URL, contentType string) string {
+	key := urlKey(u)
+	file := filePath(u, contentType)
+	if k, ok := e.fileURLs[file]; ok && k != key {
+		ext := path.Ext(path.Base(file))
+		file = strings.TrimSuffix(file, ext) + "--" + shortHash(key) + ext
+	}
+	e.files[key] = file
+	e.fileURLs[file] = key
+	return file
+}
+
+// resolve resolves link relative to the page at u, and returns it if it is a page of the server.
+func (e *Exporter) resolve(u *url.URL, link string) (*url.URL, bool) {
+	if link == "" || strings.HasPrefix(link, "#") {
+		return nil, false
+	}
+	l, err := u.Parse(link)
+	if err != nil {
+		return nil, false
+	}
+	if (l.Scheme != "http" && l.Scheme != "https") || l.Host != e.baseURL.Host {
+		return nil, false
+	}
+	return l, true
+}
+
+// follow returns true if the link is exported.
+func (e *Exporter) follow(u *url.URL) bool {
+	for _, prefix := range e.skipPrefixes {
+		if strings.HasPrefix(u.Path, prefix) {
+			return false
+		}
+	}
+	for _, prefix := range e.downloadPrefixes {
+		if strings.HasPrefix(u.Path, prefix) {
+			ext := path.Ext(u.Path)
+			for _, f := range e.downloadFormats {
+				if ext == f {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// rewriteLink returns the path of the exported file of link relative to page p,
+// or link itself if it was not exported.
+func (e *Exporter) rewriteLink(p *exportedPage, link string) string {
+	l, ok := e.resolve(p.url, link)
+	if !ok {
+		return link
+	}
+	file, ok := e.files[urlKey(l)]
+	if !ok {
+		return link
+	}
+	ret := relativePath(p.file, file)
+	if l.Fragment != "" {
+		ret += "#" + l.EscapedFragment()
+	}
+	return ret
+}
+
+// redirectPage renders an HTML page redirecting to the target of the redirect p.
+func (e *Exporter) redirectPage(p *exportedPage) []byte {
+	target := html.EscapeString(e.rewriteLink(p, p.location))
+	return []byte(fmt.Sprintf(
+		"<!DOCTYPE html>\n<html>\n<head>\n<meta http-equiv=\"refresh\" content=\"0; url=%s\">\n</head>\n"+
+			"<body>\n<a href=\"%s\">%s</a>\n</body>\n</html>\n",
+		target, target, target))
+}
+
+func (e *Exporter) writeFile(file string, body []byte) error {
+	p := filepath.Join(e.outputDirectory, filepath.FromSlash(file))
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("file", file).Msg("Exporting file")
+	err = os.WriteFile(p, body, 0644)
+	if err != nil {
+		return err
+	}
+	e.written = append(e.written, file)
+	return nil
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/parka/pkg/handlers"
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, dir string, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	require.NoError(t, err, name)
+	return string(data)
+}
+
+func TestConfigFileExporter(t *testing.T) {
+	siteDir := t.TempDir()
+	require.NoError(t, os.CopyFS(siteDir, fstest.MapFS{
+		"index.tmpl.md":  {Data: []byte("---\ntitle: Home\n---\n# Home\n\n[Intro](/docs/intro) and [the logo](/assets/logo.txt#top)\n")},
+		"intro.tmpl.md":  {Data: []byte("---\ntitle: Intro\n---\n# Intro\n\n[Home](/docs/) [Reports](/reports/) [External](https://github.com/)\n")},
+		"hidden.tmpl.md": {Data: []byte("---\ntitle: Hidden\nhidden: true\n---\n# Hidden\n")},
+	}))
+	assetsDir := t.TempDir()
+	require.NoError(t, os.CopyFS(assetsDir, fstest.MapFS{
+		"logo.txt":     {Data: []byte("logo")},
+		"css/site.css": {Data: []byte("body {}")},
+	}))
+
+	repositoryDir := t.TempDir()
+
+	cfg, err := config.ParseConfig([]byte(`
+routes:
+  - path: /docs
+    templateDirectory:
+      localDirectory: ` + siteDir + `
+  - path: /assets
+    static:
+      localPath: ` + assetsDir + `
+  - path: /reports
+    commandDirectory:
+      repositories: [` + repositoryDir + `]
+      includeDefaultRepositories: false
+  - path: /old
+    redirect:
+      target: /docs/intro
+  - path: /api/:region
+    commandDirectory:
+      repositories: [` + repositoryDir + `]
+      includeDefaultRepositories: false
+export:
+  commands:
+    - path: /reports/datatables/sales/orders
+      parameters:
+        - region: north
+        - region: south
+`))
+	require.NoError(t, err)
+
+	orders, err := utils.NewTestGlazedCommand(
+		cmds.WithName("orders"),
+		cmds.WithParents("sales"),
+		cmds.WithFlags(fields.New("region", fields.TypeString, fields.WithDefault("all"))),
+	)
+	require.NoError(t, err)
+	cfh := handlers.NewConfigFileHandler(cfg,
+		handlers.WithRepositoryFactory(func(dirs []string) (*repositories.Repository, error) {
+			r := repositories.NewRepository()
+			r.Add(orders)
+			return r, nil
+		}),
+	)
+
+	out := t.TempDir()
+	exporter, err := NewConfigFileExporter(cfh, out, WithBaseURL("https://example.com"))
+	require.NoError(t, err)
+	files, err := exporter.Run(context.Background())
+	require.NoError(t, err)
+
+	for _, f := range []string{
+		"index.html",
+		"dist/output.css",
+		"dist/mermaid.js",
+		"dist/mermaid.min.js",
+		"docs/index.html",
+		"docs/intro.html",
+		"docs/hidden.html",
+		"docs/sitemap.xml",
+		"docs/rss.xml",
+		"assets/logo.txt",
+		"assets/css/site.css",
+		"reports/index.html",
+		"reports/datatables/sales/orders.html",
+		"reports/datatables/sales/orders--region-north.html",
+		"reports/datatables/sales/orders--region-south.html",
+		"old.html",
+	} {
+		assert.Contains(t, files, f)
+		assert.FileExists(t, filepath.Join(out, filepath.FromSlash(f)))
+	}
+
+	// the links between the exported pages are relative
+	index := readFile(t, out, "docs/index.html")
+	assert.Contains(t, index, `href="intro.html"`)
+	assert.Contains(t, index, `href="../assets/logo.txt#top"`)
+	assert.Contains(t, index, `href="../dist/output.css"`)
+	intro := readFile(t, out, "docs/intro.html")
+	assert.Contains(t, intro, `href="index.html"`)
+	assert.Contains(t, intro, `href="../reports/index.html"`)
+	assert.Contains(t, intro, `href="https://github.com/"`)
+
+	// the absolute URLs of the sitemap use the base URL
+	assert.Contains(t, readFile(t, out, "docs/sitemap.xml"), "<loc>https://example.com/docs/intro</loc>")
+
+	// the redirects are exported as pages redirecting to their target
+	assert.Contains(t, readFile(t, out, "old.html"), `url=docs/intro.html`)
+
+	// the commands are exported with their parameters, together with their downloads
+	north := readFile(t, out, "reports/datatables/sales/orders--region-north.html")
+	assert.Contains(t, north, "north")
+	downloads := 0
+	for _, f := range files {
+		if filepath.Dir(f) == "reports/download/sales/orders" {
+			downloads++
+			assert.Contains(t, []string{".csv", ".json"}, filepath.Ext(f))
+			assert.Contains(t, north+readFile(t, out, "reports/datatables/sales/orders.html")+
+				readFile(t, out, "reports/datatables/sales/orders--region-south.html"),
+				`href="../../download/sales/orders/`+filepath.Base(f)+`"`)
+		}
+	}
+	// csv and json for each of the three pages
+	assert.Equal(t, 6, downloads)
+}
+
+func TestExporterFailedPages(t *testing.T) {
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.HTML(http.StatusOK, `<a href="/ok">ok</a> <a href="/broken">broken</a>`)
+	})
+	e.GET("/ok", func(c echo.Context) error {
+		return c.HTML(http.StatusOK, `ok`)
+	})
+	e.GET("/broken", func(c echo.Context) error {
+		return errors.New("broken")
+	})
+
+	tests := []struct {
+		name      string
+		keepGoing bool
+		err       string
+	}{
+		{name: "fail", keepGoing: false, err: "failed to export 1 pages: /broken (status 500)"},
+		{name: "keep going", keepGoing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			exporter, err := NewExporter(e, out, WithURLs("/"), WithKeepGoing(tt.keepGoing))
+			require.NoError(t, err)
+			files, err := exporter.Run(context.Background())
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// the other pages are exported either way
+			assert.ElementsMatch(t, []string{"index.html", "ok.html"}, files)
+			assert.Contains(t, readFile(t, out, "index.html"), `href="/broken"`)
+		})
+	}
+}
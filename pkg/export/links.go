@@ -0,0 +1,157 @@
+package export
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxQuerySlugLength is the length above which the query part of file names is shortened with a hash.
+const maxQuerySlugLength = 64
+
+// urlKey identifies a URL of the server, its query parameters being sorted.
+func urlKey(u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") && p != "/" {
+		p += "/"
+	}
+	if u.RawQuery == "" {
+		return p
+	}
+	return p + "?" + u.Query().Encode()
+}
+
+// extensionsByContentType are the extensions given to the files of URLs without extension.
+var extensionsByContentType = map[string]string{
+	"text/html":        ".html",
+	"application/json": ".json",
+	"application/xml":  ".xml",
+	"text/xml":         ".xml",
+	"text/csv":         ".csv",
+	"text/plain":       ".txt",
+}
+
+// filePath returns the path of the file a URL is exported to, relative to the output directory:
+//   - directories (URLs ending with `/`) are exported to their `index.html`
+//   - URLs without extension get the extension of their content type, `/about` becoming `about.html`
+//   - the query parameters are added to the file name, `/sales?region=north` becoming `sales--region-north.html`
+func filePath(u *url.URL, contentType string) string {
+	p := strings.TrimPrefix(urlKey(&url.URL{Path: u.Path}), "/")
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index.html"
+	} else if path.Ext(path.Base(p)) == "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		p += extensionsByContentType[mediaType]
+	}
+
+	if u.RawQuery == "" {
+		return p
+	}
+	ext := path.Ext(path.Base(p))
+	return strings.TrimSuffix(p, ext) + "--" + querySlug(u.Query()) + ext
+}
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// querySlug turns the query parameters into a part of a file name.
+func querySlug(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, k+"-"+v)
+		}
+	}
+	slug := unsafeFileNameCharacters.ReplaceAllString(strings.Join(parts, "--"), "_")
+	if len(slug) > maxQuerySlugLength {
+		slug = slug[:maxQuerySlugLength-9] + "-" + shortHash(query.Encode())
+	}
+	return slug
+}
+
+func shortHash(s string) string {
+	h := sha1.Sum([]byte(s))
+	return hex.EncodeToString(h[:4])
+}
+
+// relativePath returns the path of the file to, relative to the directory of the file from.
+func relativePath(from string, to string) string {
+	fromParts := strings.Split(path.Dir(from), "/")
+	if path.Dir(from) == "." {
+		fromParts = []string{}
+	}
+	toParts := strings.Split(to, "/")
+
+	common := 0
+	for common < len(fromParts) && common < len(toParts)-1 && fromParts[common] == toParts[common] {
+		common++
+	}
+
+	parts := []string{}
+	for i := common; i < len(fromParts); i++ {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, toParts[common:]...)
+	return strings.Join(parts, "/")
+}
+
+// linkAttributes are the attributes of the links followed and rewritten by the exporter.
+var linkAttributes = map[string]bool{
+	"href": true,
+	"src":  true,
+}
+
+// rewriteLinks calls rewrite with the href and src attributes of the HTML document, and replaces
+// them with its result. The rest of the document is kept as is.
+func rewriteLinks(body []byte, rewrite func(link string) string) ([]byte, error) {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	buf := &bytes.Buffer{}
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return buf.Bytes(), nil
+			}
+			return nil, z.Err()
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// the tokenizer lowercases the tag in place
+			raw := append([]byte{}, z.Raw()...)
+			t := z.Token()
+			changed := false
+			for i, a := range t.Attr {
+				if a.Namespace != "" || !linkAttributes[a.Key] {
+					continue
+				}
+				link := rewrite(a.Val)
+				if link != a.Val {
+					t.Attr[i].Val = link
+					changed = true
+				}
+			}
+			if changed {
+				buf.WriteString(t.String())
+			} else {
+				buf.Write(raw)
+			}
+
+		default:
+			buf.Write(z.Raw())
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package export
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePath(t *testing.T) {
+	tests := []struct {
+		url         string
+		contentType string
+		expected    string
+	}{
+		{url: "/", contentType: "text/html", expected: "index.html"},
+		{url: "/docs/", contentType: "text/html", expected: "docs/index.html"},
+		{url: "/about", contentType: "text/html; charset=UTF-8", expected: "about.html"},
+		{url: "/dist/output.css", contentType: "text/css", expected: "dist/output.css"},
+		{url: "/sitemap.xml", contentType: "application/xml", expected: "sitemap.xml"},
+		{url: "/api/data", contentType: "application/json", expected: "api/data.json"},
+		{url: "/unknown", contentType: "", expected: "unknown"},
+		{url: "/a/../b/./c", contentType: "text/html", expected: "b/c.html"},
+		{
+			url:         "/reports/sales?status=open&region=north",
+			contentType: "text/html",
+			expected:    "reports/sales--region-north--status-open.html",
+		},
+		{
+			url:         "/download/sales.csv?region=north%2Fwest",
+			contentType: "text/csv",
+			expected:    "download/sales--region-north_west.csv",
+		},
+		{url: "/docs/?page=2", contentType: "text/html", expected: "docs/index--page-2.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filePath(u, tt.contentType))
+		})
+	}
+}
+
+func TestFilePathLongQuery(t *testing.T) {
+	u := &url.URL{Path: "/sales", RawQuery: "region=" + strings.Repeat("north", 20)}
+	p := filePath(u, "text/html")
+	assert.True(t, strings.HasPrefix(p, "sales--region-north"))
+	assert.Len(t, strings.TrimSuffix(strings.TrimPrefix(p, "sales--"), ".html"), maxQuerySlugLength)
+
+	u2 := &url.URL{Path: "/sales", RawQuery: "region=" + strings.Repeat("north", 21)}
+	assert.NotEqual(t, p, filePath(u2, "text/html"))
+}
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		from     string
+		to       string
+		expected string
+	}{
+		{from: "index.html", to: "about.html", expected: "about.html"},
+		{from: "index.html", to: "docs/index.html", expected: "docs/index.html"},
+		{from: "docs/index.html", to: "index.html", expected: "../index.html"},
+		{from: "docs/index.html", to: "docs/intro.html", expected: "intro.html"},
+		{from: "docs/a/b.html", to: "docs/c.html", expected: "../c.html"},
+		{from: "docs/a/b.html", to: "dist/output.css", expected: "../../dist/output.css"},
+		{from: "docs/index.html", to: "docs/index.html", expected: "index.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" "+tt.to, func(t *testing.T) {
+			assert.Equal(t, tt.expected, relativePath(tt.from, tt.to))
+		})
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "unchanged document",
+			body:     `<!DOCTYPE html><HTML><Body class="x"><p>Hello &amp; <b>bye</b></p><!-- comment --></Body></HTML>`,
+			expected: `<!DOCTYPE html><HTML><Body class="x"><p>Hello &amp; <b>bye</b></p><!-- comment --></Body></HTML>`,
+		},
+		{
+			name:     "links and sources",
+			body:     `<a class="nav" href="/about">About</a><img src="/logo.png" alt="logo"/>`,
+			expected: `<a class="nav" href="rewritten:/about">About</a><img src="rewritten:/logo.png" alt="logo"/>`,
+		},
+		{
+			name:     "scripts are kept as is",
+			body:     `<script src="/app.js">if (a < b && c) { location.href = "/x" }</script>`,
+			expected: `<script src="rewritten:/app.js">if (a < b && c) { location.href = "/x" }</script>`,
+		},
+		{
+			name:     "unrewritten links",
+			body:     `<a href="https://example.com">Example</a>`,
+			expected: `<a href="https://example.com">Example</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := rewriteLinks([]byte(tt.body), func(link string) string {
+				if strings.HasPrefix(link, "/") {
+					return "rewritten:" + link
+				}
+				return link
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(body))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package datatables
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ChartsKey is the key under which charts are declared, in the additional data of the route
+// and in the metadata of the command.
+const ChartsKey = "charts"
+
+// Columns is a list of column names, which can be given as a single string in YAML.
+type Columns []string
+
+func (c *Columns) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = Columns{value.Value}
+		return nil
+	}
+	var columns []string
+	err := value.Decode(&columns)
+	if err != nil {
+		return err
+	}
+	*c = columns
+	return nil
+}
+
+// Chart describes a chart rendered from the rows of the command, by /dist/charts.js.
+//
+// Line, bar and scatter charts plot the Y columns against the X column. If Series is set,
+// rows are grouped into one series per value of that column, and only the first Y column is plotted.
+// Pie charts sum the first Y column for each value of the X column.
+type Chart struct {
+	Title  string  `yaml:"title,omitempty" json:"title,omitempty"`
+	Type   string  `yaml:"type" json:"type"`
+	X      string  `yaml:"x" json:"x"`
+	Y      Columns `yaml:"y" json:"y"`
+	Series string  `yaml:"series,omitempty" json:"series,omitempty"`
+	// Height is the height of the chart in pixels.
+	Height int `yaml:"height,omitempty" json:"height,omitempty"`
+}
+
+func (c *Chart) Validate() error {
+	switch c.Type {
+	case "line", "bar", "scatter", "pie":
+	default:
+		return errors.Errorf("unknown chart type %s, expected line, bar, scatter or pie", c.Type)
+	}
+	if c.X == "" {
+		return errors.Errorf("%s chart %s needs an x column", c.Type, c.Title)
+	}
+	if len(c.Y) == 0 {
+		return errors.Errorf("%s chart %s needs a y column", c.Type, c.Title)
+	}
+	if c.Height < 0 {
+		return errors.Errorf("invalid height %d for chart %s", c.Height, c.Title)
+	}
+	return nil
+}
+
+// ParseCharts converts the chart declarations found in additional data or command metadata.
+// A nil value yields no charts.
+func ParseCharts(v interface{}) ([]*Chart, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	ret := []*Chart{}
+	err = yaml.Unmarshal(b, &ret)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid charts")
+	}
+	for _, chart := range ret {
+		err = chart.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// computeCharts returns the charts declared in the command metadata, followed by those
+// declared in the additional data of the route.
+func computeCharts(dt_ *DataTables) ([]*Chart, error) {
+	ret := []*Chart{}
+	for _, m := range []map[string]interface{}{dt_.CommandMetadata, dt_.AdditionalData} {
+		charts, err := ParseCharts(m[ChartsKey])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, charts...)
+	}
+	return ret, nil
+}
@@ -0,0 +1,63 @@
+package datatables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseCharts(t *testing.T) {
+	tests := []struct {
+		name          string
+		yaml          string
+		expected      []*Chart
+		expectedError bool
+	}{
+		{name: "no charts", yaml: "", expected: nil},
+		{
+			name: "single y column",
+			yaml: `
+- title: Orders per day
+  type: line
+  x: day
+  y: orders
+  series: region
+`,
+			expected: []*Chart{{Title: "Orders per day", Type: "line", X: "day", Y: Columns{"orders"}, Series: "region"}},
+		},
+		{
+			name: "multiple y columns",
+			yaml: `
+- type: bar
+  x: month
+  y: [revenue, cost]
+  height: 200
+`,
+			expected: []*Chart{{Type: "bar", X: "month", Y: Columns{"revenue", "cost"}, Height: 200}},
+		},
+		{name: "unknown type", yaml: "- {type: radar, x: a, y: b}", expectedError: true},
+		{name: "missing y", yaml: "- {type: pie, x: a}", expectedError: true},
+		{name: "not a list", yaml: "type: pie", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(tt.yaml), &v))
+
+			charts, err := ParseCharts(v)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expected == nil {
+				assert.Empty(t, charts)
+				return
+			}
+			assert.Equal(t, tt.expected, charts)
+		})
+	}
+}
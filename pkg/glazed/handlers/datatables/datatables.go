@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/go-go-golems/glazed/pkg/cmds"
-	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/formatters"
@@ -19,9 +18,12 @@ import (
 	"github.com/go-go-golems/glazed/pkg/middlewares/table"
 	"github.com/go-go-golems/glazed/pkg/types"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/paging"
 	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
 	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/render/columns"
 	"github.com/go-go-golems/parka/pkg/render/layout"
+	"github.com/go-go-golems/parka/pkg/server/livereload"
 	"github.com/kucherenkovova/safegroup"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
@@ -71,6 +73,29 @@ type DataTables struct {
 	// This is useful when the rows are "ragged" (i.e. not all rows have the same number of columns).
 	StreamRows      bool
 	CommandMetadata map[string]interface{}
+
+	// FragmentURL is the URL of the endpoint rendering only the results of the command.
+	// If set, form submissions fetch the results from it and swap them in place instead of
+	// reloading the page.
+	FragmentURL string
+	// AutoRefresh re-runs the command at the given interval, if not zero.
+	AutoRefresh time.Duration
+
+	// PageURL is the URL of the paging endpoint of the command, see paging.QueryHandler.
+	// If set, the table is virtualized: the command isn't run to render the page, the rows are loaded
+	// from PageURL in blocks of PageSize rows as the user scrolls, and sorting and filtering are done by the server.
+	PageURL  string
+	PageSize int
+
+	// Charts are rendered above the table from the rows of the command, see Chart.
+	Charts []*Chart
+	// DataURL is the URL of the JSON data endpoint of the command. Charts load their rows from it
+	// when the page doesn't contain all the rows, because of paging or HTML rendering.
+	DataURL string
+
+	// ColumnFormats are the presentation rules of the columns. They are applied to the HTML rows,
+	// and exported as JSON for the tables rendered in the browser.
+	ColumnFormats columns.Columns
 }
 
 func NewDataTables() *DataTables {
@@ -108,6 +133,19 @@ type QueryHandler struct {
 	lookup       render.TemplateLookup
 
 	whitelistedLayers []string
+	parka_middlewares.RequestParameters
+
+	// formLayout overrides the form layout defined by the command
+	formLayout *layout.FormLayout
+	// optionsURL is the URL of the endpoint serving the options of formLayout.OptionsSources
+	optionsURL string
+
+	// fragment renders only the fragmentTemplateName block of the template, which contains the results.
+	fragment             bool
+	fragmentTemplateName string
+
+	// liveReload appends the live reload script to the rendered pages
+	liveReload bool
 
 	dt *DataTables
 }
@@ -123,6 +161,8 @@ func NewQueryHandler(
 		dt:           NewDataTables(),
 		lookup:       NewDataTablesLookupTemplate(),
 		templateName: "data-tables.tmpl.html",
+		// defined in data-tables.tmpl.html
+		fragmentTemplateName: "data-tables-results",
 	}
 
 	for _, option := range options {
@@ -138,6 +178,89 @@ func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
 	}
 }
 
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters parka_middlewares.RequestParameters) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.RequestParameters = parameters
+	}
+}
+
+// WithFormLayout overrides the layout of the command form, see layout.FormLayout.
+func WithFormLayout(formLayout *layout.FormLayout) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.formLayout = formLayout
+	}
+}
+
+// WithOptionsURL sets the URL from which the options of the inputs with an options source are loaded.
+func WithOptionsURL(url string) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.optionsURL = url
+	}
+}
+
+// WithFragment renders only the results fragment of the template, see WithFragmentTemplateName.
+func WithFragment(fragment bool) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.fragment = fragment
+	}
+}
+
+// WithFragmentTemplateName sets the name of the template block rendering the results fragment.
+// The block is looked up in the template set by WithTemplateName.
+func WithFragmentTemplateName(name string) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		if name != "" {
+			qh.fragmentTemplateName = name
+		}
+	}
+}
+
+// WithLiveReload makes the rendered page reload itself when the files it is rendered from change.
+// The live reload endpoint needs to be served, see pkg/server/livereload.
+func WithLiveReload(liveReload bool) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.liveReload = liveReload
+	}
+}
+
+// WithLiveUpdates makes the page fetch the results from fragmentURL when the form changes,
+// instead of navigating to a new page. If autoRefresh is not zero, the results are refreshed
+// at that interval.
+func WithLiveUpdates(fragmentURL string, autoRefresh time.Duration) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.dt.FragmentURL = fragmentURL
+		qh.dt.AutoRefresh = autoRefresh
+	}
+}
+
+// WithPaging renders a virtualized table that loads its rows from pageURL in chunks of pageSize rows.
+// No rows are rendered into the page. If pageSize is not positive, paging.DefaultPageSize is used.
+func WithPaging(pageURL string, pageSize int) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		if pageSize <= 0 {
+			pageSize = paging.DefaultPageSize
+		}
+		qh.dt.PageURL = pageURL
+		qh.dt.PageSize = pageSize
+	}
+}
+
+// WithDataURL sets the URL of the JSON data endpoint of the command, see DataTables.DataURL.
+func WithDataURL(dataURL string) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.dt.DataURL = dataURL
+	}
+}
+
+// WithColumnFormats sets the presentation rules of the columns, which need to be resolved, see columns.Columns.Resolve.
+func WithColumnFormats(columnFormats columns.Columns) QueryHandlerOption {
+	return func(qh *QueryHandler) {
+		qh.dt.ColumnFormats = columnFormats
+	}
+}
+
 func WithDataTables(dt *DataTables) QueryHandlerOption {
 	return func(qh *QueryHandler) {
 		qh.dt = dt
@@ -199,16 +322,10 @@ func (qh *QueryHandler) Handle(c echo.Context) error {
 	// since we have a context there, and there is no need to block the middleware processing.
 	columnsC := make(chan []types.FieldName, 10)
 
-	queryMiddleware := parka_middlewares.UpdateFromQueryParameters(c,
-		fields.WithSource("query"),
+	middlewares_ := qh.RequestParameters.Middlewares(c,
+		parka_middlewares.WithWhitelistedLayers(qh.whitelistedLayers...),
+		parka_middlewares.WithMiddlewares(qh.middlewares...),
 	)
-	if len(qh.whitelistedLayers) > 0 {
-		queryMiddleware = sources.WrapWithWhitelistedSections(qh.whitelistedLayers, queryMiddleware)
-	}
-
-	middlewares_ := []sources.Middleware{queryMiddleware}
-	middlewares_ = append(middlewares_, qh.middlewares...)
-	middlewares_ = append(middlewares_, sources.FromDefaults())
 	err := sources.Execute(description.Schema.Clone(), parsedValues, middlewares_...)
 	if err != nil {
 		log.Debug().Err(err).Msg("error executing middlewares")
@@ -249,7 +366,7 @@ func (qh *QueryHandler) Handle(c echo.Context) error {
 
 		g.Go(func() error {
 			log.Debug().Msg("Rendering template")
-			err := qh.renderTemplate(parsedValues, c.Response(), dt_, columnsC)
+			err := qh.renderTemplate(c, parsedValues, c.Response(), dt_, columnsC)
 			log.Debug().Msg("Template rendered")
 			if err != nil {
 				return err
@@ -268,12 +385,37 @@ func (qh *QueryHandler) Handle(c echo.Context) error {
 		}
 	}
 
+	dt_.Charts, err = computeCharts(dt_)
+	if err != nil {
+		return err
+	}
+
+	// The virtualized table loads its columns and rows from the paging endpoint, which runs the command
+	// and caches its result for the following blocks of rows. The page itself doesn't run the command.
+	if dt_.PageURL != "" {
+		dt_.JSRendering = true
+		dt_.JSStream = make(chan template.JS)
+		close(dt_.JSStream)
+		close(dt_.ErrorStream)
+		close(columnsC)
+
+		err = qh.renderTemplate(c, parsedValues, c.Response(), dt_, columnsC)
+		if err != nil && c.Response().Committed && c.Request().Context().Err() == nil {
+			return render.HandleRenderError(c, err, false, qh.lookup)
+		}
+		return err
+	}
+
 	var of formatters.RowOutputFormatter
 	if dt_.JSRendering {
 		of = json.NewOutputFormatter(json.WithOutputIndividualRows(true))
 		dt_.JSStream = make(chan template.JS, 100)
 	} else {
-		of = table_formatter.NewOutputFormatter("html")
+		if len(dt_.ColumnFormats) > 0 {
+			of = columns.NewHTMLRowFormatter(dt_.ColumnFormats)
+		} else {
+			of = table_formatter.NewOutputFormatter("html")
+		}
 		dt_.HTMLStream = make(chan template.HTML, 100)
 	}
 
@@ -371,7 +513,7 @@ func (qh *QueryHandler) Handle(c echo.Context) error {
 	eg.Go(func() error {
 		// if qh.Cmd implements cmds.CommandWithMetadata, get Metadata
 		log.Debug().Msg("rendering template")
-		err := qh.renderTemplate(parsedValues, c.Response(), dt_, columnsC)
+		err := qh.renderTemplate(c, parsedValues, c.Response(), dt_, columnsC)
 		log.Debug().Msg("rendered template")
 		if err != nil {
 			return err
@@ -382,6 +524,10 @@ func (qh *QueryHandler) Handle(c echo.Context) error {
 
 	err = eg.Wait()
 	if err != nil {
+		// once the page has started streaming, the error can only be shown inside the page
+		if c.Response().Committed && c.Request().Context().Err() == nil {
+			return render.HandleRenderError(c, err, false, qh.lookup)
+		}
 		return err
 	}
 
@@ -389,6 +535,7 @@ func (qh *QueryHandler) Handle(c echo.Context) error {
 }
 
 func (qh *QueryHandler) renderTemplate(
+	c echo.Context,
 	parsedValues *values.Values,
 	w io.Writer,
 	dt_ *DataTables,
@@ -407,7 +554,10 @@ func (qh *QueryHandler) renderTemplate(
 		return err
 	}
 
-	layout_, err := layout.ComputeLayout(qh.cmd, parsedValues)
+	layout_, err := layout.ComputeLayout(qh.cmd, parsedValues,
+		layout.WithFormLayout(qh.formLayout),
+		layout.WithOptionsURL(qh.optionsURL),
+	)
 	if err != nil {
 		return err
 	}
@@ -430,14 +580,37 @@ func (qh *QueryHandler) renderTemplate(
 
 	// start copying from rowC to HTML or JS stream
 
-	err = t.Execute(w, dt_)
+	if qh.fragment {
+		err = t.ExecuteTemplate(w, qh.fragmentTemplateName, dt_)
+	} else {
+		err = t.Execute(w, dt_)
+	}
 	if err != nil {
 		return err
 	}
 
+	// fragments are swapped into a page which already has the script
+	if qh.liveReload && !qh.fragment {
+		_, err = io.WriteString(w, livereload.Script(c))
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// CreateDataTablesFragmentHandler renders only the results of the command, which are used to update
+// the datatables page in place, see WithLiveUpdates.
+func CreateDataTablesFragmentHandler(
+	cmd cmds.GlazeCommand,
+	basePath string,
+	downloadPath string,
+	options ...QueryHandlerOption,
+) echo.HandlerFunc {
+	return CreateDataTablesHandler(cmd, basePath, downloadPath, append(options, WithFragment(true))...)
+}
+
 func CreateDataTablesHandler(
 	cmd cmds.GlazeCommand,
 	basePath string,
@@ -447,34 +620,39 @@ func CreateDataTablesHandler(
 	return func(c echo.Context) error {
 		name := cmd.Description().Name
 		dateTime := time.Now().Format("2006-01-02--15-04-05")
+		// the downloads use the parameters of the page, also without javascript
+		query := ""
+		if c.QueryString() != "" {
+			query = "?" + c.QueryString()
+		}
 		links := []layout.Link{
 			{
-				Href:  fmt.Sprintf("%s/%s-%s.csv", downloadPath, dateTime, name),
+				Href:  fmt.Sprintf("%s/%s-%s.csv%s", downloadPath, dateTime, name, query),
 				Text:  "Download CSV",
 				Class: "download",
 			},
 			{
-				Href:  fmt.Sprintf("%s/%s-%s.json", downloadPath, dateTime, name),
+				Href:  fmt.Sprintf("%s/%s-%s.json%s", downloadPath, dateTime, name, query),
 				Text:  "Download JSON",
 				Class: "download",
 			},
 			{
-				Href:  fmt.Sprintf("%s/%s-%s.xlsx", downloadPath, dateTime, name),
+				Href:  fmt.Sprintf("%s/%s-%s.xlsx%s", downloadPath, dateTime, name, query),
 				Text:  "Download Excel",
 				Class: "download",
 			},
 			{
-				Href:  fmt.Sprintf("%s/%s-%s.md", downloadPath, dateTime, name),
+				Href:  fmt.Sprintf("%s/%s-%s.md%s", downloadPath, dateTime, name, query),
 				Text:  "Download Markdown",
 				Class: "download",
 			},
 			{
-				Href:  fmt.Sprintf("%s/%s-%s.html", downloadPath, dateTime, name),
+				Href:  fmt.Sprintf("%s/%s-%s.html%s", downloadPath, dateTime, name, query),
 				Text:  "Download HTML",
 				Class: "download",
 			},
 			{
-				Href:  fmt.Sprintf("%s/%s-%s.txt", downloadPath, dateTime, name),
+				Href:  fmt.Sprintf("%s/%s-%s.txt%s", downloadPath, dateTime, name, query),
 				Text:  "Download Text",
 				Class: "download",
 			},
@@ -0,0 +1,155 @@
+package datatables
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/server/livereload"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataTablesFragmentHandler(t *testing.T) {
+	cmd, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/test", CreateDataTablesHandler(cmd, "", "/download",
+		WithLiveUpdates("/fragment", 30*time.Second)))
+	e.GET("/fragment", CreateDataTablesFragmentHandler(cmd, "", "/download",
+		WithLiveUpdates("/fragment", 30*time.Second)))
+
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	page := resp.Body.String()
+	assert.Contains(t, page, "<html")
+	assert.Contains(t, page, `id="results"`)
+	assert.Contains(t, page, `const fragmentURL = "/fragment"`)
+	assert.Regexp(t, `const autoRefresh = +30000`, page)
+
+	resp = httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/fragment", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	fragment := resp.Body.String()
+	assert.NotContains(t, fragment, "<html")
+	assert.Contains(t, fragment, `id="resultsRows"`)
+	assert.Contains(t, fragment, "test-2")
+}
+
+func TestDataTablesPaging(t *testing.T) {
+	cmd, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/test", CreateDataTablesHandler(cmd, "", "/download", WithPaging("/rows", 2)))
+
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	page := resp.Body.String()
+	assert.Contains(t, page, `const pageURL = "/rows"`)
+	assert.Regexp(t, `const pageSize = +2`, page)
+	// the rows are loaded from the paging endpoint, the command isn't run to render the page
+	assert.NotContains(t, page, "test-0")
+	assert.NotContains(t, page, "test-1")
+}
+
+func TestDataTablesCharts(t *testing.T) {
+	cmd, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/test", CreateDataTablesHandler(cmd, "", "/download",
+		WithDataURL("/data"),
+		WithAdditionalData(map[string]interface{}{
+			ChartsKey: []interface{}{
+				map[string]interface{}{"type": "bar", "x": "test2", "y": "test"},
+			},
+		})))
+	e.GET("/invalid", CreateDataTablesHandler(cmd, "", "/download",
+		WithAdditionalData(map[string]interface{}{
+			ChartsKey: []interface{}{map[string]interface{}{"type": "radar"}},
+		})))
+
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	page := resp.Body.String()
+	assert.Contains(t, page, `<script src="/dist/charts.js"></script>`)
+	assert.Contains(t, page, `id="resultsCharts">[{"type":"bar","x":"test2","y":["test"]}]`)
+	assert.Contains(t, page, `const dataURL = "/data"`)
+	assert.Regexp(t, `const rowsComplete = +true`, page)
+
+	resp = httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/invalid", nil))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+}
+
+func TestDataTablesLiveReload(t *testing.T) {
+	cmd, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/test", CreateDataTablesHandler(cmd, "", "/download", WithLiveReload(true)))
+	e.GET("/fragment", CreateDataTablesFragmentHandler(cmd, "", "/download", WithLiveReload(true)))
+	e.GET("/plain", CreateDataTablesHandler(cmd, "", "/download"))
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "/test", expected: true},
+		{path: "/fragment", expected: false},
+		{path: "/plain", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+			if tt.expected {
+				assert.Contains(t, resp.Body.String(), `new EventSource("`+livereload.Path+`")`)
+			} else {
+				assert.NotContains(t, resp.Body.String(), "EventSource")
+			}
+		})
+	}
+}
+
+func TestDataTablesStreamingError(t *testing.T) {
+	cmd, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+
+	lookup := render.NewLookupTemplateFromFS(
+		render.WithFS(fstest.MapFS{
+			"broken.tmpl.html": {Data: []byte(
+				`<script>{{ range .JSStream }}{{ . }}{{ end }}</script>{{ index .Columns 99 }}`,
+			)},
+		}),
+		render.WithPatterns("*.tmpl.html"),
+	)
+
+	e := echo.New()
+	e.GET("/test", CreateDataTablesHandler(cmd, "", "/download",
+		WithTemplateLookup(lookup),
+		WithTemplateName("broken.tmpl.html")))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(echo.HeaderXRequestID, "test-id")
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, req)
+
+	// the rows have already been sent when the template fails
+	require.Equal(t, http.StatusOK, resp.Code)
+	page := resp.Body.String()
+	assert.Contains(t, page, "test-2")
+	assert.Contains(t, page, `<div class="alert alert-danger parka-render-error" role="alert">`)
+	assert.Contains(t, page, "request ID: test-id")
+}
@@ -0,0 +1,181 @@
+package form
+
+import (
+	"net/http"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/options"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/go-go-golems/parka/pkg/render/layout"
+	"github.com/labstack/echo/v4"
+)
+
+// Form is the JSON representation of a command form, as computed for the datatables page.
+type Form struct {
+	Name   string         `json:"name"`
+	Short  string         `json:"short,omitempty"`
+	Long   string         `json:"long,omitempty"`
+	Layout *layout.Layout `json:"layout"`
+	// Columns are the presentation rules of the result columns, see columns.Column.
+	Columns columns.Columns `json:"columns,omitempty"`
+}
+
+// QueryHandler serves the computed layout of a command form as JSON, so that other frontends
+// can render the same forms as the datatables handler. The parameters are parsed from the request
+// the same way as for the other handlers, and the current values are returned as part of the inputs.
+type QueryHandler struct {
+	cmd         cmds.Command
+	middlewares []sources.Middleware
+
+	whitelistedLayers []string
+	parka_middlewares.RequestParameters
+
+	formLayout *layout.FormLayout
+	optionsURL string
+	// optionsProvider and optionsLookup are used to resolve the options of inputs with an options source
+	optionsProvider *options.Provider
+	optionsLookup   options.CommandLookup
+
+	columnFormats columns.Columns
+}
+
+type QueryHandlerOption func(*QueryHandler)
+
+func NewQueryHandler(cmd cmds.Command, options ...QueryHandlerOption) *QueryHandler {
+	h := &QueryHandler{
+		cmd: cmd,
+	}
+
+	for _, option := range options {
+		option(h)
+	}
+
+	return h
+}
+
+func WithMiddlewares(middlewares ...sources.Middleware) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.middlewares = middlewares
+	}
+}
+
+func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.whitelistedLayers = layers
+	}
+}
+
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters parka_middlewares.RequestParameters) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.RequestParameters = parameters
+	}
+}
+
+// WithFormLayout overrides the layout of the command form, see layout.FormLayout.
+func WithFormLayout(formLayout *layout.FormLayout) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.formLayout = formLayout
+	}
+}
+
+// WithOptionsURL sets the URL from which the options of the inputs with an options source can be searched.
+func WithOptionsURL(url string) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.optionsURL = url
+	}
+}
+
+// WithOptionsProvider resolves the initial options of the inputs with an options source,
+// looking up the options commands with lookup.
+func WithOptionsProvider(provider *options.Provider, lookup options.CommandLookup) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.optionsProvider = provider
+		h.optionsLookup = lookup
+	}
+}
+
+// WithColumnFormats exports the presentation rules of the result columns, see columns.Columns.Resolve.
+func WithColumnFormats(columnFormats columns.Columns) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.columnFormats = columnFormats
+	}
+}
+
+var _ handlers.Handler = (*QueryHandler)(nil)
+
+func (h *QueryHandler) Handle(c echo.Context) error {
+	description := h.cmd.Description()
+	parsedValues := values.New()
+
+	middlewares_ := h.RequestParameters.Middlewares(c,
+		parka_middlewares.WithWhitelistedLayers(h.whitelistedLayers...),
+		parka_middlewares.WithMiddlewares(h.middlewares...),
+	)
+
+	err := sources.Execute(description.Schema.Clone(), parsedValues, middlewares_...)
+	if err != nil {
+		return err
+	}
+
+	layout_, err := layout.ComputeLayout(h.cmd, parsedValues,
+		layout.WithFormLayout(h.formLayout),
+		layout.WithOptionsURL(h.optionsURL),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = h.resolveOptions(c, layout_)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &Form{
+		Name:    description.Name,
+		Short:   description.Short,
+		Long:    description.Long,
+		Layout:  layout_,
+		Columns: h.columnFormats,
+	})
+}
+
+// resolveOptions fills in the options of the inputs with an options source.
+func (h *QueryHandler) resolveOptions(c echo.Context, layout_ *layout.Layout) error {
+	if h.optionsProvider == nil || h.optionsLookup == nil {
+		return nil
+	}
+
+	for _, section := range layout_.Sections {
+		for _, row := range section.Rows {
+			for i := range row.Inputs {
+				input := &row.Inputs[i]
+				_, source, ok := h.formLayout.GetOptionsSource(input.Section, input.Field)
+				if !ok {
+					continue
+				}
+				cmd, err := h.optionsLookup(source.Command)
+				if err != nil {
+					return err
+				}
+				options_, err := h.optionsProvider.GetOptions(c.Request().Context(), cmd, source, "")
+				if err != nil {
+					return err
+				}
+				input.Options = options_
+			}
+		}
+	}
+
+	return nil
+}
+
+func CreateFormHandler(cmd cmds.Command, options ...QueryHandlerOption) echo.HandlerFunc {
+	handler := NewQueryHandler(cmd, options...)
+	return handler.Handle
+}
@@ -0,0 +1,77 @@
+package form
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/options"
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/go-go-golems/parka/pkg/render/layout"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormHandler(t *testing.T) {
+	cmd, err := utils.NewTestGlazedCommand(cmds.WithFlags(
+		fields.New("customer", fields.TypeString, fields.WithHelp("Customer")),
+		fields.New("limit", fields.TypeInteger, fields.WithDefault(10), fields.WithRequired(true)),
+	))
+	require.NoError(t, err)
+	optionsCmd, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+
+	formLayout := &layout.FormLayout{
+		OptionsSources: map[string]*layout.OptionsSource{
+			"customer": {Command: "customers", ValueColumn: "test2"},
+		},
+	}
+
+	e := echo.New()
+	e.GET("/layout", CreateFormHandler(cmd,
+		WithFormLayout(formLayout),
+		WithOptionsURL("/options"),
+		WithOptionsProvider(options.NewProvider(), func(path string) (cmds.Command, error) {
+			return optionsCmd, nil
+		}),
+		WithColumnFormats(columns.Columns{
+			"test": {Link: &columns.Link{Command: "orders", URL: "/datatables/orders"}},
+		}),
+	))
+
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/layout?limit=5", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	form := &Form{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), form))
+	assert.Equal(t, "test-glazed-command", form.Name)
+	require.Len(t, form.Layout.Sections, 1)
+	inputs := form.Layout.Sections[0].Rows[0].Inputs
+	require.Len(t, inputs, 2)
+
+	assert.Equal(t, "customer", inputs[0].Name)
+	assert.Equal(t, "default", inputs[0].Section)
+	assert.Equal(t, "Customer", inputs[0].Label)
+	assert.Equal(t, "string", inputs[0].Type)
+	assert.Equal(t, "/options?source=customer", inputs[0].OptionsURL)
+	assert.Len(t, inputs[0].Options, 3)
+	assert.Equal(t, "test-0", inputs[0].Options[0].Label)
+
+	assert.Equal(t, "limit", inputs[1].Field)
+	assert.True(t, inputs[1].Required)
+	assert.Equal(t, float64(5), inputs[1].Value)
+	assert.Equal(t, float64(10), inputs[1].Default)
+
+	require.Contains(t, form.Columns, "test")
+	assert.Equal(t, "/datatables/orders", form.Columns["test"].Link.URL)
+
+	resp = httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/layout?limit=foo", nil))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+}
@@ -4,7 +4,6 @@ import (
 	"net/http"
 
 	"github.com/go-go-golems/glazed/pkg/cmds"
-	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/settings"
@@ -18,6 +17,7 @@ type QueryHandler struct {
 	cmd               cmds.GlazeCommand
 	middlewares       []sources.Middleware
 	whitelistedLayers []string
+	middlewares2.RequestParameters
 }
 
 type QueryHandlerOption func(*QueryHandler)
@@ -34,6 +34,14 @@ func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
 	}
 }
 
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters middlewares2.RequestParameters) QueryHandlerOption {
+	return func(handler *QueryHandler) {
+		handler.RequestParameters = parameters
+	}
+}
+
 func NewQueryHandler(cmd cmds.GlazeCommand, options ...QueryHandlerOption) *QueryHandler {
 	h := &QueryHandler{
 		cmd: cmd,
@@ -52,18 +60,10 @@ func (h *QueryHandler) Handle(c echo.Context) error {
 	description := h.cmd.Description()
 	parsedValues := values.New()
 
-	queryMiddleware := middlewares2.UpdateFromQueryParameters(c, fields.WithSource("query"))
-	if len(h.whitelistedLayers) > 0 {
-		queryMiddleware = sources.WrapWithWhitelistedSections(h.whitelistedLayers, queryMiddleware)
-	}
-
-	middlewares_ := append(
-		[]sources.Middleware{
-			queryMiddleware,
-		},
-		h.middlewares...,
+	middlewares_ := h.RequestParameters.Middlewares(c,
+		middlewares2.WithWhitelistedLayers(h.whitelistedLayers...),
+		middlewares2.WithMiddlewares(h.middlewares...),
 	)
-	middlewares_ = append(middlewares_, sources.FromDefaults())
 
 	err := sources.Execute(description.Schema.Clone(), parsedValues, middlewares_...)
 	if err != nil {
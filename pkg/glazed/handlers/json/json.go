@@ -25,6 +25,7 @@ type QueryHandler struct {
 	parseOptions []fields.ParseOption
 	// whitelistedLayers contains the list of layers that are allowed to be modified through query parameters
 	whitelistedLayers []string
+	parka_middlewares.RequestParameters
 }
 
 type QueryHandlerOption func(*QueryHandler)
@@ -69,6 +70,14 @@ func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
 	}
 }
 
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters parka_middlewares.RequestParameters) QueryHandlerOption {
+	return func(handler *QueryHandler) {
+		handler.RequestParameters = parameters
+	}
+}
+
 var _ handlers.Handler = (*QueryHandler)(nil)
 
 func (h *QueryHandler) Handle(c echo.Context) error {
@@ -86,20 +95,15 @@ func (h *QueryHandler) Handle(c echo.Context) error {
 		}()
 	}
 
-	// Build the middleware chain
-	middlewares_ := make([]sources.Middleware, 0)
+	options := []parka_middlewares.RequestMiddlewaresOption{
+		parka_middlewares.WithWhitelistedLayers(h.whitelistedLayers...),
+		parka_middlewares.WithMiddlewares(h.middlewares...),
+		parka_middlewares.WithParseOptions(h.parseOptions...),
+	}
 	if h.useJSONBody {
-		middlewares_ = append(middlewares_, jsonMiddleware.Middleware())
-	} else {
-		queryMiddleware := parka_middlewares.UpdateFromQueryParameters(c, append(h.parseOptions, fields.WithSource("query"))...)
-		if len(h.whitelistedLayers) > 0 {
-			queryMiddleware = sources.WrapWithWhitelistedSections(h.whitelistedLayers, queryMiddleware)
-		}
-		middlewares_ = append(middlewares_, queryMiddleware)
+		options = append(options, parka_middlewares.WithBodyMiddleware(jsonMiddleware.Middleware()))
 	}
-
-	middlewares_ = append(middlewares_, h.middlewares...)
-	middlewares_ = append(middlewares_, sources.FromDefaults())
+	middlewares_ := h.RequestParameters.Middlewares(c, options...)
 
 	err := sources.Execute(description.Schema.Clone(), parsedValues, middlewares_...)
 	if err != nil {
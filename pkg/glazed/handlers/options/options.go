@@ -0,0 +1,294 @@
+package options
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers"
+	"github.com/go-go-golems/parka/pkg/render/layout"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultLimit         = 100
+	DefaultCacheDuration = time.Minute
+	// DefaultCacheSize is the maximum number of cached options, one per options source and search term.
+	DefaultCacheSize = 256
+)
+
+type cacheEntry struct {
+	options []layout.Option
+	expires time.Time
+}
+
+// Provider computes the options of a layout.OptionsSource by running its command,
+// and caches the resulting options.
+type Provider struct {
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+	size  int
+	now   func() time.Time
+}
+
+type ProviderOption func(*Provider)
+
+// WithCacheSize sets the maximum number of options kept in the cache.
+func WithCacheSize(size int) ProviderOption {
+	return func(p *Provider) {
+		p.size = size
+	}
+}
+
+// WithClock overrides the function used to get the current time when expiring cache entries.
+func WithClock(now func() time.Time) ProviderOption {
+	return func(p *Provider) {
+		p.now = now
+	}
+}
+
+func NewProvider(options ...ProviderOption) *Provider {
+	p := &Provider{
+		cache: map[string]cacheEntry{},
+		size:  DefaultCacheSize,
+		now:   time.Now,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// GetOptions returns the options of source matching search, running cmd if they are not cached.
+//
+// If the source has a SearchParameter, search is passed to the command, otherwise the command is
+// run without it and the options are filtered by label.
+func (p *Provider) GetOptions(
+	ctx context.Context,
+	cmd cmds.Command,
+	source *layout.OptionsSource,
+	search string,
+) ([]layout.Option, error) {
+	term := ""
+	if source.SearchParameter != "" {
+		term = search
+	}
+
+	key := fmt.Sprintf("%s|%v|%s|%s|%s|%s",
+		source.Command, source.Parameters, source.ValueColumn, source.LabelColumn, source.SearchParameter, term)
+	options, ok := p.getCached(key)
+	if !ok {
+		var err error
+		options, err = runOptionsCommand(ctx, cmd, source, term)
+		if err != nil {
+			return nil, err
+		}
+		p.setCached(key, options, source.CacheDuration)
+	}
+
+	ret := []layout.Option{}
+	limit := source.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	search = strings.ToLower(search)
+	for _, option := range options {
+		if len(ret) >= limit {
+			break
+		}
+		if source.SearchParameter == "" && search != "" && !strings.Contains(strings.ToLower(option.Label), search) {
+			continue
+		}
+		ret = append(ret, option)
+	}
+
+	return ret, nil
+}
+
+func (p *Provider) getCached(key string) ([]layout.Option, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if p.now().After(entry.expires) {
+		delete(p.cache, key)
+		return nil, false
+	}
+	return entry.options, true
+}
+
+func (p *Provider) setCached(key string, options []layout.Option, duration time.Duration) {
+	if duration < 0 || p.size <= 0 {
+		return
+	}
+	if duration == 0 {
+		duration = DefaultCacheDuration
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// drop expired entries, so that the cache doesn't grow with the search terms seen over time
+	now := p.now()
+	for k, entry := range p.cache {
+		if now.After(entry.expires) {
+			delete(p.cache, k)
+		}
+	}
+	for len(p.cache) >= p.size {
+		oldestKey := ""
+		var oldest time.Time
+		for k, entry := range p.cache {
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = k, entry.expires
+			}
+		}
+		delete(p.cache, oldestKey)
+	}
+
+	p.cache[key] = cacheEntry{
+		options: options,
+		expires: now.Add(duration),
+	}
+}
+
+// runOptionsCommand runs cmd with the parameters of the source, and converts the resulting rows to options.
+func runOptionsCommand(
+	ctx context.Context,
+	cmd cmds.Command,
+	source *layout.OptionsSource,
+	term string,
+) ([]layout.Option, error) {
+	glazeCommand, ok := cmd.(cmds.GlazeCommand)
+	if !ok {
+		return nil, &handlers.UnsupportedCommandError{Command: cmd}
+	}
+
+	parameters := map[string]interface{}{}
+	for k, v := range source.Parameters {
+		parameters[k] = v
+	}
+	if source.SearchParameter != "" && term != "" {
+		parameters[source.SearchParameter] = term
+	}
+
+	parsedValues := values.New()
+	err := sources.Execute(cmd.Description().Schema.Clone(), parsedValues,
+		sources.FromMap(
+			map[string]map[string]interface{}{schema.DefaultSlug: parameters},
+			fields.WithSource("options-source"),
+		),
+		sources.FromDefaults(),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse parameters of options command %s", source.Command)
+	}
+
+	// the null table middleware keeps the rows in the processor's table
+	gp := middlewares.NewTableProcessor(middlewares.WithTableMiddleware(&table.NullTableMiddleware{}))
+	err = glazeCommand.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not run options command %s", source.Command)
+	}
+	err = gp.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	labelColumn := source.LabelColumn
+	if labelColumn == "" {
+		labelColumn = source.ValueColumn
+	}
+
+	ret := []layout.Option{}
+	for _, row := range gp.GetTable().Rows {
+		value, ok := row.Get(source.ValueColumn)
+		if !ok {
+			continue
+		}
+		label, ok := row.Get(labelColumn)
+		if !ok {
+			label = value
+		}
+		ret = append(ret, layout.Option{
+			Label: fmt.Sprintf("%v", label),
+			Value: value,
+		})
+	}
+
+	return ret, nil
+}
+
+// CommandLookup resolves the command of an options source by its path.
+type CommandLookup func(path string) (cmds.Command, error)
+
+// QueryHandler serves the options of the options sources of a form layout as JSON.
+// The source is selected by the `source` query parameter, and the `q` query parameter
+// contains the text typed by the user.
+type QueryHandler struct {
+	formLayout *layout.FormLayout
+	lookup     CommandLookup
+	provider   *Provider
+}
+
+type QueryHandlerOption func(*QueryHandler)
+
+// WithProvider shares a Provider, and thus its cache, across handlers.
+func WithProvider(provider *Provider) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.provider = provider
+	}
+}
+
+func NewQueryHandler(formLayout *layout.FormLayout, lookup CommandLookup, options ...QueryHandlerOption) *QueryHandler {
+	h := &QueryHandler{
+		formLayout: formLayout,
+		lookup:     lookup,
+	}
+	for _, option := range options {
+		option(h)
+	}
+	if h.provider == nil {
+		h.provider = NewProvider()
+	}
+	return h
+}
+
+var _ handlers.Handler = (*QueryHandler)(nil)
+
+func (h *QueryHandler) Handle(c echo.Context) error {
+	key := c.QueryParam("source")
+	var source *layout.OptionsSource
+	if h.formLayout != nil {
+		source = h.formLayout.OptionsSources[key]
+	}
+	if source == nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("unknown options source %s", key))
+	}
+
+	cmd, err := h.lookup(source.Command)
+	if err != nil {
+		return err
+	}
+
+	options, err := h.provider.GetOptions(c.Request().Context(), cmd, source, c.QueryParam("q"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, options)
+}
@@ -0,0 +1,143 @@
+package options
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/parka/pkg/render/layout"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCommand counts how often the options command is run, to test caching.
+type countingCommand struct {
+	*utils.TestGlazedCommand
+	runs int
+}
+
+func (c *countingCommand) RunIntoGlazeProcessor(ctx context.Context, parsedValues *values.Values, gp middlewares.Processor) error {
+	c.runs++
+	return c.TestGlazedCommand.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+}
+
+func newCountingCommand(t *testing.T) *countingCommand {
+	cmd, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+	return &countingCommand{TestGlazedCommand: cmd}
+}
+
+func TestProviderGetOptions(t *testing.T) {
+	cmd := newCountingCommand(t)
+	source := &layout.OptionsSource{
+		Command:     "test",
+		ValueColumn: "test",
+		LabelColumn: "test2",
+	}
+
+	now := time.Now()
+	p := NewProvider(WithClock(func() time.Time { return now }))
+
+	options, err := p.GetOptions(context.Background(), cmd, source, "")
+	require.NoError(t, err)
+	assert.Equal(t, []layout.Option{
+		{Label: "test-0", Value: 0},
+		{Label: "test-1", Value: 1},
+		{Label: "test-2", Value: 2},
+	}, options)
+
+	// without a search parameter, options are filtered by label from the cache
+	options, err = p.GetOptions(context.Background(), cmd, source, "TEST-1")
+	require.NoError(t, err)
+	assert.Equal(t, []layout.Option{{Label: "test-1", Value: 1}}, options)
+	assert.Equal(t, 1, cmd.runs)
+
+	now = now.Add(2 * DefaultCacheDuration)
+	_, err = p.GetOptions(context.Background(), cmd, source, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, cmd.runs)
+
+	// sources running the same command with other columns don't share cached options
+	labelSource := &layout.OptionsSource{Command: "test", ValueColumn: "test2"}
+	options, err = p.GetOptions(context.Background(), cmd, labelSource, "")
+	require.NoError(t, err)
+	assert.Equal(t, layout.Option{Label: "test-0", Value: "test-0"}, options[0])
+	assert.Equal(t, 3, cmd.runs)
+
+	source.Limit = 2
+	source.CacheDuration = -1
+	p = NewProvider()
+	options, err = p.GetOptions(context.Background(), cmd, source, "")
+	require.NoError(t, err)
+	assert.Len(t, options, 2)
+	_, err = p.GetOptions(context.Background(), cmd, source, "")
+	require.NoError(t, err)
+	assert.Equal(t, 5, cmd.runs)
+}
+
+func TestProviderCacheSize(t *testing.T) {
+	cmd := newCountingCommand(t)
+	now := time.Now()
+	p := NewProvider(WithCacheSize(2), WithClock(func() time.Time { return now }))
+
+	getOptions := func(command string) {
+		_, err := p.GetOptions(context.Background(), cmd,
+			&layout.OptionsSource{Command: command, ValueColumn: "test"}, "")
+		require.NoError(t, err)
+	}
+
+	getOptions("a")
+	now = now.Add(time.Second)
+	getOptions("b")
+	now = now.Add(time.Second)
+	getOptions("c")
+	// the oldest entry is evicted
+	assert.Len(t, p.cache, 2)
+	assert.NotContains(t, p.cache, "a|map[]|test|||")
+	getOptions("b")
+	assert.Equal(t, 3, cmd.runs)
+
+	// expired entries are dropped when adding a new one
+	now = now.Add(2 * DefaultCacheDuration)
+	getOptions("d")
+	assert.Len(t, p.cache, 1)
+	assert.Equal(t, 4, cmd.runs)
+}
+
+func TestQueryHandler(t *testing.T) {
+	cmd := newCountingCommand(t)
+	formLayout := &layout.FormLayout{
+		OptionsSources: map[string]*layout.OptionsSource{
+			"customer": {Command: "customers/active", ValueColumn: "test2"},
+		},
+	}
+	lookedUp := ""
+	handler := NewQueryHandler(formLayout, func(path string) (cmds.Command, error) {
+		lookedUp = path
+		return cmd, nil
+	})
+
+	e := echo.New()
+	e.GET("/options", handler.Handle)
+
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/options?source=customer&q=2", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "customers/active", lookedUp)
+
+	var options []map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &options))
+	assert.Equal(t, []map[string]interface{}{{"label": "test-2", "value": "test-2"}}, options)
+
+	resp = httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/options?source=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -25,6 +25,7 @@ type QueryHandler struct {
 	middlewares []sources.Middleware
 	// whitelistedLayers contains the list of layers that are allowed to be modified through query parameters
 	whitelistedLayers []string
+	parka_middlewares.RequestParameters
 }
 
 type QueryHandlerOption func(*QueryHandler)
@@ -54,12 +55,15 @@ func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
 	}
 }
 
-func (h *QueryHandler) Handle(c echo.Context) error {
-	queryMiddleware := parka_middlewares.UpdateFromQueryParameters(c, fields.WithSource("query"))
-	if len(h.whitelistedLayers) > 0 {
-		queryMiddleware = sources.WrapWithWhitelistedSections(h.whitelistedLayers, queryMiddleware)
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters parka_middlewares.RequestParameters) QueryHandlerOption {
+	return func(handler *QueryHandler) {
+		handler.RequestParameters = parameters
 	}
+}
 
+func (h *QueryHandler) Handle(c echo.Context) error {
 	glazedOverrides := map[string]interface{}{}
 	needsRealFileOutput := false
 
@@ -100,17 +104,10 @@ func (h *QueryHandler) Handle(c echo.Context) error {
 		fields.WithSource("output-file-glazed-override"),
 	)
 
-	middlewares_ := append(
-		[]sources.Middleware{
-			queryMiddleware,
-			glazedOverride,
-		},
-		h.middlewares...,
-	)
-	middlewares_ = append(middlewares_, sources.FromDefaults())
-
 	handler := glazed.NewQueryHandler(h.cmd,
-		glazed.WithMiddlewares(middlewares_...),
+		glazed.WithRequestParameters(h.RequestParameters),
+		glazed.WithWhitelistedLayers(h.whitelistedLayers...),
+		glazed.WithMiddlewares(append([]sources.Middleware{glazedOverride}, h.middlewares...)...),
 	)
 
 	baseName := filepath.Base(h.fileName)
@@ -134,6 +131,8 @@ func (h *QueryHandler) Handle(c echo.Context) error {
 		res := httptest.NewRecorder()
 		req := c.Request()
 		newCtx := c.Echo().NewContext(req, res)
+		newCtx.SetParamNames(c.ParamNames()...)
+		newCtx.SetParamValues(c.ParamValues()...)
 
 		err = handler.Handle(newCtx)
 		if err != nil {
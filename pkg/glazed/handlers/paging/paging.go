@@ -0,0 +1,630 @@
+package paging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultPageSize = 500
+	// DefaultMaxPageSize is the largest number of rows a client can request at once.
+	DefaultMaxPageSize   = 5000
+	DefaultCacheDuration = time.Minute
+	DefaultCacheSize     = 16
+	// DefaultCacheRows is the total number of rows kept in a ResultCache.
+	DefaultCacheRows = 200000
+
+	// The query parameters used for paging. They are prefixed with an underscore so that they
+	// don't collide with the parameters of the command.
+	StartQueryParameter  = "_start"
+	EndQueryParameter    = "_end"
+	SortQueryParameter   = "_sort"
+	FilterQueryParameter = "_filter"
+)
+
+// SortColumn sorts the rows by a column, in the format of the ag-grid sort model.
+type SortColumn struct {
+	Column string `json:"colId"`
+	// Sort is either `asc` or `desc`.
+	Sort string `json:"sort"`
+}
+
+// Filter filters the rows by the value of a column, in the format of the ag-grid filter model.
+// Text filters support the types `contains`, `notContains`, `equals`, `notEqual`, `startsWith`,
+// `endsWith`, `blank` and `notBlank`, number filters additionally support `lessThan`, `lessThanOrEqual`,
+// `greaterThan`, `greaterThanOrEqual` and `inRange`.
+//
+// Filters with Conditions combine them with Operator, which is either `AND` or `OR`.
+type Filter struct {
+	FilterType string      `json:"filterType"`
+	Type       string      `json:"type,omitempty"`
+	Filter     interface{} `json:"filter,omitempty"`
+	FilterTo   interface{} `json:"filterTo,omitempty"`
+
+	Operator   string    `json:"operator,omitempty"`
+	Conditions []*Filter `json:"conditions,omitempty"`
+}
+
+// Request describes the page of rows requested by the client.
+type Request struct {
+	// Start and End are the indices of the first and after the last requested row.
+	Start  int
+	End    int
+	Sort   []SortColumn
+	Filter map[string]*Filter
+}
+
+// Page is the JSON response of the paging endpoint.
+type Page struct {
+	Columns []types.FieldName `json:"columns"`
+	Rows    []types.Row       `json:"rows"`
+	// LastRow is the total number of rows after filtering, which allows the client to size its scrollbar.
+	LastRow int `json:"lastRow"`
+}
+
+// ParseRequest parses the paging query parameters. The page defaults to the first DefaultPageSize rows,
+// and is clamped to maxPageSize rows.
+func ParseRequest(query url.Values, maxPageSize int) (*Request, error) {
+	if maxPageSize <= 0 {
+		maxPageSize = DefaultMaxPageSize
+	}
+	defaultPageSize := min(DefaultPageSize, maxPageSize)
+	ret := &Request{
+		Start: 0,
+		End:   defaultPageSize,
+	}
+
+	var err error
+	if v := query.Get(StartQueryParameter); v != "" {
+		ret.Start, err = strconv.Atoi(v)
+		if err != nil || ret.Start < 0 {
+			return nil, errors.Errorf("invalid %s: %s", StartQueryParameter, v)
+		}
+		ret.End = ret.Start + defaultPageSize
+	}
+	if v := query.Get(EndQueryParameter); v != "" {
+		ret.End, err = strconv.Atoi(v)
+		if err != nil || ret.End < ret.Start {
+			return nil, errors.Errorf("invalid %s: %s", EndQueryParameter, v)
+		}
+	}
+	ret.End = min(ret.End, ret.Start+maxPageSize)
+	if v := query.Get(SortQueryParameter); v != "" {
+		err = json.Unmarshal([]byte(v), &ret.Sort)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", SortQueryParameter)
+		}
+		for _, s := range ret.Sort {
+			if s.Sort != "asc" && s.Sort != "desc" {
+				return nil, errors.Errorf("invalid sort direction %s for column %s", s.Sort, s.Column)
+			}
+		}
+	}
+	if v := query.Get(FilterQueryParameter); v != "" {
+		err = json.Unmarshal([]byte(v), &ret.Filter)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", FilterQueryParameter)
+		}
+	}
+
+	return ret, nil
+}
+
+// Apply filters and sorts the rows of the table, and returns the requested page.
+func (r *Request) Apply(table_ *types.Table) (*Page, error) {
+	rows := make([]types.Row, 0, len(table_.Rows))
+	for _, row := range table_.Rows {
+		ok, err := r.matches(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+
+	if len(r.Sort) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, s := range r.Sort {
+				a, _ := rows[i].Get(s.Column)
+				b, _ := rows[j].Get(s.Column)
+				c := compareValues(a, b)
+				if c == 0 {
+					continue
+				}
+				if s.Sort == "desc" {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	start, end := r.Start, r.End
+	if start > len(rows) {
+		start = len(rows)
+	}
+	if end > len(rows) {
+		end = len(rows)
+	}
+
+	return &Page{
+		Columns: table_.Columns,
+		Rows:    rows[start:end],
+		LastRow: len(rows),
+	}, nil
+}
+
+func (r *Request) matches(row types.Row) (bool, error) {
+	for column, filter := range r.Filter {
+		value, _ := row.Get(column)
+		ok, err := filter.Matches(value)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid filter for column %s", column)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Matches returns true if value passes the filter.
+func (f *Filter) Matches(value interface{}) (bool, error) {
+	if len(f.Conditions) > 0 {
+		isOr := strings.EqualFold(f.Operator, "OR")
+		for _, condition := range f.Conditions {
+			ok, err := condition.Matches(value)
+			if err != nil {
+				return false, err
+			}
+			if isOr && ok {
+				return true, nil
+			}
+			if !isOr && !ok {
+				return false, nil
+			}
+		}
+		return !isOr, nil
+	}
+
+	switch f.Type {
+	case "blank":
+		return value == nil || fmt.Sprintf("%v", value) == "", nil
+	case "notBlank":
+		return value != nil && fmt.Sprintf("%v", value) != "", nil
+	}
+
+	switch f.FilterType {
+	case "", "text":
+		return f.matchesText(value)
+	case "number":
+		return f.matchesNumber(value)
+	default:
+		return false, errors.Errorf("unsupported filter type %s", f.FilterType)
+	}
+}
+
+func (f *Filter) matchesText(value interface{}) (bool, error) {
+	if value == nil {
+		return f.Type == "notContains" || f.Type == "notEqual", nil
+	}
+	s := strings.ToLower(fmt.Sprintf("%v", value))
+	filter := strings.ToLower(fmt.Sprintf("%v", f.Filter))
+
+	switch f.Type {
+	case "", "contains":
+		return strings.Contains(s, filter), nil
+	case "notContains":
+		return !strings.Contains(s, filter), nil
+	case "equals":
+		return s == filter, nil
+	case "notEqual":
+		return s != filter, nil
+	case "startsWith":
+		return strings.HasPrefix(s, filter), nil
+	case "endsWith":
+		return strings.HasSuffix(s, filter), nil
+	default:
+		return false, errors.Errorf("unsupported text filter %s", f.Type)
+	}
+}
+
+func (f *Filter) matchesNumber(value interface{}) (bool, error) {
+	filter, ok := toFloat(f.Filter)
+	if !ok {
+		return false, errors.Errorf("invalid number filter %v", f.Filter)
+	}
+	v, ok := toFloat(value)
+	if !ok {
+		return f.Type == "notEqual", nil
+	}
+
+	switch f.Type {
+	case "", "equals":
+		return v == filter, nil
+	case "notEqual":
+		return v != filter, nil
+	case "lessThan":
+		return v < filter, nil
+	case "lessThanOrEqual":
+		return v <= filter, nil
+	case "greaterThan":
+		return v > filter, nil
+	case "greaterThanOrEqual":
+		return v >= filter, nil
+	case "inRange":
+		filterTo, ok := toFloat(f.FilterTo)
+		if !ok {
+			return false, errors.Errorf("invalid number filter %v", f.FilterTo)
+		}
+		return v >= filter && v <= filterTo, nil
+	default:
+		return false, errors.Errorf("unsupported number filter %s", f.Type)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v_ := v.(type) {
+	case int:
+		return float64(v_), true
+	case int8:
+		return float64(v_), true
+	case int16:
+		return float64(v_), true
+	case int32:
+		return float64(v_), true
+	case int64:
+		return float64(v_), true
+	case uint:
+		return float64(v_), true
+	case uint8:
+		return float64(v_), true
+	case uint16:
+		return float64(v_), true
+	case uint32:
+		return float64(v_), true
+	case uint64:
+		return float64(v_), true
+	case float32:
+		return float64(v_), true
+	case float64:
+		return v_, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v_), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// compareValues orders nil values first, numbers numerically and everything else by its string representation.
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+type cacheEntry struct {
+	table   *types.Table
+	expires time.Time
+}
+
+// ResultCache keeps the results of recent command runs, so that scrolling through the pages
+// of a result doesn't run the command for every page. The cache holds at most Size results
+// and MaxRows rows in total, evicting the ones that expire first. Results with more than MaxRows
+// rows are not cached.
+type ResultCache struct {
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+	size     int
+	maxRows  int
+	rows     int
+	duration time.Duration
+	now      func() time.Time
+}
+
+type ResultCacheOption func(*ResultCache)
+
+// WithCacheSize sets the maximum number of results kept in the cache.
+func WithCacheSize(size int) ResultCacheOption {
+	return func(c *ResultCache) {
+		c.size = size
+	}
+}
+
+// WithCacheRows sets the maximum number of rows kept in the cache, across all results.
+func WithCacheRows(maxRows int) ResultCacheOption {
+	return func(c *ResultCache) {
+		c.maxRows = maxRows
+	}
+}
+
+// WithCacheDuration sets how long results are kept. A negative duration disables caching.
+func WithCacheDuration(duration time.Duration) ResultCacheOption {
+	return func(c *ResultCache) {
+		c.duration = duration
+	}
+}
+
+// WithClock overrides the function used to get the current time when expiring cache entries.
+func WithClock(now func() time.Time) ResultCacheOption {
+	return func(c *ResultCache) {
+		c.now = now
+	}
+}
+
+func NewResultCache(options ...ResultCacheOption) *ResultCache {
+	c := &ResultCache{
+		entries:  map[string]cacheEntry{},
+		size:     DefaultCacheSize,
+		maxRows:  DefaultCacheRows,
+		duration: DefaultCacheDuration,
+		now:      time.Now,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+func (c *ResultCache) get(key string) (*types.Table, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().After(entry.expires) {
+		c.remove(key)
+		return nil, false
+	}
+	return entry.table, true
+}
+
+func (c *ResultCache) set(key string, table_ *types.Table) {
+	if c.duration < 0 || c.size <= 0 || len(table_.Rows) > c.maxRows {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.remove(key)
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			c.remove(k)
+		}
+	}
+	for len(c.entries) >= c.size || c.rows+len(table_.Rows) > c.maxRows {
+		oldestKey := ""
+		var oldest time.Time
+		for k, entry := range c.entries {
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = k, entry.expires
+			}
+		}
+		c.remove(oldestKey)
+	}
+
+	c.entries[key] = cacheEntry{
+		table:   table_,
+		expires: now.Add(c.duration),
+	}
+	c.rows += len(table_.Rows)
+}
+
+// remove deletes the entry of key and updates the row count. The lock must be held.
+func (c *ResultCache) remove(key string) {
+	if entry, ok := c.entries[key]; ok {
+		c.rows -= len(entry.table.Rows)
+		delete(c.entries, key)
+	}
+}
+
+// QueryHandler runs a glazed command and serves a page of its sorted and filtered rows as JSON.
+// This is the endpoint used by the virtualized datatables view to load rows as the user scrolls.
+//
+// The parameters of the command are parsed like for the other handlers, the paging itself
+// is controlled by the `_start`, `_end`, `_sort` and `_filter` query parameters, see ParseRequest.
+type QueryHandler struct {
+	cmd         cmds.GlazeCommand
+	middlewares []sources.Middleware
+
+	whitelistedLayers []string
+	parka_middlewares.RequestParameters
+
+	cache       *ResultCache
+	maxPageSize int
+}
+
+type QueryHandlerOption func(*QueryHandler)
+
+func NewQueryHandler(cmd cmds.GlazeCommand, options ...QueryHandlerOption) *QueryHandler {
+	h := &QueryHandler{
+		cmd:         cmd,
+		maxPageSize: DefaultMaxPageSize,
+	}
+	for _, option := range options {
+		option(h)
+	}
+	if h.cache == nil {
+		h.cache = NewResultCache()
+	}
+	return h
+}
+
+func WithMiddlewares(middlewares ...sources.Middleware) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.middlewares = middlewares
+	}
+}
+
+func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.whitelistedLayers = layers
+	}
+}
+
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters parka_middlewares.RequestParameters) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.RequestParameters = parameters
+	}
+}
+
+// WithResultCache shares a ResultCache across handlers.
+func WithResultCache(cache *ResultCache) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.cache = cache
+	}
+}
+
+// WithMaxPageSize sets the largest number of rows a client can request at once. Larger pages are clamped.
+func WithMaxPageSize(maxPageSize int) QueryHandlerOption {
+	return func(h *QueryHandler) {
+		h.maxPageSize = maxPageSize
+	}
+}
+
+var _ handlers.Handler = (*QueryHandler)(nil)
+
+func (h *QueryHandler) Handle(c echo.Context) error {
+	request, err := ParseRequest(c.QueryParams(), h.maxPageSize)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	table_, err := h.getTable(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := request.Apply(table_)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// getTable returns the rows of the command for the parameters of the request, from the cache if possible.
+func (h *QueryHandler) getTable(c echo.Context) (*types.Table, error) {
+	description := h.cmd.Description()
+
+	// the paging parameters don't change the result of the command
+	query := url.Values{}
+	for k, v := range c.QueryParams() {
+		if k == StartQueryParameter || k == EndQueryParameter || k == SortQueryParameter || k == FilterQueryParameter {
+			continue
+		}
+		query[k] = v
+	}
+	// path parameters (part of the URL path), headers and cookies can change the result as well
+	key := fmt.Sprintf("%s|%s|%s|%v|%v",
+		description.FullPath(), c.Request().URL.Path, query.Encode(),
+		pickValues(h.HeaderParameters, c.Request().Header.Get),
+		pickValues(h.CookieParameters, func(name string) string {
+			cookie, err := c.Cookie(name)
+			if err != nil {
+				return ""
+			}
+			return cookie.Value
+		}),
+	)
+	if table_, ok := h.cache.get(key); ok {
+		return table_, nil
+	}
+
+	parsedValues := values.New()
+
+	middlewares_ := h.RequestParameters.Middlewares(c,
+		parka_middlewares.WithWhitelistedLayers(h.whitelistedLayers...),
+		parka_middlewares.WithMiddlewares(h.middlewares...),
+	)
+
+	err := sources.Execute(description.Schema.Clone(), parsedValues, middlewares_...)
+	if err != nil {
+		return nil, err
+	}
+
+	gp, err := handlers.CreateTableProcessorWithOutput(parsedValues, "table", "ascii")
+	if err != nil {
+		return nil, err
+	}
+	// the null table middleware keeps the rows in the processor's table
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+
+	ctx := c.Request().Context()
+	err = h.cmd.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+	if err != nil {
+		return nil, err
+	}
+	err = gp.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	table_ := gp.GetTable()
+	h.cache.set(key, table_)
+
+	return table_, nil
+}
+
+// pickValues returns the values of the mapped names, sorted by name, for use in cache keys.
+func pickValues(mapping map[string]string, get func(name string) string) []string {
+	ret := []string{}
+	for name := range mapping {
+		ret = append(ret, name+"="+get(name))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func CreatePagingHandler(cmd cmds.GlazeCommand, options ...QueryHandlerOption) echo.HandlerFunc {
+	handler := NewQueryHandler(cmd, options...)
+	return handler.Handle
+}
@@ -0,0 +1,209 @@
+package paging
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTable() *types.Table {
+	t := types.NewTable()
+	t.AddRows(
+		types.NewRow(types.MRP("name", "beta"), types.MRP("count", 10)),
+		types.NewRow(types.MRP("name", "alpha"), types.MRP("count", 2)),
+		types.NewRow(types.MRP("name", "gamma"), types.MRP("count", nil)),
+		types.NewRow(types.MRP("name", "alphabet"), types.MRP("count", 7.5)),
+	)
+	return t
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedNames []string
+		lastRow       int
+		expectedError bool
+	}{
+		{name: "defaults", query: "", expectedNames: []string{"beta", "alpha", "gamma", "alphabet"}, lastRow: 4},
+		{name: "range", query: "_start=1&_end=3", expectedNames: []string{"alpha", "gamma"}, lastRow: 4},
+		{name: "range past the end", query: "_start=3&_end=10", expectedNames: []string{"alphabet"}, lastRow: 4},
+		{name: "start past the end", query: "_start=10", expectedNames: []string{}, lastRow: 4},
+		{
+			name:          "sort by name",
+			query:         `_sort=[{"colId":"name","sort":"asc"}]`,
+			expectedNames: []string{"alpha", "alphabet", "beta", "gamma"},
+			lastRow:       4,
+		},
+		{
+			name:          "sort numbers descending with nil last",
+			query:         `_sort=[{"colId":"count","sort":"desc"}]`,
+			expectedNames: []string{"beta", "alphabet", "alpha", "gamma"},
+			lastRow:       4,
+		},
+		{
+			name:          "text filter",
+			query:         `_filter={"name":{"filterType":"text","type":"startsWith","filter":"ALPHA"}}`,
+			expectedNames: []string{"alpha", "alphabet"},
+			lastRow:       2,
+		},
+		{
+			name:          "number filter",
+			query:         `_filter={"count":{"filterType":"number","type":"greaterThan","filter":5}}&_end=1`,
+			expectedNames: []string{"beta"},
+			lastRow:       2,
+		},
+		{
+			name: "combined conditions",
+			query: `_filter={"count":{"filterType":"number","operator":"OR","conditions":[` +
+				`{"filterType":"number","type":"lessThan","filter":3},{"filterType":"number","type":"blank"}]}}`,
+			expectedNames: []string{"alpha", "gamma"},
+			lastRow:       2,
+		},
+		{name: "invalid range", query: "_start=5&_end=2", expectedError: true},
+		{name: "invalid sort", query: `_sort=[{"colId":"name","sort":"up"}]`, expectedError: true},
+		{name: "unsupported filter", query: `_filter={"name":{"filterType":"set","values":["a"]}}`, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			request, err := ParseRequest(query, DefaultMaxPageSize)
+			var page *Page
+			if err == nil {
+				page, err = request.Apply(newTable())
+			}
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			names := []string{}
+			for _, row := range page.Rows {
+				name, _ := row.Get("name")
+				names = append(names, name.(string))
+			}
+			assert.Equal(t, tt.expectedNames, names)
+			assert.Equal(t, tt.lastRow, page.LastRow)
+		})
+	}
+}
+
+func TestParseRequestMaxPageSize(t *testing.T) {
+	tests := []struct {
+		query string
+		start int
+		end   int
+	}{
+		{query: "", start: 0, end: 100},
+		{query: "_start=50", start: 50, end: 150},
+		{query: "_start=0&_end=50", start: 0, end: 50},
+		{query: "_start=10&_end=1000000", start: 10, end: 110},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			request, err := ParseRequest(query, 100)
+			require.NoError(t, err)
+			assert.Equal(t, tt.start, request.Start)
+			assert.Equal(t, tt.end, request.End)
+		})
+	}
+}
+
+func TestResultCacheRows(t *testing.T) {
+	now := time.Now()
+	c := NewResultCache(WithCacheRows(6), WithClock(func() time.Time { return now }))
+
+	c.set("a", newTable())
+	now = now.Add(time.Second)
+	c.set("b", newTable())
+	assert.Len(t, c.entries, 1, "the oldest result is evicted to stay below the row limit")
+	_, ok := c.get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 4, c.rows)
+
+	// results with more rows than the cache holds are not cached
+	large := types.NewTable()
+	for i := 0; i < 7; i++ {
+		large.AddRows(types.NewRow(types.MRP("name", i)))
+	}
+	c.set("large", large)
+	_, ok = c.get("large")
+	assert.False(t, ok)
+	_, ok = c.get("b")
+	assert.True(t, ok)
+
+	// replacing a result doesn't count its rows twice
+	c.set("b", newTable())
+	assert.Equal(t, 4, c.rows)
+
+	now = now.Add(2 * DefaultCacheDuration)
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.rows)
+}
+
+// countingCommand counts how often the command is run, to test caching.
+type countingCommand struct {
+	*utils.TestGlazedCommand
+	runs int
+}
+
+func (c *countingCommand) RunIntoGlazeProcessor(ctx context.Context, parsedValues *values.Values, gp middlewares.Processor) error {
+	c.runs++
+	return c.TestGlazedCommand.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+}
+
+func TestQueryHandler(t *testing.T) {
+	cmd_, err := utils.NewTestGlazedCommand()
+	require.NoError(t, err)
+	cmd := &countingCommand{TestGlazedCommand: cmd_}
+
+	e := echo.New()
+	e.GET("/rows", CreatePagingHandler(cmd))
+
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet,
+		"/rows?_start=0&_end=2&_sort="+url.QueryEscape(`[{"colId":"test","sort":"desc"}]`), nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	page := struct {
+		Columns []string                 `json:"columns"`
+		Rows    []map[string]interface{} `json:"rows"`
+		LastRow int                      `json:"lastRow"`
+	}{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+	assert.Equal(t, []string{"test", "test2", "test3"}, page.Columns)
+	assert.Equal(t, 3, page.LastRow)
+	require.Len(t, page.Rows, 2)
+	assert.Equal(t, "test-2", page.Rows[0]["test2"])
+	assert.Equal(t, "test-1", page.Rows[1]["test2"])
+
+	// the next page is served from the cache
+	resp = httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/rows?_start=2&_end=4", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 1, cmd.runs)
+
+	resp = httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/rows?_start=foo", nil))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
@@ -7,7 +7,6 @@ import (
 	"net/http"
 
 	"github.com/go-go-golems/glazed/pkg/cmds"
-	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	json2 "github.com/go-go-golems/glazed/pkg/formatters/json"
@@ -23,6 +22,7 @@ type QueryHandler struct {
 	middlewares []sources.Middleware
 	// whitelistedLayers contains the list of layers that are allowed to be modified through query parameters
 	whitelistedLayers []string
+	middlewares2.RequestParameters
 }
 
 type QueryHandlerOption func(*QueryHandler)
@@ -51,24 +51,24 @@ func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
 	}
 }
 
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters middlewares2.RequestParameters) QueryHandlerOption {
+	return func(handler *QueryHandler) {
+		handler.RequestParameters = parameters
+	}
+}
+
 var _ handlers.Handler = (*QueryHandler)(nil)
 
 func (h *QueryHandler) Handle(c echo.Context) error {
 	description := h.cmd.Description()
 	parsedValues := values.New()
 
-	queryMiddleware := middlewares2.UpdateFromQueryParameters(c, fields.WithSource("query"))
-	if len(h.whitelistedLayers) > 0 {
-		queryMiddleware = sources.WrapWithWhitelistedSections(h.whitelistedLayers, queryMiddleware)
-	}
-
-	middlewares_ := append(
-		[]sources.Middleware{
-			queryMiddleware,
-		},
-		h.middlewares...,
+	middlewares_ := h.RequestParameters.Middlewares(c,
+		middlewares2.WithWhitelistedLayers(h.whitelistedLayers...),
+		middlewares2.WithMiddlewares(h.middlewares...),
 	)
-	middlewares_ = append(middlewares_, sources.FromDefaults())
 	err := sources.Execute(description.Schema.Clone(), parsedValues, middlewares_...)
 	if err != nil {
 		return err
@@ -2,7 +2,6 @@ package text
 
 import (
 	"github.com/go-go-golems/glazed/pkg/cmds"
-	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/middlewares/table"
@@ -18,6 +17,7 @@ type QueryHandler struct {
 	middlewares []sources.Middleware
 	// whitelistedLayers contains the list of layers that are allowed to be modified through query parameters
 	whitelistedLayers []string
+	parka_middlewares.RequestParameters
 }
 
 type QueryHandlerOption func(*QueryHandler)
@@ -46,24 +46,24 @@ func WithWhitelistedLayers(layers ...string) QueryHandlerOption {
 	}
 }
 
+// WithRequestParameters maps the path parameters, headers and cookies of the request to command parameters,
+// see middlewares.RequestParameters.
+func WithRequestParameters(parameters parka_middlewares.RequestParameters) QueryHandlerOption {
+	return func(handler *QueryHandler) {
+		handler.RequestParameters = parameters
+	}
+}
+
 var _ handlers.Handler = (*QueryHandler)(nil)
 
 func (h *QueryHandler) Handle(c echo.Context) error {
 	description := h.cmd.Description()
 	parsedValues := values.New()
 
-	queryMiddleware := parka_middlewares.UpdateFromQueryParameters(c, fields.WithSource("query"))
-	if len(h.whitelistedLayers) > 0 {
-		queryMiddleware = sources.WrapWithWhitelistedSections(h.whitelistedLayers, queryMiddleware)
-	}
-
-	middlewares_ := append(
-		[]sources.Middleware{
-			queryMiddleware,
-		},
-		h.middlewares...,
+	middlewares_ := h.RequestParameters.Middlewares(c,
+		parka_middlewares.WithWhitelistedLayers(h.whitelistedLayers...),
+		parka_middlewares.WithMiddlewares(h.middlewares...),
 	)
-	middlewares_ = append(middlewares_, sources.FromDefaults())
 
 	err := sources.Execute(description.Schema.Clone(), parsedValues, middlewares_...)
 	if err != nil {
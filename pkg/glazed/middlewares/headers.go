@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"net/url"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/labstack/echo/v4"
+)
+
+// UpdateFromHeaders sets command parameters from request headers.
+//
+// mapping maps a header name (for example `X-Region`) to a command parameter, given as `param`
+// for the default section or `section.param`. Headers that are not listed in mapping are ignored,
+// and so are headers that are missing or empty. List parameters are split on commas.
+//
+// Like UpdateFromPathParameters, the mapping is part of the route configuration, so mapped
+// parameters can be set even if they are blacklisted or not whitelisted for the query string.
+func UpdateFromHeaders(c echo.Context, mapping map[string]string, options ...fields.ParseOption) sources.Middleware {
+	return updateFromRequest(mapping, "header", func(name string) (string, bool) {
+		value := c.Request().Header.Get(name)
+		return value, value != ""
+	}, options...)
+}
+
+// UpdateFromCookies sets command parameters from request cookies.
+//
+// mapping maps a cookie name to a command parameter, given as `param` for the default section
+// or `section.param`. Cookie values are URL-unescaped if possible, since browsers usually
+// store them URL-encoded.
+func UpdateFromCookies(c echo.Context, mapping map[string]string, options ...fields.ParseOption) sources.Middleware {
+	return updateFromRequest(mapping, "cookie", func(name string) (string, bool) {
+		cookie, err := c.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			return "", false
+		}
+		value, err := url.QueryUnescape(cookie.Value)
+		if err != nil {
+			return cookie.Value, true
+		}
+		return value, true
+	}, options...)
+}
+
+// UpdateFromValues sets command parameters from named values, for example the shared inputs of a dashboard.
+//
+// mapping maps a value name to a command parameter, given as `param` for the default section
+// or `section.param`. Missing and empty values are ignored.
+func UpdateFromValues(values_ map[string]string, mapping map[string]string, options ...fields.ParseOption) sources.Middleware {
+	return updateFromRequest(mapping, "input", func(name string) (string, bool) {
+		value := values_[name]
+		return value, value != ""
+	}, options...)
+}
+
+func updateFromRequest(
+	mapping map[string]string,
+	kind string,
+	lookup func(name string) (string, bool),
+	options ...fields.ParseOption,
+) sources.Middleware {
+	return func(next sources.HandlerFunc) sources.HandlerFunc {
+		return func(schema_ *schema.Schema, parsedValues *values.Values) error {
+			if len(mapping) == 0 {
+				return next(schema_, parsedValues)
+			}
+
+			// keep a copy of the full schema, because later middlewares might hide sections and parameters
+			fullSchema := schema_.Clone()
+
+			err := next(schema_, parsedValues)
+			if err != nil {
+				return err
+			}
+
+			return updateFromMapping(fullSchema, parsedValues, kind, mapping, lookup, options...)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package middlewares
+
+import (
+	_ "embed"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/helpers"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/helpers/yaml"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type UpdateFromHeadersAndCookiesTest struct {
+	Name             string                        `yaml:"name"`
+	Description      string                        `yaml:"description"`
+	Sections         []helpers.TestSection         `yaml:"sections"`
+	Values           []helpers.TestSectionValues   `yaml:"values"`
+	Headers          map[string]string             `yaml:"headers"`
+	HeaderMapping    map[string]string             `yaml:"headerMapping"`
+	Cookies          map[string]string             `yaml:"cookies"`
+	CookieMapping    map[string]string             `yaml:"cookieMapping"`
+	QueryParameters  []utils.QueryParameter        `yaml:"queryParameters"`
+	Middlewares      helpers.TestMiddlewares       `yaml:"middlewares"`
+	ExpectedSections []helpers.TestExpectedSection `yaml:"expectedSections"`
+	ExpectedError    bool                          `yaml:"expectedError"`
+	ErrorString      string                        `yaml:"errorString,omitempty"`
+}
+
+//go:embed test-data/update-from-headers-and-cookies.yaml
+var updateFromHeadersAndCookiesTestsYAML string
+
+// TestUpdateFromHeadersAndCookies chains the query, header and cookie middlewares
+// the way the glazed handlers do.
+func TestUpdateFromHeadersAndCookies(t *testing.T) {
+	tests, err := yaml.LoadTestFromYAML[[]UpdateFromHeadersAndCookiesTest](updateFromHeadersAndCookiesTestsYAML)
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := utils.NewRequestWithQueryParameters(tt.QueryParameters)
+			for k, v := range tt.Headers {
+				req.Header.Set(k, v)
+			}
+			for k, v := range tt.Cookies {
+				req.AddCookie(&http.Cookie{Name: k, Value: v})
+			}
+
+			schema_ := helpers.NewTestSchema(tt.Sections)
+			parsedValues := helpers.NewTestValues(schema_, tt.Values...)
+
+			resp := httptest.NewRecorder()
+			e := echo.New()
+			c := e.NewContext(req, resp)
+
+			additionalMiddlewares, err := tt.Middlewares.ToMiddlewares()
+			require.NoError(t, err)
+
+			middlewares_ := []sources.Middleware{
+				UpdateFromQueryParameters(c, fields.WithSource("query")),
+				UpdateFromHeaders(c, tt.HeaderMapping, fields.WithSource("headers")),
+				UpdateFromCookies(c, tt.CookieMapping, fields.WithSource("cookies")),
+			}
+			middlewares_ = append(middlewares_, additionalMiddlewares...)
+
+			err = sources.Execute(schema_, parsedValues, middlewares_...)
+
+			if tt.ExpectedError {
+				assert.Error(t, err)
+				if tt.ErrorString != "" {
+					assert.Equal(t, tt.ErrorString, err.Error())
+				}
+			} else {
+				require.NoError(t, err)
+				helpers.TestExpectedOutputs(t, tt.ExpectedSections, parsedValues)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/pkg/errors"
+)
+
+// ParseParameterTarget splits a mapping target of the form `param` or `section.param`.
+// A target without a section refers to the default section.
+func ParseParameterTarget(target string) (string, string) {
+	if idx := strings.Index(target, "."); idx != -1 {
+		return target[:idx], target[idx+1:]
+	}
+	return schema.DefaultSlug, target
+}
+
+// updateFromString parses value for the parameter name of the given section and stores it in parsedValues.
+// List parameters are split on commas.
+//
+// It returns false if the schema has no such parameter.
+func updateFromString(
+	schema_ *schema.Schema,
+	parsedValues *values.Values,
+	sectionSlug string,
+	name string,
+	value string,
+	options ...fields.ParseOption,
+) (bool, error) {
+	section, ok := schema_.Get(sectionSlug)
+	if !ok {
+		return false, nil
+	}
+	p, ok := section.GetDefinitions().Get(name)
+	if !ok {
+		return false, nil
+	}
+
+	if p.Type.IsFile() || p.Type.NeedsFileContent("") {
+		return true, errors.Errorf("parameter '%s' of type %s can't be set from a string value", p.Name, p.Type)
+	}
+
+	values_ := []string{value}
+	if p.Type.IsList() {
+		values_ = []string{}
+		for _, v := range strings.Split(value, ",") {
+			values_ = append(values_, strings.TrimSpace(v))
+		}
+	}
+	parsedField, err := p.ParseField(values_, options...)
+	if err != nil {
+		return true, errors.Wrapf(err, "invalid value for parameter '%s': %s", p.Name, value)
+	}
+	parsedValues.GetOrCreate(section).Fields.Update(p.Name, parsedField)
+
+	return true, nil
+}
+
+// updateFromMapping looks up each key of mapping with lookup, and sets the mapped parameter
+// (`param` or `section.param`) if a value was found. kind is used in error messages.
+//
+// Since the mapping is explicitly configured, mapping to an unknown parameter is an error.
+func updateFromMapping(
+	schema_ *schema.Schema,
+	parsedValues *values.Values,
+	kind string,
+	mapping map[string]string,
+	lookup func(name string) (string, bool),
+	options ...fields.ParseOption,
+) error {
+	for name, target := range mapping {
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		sectionSlug, parameter := ParseParameterTarget(target)
+		ok, err := updateFromString(schema_, parsedValues, sectionSlug, parameter, value, options...)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Errorf("%s '%s' is mapped to unknown parameter '%s.%s'", kind, name, sectionSlug, parameter)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// PathParameterBinding describes which command parameter an echo path parameter is bound to.
+type PathParameterBinding struct {
+	PathParameter string
+	Section       string
+	Parameter     string
+	Value         string
+	// Explicit is true if the binding was declared in the mapping, in which case the
+	// target parameter has to exist.
+	Explicit bool
+}
+
+// GetPathParameterBindings returns the bindings for all the path parameters matched by the route.
+//
+// mapping maps a path parameter name to a command parameter, given as `param` or `section.param`.
+// Path parameters that are not listed in mapping are bound to the parameter of the same name
+// in the default section, if there is one. The wildcard parameter `*` is never bound.
+func GetPathParameterBindings(c echo.Context, mapping map[string]string) []PathParameterBinding {
+	ret := []PathParameterBinding{}
+	paramValues := c.ParamValues()
+	for i, name := range c.ParamNames() {
+		if name == "*" || i >= len(paramValues) {
+			continue
+		}
+
+		binding := PathParameterBinding{
+			PathParameter: name,
+			Section:       schema.DefaultSlug,
+			Parameter:     name,
+			Value:         paramValues[i],
+		}
+		if target, ok := mapping[name]; ok {
+			binding.Section, binding.Parameter = ParseParameterTarget(target)
+			binding.Explicit = true
+		}
+		ret = append(ret, binding)
+	}
+
+	return ret
+}
+
+// GetPathParameterFields returns the command parameters bound to path parameters, indexed by section.
+// This is used to hide these parameters from the query string middleware, see UpdateFromPathParameters.
+func GetPathParameterFields(c echo.Context, mapping map[string]string) map[string][]string {
+	ret := map[string][]string{}
+	for _, binding := range GetPathParameterBindings(c, mapping) {
+		ret[binding.Section] = append(ret[binding.Section], binding.Parameter)
+	}
+	return ret
+}
+
+// UpdateFromPathParameters sets command parameters from the path parameters matched by the echo route,
+// for example `/customers/:id/orders`. See GetPathParameterBindings for how path parameters are mapped.
+//
+// The middleware updates the values after calling next, and should be the first middleware in the chain,
+// so that values from the path take precedence over query parameters, overrides and defaults.
+// Since the mapping is part of the route configuration, bound parameters can be set even if
+// they are blacklisted or not whitelisted for the query string.
+func UpdateFromPathParameters(c echo.Context, mapping map[string]string, options ...fields.ParseOption) sources.Middleware {
+	return func(next sources.HandlerFunc) sources.HandlerFunc {
+		return func(schema_ *schema.Schema, parsedValues *values.Values) error {
+			// keep a copy of the full schema, because later middlewares might hide sections and parameters
+			fullSchema := schema_.Clone()
+
+			err := next(schema_, parsedValues)
+			if err != nil {
+				return err
+			}
+
+			for _, binding := range GetPathParameterBindings(c, mapping) {
+				ok, err := updateFromString(fullSchema, parsedValues, binding.Section, binding.Parameter, binding.Value, options...)
+				if err != nil {
+					return err
+				}
+				if !ok && binding.Explicit {
+					return errors.Errorf("path parameter '%s' is mapped to unknown parameter '%s.%s'",
+						binding.PathParameter, binding.Section, binding.Parameter)
+				}
+			}
+
+			return nil
+		}
+	}
+}
+
+// WrapQueryMiddlewareWithPathParameters hides the parameters bound to path parameters from the query middleware,
+// so that they can't be overridden through the query string and are not reported as missing
+// if they are required.
+func WrapQueryMiddlewareWithPathParameters(
+	c echo.Context,
+	mapping map[string]string,
+	queryMiddleware sources.Middleware,
+) sources.Middleware {
+	pathFields := GetPathParameterFields(c, mapping)
+	if len(pathFields) == 0 {
+		return queryMiddleware
+	}
+	return sources.WrapWithBlacklistedSectionFields(pathFields, queryMiddleware)
+}
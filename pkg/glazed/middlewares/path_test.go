@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	_ "embed"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/helpers"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/helpers/yaml"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type UpdateFromPathParametersTest struct {
+	Name             string                        `yaml:"name"`
+	Description      string                        `yaml:"description"`
+	Sections         []helpers.TestSection         `yaml:"sections"`
+	Values           []helpers.TestSectionValues   `yaml:"values"`
+	PathParameters   []utils.QueryParameter        `yaml:"pathParameters"`
+	Mapping          map[string]string             `yaml:"mapping"`
+	QueryParameters  []utils.QueryParameter        `yaml:"queryParameters"`
+	Middlewares      helpers.TestMiddlewares       `yaml:"middlewares"`
+	ExpectedSections []helpers.TestExpectedSection `yaml:"expectedSections"`
+	ExpectedError    bool                          `yaml:"expectedError"`
+	ErrorString      string                        `yaml:"errorString,omitempty"`
+}
+
+//go:embed test-data/update-from-path-parameters.yaml
+var updateFromPathParametersTestsYAML string
+
+// TestUpdateFromPathParameters runs the path middleware in front of the query middleware and
+// the additional middlewares given in the test, with the chain of the glazed handlers.
+func TestUpdateFromPathParameters(t *testing.T) {
+	tests, err := yaml.LoadTestFromYAML[[]UpdateFromPathParametersTest](updateFromPathParametersTestsYAML)
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := utils.NewRequestWithQueryParameters(tt.QueryParameters)
+
+			schema_ := helpers.NewTestSchema(tt.Sections)
+			parsedValues := helpers.NewTestValues(schema_, tt.Values...)
+
+			resp := httptest.NewRecorder()
+			e := echo.New()
+			c := e.NewContext(req, resp)
+			names := []string{}
+			values_ := []string{}
+			for _, p := range tt.PathParameters {
+				names = append(names, p.Name)
+				values_ = append(values_, p.Value)
+			}
+			c.SetParamNames(names...)
+			c.SetParamValues(values_...)
+
+			additionalMiddlewares, err := tt.Middlewares.ToMiddlewares()
+			require.NoError(t, err)
+
+			middlewares_ := RequestParameters{PathParameters: tt.Mapping}.Middlewares(c,
+				WithMiddlewares(additionalMiddlewares...))
+
+			err = sources.Execute(schema_, parsedValues, middlewares_...)
+
+			if tt.ExpectedError {
+				assert.Error(t, err)
+				if tt.ErrorString != "" {
+					assert.Equal(t, tt.ErrorString, err.Error())
+				}
+			} else {
+				require.NoError(t, err)
+				helpers.TestExpectedOutputs(t, tt.ExpectedSections, parsedValues)
+			}
+		})
+	}
+}
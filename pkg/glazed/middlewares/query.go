@@ -12,6 +12,76 @@ import (
 	"github.com/pkg/errors"
 )
 
+// QualifiedParameterName returns the `section.field` name that can be used in query parameters
+// to target the field of a specific section.
+func QualifiedParameterName(sectionSlug string, name string) string {
+	return sectionSlug + "." + name
+}
+
+// getQueryParameterName returns the name under which the field is looked up in the query parameters.
+// The qualified `section.field` name takes precedence over the plain field name, so that
+// fields with the same name in different sections can be set independently.
+func getQueryParameterName(c echo.Context, sectionSlug string, name string) string {
+	qualifiedName := QualifiedParameterName(sectionSlug, name)
+	params := c.QueryParams()
+	if _, ok := params[qualifiedName]; ok {
+		return qualifiedName
+	}
+	if _, ok := params[qualifiedName+"[]"]; ok {
+		return qualifiedName
+	}
+	return name
+}
+
+// ComputeQueryParameterNames returns the query parameter name to use for each field of the schema,
+// indexed by section slug and field name. Fields whose name is unique across the schema use their plain name,
+// while fields defined in more than one section use the qualified `section.field` name.
+//
+// This is used to render forms and API descriptions where each section can be targeted independently.
+func ComputeQueryParameterNames(schema_ *schema.Schema) map[string]map[string]string {
+	counts := map[string]int{}
+	schema_.ForEach(func(_ string, section schema.Section) {
+		section.GetDefinitions().ForEach(func(p *fields.Definition) {
+			counts[p.Name]++
+		})
+	})
+
+	ret := map[string]map[string]string{}
+	schema_.ForEach(func(_ string, section schema.Section) {
+		slug := section.GetSlug()
+		ret[slug] = map[string]string{}
+		section.GetDefinitions().ForEach(func(p *fields.Definition) {
+			if counts[p.Name] > 1 {
+				ret[slug][p.Name] = QualifiedParameterName(slug, p.Name)
+			} else {
+				ret[slug][p.Name] = p.Name
+			}
+		})
+	})
+
+	return ret
+}
+
+// isSetFromRequest returns true if the field name was set from the path parameters, headers or cookies
+// of the request, but not if it was only set by a default or by another middleware.
+func isSetFromRequest(fields_ *fields.FieldValues, name string) bool {
+	v, ok := fields_.Get(name)
+	if !ok {
+		return false
+	}
+	for _, step := range v.Log {
+		switch step.Source {
+		case SourcePath, SourceHeaders, SourceCookies:
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateFromQueryParameters sets the fields of all sections from the query parameters.
+// A field is looked up by its qualified `section.field` name first, and then by its plain name,
+// which sets the fields of the same name in all sections. List fields can be passed as
+// `name[]=a&name[]=b` or as a comma separated `name=a,b`.
 func UpdateFromQueryParameters(c echo.Context, options ...fields.ParseOption) sources.Middleware {
 	return func(next sources.HandlerFunc) sources.HandlerFunc {
 		return func(schema_ *schema.Schema, parsedValues *values.Values) error {
@@ -28,9 +98,11 @@ func UpdateFromQueryParameters(c echo.Context, options ...fields.ParseOption) so
 						return errors.New("file parameters are not supported in query parameters")
 					}
 
+					name := getQueryParameterName(c, section.GetSlug(), p.Name)
+
 					if p.Type.IsList() {
-						// check p.Name[] parameter
-						values_, ok := c.QueryParams()[fmt.Sprintf("%s[]", p.Name)]
+						// check name[] parameter
+						values_, ok := c.QueryParams()[fmt.Sprintf("%s[]", name)]
 						if ok {
 							parsedField, err := p.ParseField(values_, options...)
 							if err != nil {
@@ -40,9 +112,10 @@ func UpdateFromQueryParameters(c echo.Context, options ...fields.ParseOption) so
 							return nil
 						}
 					}
-					value := c.QueryParam(p.Name)
+					value := c.QueryParam(name)
 					if value == "" {
-						if p.Required {
+						// the parameter might already have been provided by another part of the request, for example a header
+						if p.Required && !isSetFromRequest(sectionValues.Fields, p.Name) {
 							return errors.Errorf("required parameter '%s' is missing", p.Name)
 						}
 						return nil
@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	_ "embed"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/helpers"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
@@ -65,3 +66,34 @@ func TestUpdateFromQueryParameters(t *testing.T) {
 		})
 	}
 }
+
+func TestComputeQueryParameterNames(t *testing.T) {
+	schema_ := helpers.NewTestSchema([]helpers.TestSection{
+		{
+			Name: "default",
+			Definitions: []*fields.Definition{
+				fields.New("limit", fields.TypeInteger),
+				fields.New("name", fields.TypeString),
+			},
+		},
+		{
+			Name: "pagination",
+			Definitions: []*fields.Definition{
+				fields.New("limit", fields.TypeInteger),
+				fields.New("offset", fields.TypeInteger),
+			},
+		},
+	})
+
+	names := ComputeQueryParameterNames(schema_)
+	assert.Equal(t, map[string]map[string]string{
+		"default": {
+			"limit": "default.limit",
+			"name":  "name",
+		},
+		"pagination": {
+			"limit":  "pagination.limit",
+			"offset": "offset",
+		},
+	}, names)
+}
@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/labstack/echo/v4"
+)
+
+// The sources of the values parsed from the request, see fields.WithSource.
+const (
+	SourcePath    = "path"
+	SourceQuery   = "query"
+	SourceHeaders = "headers"
+	SourceCookies = "cookies"
+)
+
+// RequestParameters maps the parts of a request other than the query string to command parameters.
+// It is embedded in the handlers that parse the parameters of a command from a request, which build
+// their middleware chain with Middlewares.
+type RequestParameters struct {
+	// PathParameters maps the path parameters of the route (for example `:id` in `/customers/:id`)
+	// to command parameters, see UpdateFromPathParameters.
+	PathParameters map[string]string
+	// HeaderParameters maps request headers to command parameters, see UpdateFromHeaders.
+	HeaderParameters map[string]string
+	// CookieParameters maps cookies to command parameters, see UpdateFromCookies.
+	CookieParameters map[string]string
+}
+
+type requestMiddlewares struct {
+	whitelistedLayers []string
+	bodyMiddleware    sources.Middleware
+	middlewares       []sources.Middleware
+	parseOptions      []fields.ParseOption
+}
+
+type RequestMiddlewaresOption func(m *requestMiddlewares)
+
+// WithWhitelistedLayers restricts the sections that can be set through the query string.
+func WithWhitelistedLayers(layers ...string) RequestMiddlewaresOption {
+	return func(m *requestMiddlewares) {
+		m.whitelistedLayers = layers
+	}
+}
+
+// WithBodyMiddleware parses the parameters from the body of the request instead of the query string,
+// for example with a JSONBodyMiddleware. The body middleware is used as is.
+func WithBodyMiddleware(middleware sources.Middleware) RequestMiddlewaresOption {
+	return func(m *requestMiddlewares) {
+		m.bodyMiddleware = middleware
+	}
+}
+
+// WithMiddlewares adds middlewares after the request sources, and before the defaults of the parameters.
+func WithMiddlewares(middlewares ...sources.Middleware) RequestMiddlewaresOption {
+	return func(m *requestMiddlewares) {
+		m.middlewares = append(m.middlewares, middlewares...)
+	}
+}
+
+// WithParseOptions adds parse options to the values parsed from the request.
+func WithParseOptions(options ...fields.ParseOption) RequestMiddlewaresOption {
+	return func(m *requestMiddlewares) {
+		m.parseOptions = append(m.parseOptions, options...)
+	}
+}
+
+// Middlewares returns the middlewares parsing the parameters of a command from the request c, from the
+// highest to the lowest precedence: path parameters, query string, headers, cookies, the middlewares
+// added with WithMiddlewares, and the defaults of the parameters.
+//
+// The parameters bound to path parameters can't be set through the query string.
+func (p RequestParameters) Middlewares(c echo.Context, options ...RequestMiddlewaresOption) []sources.Middleware {
+	m := &requestMiddlewares{}
+	for _, option := range options {
+		option(m)
+	}
+	withSource := func(source string) []fields.ParseOption {
+		return append(append([]fields.ParseOption{}, m.parseOptions...), fields.WithSource(source))
+	}
+
+	queryMiddleware := m.bodyMiddleware
+	if queryMiddleware == nil {
+		queryMiddleware = UpdateFromQueryParameters(c, withSource(SourceQuery)...)
+		queryMiddleware = WrapQueryMiddlewareWithPathParameters(c, p.PathParameters, queryMiddleware)
+		if len(m.whitelistedLayers) > 0 {
+			queryMiddleware = sources.WrapWithWhitelistedSections(m.whitelistedLayers, queryMiddleware)
+		}
+	}
+
+	ret := []sources.Middleware{
+		UpdateFromPathParameters(c, p.PathParameters, withSource(SourcePath)...),
+		queryMiddleware,
+		UpdateFromHeaders(c, p.HeaderParameters, withSource(SourceHeaders)...),
+		UpdateFromCookies(c, p.CookieParameters, withSource(SourceCookies)...),
+	}
+	ret = append(ret, m.middlewares...)
+	ret = append(ret, sources.FromDefaults())
+
+	return ret
+}
@@ -34,14 +34,13 @@ package command_dir
 
 import (
 	"context"
-	"os"
 
 	"github.com/go-go-golems/clay/pkg/repositories"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
 	"github.com/go-go-golems/parka/pkg/handlers/config"
 	generic_command "github.com/go-go-golems/parka/pkg/handlers/generic-command"
-	"github.com/go-go-golems/parka/pkg/render"
 	parka "github.com/go-go-golems/parka/pkg/server"
 	"github.com/pkg/errors"
 )
@@ -85,7 +84,18 @@ func NewCommandDirHandlerFromConfig(
 		generic_command.WithTemplateName(config_.TemplateName),
 		generic_command.WithIndexTemplateName(config_.IndexTemplateName),
 		generic_command.WithMergeAdditionalData(config_.AdditionalData, true),
-		generic_command.WithWhitelistedLayers(schema.DefaultSlug),
+		// sections exposed in the form layout need to be settable through the query string as well
+		generic_command.WithWhitelistedLayers(append([]string{schema.DefaultSlug}, config_.Layout.SectionSlugs()...)...),
+		generic_command.WithRequestParameters(parka_middlewares.RequestParameters{
+			PathParameters:   config_.PathParameters,
+			HeaderParameters: config_.HeaderParameters,
+			CookieParameters: config_.CookieParameters,
+		}),
+		generic_command.WithFormLayout(config_.Layout),
+		generic_command.WithLiveUpdates(config_.LiveUpdates),
+		generic_command.WithAutoRefresh(config_.AutoRefresh),
+		generic_command.WithVirtualize(config_.Virtualize, config_.PageSize),
+		generic_command.WithColumns(config_.Columns),
 	}
 	genericHandler, err := generic_command.NewGenericCommandHandler(genericOptions...)
 	if err != nil {
@@ -113,20 +123,10 @@ func NewCommandDirHandlerFromConfig(
 	// we run this after the options in order to get the DevMode value
 	if cd.TemplateLookup == nil {
 		if config_.TemplateLookup != nil {
-			patterns := config_.TemplateLookup.Patterns
-			if len(patterns) == 0 {
-				patterns = []string{"**/*.tmpl.md", "**/*.tmpl.html"}
+			cd.TemplateLookup, err = config_.TemplateLookup.NewTemplateLookup(cd.DevMode)
+			if err != nil {
+				return nil, err
 			}
-			// we currently only support a single directory
-			if len(config_.TemplateLookup.Directories) != 1 {
-				return nil, errors.New("template lookup directories must be exactly one")
-			}
-			cd.TemplateLookup = render.NewLookupTemplateFromFS(
-				render.WithFS(os.DirFS(config_.TemplateLookup.Directories[0])),
-				render.WithBaseDir(""),
-				render.WithPatterns(patterns...),
-				render.WithAlwaysReload(cd.DevMode),
-			)
 		} else {
 			cd.TemplateLookup = datatables.NewDataTablesLookupTemplate()
 		}
@@ -1,16 +1,15 @@
 package command
 
 import (
-	"os"
 	"strings"
 
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/alias"
 	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
 	"github.com/go-go-golems/parka/pkg/handlers/config"
 	generic_command "github.com/go-go-golems/parka/pkg/handlers/generic-command"
-	"github.com/go-go-golems/parka/pkg/render"
 	parka "github.com/go-go-golems/parka/pkg/server"
 	"github.com/pkg/errors"
 )
@@ -112,6 +111,16 @@ func NewCommandHandlerFromConfig(
 	genericOptions := []generic_command.GenericCommandHandlerOption{
 		generic_command.WithTemplateName(config_.TemplateName),
 		generic_command.WithMergeAdditionalData(config_.AdditionalData, true),
+		generic_command.WithRequestParameters(parka_middlewares.RequestParameters{
+			PathParameters:   config_.PathParameters,
+			HeaderParameters: config_.HeaderParameters,
+			CookieParameters: config_.CookieParameters,
+		}),
+		generic_command.WithFormLayout(config_.Layout),
+		generic_command.WithLiveUpdates(config_.LiveUpdates),
+		generic_command.WithAutoRefresh(config_.AutoRefresh),
+		generic_command.WithVirtualize(config_.Virtualize, config_.PageSize),
+		generic_command.WithColumns(config_.Columns),
 	}
 	// TODO(manuel, 2024-05-09) To make this reloadable on dev mode, we would actually need to thunk this and pass the thunk to the GenericCommandHandler
 	cmd, err := LoadCommandFromFile(config_.File, loader)
@@ -146,26 +155,13 @@ func NewCommandHandlerFromConfig(
 		option(c)
 	}
 
-	// TODO(manuel, 2024-05-09) The TemplateLookup initialization probably makes sense to be extracted as a reusable component
-	// to load templates dynamically in dev mode, since it's shared across quite a few handlers (see command-dir).
-
 	// we run this after the options in order to get the DevMode value
 	if c.TemplateLookup == nil {
 		if config_.TemplateLookup != nil {
-			patterns := config_.TemplateLookup.Patterns
-			if len(patterns) == 0 {
-				patterns = []string{"**/*.tmpl.md", "**/*.tmpl.html"}
-			}
-			// we currently only support a single directory
-			if len(config_.TemplateLookup.Directories) != 1 {
-				return nil, errors.New("template lookup directories must be exactly one")
+			c.TemplateLookup, err = config_.TemplateLookup.NewTemplateLookup(c.DevMode)
+			if err != nil {
+				return nil, err
 			}
-			c.TemplateLookup = render.NewLookupTemplateFromFS(
-				render.WithFS(os.DirFS(config_.TemplateLookup.Directories[0])),
-				render.WithBaseDir(""),
-				render.WithPatterns(patterns...),
-				render.WithAlwaysReload(c.DevMode),
-			)
 		} else {
 			c.TemplateLookup = datatables.NewDataTablesLookupTemplate()
 		}
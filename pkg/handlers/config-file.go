@@ -11,12 +11,18 @@ import (
 	"github.com/go-go-golems/parka/pkg/handlers/command"
 	"github.com/go-go-golems/parka/pkg/handlers/command-dir"
 	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/handlers/dashboard"
+	generic_command "github.com/go-go-golems/parka/pkg/handlers/generic-command"
+	"github.com/go-go-golems/parka/pkg/handlers/proxy"
+	"github.com/go-go-golems/parka/pkg/handlers/redirect"
 	"github.com/go-go-golems/parka/pkg/handlers/static-dir"
 	"github.com/go-go-golems/parka/pkg/handlers/static-file"
 	"github.com/go-go-golems/parka/pkg/handlers/template"
 	"github.com/go-go-golems/parka/pkg/handlers/template-dir"
 	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/render/commands"
 	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/go-go-golems/parka/pkg/server/livereload"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -91,17 +97,26 @@ type ConfigFileHandler struct {
 	Config *config.Config
 
 	RepositoryFactory RepositoryFactory
+	// CommandLoader is used to load the command file of command routes.
+	CommandLoader loaders.CommandLoader
 
 	CommandDirectoryOptions  []command_dir.CommandDirHandlerOption
 	TemplateDirectoryOptions []template_dir.TemplateDirHandlerOption
 	TemplateOptions          []template.TemplateHandlerOption
 	CommandOptions           []command.CommandHandlerOption
+	ProxyOptions             []proxy.ProxyHandlerOption
+	DashboardOptions         []dashboard.DashboardHandlerOption
 
 	// ConfigFileLocation is an optional path to the config file on disk in case it needs to be reloaded
 	ConfigFileLocation        string
 	commandDirectoryHandlers  []*command_dir.CommandDirHandler
 	templateDirectoryHandlers []*template_dir.TemplateDirHandler
 	templateHandlers          []*template.TemplateHandler
+	// templateLookups are the template lookups created by the handlers, which are watched
+	// and report their errors in dev mode.
+	templateLookups []render.TemplateLookup
+	// liveReload notifies the browsers of changes to the files of the routes in dev mode.
+	liveReload *livereload.LiveReload
 
 	DevMode bool
 }
@@ -138,6 +153,18 @@ func WithAppendTemplateHandlerOptions(options ...template.TemplateHandlerOption)
 	}
 }
 
+func WithAppendProxyHandlerOptions(options ...proxy.ProxyHandlerOption) ConfigFileHandlerOption {
+	return func(handler *ConfigFileHandler) {
+		handler.ProxyOptions = append(handler.ProxyOptions, options...)
+	}
+}
+
+func WithAppendDashboardHandlerOptions(options ...dashboard.DashboardHandlerOption) ConfigFileHandlerOption {
+	return func(handler *ConfigFileHandler) {
+		handler.DashboardOptions = append(handler.DashboardOptions, options...)
+	}
+}
+
 func WithConfigFileLocation(location string) ConfigFileHandlerOption {
 	return func(handler *ConfigFileHandler) {
 		handler.ConfigFileLocation = location
@@ -150,6 +177,12 @@ func WithRepositoryFactory(rf RepositoryFactory) ConfigFileHandlerOption {
 	}
 }
 
+func WithCommandLoader(loader loaders.CommandLoader) ConfigFileHandlerOption {
+	return func(handler *ConfigFileHandler) {
+		handler.CommandLoader = loader
+	}
+}
+
 type ErrNoRepositoryFactory struct{}
 
 func (e ErrNoRepositoryFactory) Error() string {
@@ -208,7 +241,21 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 		}
 	}
 
+	if cfh.DevMode {
+		cfh.liveReload = livereload.NewLiveReload()
+		cfh.liveReload.Register(server_.Group)
+	}
+
 	rendererOptionsConfig := cfh.Config.Defaults.Renderer
+	defaultLookup, err := rendererOptionsConfig.NewTemplateLookup(cfh.DevMode)
+	if err != nil {
+		return err
+	}
+	if defaultLookup != nil {
+		cfh.addTemplateLookup(defaultLookup)
+		cfh.watchForLiveReload(rendererOptionsConfig.TemplateDirectory)
+	}
+
 	rendererOptions := []render.RendererOption{}
 	if *rendererOptionsConfig.UseDefaultParkaRenderer {
 		parkaDefaultRendererOptions, err := server.GetDefaultParkaRendererOptions()
@@ -217,33 +264,26 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 		}
 
 		rendererOptions = append(rendererOptions, parkaDefaultRendererOptions...)
-	} else {
-		if rendererOptionsConfig.TemplateDirectory != "" {
-			dir, err := filepath.Abs(os.ExpandEnv(rendererOptionsConfig.TemplateDirectory))
-			if err != nil {
-				return err
-			}
-			lookup := render.NewLookupTemplateFromFS(
-				render.WithFS(os.DirFS(dir)),
-				render.WithPatterns("**/*.tmpl.*"),
-			)
-			err = lookup.Reload()
+
+		// the fallback pages of the server are restyled by the template directory as well
+		if server_.DefaultRenderer != nil {
+			err = server_.DefaultRenderer.Configure(rendererOptionsConfig.RendererOptions(defaultLookup)...)
 			if err != nil {
 				return err
 			}
-
-			markdownBaseTemplateName := "base.tmpl.html"
-			if rendererOptionsConfig.MarkdownBaseTemplateName != "" {
-				markdownBaseTemplateName = rendererOptionsConfig.MarkdownBaseTemplateName
-			}
-
-			rendererOptions = []render.RendererOption{
-				render.WithAppendTemplateLookups(lookup),
-				render.WithMarkdownBaseTemplateName(markdownBaseTemplateName),
-			}
 		}
+	} else if defaultLookup != nil {
+		rendererOptions = append(rendererOptions, render.WithMarkdownBaseTemplateName("base.tmpl.html"))
 	}
 
+	rendererOptions = append(rendererOptions, rendererOptionsConfig.RendererOptions(defaultLookup)...)
+	rendererOptions = append(rendererOptions,
+		render.WithLiveReload(cfh.DevMode),
+		render.WithDevMode(cfh.DevMode),
+		// the scripts drawing the mermaid diagrams are served under the root path
+		render.WithMarkdownOptions(render.WithMarkdownAssetPrefix(server_.RootPath)),
+	)
+
 	// prepend the renderer options to the list of options
 	// honestly this setting should actually be a setting for each route as well
 	cfh.TemplateDirectoryOptions = append([]template_dir.TemplateDirHandlerOption{
@@ -253,9 +293,48 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 		template.WithAppendRendererOptions(rendererOptions...),
 	}, cfh.TemplateOptions...)
 
+	// in dev mode, templates are reloaded when they change. The external options are
+	// passed in last, so that they can still override this per handler type.
+	cfh.TemplateDirectoryOptions = append([]template_dir.TemplateDirHandlerOption{
+		template_dir.WithAlwaysReload(cfh.DevMode),
+	}, cfh.TemplateDirectoryOptions...)
+	cfh.CommandOptions = append([]command.CommandHandlerOption{
+		command.WithDevMode(cfh.DevMode),
+		command.WithGenericCommandHandlerOptions(
+			generic_command.WithLiveReload(cfh.DevMode),
+			generic_command.WithDevMode(cfh.DevMode),
+		),
+	}, cfh.CommandOptions...)
+	cfh.CommandDirectoryOptions = append([]command_dir.CommandDirHandlerOption{
+		command_dir.WithDevMode(cfh.DevMode),
+		command_dir.WithGenericCommandHandlerOptions(
+			generic_command.WithLiveReload(cfh.DevMode),
+			generic_command.WithDevMode(cfh.DevMode),
+		),
+	}, cfh.CommandDirectoryOptions...)
+
 	for _, route := range cfh.Config.Routes {
 		if route.Command != nil {
-			return errors.New("command routes are not yet supported")
+			if cfh.CommandLoader == nil {
+				return errors.Errorf("no command loader provided for command route %s", route.Path)
+			}
+
+			ch, err := command.NewCommandHandlerFromConfig(route.Command, cfh.CommandLoader, cfh.CommandOptions...)
+			if err != nil {
+				return err
+			}
+			cfh.addTemplateLookup(ch.TemplateLookup)
+			cfh.watchForLiveReload(route.Command.File)
+			if route.Command.TemplateLookup != nil {
+				cfh.watchForLiveReload(route.Command.TemplateLookup.Directories...)
+			}
+
+			err = ch.Serve(server_, route.Path)
+			if err != nil {
+				return err
+			}
+
+			continue
 		}
 
 		if route.CommandDirectory != nil {
@@ -264,20 +343,8 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 			// because we need to create an app specific repository, but the config file
 			// contains the directories to load commands from.
 
-			if cfh.RepositoryFactory == nil {
-				return ErrNoRepositoryFactory{}
-			}
-
 			// TODO(manuel, 2023-06-22) It would be nicer to do that in the constructor for the handler itself
-			repositories := []string{}
-			if *cd.IncludeDefaultRepositories {
-				repositories = viper.GetStringSlice("repositories")
-			}
-			repositories = append(repositories, cd.Repositories...)
-			// remove duplicates
-			repositories = strings.UniqueStrings(repositories)
-
-			r, err := cfh.RepositoryFactory(repositories)
+			r, err := cfh.createRepository(cd.Repositories, *cd.IncludeDefaultRepositories)
 			if err != nil {
 				return err
 			}
@@ -299,6 +366,10 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 			}
 
 			cfh.commandDirectoryHandlers = append(cfh.commandDirectoryHandlers, cdh)
+			cfh.addTemplateLookup(cdh.TemplateLookup)
+			if cd.TemplateLookup != nil {
+				cfh.watchForLiveReload(cd.TemplateLookup.Directories...)
+			}
 
 			err = cdh.Serve(server_, route.Path)
 			if err != nil {
@@ -308,13 +379,53 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 			continue
 		}
 
+		if route.Dashboard != nil {
+			r, err := cfh.createRepository(route.Dashboard.Repositories, *route.Dashboard.IncludeDefaultRepositories)
+			if err != nil {
+				return err
+			}
+
+			dashboardOptions := []dashboard.DashboardHandlerOption{
+				dashboard.WithRepository(r),
+				dashboard.WithDevMode(cfh.DevMode),
+				dashboard.WithLiveReload(cfh.DevMode),
+			}
+			dashboardOptions = append(dashboardOptions, cfh.DashboardOptions...)
+
+			dh, err := dashboard.NewDashboardHandlerFromConfig(route.Dashboard, dashboardOptions...)
+			if err != nil {
+				return err
+			}
+			cfh.addTemplateLookup(dh.TemplateLookup)
+			if route.Dashboard.TemplateLookup != nil {
+				cfh.watchForLiveReload(route.Dashboard.TemplateLookup.Directories...)
+			}
+
+			err = dh.Serve(server_, route.Path)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		if route.Template != nil {
-			th, err := template.NewTemplateHandlerFromConfig(route.Template, cfh.TemplateOptions...)
+			templateOptions := cfh.TemplateOptions
+			if route.Template.Commands != nil {
+				runner, err := cfh.createCommandRunner(route.Template.Commands, server_.RootPath)
+				if err != nil {
+					return err
+				}
+				templateOptions = append([]template.TemplateHandlerOption{template.WithCommandRunner(runner)}, templateOptions...)
+			}
+
+			th, err := template.NewTemplateHandlerFromConfig(route.Template, templateOptions...)
 			if err != nil {
 				return err
 			}
 
 			cfh.templateHandlers = append(cfh.templateHandlers, th)
+			cfh.watchForLiveReload(route.Template.TemplateFile)
 
 			err = th.Serve(server_, route.Path)
 			if err != nil {
@@ -325,16 +436,32 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 		}
 
 		if route.TemplateDirectory != nil {
+			templateDirectoryOptions := cfh.TemplateDirectoryOptions
+			if route.TemplateDirectory.Commands != nil {
+				runner, err := cfh.createCommandRunner(route.TemplateDirectory.Commands, server_.RootPath)
+				if err != nil {
+					return err
+				}
+				templateDirectoryOptions = append([]template_dir.TemplateDirHandlerOption{
+					template_dir.WithCommandRunner(runner),
+				}, templateDirectoryOptions...)
+			}
+
 			tdh, err := template_dir.NewTemplateDirHandlerFromConfig(
 				route.TemplateDirectory,
-				cfh.TemplateDirectoryOptions...,
+				templateDirectoryOptions...,
 			)
 			if err != nil {
 				return err
 			}
 
-			// NOTE(manuel, 2023-06-20) I don't think we need to keep track of these
+			// the data files of the template directories are reloaded in Watch
 			cfh.templateDirectoryHandlers = append(cfh.templateDirectoryHandlers, tdh)
+			cfh.addTemplateLookup(tdh.TemplateLookup)
+			cfh.watchForLiveReload(route.TemplateDirectory.LocalDirectory)
+			if tdh.DataDirectory != nil {
+				cfh.watchForLiveReload(tdh.DataDirectory.Directory())
+			}
 
 			err = tdh.Serve(server_, route.Path)
 			if err != nil {
@@ -350,6 +477,7 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 			if err != nil {
 				return err
 			}
+			cfh.watchForLiveReload(route.StaticFile.LocalPath)
 
 			continue
 		}
@@ -360,17 +488,141 @@ func (cfh *ConfigFileHandler) Serve(server_ *server.Server) error {
 			if err != nil {
 				return err
 			}
+			cfh.watchForLiveReload(route.Static.LocalPath)
+
+			continue
+		}
+
+		if route.Proxy != nil {
+			ph, err := proxy.NewProxyHandlerFromConfig(route.Proxy, cfh.ProxyOptions...)
+			if err != nil {
+				return err
+			}
+
+			err = ph.Serve(server_, route.Path)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if route.Redirect != nil {
+			rh := redirect.NewRedirectHandlerFromConfig(route.Redirect)
+			err := rh.Serve(server_, route.Path)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if route.Rewrite != nil {
+			// rewrites are not routes per se, but are applied to the request before routing
+			rule, err := server.NewRewriteRule(route.Path, route.Rewrite.Target)
+			if err != nil {
+				return err
+			}
+			server_.AddRewriteRules(rule)
 
 			continue
 		}
 	}
 
+	if cfh.DevMode {
+		reporters := []render.TemplateErrorReporter{}
+		for _, lookup := range cfh.templateLookups {
+			if r, ok := lookup.(render.TemplateErrorReporter); ok {
+				reporters = append(reporters, r)
+			}
+		}
+		server_.Group.GET(render.DevTemplateErrorsPath, render.NewTemplateErrorsHandler(reporters...))
+	}
+
 	return nil
 }
 
+// TemplateDirectoryHandlers returns the handlers of the template directory routes, created by Serve.
+func (cfh *ConfigFileHandler) TemplateDirectoryHandlers() []*template_dir.TemplateDirHandler {
+	return cfh.templateDirectoryHandlers
+}
+
+// watchForLiveReload reloads the browsers when the given files or directories change, in dev mode.
+func (cfh *ConfigFileHandler) watchForLiveReload(paths ...string) {
+	if cfh.liveReload == nil {
+		return
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			log.Warn().Err(err).Str("path", p).Msg("Not watching path for live reload")
+			continue
+		}
+		cfh.liveReload.AddPaths(abs)
+	}
+}
+
+// addTemplateLookup keeps track of the template lookups created by the handlers,
+// a lookup shared by several handlers being only kept once.
+func (cfh *ConfigFileHandler) addTemplateLookup(lookup render.TemplateLookup) {
+	if lookup == nil {
+		return
+	}
+	for _, l := range cfh.templateLookups {
+		if l == lookup {
+			return
+		}
+	}
+	cfh.templateLookups = append(cfh.templateLookups, lookup)
+}
+
+// createRepository creates a repository for the given directories, preceded by the default
+// repositories from the viper config if includeDefaultRepositories is set.
+func (cfh *ConfigFileHandler) createRepository(dirs []string, includeDefaultRepositories bool) (*repositories.Repository, error) {
+	if cfh.RepositoryFactory == nil {
+		return nil, ErrNoRepositoryFactory{}
+	}
+
+	repositories_ := []string{}
+	if includeDefaultRepositories {
+		repositories_ = viper.GetStringSlice("repositories")
+	}
+	repositories_ = append(repositories_, dirs...)
+	// remove duplicates
+	repositories_ = strings.UniqueStrings(repositories_)
+	cfh.watchForLiveReload(repositories_...)
+
+	return cfh.RepositoryFactory(repositories_)
+}
+
+// createCommandRunner creates the runner for the commands available to a template or template directory route.
+// rootPath is the root path of the server, under which the static files drawing the charts are served.
+func (cfh *ConfigFileHandler) createCommandRunner(c *config.TemplateCommands, rootPath string) (*commands.Runner, error) {
+	r, err := cfh.createRepository(c.Repositories, *c.IncludeDefaultRepositories)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []commands.RunnerOption{commands.WithAssetPrefix(rootPath)}
+	if c.Timeout != nil {
+		options = append(options, commands.WithTimeout(*c.Timeout))
+	}
+	if c.CacheDuration != nil {
+		options = append(options, commands.WithCacheDuration(*c.CacheDuration))
+	}
+
+	return commands.NewRunner(r, options...), nil
+}
+
 // Watch watches the config for changes and updates the server accordingly.
 // Because this will register / unregister routes, this will probably need to be handled
 // at a level where we can restart the gin server altogether.
+//
+// It also watches the template directories of the handlers that were created in dev mode,
+// the data files of the template directories, and the files of the routes to reload the browsers.
 func (cfh *ConfigFileHandler) Watch(ctx context.Context) error {
 	errGroup, ctx2 := errgroup.WithContext(ctx)
 	for _, cdh := range cfh.commandDirectoryHandlers {
@@ -379,6 +631,26 @@ func (cfh *ConfigFileHandler) Watch(ctx context.Context) error {
 			return cdh_.Watch(ctx2)
 		})
 	}
+	for _, tdh := range cfh.templateDirectoryHandlers {
+		if tdh.DataDirectory != nil {
+			d := tdh.DataDirectory
+			errGroup.Go(func() error {
+				return d.Watch(ctx2)
+			})
+		}
+	}
+	for _, lookup := range cfh.templateLookups {
+		if w, ok := lookup.(*render.LookupTemplateFromWatchedDirectory); ok {
+			errGroup.Go(func() error {
+				return w.Watch(ctx2)
+			})
+		}
+	}
+	if cfh.liveReload != nil {
+		errGroup.Go(func() error {
+			return cfh.liveReload.Watch(ctx2)
+		})
+	}
 
 	// TODO(manuel, 2023-05-31) What happens if we wait on an empty errgroup?
 	return errGroup.Wait()
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFileHandlerDefaultRenderer(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.tmpl.html"), []byte(`<h1>Custom index</h1>`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs.tmpl.html"), []byte(`<article>{{ .markdown }}</article>`), 0644))
+
+	cfg, err := config.ParseConfig([]byte(`
+routes: []
+defaults:
+  renderer:
+    useDefaultParkaRenderer: true
+    templateDirectory: ` + dir + `
+    markdownBaseTemplateName: docs.tmpl.html
+`))
+	require.NoError(t, err)
+
+	s, err := server.NewServer(server.WithDefaultParkaRenderer())
+	require.NoError(t, err)
+	require.NoError(t, NewConfigFileHandler(cfg).Serve(s))
+
+	e := echo.New()
+	e.GET("/*", s.DefaultRenderer.WithTemplateDirHandler(nil))
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/", expected: "<h1>Custom index</h1>"},
+		// foo is a markdown page of the default parka templates
+		{path: "/foo", expected: "<article><h1>Foo Bar</h1>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Contains(t, resp.Body.String(), tt.expected)
+		})
+	}
+}
+
+func TestConfigFileHandlerTemplateDirectoryLayouts(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "_layout.tmpl.html"), []byte(`<main>{{ block "content" . }}{{ end }}</main>`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page.tmpl.html"), []byte(`<p>page</p>`), 0644))
+
+	tests := []struct {
+		name                 string
+		layouts              string
+		expected             string
+		expectedLayoutServed bool
+	}{
+		{name: "default", layouts: "", expected: "<p>page</p>", expectedLayoutServed: true},
+		{name: "enabled", layouts: "layouts: true", expected: "<main><p>page</p></main>", expectedLayoutServed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.ParseConfig([]byte(`
+routes:
+  - path: /site
+    templateDirectory:
+      localDirectory: ` + dir + `
+      ` + tt.layouts + `
+`))
+			require.NoError(t, err)
+
+			s, err := server.NewServer()
+			require.NoError(t, err)
+			require.NoError(t, NewConfigFileHandler(cfg).Serve(s))
+
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/site/page", nil))
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expected, resp.Body.String())
+
+			// layouts are hidden when they are enabled
+			resp = httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/site/_layout", nil))
+			assert.Equal(t, tt.expectedLayoutServed, resp.Code == http.StatusOK)
+		})
+	}
+}
+
+func TestConfigFileHandlerTemplateDirectoryRootPath(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.tmpl.html"),
+		[]byte(`{{ range .Site.Root.Children }}{{ .URL }};{{ end }}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page.tmpl.html"), []byte(`<p>page</p>`), 0644))
+
+	cfg, err := config.ParseConfig([]byte(`
+routes:
+  - path: /site
+    templateDirectory:
+      localDirectory: ` + dir + `
+`))
+	require.NoError(t, err)
+
+	s, err := server.NewServer(server.WithRootPath("/app"))
+	require.NoError(t, err)
+	require.NoError(t, NewConfigFileHandler(cfg).Serve(s))
+
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/app/site/", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "/app/site/page;", resp.Body.String())
+
+	resp = httptest.NewRecorder()
+	s.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/app/site/sitemap.xml", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "/app/site/page</loc>")
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
@@ -48,6 +51,32 @@ type TemplateLookupConfig struct {
 	Patterns []string `yaml:"patterns,omitempty"`
 }
 
+// NewTemplateLookup creates the lookup for the configured directory. In dev mode, the directory
+// is watched and the templates that change are reloaded, instead of being loaded once.
+func (t *TemplateLookupConfig) NewTemplateLookup(devMode bool) (render.TemplateLookup, error) {
+	patterns := t.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"**/*.tmpl.md", "**/*.tmpl.html"}
+	}
+	// we currently only support a single directory
+	if len(t.Directories) != 1 {
+		return nil, errors.New("template lookup directories must be exactly one")
+	}
+
+	if devMode {
+		return render.NewLookupTemplateFromWatchedDirectory(
+			t.Directories[0],
+			render.WithWatchedPatterns(patterns...),
+		)
+	}
+
+	return render.NewLookupTemplateFromFS(
+		render.WithFS(os.DirFS(t.Directories[0])),
+		render.WithBaseDir(""),
+		render.WithPatterns(patterns...),
+	), nil
+}
+
 // Defaults controls the default renderer and which embedded static files to serve.
 type Defaults struct {
 	Renderer            *DefaultRendererOptions `yaml:"renderer,omitempty"`
@@ -58,18 +87,122 @@ type Defaults struct {
 // If UseDefaultParkaRenderer is true, the default parka renderer will be used.
 // It renders markdown files using base.tmpl.html and uses a tailwind css stylesheet
 // which has to be served under dist/output.css.
+//
+// The templates of TemplateDirectory are looked up before the templates of the default renderer,
+// so that a base.tmpl.html or index.tmpl.html in the directory restyles the markdown and index pages.
 type DefaultRendererOptions struct {
-	UseDefaultParkaRenderer *bool `yaml:"useDefaultParkaRenderer,omitempty"`
-	// TODO(manuel, 2023-06-21) These two options are not implemented yet
-	// It is not so much that they are hard to implement, but rather that they are annoying to test.
-	// See: https://github.com/go-go-golems/parka/issues/56
-	TemplateDirectory        string `yaml:"templateDirectory,omitempty"`
+	UseDefaultParkaRenderer *bool  `yaml:"useDefaultParkaRenderer,omitempty"`
+	TemplateDirectory       string `yaml:"templateDirectory,omitempty"`
+	// MarkdownBaseTemplateName is the template wrapping the rendered markdown pages.
 	MarkdownBaseTemplateName string `yaml:"markdownBaseTemplateName,omitempty"`
+	// Markdown configures how markdown pages are rendered.
+	Markdown *MarkdownOptions `yaml:"markdown,omitempty"`
+}
+
+// DefaultRendererTemplatePatterns are the templates loaded from the template directory of the default renderer.
+var DefaultRendererTemplatePatterns = []string{"**/*.tmpl.*"}
+
+// NewTemplateLookup creates the lookup of the template directory, or returns nil if there is none.
+// In dev mode, the directory is watched and the templates that change are reloaded, instead of being loaded once.
+func (d *DefaultRendererOptions) NewTemplateLookup(devMode bool) (render.TemplateLookup, error) {
+	if d.TemplateDirectory == "" {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(d.TemplateDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	if devMode {
+		return render.NewLookupTemplateFromWatchedDirectory(
+			dir,
+			render.WithWatchedPatterns(DefaultRendererTemplatePatterns...),
+		)
+	}
+
+	lookup := render.NewLookupTemplateFromFS(
+		render.WithFS(os.DirFS(dir)),
+		render.WithPatterns(DefaultRendererTemplatePatterns...),
+	)
+	err = lookup.Reload()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load templates from %s", dir)
+	}
+
+	return lookup, nil
+}
+
+// RendererOptions returns the options applying the defaults to a renderer: the templates of lookup
+// (created by NewTemplateLookup, and which can be nil) take precedence over the templates of the renderer,
+// followed by the markdown base template and the markdown options.
+func (d *DefaultRendererOptions) RendererOptions(lookup render.TemplateLookup) []render.RendererOption {
+	ret := []render.RendererOption{}
+	if lookup != nil {
+		ret = append(ret, render.WithPrependTemplateLookups(lookup))
+	}
+	if d.MarkdownBaseTemplateName != "" {
+		ret = append(ret, render.WithMarkdownBaseTemplateName(d.MarkdownBaseTemplateName))
+	}
+	ret = append(ret, render.WithMarkdownOptions(d.Markdown.MarkdownEngineOptions()...))
+
+	return ret
+}
+
+// MarkdownOptions configures the markdown engine of the renderer, see render.MarkdownEngine.
+// Options that are not set keep the defaults of the engine.
+type MarkdownOptions struct {
+	// HighlightStyle is the chroma style used to highlight code blocks, monokai by default.
+	HighlightStyle  string `yaml:"highlightStyle,omitempty"`
+	LineNumbers     *bool  `yaml:"lineNumbers,omitempty"`
+	HeadingAnchors  *bool  `yaml:"headingAnchors,omitempty"`
+	TOC             *bool  `yaml:"toc,omitempty"`
+	Footnotes       *bool  `yaml:"footnotes,omitempty"`
+	DefinitionLists *bool  `yaml:"definitionLists,omitempty"`
+	TaskLists       *bool  `yaml:"taskLists,omitempty"`
+	Typographer     *bool  `yaml:"typographer,omitempty"`
+	Admonitions     *bool  `yaml:"admonitions,omitempty"`
+	Mermaid         *bool  `yaml:"mermaid,omitempty"`
+	// Sanitize removes scripts and other unsafe HTML from the rendered pages,
+	// for pages written by less trusted authors.
+	Sanitize *bool `yaml:"sanitize,omitempty"`
+}
+
+// MarkdownEngineOptions returns the options of the markdown engine. m can be nil.
+func (m *MarkdownOptions) MarkdownEngineOptions() []render.MarkdownOption {
+	ret := []render.MarkdownOption{}
+	if m == nil {
+		return ret
+	}
+	if m.HighlightStyle != "" {
+		ret = append(ret, render.WithMarkdownHighlightStyle(m.HighlightStyle))
+	}
+	bools := []struct {
+		value  *bool
+		option func(bool) render.MarkdownOption
+	}{
+		{m.LineNumbers, render.WithMarkdownLineNumbers},
+		{m.HeadingAnchors, render.WithMarkdownHeadingAnchors},
+		{m.TOC, render.WithMarkdownTOC},
+		{m.Footnotes, render.WithMarkdownFootnotes},
+		{m.DefinitionLists, render.WithMarkdownDefinitionLists},
+		{m.TaskLists, render.WithMarkdownTaskLists},
+		{m.Typographer, render.WithMarkdownTypographer},
+		{m.Admonitions, render.WithMarkdownAdmonitions},
+		{m.Mermaid, render.WithMarkdownMermaid},
+		{m.Sanitize, render.WithMarkdownSanitizer},
+	}
+	for _, b := range bools {
+		if b.value != nil {
+			ret = append(ret, b.option(*b.value))
+		}
+	}
+	return ret
 }
 
 type Config struct {
 	Routes   []*Route  `yaml:"routes"`
 	Defaults *Defaults `yaml:"defaults,omitempty"`
+	Export   *Export   `yaml:"export,omitempty"`
 }
 
 func boolPtr(b bool) *bool {
@@ -120,10 +253,20 @@ func (cfg *Config) Initialize() error {
 			if cfg.Defaults.Renderer.TemplateDirectory != "" {
 				cfg.Defaults.Renderer.TemplateDirectory = expandPath(cfg.Defaults.Renderer.TemplateDirectory)
 			}
+
+			// fail when loading the config rather than on the first request
+			_, err := render.NewMarkdownEngine(cfg.Defaults.Renderer.Markdown.MarkdownEngineOptions()...)
+			if err != nil {
+				return errors.Wrap(err, "invalid markdown options")
+			}
 		}
 	}
 	var err error
 	for _, route := range cfg.Routes {
+		err = route.ValidatePathParameters()
+		if err != nil {
+			return err
+		}
 		if route.CommandDirectory != nil {
 			err = route.CommandDirectory.ExpandPaths()
 			if err != nil {
@@ -160,7 +303,31 @@ func (cfg *Config) Initialize() error {
 				return err
 			}
 		}
+		if route.Proxy != nil {
+			err = route.Proxy.ExpandPaths()
+			if err != nil {
+				return err
+			}
+		}
+		if route.Redirect != nil {
+			err = route.Redirect.ExpandPaths()
+			if err != nil {
+				return err
+			}
+		}
+		if route.Rewrite != nil {
+			err = route.Rewrite.ExpandPaths()
+			if err != nil {
+				return err
+			}
+		}
+		if route.Dashboard != nil {
+			err = route.Dashboard.ExpandPaths()
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	return nil
+	return cfg.Export.Validate()
 }
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigMarkdownOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected int
+		err      bool
+	}{
+		{
+			name:     "no markdown options",
+			config:   "routes: []\n",
+			expected: 0,
+		},
+		{
+			name: "markdown options",
+			config: `
+routes: []
+defaults:
+  renderer:
+    markdown:
+      highlightStyle: github
+      toc: true
+      headingAnchors: true
+      mermaid: false
+      sanitize: true
+`,
+			expected: 5,
+		},
+		{
+			name: "unknown highlight style",
+			config: `
+routes: []
+defaults:
+  renderer:
+    markdown:
+      highlightStyle: no-such-style
+`,
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tt.config))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, cfg.Defaults.Renderer.Markdown.MarkdownEngineOptions(), tt.expected)
+		})
+	}
+}
+
+var defaultRendererFS = fstest.MapFS{
+	"base.tmpl.html":  {Data: []byte(`<main class="custom">{{ .markdown }}</main>`)},
+	"site.tmpl.html":  {Data: []byte(`<main class="site">{{ .markdown }}</main>`)},
+	"index.tmpl.html": {Data: []byte(`<h1>Custom index</h1>`)},
+	"about.tmpl.md":   {Data: []byte("# About\n")},
+}
+
+func TestDefaultRendererOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  *DefaultRendererOptions
+		lookup   bool
+		path     string
+		contains []string
+	}{
+		{
+			name:     "parka index",
+			options:  &DefaultRendererOptions{},
+			path:     "/",
+			contains: []string{"Garlic bread with cheese"},
+		},
+		{
+			name:     "parka base template",
+			options:  &DefaultRendererOptions{},
+			path:     "/foo",
+			contains: []string{`<link rel="stylesheet" href="/dist/output.css"/>`, "<h1>Foo Bar</h1>"},
+		},
+		{
+			name:     "index of the template directory",
+			options:  &DefaultRendererOptions{},
+			lookup:   true,
+			path:     "/",
+			contains: []string{"<h1>Custom index</h1>"},
+		},
+		{
+			name:     "base template of the template directory",
+			options:  &DefaultRendererOptions{},
+			lookup:   true,
+			path:     "/foo",
+			contains: []string{`<main class="custom"><h1>Foo Bar</h1>`},
+		},
+		{
+			name:     "pages of the template directory",
+			options:  &DefaultRendererOptions{},
+			lookup:   true,
+			path:     "/about",
+			contains: []string{`<main class="custom"><h1>About</h1>`},
+		},
+		{
+			name:     "markdown base template name",
+			options:  &DefaultRendererOptions{MarkdownBaseTemplateName: "site.tmpl.html"},
+			lookup:   true,
+			path:     "/about",
+			contains: []string{`<main class="site"><h1>About</h1>`},
+		},
+		{
+			name: "markdown options",
+			options: &DefaultRendererOptions{
+				Markdown: &MarkdownOptions{HeadingAnchors: boolPtr(true)},
+			},
+			lookup:   true,
+			path:     "/about",
+			contains: []string{`<h1 id="about">About<a href="#about" class="anchor">#</a></h1>`},
+		},
+	}
+
+	for _, tt := range tests {
+		var lookup render.TemplateLookup
+		if tt.lookup {
+			l := render.NewLookupTemplateFromFS(
+				render.WithFS(defaultRendererFS),
+				render.WithPatterns(DefaultRendererTemplatePatterns...),
+			)
+			require.NoError(t, l.Reload())
+			lookup = l
+		}
+
+		// the options are either passed when creating the default renderer,
+		// or applied to the default renderer of an existing server
+		newServers := map[string]func() (*server.Server, error){
+			"create": func() (*server.Server, error) {
+				return server.NewServer(server.WithDefaultParkaRenderer(tt.options.RendererOptions(lookup)...))
+			},
+			"configure": func() (*server.Server, error) {
+				s, err := server.NewServer(server.WithDefaultParkaRenderer())
+				if err != nil {
+					return nil, err
+				}
+				return s, s.DefaultRenderer.Configure(tt.options.RendererOptions(lookup)...)
+			},
+		}
+		for name, newServer := range newServers {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				s, err := newServer()
+				require.NoError(t, err)
+
+				e := echo.New()
+				e.GET("/*", s.DefaultRenderer.WithTemplateDirHandler(nil))
+				resp := httptest.NewRecorder()
+				e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				assert.Equal(t, http.StatusOK, resp.Code)
+				for _, c := range tt.contains {
+					assert.Contains(t, resp.Body.String(), c)
+				}
+			})
+		}
+	}
+}
+
+func TestDefaultRendererOptionsNewTemplateLookup(t *testing.T) {
+	lookup, err := (&DefaultRendererOptions{}).NewTemplateLookup(false)
+	require.NoError(t, err)
+	assert.Nil(t, lookup)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.tmpl.html"), []byte(`{{ .markdown }}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.md"), []byte("# Notes\n"), 0644))
+
+	for _, devMode := range []bool{false, true} {
+		lookup, err := (&DefaultRendererOptions{TemplateDirectory: dir}).NewTemplateLookup(devMode)
+		require.NoError(t, err)
+		_, err = lookup.Lookup("base.tmpl.html")
+		assert.NoError(t, err)
+		// only templates are loaded from the directory
+		_, err = lookup.Lookup("notes.md")
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/pkg/errors"
+)
+
+// Dashboard represents the config file entry for a dashboard route, which renders the results
+// of several commands side by side, sharing one parameter form.
+type Dashboard struct {
+	Title       string `yaml:"title,omitempty"`
+	Description string `yaml:"description,omitempty"`
+
+	// Repositories are the directories the panel commands are loaded from.
+	Repositories               []string `yaml:"repositories"`
+	IncludeDefaultRepositories *bool    `yaml:"includeDefaultRepositories"`
+
+	// Inputs are the fields of the shared parameter form, set through query parameters of the same name.
+	Inputs []*DashboardInput `yaml:"inputs,omitempty"`
+	Panels []*DashboardPanel `yaml:"panels"`
+
+	// Timeout limits how long each panel command can run, for example `30s`.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	TemplateLookup *TemplateLookupConfig `yaml:"templateLookup,omitempty"`
+	TemplateName   string                `yaml:"templateName,omitempty"`
+
+	AdditionalData map[string]interface{} `yaml:"additionalData,omitempty"`
+}
+
+// DashboardInput is a field of the shared parameter form of a dashboard.
+type DashboardInput struct {
+	Name  string `yaml:"name"`
+	Label string `yaml:"label,omitempty"`
+	// Type is `text` (the default), `date`, `number` or `select`.
+	Type    string `yaml:"type,omitempty"`
+	Default string `yaml:"default,omitempty"`
+	// Options are the choices of select inputs.
+	Options []string `yaml:"options,omitempty"`
+}
+
+// DashboardPanel is a command rendered on a dashboard.
+type DashboardPanel struct {
+	Title string `yaml:"title,omitempty"`
+	// Command is the path of the command in the dashboard repositories, for example `sales/revenue`.
+	Command string `yaml:"command"`
+
+	// Inputs maps the dashboard inputs to command parameters, given as `param` for the default layer
+	// or `layer.param`. Empty inputs are not passed to the command.
+	Inputs map[string]string `yaml:"inputs,omitempty"`
+	// Values sets fixed command parameters, given as `param` or `layer.param`.
+	// Mapped inputs take precedence over values.
+	Values map[string]interface{} `yaml:"values,omitempty"`
+
+	// Display is `table` (the default), `chart` or `value`.
+	Display string `yaml:"display,omitempty"`
+	// Chart describes the chart of chart panels.
+	Chart *datatables.Chart `yaml:"chart,omitempty"`
+	// Value is the column shown by value panels, taken from the first row.
+	Value string `yaml:"value,omitempty"`
+	// Limit is the maximum number of rows shown by table panels, DefaultDashboardPanelLimit by default.
+	Limit int `yaml:"limit,omitempty"`
+
+	Columns columns.Columns `yaml:"columns,omitempty"`
+
+	// Size is the width of the panel: `full` (the default), `half`, `third`, `two-thirds` or `quarter`.
+	Size string `yaml:"size,omitempty"`
+}
+
+// DefaultDashboardPanelLimit is the number of rows shown by table panels without a limit.
+const DefaultDashboardPanelLimit = 100
+
+func (d *Dashboard) ExpandPaths() error {
+	var err error
+
+	inputs := map[string]bool{}
+	for _, input := range d.Inputs {
+		if input.Name == "" {
+			return errors.New("dashboard input without name")
+		}
+		if inputs[input.Name] {
+			return errors.Errorf("duplicate dashboard input %s", input.Name)
+		}
+		inputs[input.Name] = true
+
+		switch input.Type {
+		case "":
+			input.Type = "text"
+		case "text", "date", "number":
+		case "select":
+			if len(input.Options) == 0 {
+				return errors.Errorf("select input %s has no options", input.Name)
+			}
+		default:
+			return errors.Errorf("unknown type %s for dashboard input %s, expected text, date, number or select", input.Type, input.Name)
+		}
+	}
+
+	if len(d.Panels) == 0 {
+		return errors.New("dashboard has no panels")
+	}
+	for i, panel := range d.Panels {
+		err = panel.validate(inputs)
+		if err != nil {
+			return errors.Wrapf(err, "invalid panel %d", i)
+		}
+
+		evaluatedValues, err := EvaluateConfigEntry(panel.Values)
+		if err != nil {
+			return err
+		}
+		panel.Values = evaluatedValues.(map[string]interface{})
+	}
+
+	if d.TemplateLookup != nil {
+		d.TemplateLookup.Directories, err = expandPaths(d.TemplateLookup.Directories)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.IncludeDefaultRepositories == nil {
+		d.IncludeDefaultRepositories = boolPtr(true)
+	}
+
+	repositories, err := expandPaths(d.Repositories)
+	if err != nil {
+		return err
+	}
+
+	if len(repositories) == 0 && !*d.IncludeDefaultRepositories {
+		return errors.Errorf("no repositories found: %s", strings.Join(repositories, ", "))
+	}
+	d.Repositories = repositories
+
+	evaluatedData, err := EvaluateConfigEntry(d.AdditionalData)
+	if err != nil {
+		return err
+	}
+	d.AdditionalData = evaluatedData.(map[string]interface{})
+
+	return nil
+}
+
+func (p *DashboardPanel) validate(inputs map[string]bool) error {
+	if p.Command == "" {
+		return errors.New("panel without command")
+	}
+
+	for name := range p.Inputs {
+		if !inputs[name] {
+			return errors.Errorf("unknown dashboard input %s", name)
+		}
+	}
+	err := validateParameterMapping("dashboard input", p.Inputs)
+	if err != nil {
+		return err
+	}
+	for target := range p.Values {
+		if target == "" || strings.HasPrefix(target, ".") || strings.HasSuffix(target, ".") {
+			return errors.Errorf("invalid parameter %s in values of panel %s", target, p.Command)
+		}
+	}
+
+	switch p.Display {
+	case "":
+		p.Display = "table"
+	case "table":
+	case "chart":
+		if p.Chart == nil {
+			return errors.Errorf("chart panel %s has no chart", p.Command)
+		}
+		err = p.Chart.Validate()
+		if err != nil {
+			return err
+		}
+	case "value":
+		if p.Value == "" {
+			return errors.Errorf("value panel %s has no value column", p.Command)
+		}
+	default:
+		return errors.Errorf("unknown display %s for panel %s, expected table, chart or value", p.Display, p.Command)
+	}
+
+	switch p.Size {
+	case "":
+		p.Size = "full"
+	case "full", "half", "third", "two-thirds", "quarter":
+	default:
+		return errors.Errorf("unknown size %s for panel %s, expected full, half, third, two-thirds or quarter", p.Size, p.Command)
+	}
+
+	if p.Limit < 0 {
+		return errors.Errorf("invalid limit %d for panel %s", p.Limit, p.Command)
+	}
+	if p.Limit == 0 {
+		p.Limit = DefaultDashboardPanelLimit
+	}
+
+	return p.Columns.Validate()
+}
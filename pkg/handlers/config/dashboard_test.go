@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDashboardExpandPaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		yaml          string
+		expectedError bool
+	}{
+		{
+			name: "valid",
+			yaml: `
+inputs:
+  - name: from
+    type: date
+panels:
+  - command: sales/revenue
+    inputs:
+      from: filters.since
+    display: chart
+    chart: {type: line, x: day, y: revenue}
+    size: half
+`,
+		},
+		{name: "no panels", yaml: `inputs: [{name: from}]`, expectedError: true},
+		{name: "unknown input", yaml: `panels: [{command: a, inputs: {to: until}}]`, expectedError: true},
+		{name: "invalid target", yaml: `{inputs: [{name: to}], panels: [{command: a, inputs: {to: "filters."}}]}`, expectedError: true},
+		{name: "chart without chart", yaml: `panels: [{command: a, display: chart}]`, expectedError: true},
+		{name: "value without column", yaml: `panels: [{command: a, display: value}]`, expectedError: true},
+		{name: "unknown size", yaml: `panels: [{command: a, size: huge}]`, expectedError: true},
+		{name: "select without options", yaml: `{inputs: [{name: region, type: select}], panels: [{command: a}]}`, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Dashboard{}
+			require.NoError(t, yaml.Unmarshal([]byte(tt.yaml), d))
+			err := d.ExpandPaths()
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, DefaultDashboardPanelLimit, d.Panels[0].Limit)
+			assert.True(t, *d.IncludeDefaultRepositories)
+		})
+	}
+}
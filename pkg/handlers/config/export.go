@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Export configures the static export of the routes of the config file, see pkg/export.
+type Export struct {
+	// Commands declares the parameter combinations commands are exported with,
+	// in addition to their default parameters.
+	Commands []*ExportCommand `yaml:"commands,omitempty"`
+}
+
+// ExportCommand declares the parameter combinations of the command page at Path, which is the path
+// of a command route, or `<path>/datatables/<command>` for a command of a command directory route.
+type ExportCommand struct {
+	Path string `yaml:"path"`
+	// Parameters are the query parameters of each exported combination, for example `region: north`.
+	// List values are passed separated by commas.
+	Parameters []map[string]interface{} `yaml:"parameters"`
+}
+
+func (e *Export) Validate() error {
+	if e == nil {
+		return nil
+	}
+	for _, c := range e.Commands {
+		if c.Path == "" || !strings.HasPrefix(c.Path, "/") {
+			return errors.Errorf("export command path %q must start with /", c.Path)
+		}
+	}
+	return nil
+}
+
+// URLs returns the URL of the command page for each parameter combination.
+func (c *ExportCommand) URLs() []string {
+	ret := []string{}
+	for _, parameters := range c.Parameters {
+		query := url.Values{}
+		for k, v := range parameters {
+			query.Set(k, formatQueryValue(v))
+		}
+		ret = append(ret, c.Path+"?"+query.Encode())
+	}
+	return ret
+}
+
+func formatQueryValue(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, v_ := range v {
+			values = append(values, formatQueryValue(v_))
+		}
+		return strings.Join(values, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigExport(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        string
+		expected      []string
+		expectedError bool
+	}{
+		{name: "no export", config: "routes: []\n"},
+		{
+			name: "parameter combinations",
+			config: `
+routes: []
+export:
+  commands:
+    - path: /reports/datatables/sales/orders
+      parameters:
+        - region: north
+          limit: 10
+        - region: south
+          status: [open, closed]
+`,
+			expected: []string{
+				"/reports/datatables/sales/orders?limit=10&region=north",
+				"/reports/datatables/sales/orders?region=south&status=open%2Cclosed",
+			},
+		},
+		{
+			name:          "relative path",
+			config:        "routes: []\nexport: {commands: [{path: reports/sales}]}\n",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tt.config))
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			urls := []string{}
+			if cfg.Export != nil {
+				for _, c := range cfg.Export.Commands {
+					urls = append(urls, c.URLs()...)
+				}
+			}
+			assert.ElementsMatch(t, tt.expected, urls)
+		})
+	}
+}
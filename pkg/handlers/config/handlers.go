@@ -1,8 +1,12 @@
 package config
 
 import (
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/go-go-golems/parka/pkg/render/layout"
 	"github.com/pkg/errors"
+	"net/http"
 	"strings"
+	"time"
 )
 
 // CommandDir represents the config file entry for a command directory route.
@@ -22,12 +26,55 @@ type CommandDir struct {
 	Blacklist *ParameterFilterList `yaml:"blackList,omitempty"`
 	Whitelist *ParameterFilterList `yaml:"whiteList,omitempty"`
 
+	// PathParameters maps the path parameters declared in the route path to command parameters,
+	// given as `param` for the default layer or `layer.param`.
+	PathParameters map[string]string `yaml:"pathParameters,omitempty"`
+	// HeaderParameters and CookieParameters map request headers and cookies to command parameters.
+	HeaderParameters map[string]string `yaml:"headerParameters,omitempty"`
+	CookieParameters map[string]string `yaml:"cookieParameters,omitempty"`
+
+	// Layout configures the form rendered for the commands of the directory.
+	// Command sections referenced by the layout can be set through query parameters.
+	Layout *layout.FormLayout `yaml:"layout,omitempty"`
+
+	// LiveUpdates updates the results of the datatables pages in place when the form changes,
+	// and AutoRefresh re-runs the commands at the given interval (for example `30s`).
+	LiveUpdates bool          `yaml:"liveUpdates,omitempty"`
+	AutoRefresh time.Duration `yaml:"autoRefresh,omitempty"`
+
+	// Virtualize renders virtualized datatables pages for large results, which load
+	// PageSize rows at a time and sort and filter on the server.
+	Virtualize bool `yaml:"virtualize,omitempty"`
+	PageSize   int  `yaml:"pageSize,omitempty"`
+
+	// Columns configures the presentation of the result columns: number and date formats,
+	// conditional CSS classes and links to other commands.
+	Columns columns.Columns `yaml:"columns,omitempty"`
+
 	Stream *bool `yaml:"stream,omitempty"`
 }
 
 func (c *CommandDir) ExpandPaths() error {
 	var err error
 
+	err = validateParameterMapping("header", c.HeaderParameters)
+	if err != nil {
+		return err
+	}
+	err = validateParameterMapping("cookie", c.CookieParameters)
+	if err != nil {
+		return err
+	}
+	err = c.Layout.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = c.Columns.Validate()
+	if err != nil {
+		return err
+	}
+
 	if c.TemplateLookup != nil {
 		c.TemplateLookup.Directories, err = expandPaths(c.TemplateLookup.Directories)
 		if err != nil {
@@ -85,12 +132,62 @@ type Command struct {
 	Whitelist      *ParameterFilterList   `yaml:"whitelist,omitempty"`
 	Blacklist      *ParameterFilterList   `yaml:"blacklist,omitempty"`
 
+	// PathParameters maps the path parameters declared in the route path (for example `:id` in
+	// `/customers/:id/orders`) to command parameters, given as `param` for the default layer or `layer.param`.
+	// Path parameters that are not mapped are bound to the parameter of the same name in the default layer.
+	PathParameters map[string]string `yaml:"pathParameters,omitempty"`
+	// HeaderParameters maps request headers (for example `X-Region`) to command parameters,
+	// and CookieParameters maps cookies to command parameters, using the same syntax as PathParameters.
+	// Query parameters take precedence over headers, which take precedence over cookies.
+	HeaderParameters map[string]string `yaml:"headerParameters,omitempty"`
+	CookieParameters map[string]string `yaml:"cookieParameters,omitempty"`
+
+	// Layout configures the form rendered for the command, overriding the layout of the command itself:
+	// which sections and fields are shown, how they are grouped into rows, and input overrides.
+	Layout *layout.FormLayout `yaml:"layout,omitempty"`
+
+	// LiveUpdates updates the results of the datatables page in place when the form changes,
+	// and AutoRefresh re-runs the command at the given interval (for example `30s`).
+	LiveUpdates bool          `yaml:"liveUpdates,omitempty"`
+	AutoRefresh time.Duration `yaml:"autoRefresh,omitempty"`
+
+	// Virtualize renders a virtualized datatables page for large results, which loads
+	// PageSize rows at a time and sorts and filters on the server.
+	Virtualize bool `yaml:"virtualize,omitempty"`
+	PageSize   int  `yaml:"pageSize,omitempty"`
+
+	// Columns configures the presentation of the result columns: number and date formats,
+	// conditional CSS classes and links to other commands.
+	Columns columns.Columns `yaml:"columns,omitempty"`
+
 	Stream *bool `yaml:"stream,omitempty"`
 }
 
 func (c *Command) ExpandPaths() error {
 	c.File = expandPath(c.File)
 
+	err := validateParameterMapping("header", c.HeaderParameters)
+	if err != nil {
+		return err
+	}
+	err = validateParameterMapping("cookie", c.CookieParameters)
+	if err != nil {
+		return err
+	}
+	err = c.Layout.Validate()
+	if err != nil {
+		return err
+	}
+	// the commands of options sources are looked up in the repository of a command directory
+	if c.Layout != nil && len(c.Layout.OptionsSources) > 0 {
+		return errors.New("layout options sources are only supported on commandDirectory routes")
+	}
+
+	err = c.Columns.Validate()
+	if err != nil {
+		return err
+	}
+
 	evaluatedData, err := EvaluateConfigEntry(c.AdditionalData)
 	if err != nil {
 		return err
@@ -147,10 +244,66 @@ type TemplateDir struct {
 	LocalDirectory    string                 `yaml:"localDirectory"`
 	IndexTemplateName string                 `yaml:"indexTemplateName,omitempty"`
 	AdditionalData    map[string]interface{} `yaml:"additionalData,omitempty"`
+	// DataDirectory is the directory of YAML, JSON and CSV files exposed to the templates as `.Data`,
+	// relative to LocalDirectory. It defaults to `data`.
+	DataDirectory string `yaml:"dataDirectory,omitempty"`
+	// BaseURL is the scheme and host of the absolute URLs of the sitemap and the RSS feed,
+	// for example `https://example.com`. It defaults to the URL of the request.
+	BaseURL string `yaml:"baseURL,omitempty"`
+	// Layouts renders the pages into the `_layout.tmpl.html` of their nearest ancestor directory,
+	// and hides the files and directories starting with `_`.
+	Layouts bool `yaml:"layouts,omitempty"`
+	// Commands makes commands available to the templates and markdown pages.
+	Commands *TemplateCommands `yaml:"commands,omitempty"`
+}
+
+// TemplateCommands configures the commands that templates can run with the `command`, `commandTable`
+// and `commandChart` functions, and that markdown pages can embed with `parka-command` code blocks.
+type TemplateCommands struct {
+	Repositories               []string `yaml:"repositories"`
+	IncludeDefaultRepositories *bool    `yaml:"includeDefaultRepositories"`
+	// Timeout limits how long a command can run, 30s by default.
+	Timeout *time.Duration `yaml:"timeout,omitempty"`
+	// CacheDuration is how long the results of a command are reused for the same parameters, 1m by default.
+	CacheDuration *time.Duration `yaml:"cacheDuration,omitempty"`
+}
+
+func (t *TemplateCommands) ExpandPaths() error {
+	if t == nil {
+		return nil
+	}
+
+	if t.IncludeDefaultRepositories == nil {
+		t.IncludeDefaultRepositories = boolPtr(true)
+	}
+
+	repositories, err := expandPaths(t.Repositories)
+	if err != nil {
+		return err
+	}
+	if len(repositories) == 0 && !*t.IncludeDefaultRepositories {
+		return errors.Errorf("no repositories found: %s", strings.Join(t.Repositories, ", "))
+	}
+	t.Repositories = repositories
+
+	if t.Timeout != nil && *t.Timeout < 0 {
+		return errors.Errorf("invalid timeout %s", *t.Timeout)
+	}
+	if t.CacheDuration != nil && *t.CacheDuration < 0 {
+		return errors.Errorf("invalid cache duration %s", *t.CacheDuration)
+	}
+
+	return nil
 }
 
 func (t *TemplateDir) ExpandPaths() error {
 	t.LocalDirectory = expandPath(t.LocalDirectory)
+	t.DataDirectory = expandPath(t.DataDirectory)
+
+	err := t.Commands.ExpandPaths()
+	if err != nil {
+		return err
+	}
 
 	evaluatedData, err := EvaluateConfigEntry(t.AdditionalData)
 	if err != nil {
@@ -166,11 +319,18 @@ type Template struct {
 	// content.
 	TemplateFile   string                 `yaml:"templateFile"`
 	AdditionalData map[string]interface{} `yaml:"additionalData,omitempty"`
+	// Commands makes commands available to the template.
+	Commands *TemplateCommands `yaml:"commands,omitempty"`
 }
 
 func (t *Template) ExpandPaths() error {
 	t.TemplateFile = expandPath(t.TemplateFile)
 
+	err := t.Commands.ExpandPaths()
+	if err != nil {
+		return err
+	}
+
 	evaluatedData, err := EvaluateConfigEntry(t.AdditionalData)
 	if err != nil {
 		return err
@@ -179,3 +339,109 @@ func (t *Template) ExpandPaths() error {
 
 	return nil
 }
+
+// PathRewrite rewrites the path forwarded to the upstream. From is a regular expression
+// matched against the request path (after the route prefix has been stripped), To is the
+// replacement, and can reference capture groups as $1, ${name}, etc...
+type PathRewrite struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// Proxy forwards every request under the route path to an upstream server.
+//
+// Upstream is either an HTTP(S) URL (http://localhost:8081/app) or a unix socket
+// given as unix:///var/run/app.sock. Headers values go through the config evaluators,
+// which means they can be read from the environment or SSM.
+type Proxy struct {
+	Upstream string `yaml:"upstream"`
+
+	// StripPrefix removes the route path before forwarding the request. Defaults to true.
+	StripPrefix  *bool         `yaml:"stripPrefix,omitempty"`
+	PathRewrites []PathRewrite `yaml:"pathRewrites,omitempty"`
+	// PreserveHost forwards the incoming Host header instead of the upstream host.
+	PreserveHost bool `yaml:"preserveHost,omitempty"`
+
+	Headers map[string]interface{} `yaml:"headers,omitempty"`
+	// RemoveHeaders lists request headers that are removed before forwarding.
+	RemoveHeaders []string `yaml:"removeHeaders,omitempty"`
+
+	// Timeout is the maximum time to wait for the upstream response headers (e.g. "30s").
+	// The body itself is streamed and not subject to the timeout.
+	Timeout string `yaml:"timeout,omitempty"`
+	// DialTimeout is the maximum time to establish a connection to the upstream.
+	DialTimeout string `yaml:"dialTimeout,omitempty"`
+}
+
+func (p *Proxy) ExpandPaths() error {
+	if p.Upstream == "" {
+		return errors.New("proxy upstream must be set")
+	}
+
+	if strings.HasPrefix(p.Upstream, "unix://") {
+		p.Upstream = "unix://" + expandPath(strings.TrimPrefix(p.Upstream, "unix://"))
+	}
+
+	if p.StripPrefix == nil {
+		p.StripPrefix = boolPtr(true)
+	}
+
+	evaluatedHeaders, err := EvaluateConfigEntry(p.Headers)
+	if err != nil {
+		return err
+	}
+	p.Headers = evaluatedHeaders.(map[string]interface{})
+
+	return nil
+}
+
+// Redirect sends the client to Target when the route path matches.
+//
+// The route path can capture path segments with `:name` and the remainder of the path with a trailing `*`.
+// A route path without a trailing `*` only matches exactly.
+// Target references the captured segments as `{name}` and the remainder as `{*}`, for example:
+//
+//	path: /reports/:year/*
+//	redirect:
+//	  target: /analytics/{year}/{*}
+type Redirect struct {
+	Target string `yaml:"target"`
+	// StatusCode is the HTTP status code of the redirect, one of 301, 302, 303, 307 and 308. 302 if not set.
+	StatusCode int `yaml:"statusCode,omitempty"`
+	// PreserveQuery appends the query string of the request to the target. Defaults to true.
+	PreserveQuery *bool `yaml:"preserveQuery,omitempty"`
+}
+
+func (r *Redirect) ExpandPaths() error {
+	if r.Target == "" {
+		return errors.New("redirect target must be set")
+	}
+	if r.StatusCode == 0 {
+		r.StatusCode = http.StatusFound
+	}
+	switch r.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return errors.Errorf("invalid redirect status code %d", r.StatusCode)
+	}
+	if r.PreserveQuery == nil {
+		r.PreserveQuery = boolPtr(true)
+	}
+
+	return nil
+}
+
+// Rewrite internally rewrites requests matching the route path to Target, before route matching.
+// The path and target are matched and expanded like the ones of Redirect. The client does not see the rewritten URL.
+type Rewrite struct {
+	Target string `yaml:"target"`
+}
+
+func (r *Rewrite) ExpandPaths() error {
+	if r.Target == "" {
+		return errors.New("rewrite target must be set")
+	}
+
+	return nil
+}
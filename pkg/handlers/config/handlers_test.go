@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCommandExpandPaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		yaml          string
+		expectedError bool
+	}{
+		{name: "layout", yaml: `{file: cmd.yaml, layout: {sections: [{section: default}]}}`},
+		{
+			name:          "options sources",
+			yaml:          `{file: cmd.yaml, layout: {optionsSources: {customer: {command: customers, value: id}}}}`,
+			expectedError: true,
+		},
+		{name: "invalid header mapping", yaml: `{file: cmd.yaml, headerParameters: {X-Region: "filters."}}`, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Command{}
+			require.NoError(t, yaml.Unmarshal([]byte(tt.yaml), c))
+			err := c.ExpandPaths()
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRedirectExpandPaths(t *testing.T) {
+	tests := []struct {
+		statusCode    int
+		expectedError bool
+	}{
+		{statusCode: 0},
+		{statusCode: 301},
+		{statusCode: 303},
+		{statusCode: 307},
+		{statusCode: 308},
+		{statusCode: 200, expectedError: true},
+		{statusCode: 300, expectedError: true},
+		{statusCode: 304, expectedError: true},
+		{statusCode: 306, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.statusCode), func(t *testing.T) {
+			r := &Redirect{Target: "/new", StatusCode: tt.statusCode}
+			err := r.ExpandPaths()
+			if tt.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
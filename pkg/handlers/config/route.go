@@ -1,5 +1,11 @@
 package config
 
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
 // Route represents a single sub-route of the server.
 // Only one of the booleans or one of the pointers should be true or non-nil.
 // This is the first attempt at the structure of a config file, and is bound to change.
@@ -11,6 +17,10 @@ type Route struct {
 	StaticFile        *StaticFile  `yaml:"staticFile,omitempty"`
 	TemplateDirectory *TemplateDir `yaml:"templateDirectory,omitempty"`
 	Template          *Template    `yaml:"template,omitempty"`
+	Proxy             *Proxy       `yaml:"proxy,omitempty"`
+	Redirect          *Redirect    `yaml:"redirect,omitempty"`
+	Rewrite           *Rewrite     `yaml:"rewrite,omitempty"`
+	Dashboard         *Dashboard   `yaml:"dashboard,omitempty"`
 }
 
 // RouteHandlerConfiguration is the interface that all route handler configurations must implement.
@@ -23,6 +33,10 @@ func (r *Route) HandlesCommand() bool {
 	return r.Command != nil || r.CommandDirectory != nil
 }
 
+func (r *Route) HandlesDashboard() bool {
+	return r.Dashboard != nil
+}
+
 func (r *Route) HandlesStatic() bool {
 	return r.Static != nil || r.StaticFile != nil
 }
@@ -31,6 +45,14 @@ func (r *Route) HandlesTemplate() bool {
 	return r.Template != nil || r.TemplateDirectory != nil
 }
 
+func (r *Route) HandlesProxy() bool {
+	return r.Proxy != nil
+}
+
+func (r *Route) HandlesRedirect() bool {
+	return r.Redirect != nil || r.Rewrite != nil
+}
+
 func (r *Route) IsCommandRoute() bool {
 	return r.Command != nil
 }
@@ -54,3 +76,64 @@ func (r *Route) IsTemplateRoute() bool {
 func (r *Route) IsTemplateDirRoute() bool {
 	return r.TemplateDirectory != nil
 }
+
+func (r *Route) IsProxyRoute() bool {
+	return r.Proxy != nil
+}
+
+func (r *Route) IsRedirectRoute() bool {
+	return r.Redirect != nil
+}
+
+func (r *Route) IsRewriteRoute() bool {
+	return r.Rewrite != nil
+}
+
+func (r *Route) IsDashboardRoute() bool {
+	return r.Dashboard != nil
+}
+
+// PathParameterNames returns the names of the `:name` path parameters declared in the route path.
+func (r *Route) PathParameterNames() []string {
+	ret := []string{}
+	for _, segment := range strings.Split(r.Path, "/") {
+		if strings.HasPrefix(segment, ":") && len(segment) > 1 {
+			ret = append(ret, segment[1:])
+		}
+	}
+	return ret
+}
+
+// ValidatePathParameters checks that the path parameters mapped by command and command directory routes
+// are declared in the route path.
+func (r *Route) ValidatePathParameters() error {
+	var mapping map[string]string
+	if r.Command != nil {
+		mapping = r.Command.PathParameters
+	} else if r.CommandDirectory != nil {
+		mapping = r.CommandDirectory.PathParameters
+	}
+
+	names := map[string]bool{}
+	for _, name := range r.PathParameterNames() {
+		names[name] = true
+	}
+	for name := range mapping {
+		if !names[name] {
+			return errors.Errorf("path parameter %s is not declared in route path %s", name, r.Path)
+		}
+	}
+
+	return validateParameterMapping("path parameter", mapping)
+}
+
+// validateParameterMapping checks that the targets of a mapping from request values to command parameters
+// are of the form `param` or `layer.param`.
+func validateParameterMapping(kind string, mapping map[string]string) error {
+	for name, target := range mapping {
+		if target == "" || strings.HasPrefix(target, ".") || strings.HasSuffix(target, ".") {
+			return errors.Errorf("invalid target %s for %s %s", target, kind, name)
+		}
+	}
+	return nil
+}
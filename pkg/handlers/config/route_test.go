@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutePathParameterNames(t *testing.T) {
+	r := &Route{Path: "/customers/:id/orders/:order/*"}
+	assert.Equal(t, []string{"id", "order"}, r.PathParameterNames())
+}
+
+func TestRouteValidatePathParameters(t *testing.T) {
+	r := &Route{
+		Path: "/customers/:id/orders",
+		Command: &Command{
+			PathParameters: map[string]string{"id": "filter.customer-id"},
+		},
+	}
+	assert.NoError(t, r.ValidatePathParameters())
+
+	r.Command.PathParameters = map[string]string{"customer": "customer-id"}
+	assert.Error(t, r.ValidatePathParameters())
+
+	r.Command.PathParameters = map[string]string{"id": "filter."}
+	assert.Error(t, r.ValidatePathParameters())
+}
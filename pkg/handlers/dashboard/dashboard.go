@@ -0,0 +1,425 @@
+// Package dashboard renders the results of several commands on one page, sharing one parameter form.
+//
+// The panels of a dashboard are run concurrently when the page is requested. A panel that fails only
+// shows its error, the other panels are rendered normally. The page is streamed: the template renders
+// the panels in order, and waits for the result of a panel only when it reaches it, flushing
+// what has been rendered so far.
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/go-go-golems/parka/pkg/server/livereload"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTemplateName is the name of the template used to render dashboards.
+const DefaultTemplateName = "dashboard.tmpl.html"
+
+//go:embed templates/*
+var templateFS embed.FS
+
+func NewDashboardLookupTemplate() *render.LookupTemplateFromFS {
+	l := render.NewLookupTemplateFromFS(
+		render.WithFS(templateFS),
+		render.WithBaseDir("templates/"),
+		render.WithPatterns("**/*.tmpl.html"),
+	)
+
+	_ = l.Reload()
+
+	return l
+}
+
+type DashboardHandler struct {
+	Dashboard *config.Dashboard
+
+	Repository     *repositories.Repository
+	TemplateLookup render.TemplateLookup
+	TemplateName   string
+	DevMode        bool
+	// LiveReload appends the live reload script to the page, see pkg/server/livereload.
+	LiveReload bool
+
+	// columns are the resolved column presentation rules of each panel
+	columns []columns.Columns
+}
+
+type DashboardHandlerOption func(*DashboardHandler)
+
+func WithRepository(r *repositories.Repository) DashboardHandlerOption {
+	return func(handler *DashboardHandler) {
+		handler.Repository = r
+	}
+}
+
+func WithTemplateLookup(lookup render.TemplateLookup) DashboardHandlerOption {
+	return func(handler *DashboardHandler) {
+		handler.TemplateLookup = lookup
+	}
+}
+
+func WithTemplateName(name string) DashboardHandlerOption {
+	return func(handler *DashboardHandler) {
+		if name != "" {
+			handler.TemplateName = name
+		}
+	}
+}
+
+func WithDevMode(devMode bool) DashboardHandlerOption {
+	return func(handler *DashboardHandler) {
+		handler.DevMode = devMode
+	}
+}
+
+// WithLiveReload makes the page reload itself when the files it is rendered from change.
+// The live reload endpoint needs to be served, see pkg/server/livereload.
+func WithLiveReload(liveReload bool) DashboardHandlerOption {
+	return func(handler *DashboardHandler) {
+		handler.LiveReload = liveReload
+	}
+}
+
+// NewDashboardHandlerFromConfig creates the handler for a dashboard route.
+// The panel commands are looked up in the repository when the page is requested,
+// but they have to exist when the handler is created.
+func NewDashboardHandlerFromConfig(
+	config_ *config.Dashboard,
+	options ...DashboardHandlerOption,
+) (*DashboardHandler, error) {
+	h := &DashboardHandler{
+		Dashboard:    config_,
+		TemplateName: DefaultTemplateName,
+	}
+	WithTemplateName(config_.TemplateName)(h)
+
+	for _, option := range options {
+		option(h)
+	}
+
+	if h.Repository == nil {
+		return nil, errors.New("no repository provided for dashboard")
+	}
+
+	for _, panel := range config_.Panels {
+		_, err := h.getCommand(panel.Command)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// we run this after the options in order to get the DevMode value
+	if h.TemplateLookup == nil {
+		if config_.TemplateLookup != nil {
+			lookup, err := config_.TemplateLookup.NewTemplateLookup(h.DevMode)
+			if err != nil {
+				return nil, err
+			}
+			h.TemplateLookup = lookup
+		} else {
+			h.TemplateLookup = NewDashboardLookupTemplate()
+		}
+	}
+
+	err := h.TemplateLookup.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *DashboardHandler) Serve(server_ *server.Server, path_ string) error {
+	path_ = strings.TrimSuffix(path_, "/")
+
+	// links to other commands are resolved like for a single command route
+	h.columns = make([]columns.Columns, len(h.Dashboard.Panels))
+	for i, panel := range h.Dashboard.Panels {
+		resolved, err := panel.Columns.Resolve(path.Dir(path_))
+		if err != nil {
+			return err
+		}
+		h.columns[i] = resolved
+	}
+
+	if path_ != "" {
+		server_.Group.GET(path_, h.Handle)
+	}
+	server_.Group.GET(path_+"/", h.Handle)
+
+	return nil
+}
+
+// Dashboard is the data passed to the dashboard template.
+type Dashboard struct {
+	Title          string
+	Description    string
+	Inputs         []*Input
+	Panels         []*Panel
+	AdditionalData map[string]interface{}
+}
+
+// Input is a field of the shared parameter form, with the value of the current request.
+type Input struct {
+	*config.DashboardInput
+	Value string
+}
+
+// Panel is a panel of the dashboard. Its result is computed concurrently, and Result
+// waits for it, so that the template can render the panels as they become available.
+type Panel struct {
+	*config.DashboardPanel
+	ID string
+
+	result *PanelResult
+	done   chan struct{}
+	flush  func()
+}
+
+// Result flushes what has been rendered so far, and waits for the result of the panel.
+func (p *Panel) Result() *PanelResult {
+	if p.flush != nil {
+		p.flush()
+	}
+	<-p.done
+	return p.result
+}
+
+// PanelResult is the output of the panel command.
+type PanelResult struct {
+	Columns []types.FieldName
+	// Rows are all the rows returned by the command.
+	Rows []types.Row
+	// Table is the rendered HTML table of table panels, limited to the panel limit.
+	Table     template.HTML
+	Truncated bool
+	// Value is the formatted value of value panels.
+	Value    columns.Cell
+	Error    string
+	Duration time.Duration
+}
+
+func (h *DashboardHandler) Handle(c echo.Context) error {
+	dashboard := &Dashboard{
+		Title:          h.Dashboard.Title,
+		Description:    h.Dashboard.Description,
+		AdditionalData: h.Dashboard.AdditionalData,
+	}
+
+	inputs := map[string]string{}
+	for _, input := range h.Dashboard.Inputs {
+		value := input.Default
+		if v := c.QueryParam(input.Name); v != "" {
+			value = v
+		}
+		inputs[input.Name] = value
+		dashboard.Inputs = append(dashboard.Inputs, &Input{DashboardInput: input, Value: value})
+	}
+
+	// echo's Response.Flush panics if the underlying writer can't be flushed
+	flush := func() {
+		_ = http.NewResponseController(c.Response().Writer).Flush()
+	}
+
+	ctx := c.Request().Context()
+	wg := sync.WaitGroup{}
+	for i, panel := range h.Dashboard.Panels {
+		p := &Panel{
+			DashboardPanel: panel,
+			ID:             fmt.Sprintf("panel-%d", i),
+			done:           make(chan struct{}),
+			flush:          flush,
+		}
+		dashboard.Panels = append(dashboard.Panels, p)
+
+		var columns_ columns.Columns
+		if i < len(h.columns) {
+			columns_ = h.columns[i]
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(p.done)
+			p.result = h.runPanel(ctx, panel, columns_, inputs)
+		}()
+	}
+	// don't leave the panels running if the template fails
+	defer wg.Wait()
+
+	t, err := h.TemplateLookup.Lookup(h.TemplateName)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+
+	// dashboards are streamed as their panels complete, so errors are shown inside the page
+	err = t.Execute(c.Response(), dashboard)
+	if err != nil {
+		return render.HandleRenderError(c, err, h.DevMode, h.TemplateLookup)
+	}
+
+	if h.LiveReload {
+		_, err = c.Response().Write([]byte(livereload.Script(c)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runPanel runs the command of panel. Errors, including panics, are reported in the result
+// so that they don't affect the other panels.
+func (h *DashboardHandler) runPanel(
+	ctx context.Context,
+	panel *config.DashboardPanel,
+	columns_ columns.Columns,
+	inputs map[string]string,
+) (ret *PanelResult) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			ret = &PanelResult{Error: fmt.Sprintf("panic: %v", r)}
+		}
+		ret.Duration = time.Since(start)
+	}()
+
+	if h.Dashboard.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Dashboard.Timeout)
+		defer cancel()
+	}
+
+	table_, err := h.runCommand(ctx, panel, inputs)
+	if err != nil {
+		log.Warn().Err(err).Str("command", panel.Command).Msg("dashboard panel failed")
+		return &PanelResult{Error: err.Error()}
+	}
+
+	ret = &PanelResult{
+		Columns: table_.Columns,
+		Rows:    table_.Rows,
+	}
+	if ret.Rows == nil {
+		ret.Rows = []types.Row{}
+	}
+
+	switch panel.Display {
+	case "value":
+		if len(table_.Rows) > 0 {
+			if v, ok := table_.Rows[0].Get(panel.Value); ok {
+				ret.Value = columns_.FormatCell(panel.Value, v, table_.Rows[0])
+			}
+		}
+	case "chart":
+	default:
+		rows := table_.Rows
+		if len(rows) > panel.Limit {
+			rows = rows[:panel.Limit]
+			ret.Truncated = true
+		}
+		buf := &bytes.Buffer{}
+		formatter := columns.NewHTMLRowFormatter(columns_)
+		for _, row := range rows {
+			err = formatter.OutputRow(ctx, row, buf)
+			if err != nil {
+				return &PanelResult{Error: err.Error()}
+			}
+		}
+		ret.Table = template.HTML(buf.String()) // #nosec G203
+	}
+
+	return ret
+}
+
+func (h *DashboardHandler) runCommand(
+	ctx context.Context,
+	panel *config.DashboardPanel,
+	inputs map[string]string,
+) (*types.Table, error) {
+	cmd, err := h.getCommand(panel.Command)
+	if err != nil {
+		return nil, err
+	}
+	glazeCommand, ok := cmd.(cmds.GlazeCommand)
+	if !ok {
+		return nil, errors.Errorf("command %s is not a glazed command", panel.Command)
+	}
+
+	fixedValues := map[string]map[string]interface{}{}
+	for target, v := range panel.Values {
+		section, parameter := parka_middlewares.ParseParameterTarget(target)
+		if _, ok := fixedValues[section]; !ok {
+			fixedValues[section] = map[string]interface{}{}
+		}
+		fixedValues[section][parameter] = v
+	}
+
+	parsedValues := values.New()
+	description := cmd.Description()
+	err = sources.Execute(description.Schema.Clone(), parsedValues,
+		parka_middlewares.UpdateFromValues(inputs, panel.Inputs, fields.WithSource("dashboard")),
+		sources.FromMap(fixedValues, fields.WithSource("dashboard")),
+		sources.FromDefaults(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	gp, err := handlers.CreateTableProcessorWithOutput(parsedValues, "table", "ascii")
+	if err != nil {
+		return nil, err
+	}
+	// the null table middleware keeps the rows in the processor's table
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+
+	err = glazeCommand.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+	if err != nil {
+		return nil, err
+	}
+	err = gp.Close(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return gp.GetTable(), nil
+}
+
+func (h *DashboardHandler) getCommand(commandPath string) (cmds.Command, error) {
+	commands := h.Repository.CollectCommands(strings.Split(strings.Trim(commandPath, "/"), "/"), false)
+	if len(commands) == 0 {
+		return nil, errors.Errorf("command %s not found", commandPath)
+	}
+	if len(commands) > 1 {
+		return nil, errors.Errorf("command path %s is ambiguous", commandPath)
+	}
+	return commands[0], nil
+}
@@ -0,0 +1,147 @@
+package dashboard
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingCommand returns an error, or panics, instead of rows.
+type failingCommand struct {
+	*utils.TestGlazedCommand
+	panics bool
+}
+
+func (c *failingCommand) RunIntoGlazeProcessor(ctx context.Context, parsedValues *values.Values, gp middlewares.Processor) error {
+	if c.panics {
+		panic("boom")
+	}
+	return errors.New("database unavailable")
+}
+
+func newTestRepository(t *testing.T) *repositories.Repository {
+	orders, err := utils.NewTestGlazedCommand(
+		cmds.WithName("orders"),
+		cmds.WithParents("sales"),
+		cmds.WithFlags(
+			fields.New("region", fields.TypeString, fields.WithDefault("all")),
+			fields.New("status", fields.TypeString),
+		),
+	)
+	require.NoError(t, err)
+	failing, err := utils.NewTestGlazedCommand(cmds.WithName("failing"), cmds.WithParents("sales"))
+	require.NoError(t, err)
+	panicking, err := utils.NewTestGlazedCommand(cmds.WithName("panicking"), cmds.WithParents("sales"))
+	require.NoError(t, err)
+
+	r := repositories.NewRepository()
+	r.Add(orders, &failingCommand{TestGlazedCommand: failing}, &failingCommand{TestGlazedCommand: panicking, panics: true})
+	return r
+}
+
+func newTestDashboard(t *testing.T) *config.Dashboard {
+	d := &config.Dashboard{
+		Title: "Sales overview",
+		Inputs: []*config.DashboardInput{
+			{Name: "region", Type: "select", Options: []string{"eu", "us"}, Default: "eu"},
+		},
+		Panels: []*config.DashboardPanel{
+			{
+				Title:   "Orders",
+				Command: "sales/orders",
+				Inputs:  map[string]string{"region": "region"},
+				Values:  map[string]interface{}{"status": "open"},
+				Limit:   2,
+				Size:    "half",
+			},
+			{Title: "Broken", Command: "sales/failing"},
+			{Title: "Panicking", Command: "sales/panicking"},
+			{Title: "Count", Command: "sales/orders", Display: "value", Value: "test2"},
+			{
+				Title:   "Chart",
+				Command: "sales/orders",
+				Display: "chart",
+				Chart:   &datatables.Chart{Type: "bar", X: "test2", Y: datatables.Columns{"test"}},
+			},
+		},
+	}
+	require.NoError(t, d.ExpandPaths())
+	return d
+}
+
+func TestDashboardHandler(t *testing.T) {
+	h, err := NewDashboardHandlerFromConfig(newTestDashboard(t), WithRepository(newTestRepository(t)))
+	require.NoError(t, err)
+
+	s, err := server.NewServer()
+	require.NoError(t, err)
+	require.NoError(t, h.Serve(s, "/dashboards/sales"))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			expected: []string{
+				`<option value="eu" selected>eu</option>`,
+				`<td>eu</td><td>open</td>`,
+			},
+		},
+		{
+			name:  "shared input",
+			query: "?region=us",
+			expected: []string{
+				`<option value="us" selected>us</option>`,
+				`<td>us</td><td>open</td>`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			s.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/dashboards/sales"+tt.query, nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			for _, expected := range tt.expected {
+				assert.Contains(t, string(body), expected)
+			}
+
+			// the failing panels don't prevent the other panels from rendering
+			assert.Contains(t, string(body), "database unavailable")
+			assert.Contains(t, string(body), "panic: boom")
+			assert.Contains(t, string(body), `class="panel panel-half panel-table"`)
+			assert.Contains(t, string(body), "Showing the first 2 of 3 rows.")
+			assert.Contains(t, string(body), `<div class="value">test-0</div>`)
+			assert.Contains(t, string(body), `parkaCharts.render(document.getElementById("panel-4-chart"), {"type":"bar","x":"test2","y":["test"]}`)
+		})
+	}
+}
+
+func TestDashboardHandlerUnknownCommand(t *testing.T) {
+	d := newTestDashboard(t)
+	d.Panels[0].Command = "sales/unknown"
+
+	_, err := NewDashboardHandlerFromConfig(d, WithRepository(newTestRepository(t)))
+	assert.Error(t, err)
+}
@@ -2,21 +2,30 @@ package generic_command
 
 import (
 	"fmt"
+	"html/template"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-go-golems/clay/pkg/repositories"
 	"github.com/go-go-golems/clay/pkg/repositories/trie"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/form"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers/json"
+	options_handler "github.com/go-go-golems/parka/pkg/glazed/handlers/options"
 	output_file "github.com/go-go-golems/parka/pkg/glazed/handlers/output-file"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/paging"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers/sse"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers/text"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
 	"github.com/go-go-golems/parka/pkg/handlers/config"
 	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/go-go-golems/parka/pkg/render/layout"
 	parka "github.com/go-go-golems/parka/pkg/server"
 	"github.com/go-go-golems/parka/pkg/utils"
 	"github.com/labstack/echo/v4"
@@ -55,12 +64,43 @@ type GenericCommandHandler struct {
 	// If empty, all layers are allowed.
 	WhitelistedLayers []string
 
+	// RequestParameters maps the path parameters, headers and cookies of the request to command parameters.
+	parka_middlewares.RequestParameters
+
+	// LiveUpdates makes the datatables page fetch the results of the command from the fragment endpoint
+	// and swap them in place, instead of reloading the whole page.
+	LiveUpdates bool
+	// AutoRefresh re-runs the command of the datatables page at the given interval, if not zero.
+	AutoRefresh time.Duration
+	// Virtualize renders a virtualized datatables page, which only contains the first PageSize rows
+	// and loads the others from the rows endpoint as the user scrolls.
+	Virtualize bool
+	PageSize   int
+	// pagingCache keeps the results served by the rows endpoint
+	pagingCache *paging.ResultCache
+
+	// LiveReload makes the datatables page reload itself when the files it is rendered from change,
+	// see pkg/server/livereload.
+	LiveReload bool
+	// DevMode shows the details of rendering errors on the error pages of the command index.
+	DevMode bool
+
+	// Columns are the presentation rules of the result columns.
+	Columns columns.Columns
+	// resolvedColumns are the Columns with their links resolved against the route, set when serving
+	resolvedColumns columns.Columns
+
+	// FormLayout overrides the layout of the command forms rendered by the datatables handler.
+	FormLayout *layout.FormLayout
+	// optionsProvider runs and caches the commands of the FormLayout options sources
+	optionsProvider *options_handler.Provider
+	// optionsLookup resolves the commands of the options sources, and is set when serving a repository
+	optionsLookup options_handler.CommandLookup
+
 	// preMiddlewares are run before the parameter filter middlewares
 	preMiddlewares []sources.Middleware
 	// postMiddlewares are run after the parameter filter middlewares
 	postMiddlewares []sources.Middleware
-	// middlewares contains all middlewares in order: pre + parameter filter + post
-	middlewares []sources.Middleware
 }
 
 func NewGenericCommandHandler(options ...GenericCommandHandlerOption) (*GenericCommandHandler, error) {
@@ -68,6 +108,8 @@ func NewGenericCommandHandler(options ...GenericCommandHandlerOption) (*GenericC
 		AdditionalData:  map[string]interface{}{},
 		TemplateLookup:  datatables.NewDataTablesLookupTemplate(),
 		ParameterFilter: &config.ParameterFilter{},
+		optionsProvider: options_handler.NewProvider(),
+		pagingCache:     paging.NewResultCache(),
 		preMiddlewares:  []sources.Middleware{},
 		postMiddlewares: []sources.Middleware{},
 	}
@@ -76,11 +118,6 @@ func NewGenericCommandHandler(options ...GenericCommandHandlerOption) (*GenericC
 		opt(handler)
 	}
 
-	// Compute the final middleware chain
-	parameterMiddlewares := handler.ParameterFilter.ComputeMiddlewares(handler.Stream)
-	handler.middlewares = append(handler.preMiddlewares, parameterMiddlewares...)
-	handler.middlewares = append(handler.middlewares, handler.postMiddlewares...)
-
 	if handler.TemplateLookup == nil {
 		handler.TemplateLookup = datatables.NewDataTablesLookupTemplate()
 	}
@@ -159,6 +196,21 @@ func WithTemplateLookup(lookup render.TemplateLookup) GenericCommandHandlerOptio
 	}
 }
 
+// WithLiveReload makes the datatables page reload itself when the files it is rendered from change.
+// The live reload endpoint needs to be served, see pkg/server/livereload.
+func WithLiveReload(liveReload bool) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.LiveReload = liveReload
+	}
+}
+
+// WithDevMode shows the details of rendering errors on error pages, see render.HandleRenderError.
+func WithDevMode(devMode bool) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.DevMode = devMode
+	}
+}
+
 func WithPreMiddlewares(middlewares ...sources.Middleware) GenericCommandHandlerOption {
 	return func(handler *GenericCommandHandler) {
 		handler.preMiddlewares = append(handler.preMiddlewares, middlewares...)
@@ -177,9 +229,66 @@ func WithWhitelistedLayers(layers ...string) GenericCommandHandlerOption {
 	}
 }
 
+func WithRequestParameters(parameters parka_middlewares.RequestParameters) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.RequestParameters = parameters
+	}
+}
+
+func WithLiveUpdates(liveUpdates bool) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.LiveUpdates = liveUpdates
+	}
+}
+
+func WithAutoRefresh(autoRefresh time.Duration) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.AutoRefresh = autoRefresh
+	}
+}
+
+// WithVirtualize renders virtualized datatables pages loading pageSize rows at a time.
+// If pageSize is not positive, paging.DefaultPageSize is used.
+func WithVirtualize(virtualize bool, pageSize int) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.Virtualize = virtualize
+		handler.PageSize = pageSize
+	}
+}
+
+func WithColumns(columns_ columns.Columns) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.Columns = columns_
+	}
+}
+
+func WithFormLayout(formLayout *layout.FormLayout) GenericCommandHandlerOption {
+	return func(handler *GenericCommandHandler) {
+		handler.FormLayout = formLayout
+	}
+}
+
+// computeMiddlewares returns all middlewares in order: pre + parameter filter + post.
+//
+// This is computed when handling a request, because the ParameterFilter is usually
+// filled in after the handler has been created (see NewCommandHandlerFromConfig).
+func (gch *GenericCommandHandler) computeMiddlewares() []sources.Middleware {
+	ret := append([]sources.Middleware{}, gch.preMiddlewares...)
+	ret = append(ret, gch.ParameterFilter.ComputeMiddlewares(gch.Stream)...)
+	ret = append(ret, gch.postMiddlewares...)
+	return ret
+}
+
 func (gch *GenericCommandHandler) ServeSingleCommand(server *parka.Server, basePath string, command cmds.Command) error {
 	gch.BasePath = basePath
 
+	// links to other commands are relative to the parent of the route
+	var err error
+	gch.resolvedColumns, err = gch.Columns.Resolve(path.Dir(basePath))
+	if err != nil {
+		return err
+	}
+
 	server.Group.GET(basePath+"/data", func(c echo.Context) error {
 		return gch.ServeData(c, command)
 	})
@@ -192,9 +301,19 @@ func (gch *GenericCommandHandler) ServeSingleCommand(server *parka.Server, baseP
 	server.Group.GET(basePath+"/download/*", func(c echo.Context) error {
 		return gch.ServeDownload(c, command)
 	})
+	server.Group.GET(basePath+"/layout", func(c echo.Context) error {
+		return gch.ServeLayout(c, command)
+	})
+	server.Group.GET(basePath+"/rows", func(c echo.Context) error {
+		return gch.ServeRows(c, command)
+	})
+	paths := NewDataTablesPaths(basePath, "")
+	server.Group.GET(basePath+"/fragment", func(c echo.Context) error {
+		return gch.ServeDataTablesFragment(c, command, paths)
+	})
 	// don't use a specific datatables path here
 	server.Group.GET(basePath, func(c echo.Context) error {
-		return gch.ServeDataTables(c, command, basePath+"/download")
+		return gch.ServeDataTables(c, command, paths)
 	})
 
 	return nil
@@ -204,6 +323,32 @@ func (gch *GenericCommandHandler) ServeRepository(server *parka.Server, basePath
 	basePath = strings.TrimSuffix(basePath, "/")
 	gch.BasePath = basePath
 
+	var err error
+	gch.resolvedColumns, err = gch.Columns.Resolve(basePath + "/datatables")
+	if err != nil {
+		return err
+	}
+
+	gch.optionsLookup = func(path string) (cmds.Command, error) {
+		return getRepositoryCommand(repository, strings.Trim(path, "/"))
+	}
+	gch.serveOptions(server, basePath)
+
+	server.Group.GET(basePath+"/layout/*", func(c echo.Context) error {
+		commandPath := c.Param("*")
+		commandPath = strings.TrimPrefix(commandPath, "/")
+		command, err := getRepositoryCommand(repository, commandPath)
+		if err != nil {
+			log.Debug().
+				Str("commandPath", commandPath).
+				Str("basePath", basePath).
+				Msg("could not find command")
+			return err
+		}
+
+		return gch.ServeLayout(c, command)
+	})
+
 	server.Group.GET(basePath+"/data/*", func(c echo.Context) error {
 		commandPath := c.Param("*")
 		commandPath = strings.TrimPrefix(commandPath, "/")
@@ -263,7 +408,39 @@ func (gch *GenericCommandHandler) ServeRepository(server *parka.Server, basePath
 			return err
 		}
 
-		return gch.ServeDataTables(c, command, basePath+"/download/"+commandPath)
+		return gch.ServeDataTables(c, command, NewDataTablesPaths(basePath, commandPath))
+	})
+
+	server.Group.GET(basePath+"/rows/*", func(c echo.Context) error {
+		commandPath := c.Param("*")
+		commandPath = strings.TrimPrefix(commandPath, "/")
+
+		command, err := getRepositoryCommand(repository, commandPath)
+		if err != nil {
+			log.Debug().
+				Str("commandPath", commandPath).
+				Str("basePath", basePath).
+				Msg("could not find command")
+			return err
+		}
+
+		return gch.ServeRows(c, command)
+	})
+
+	server.Group.GET(basePath+"/fragment/*", func(c echo.Context) error {
+		commandPath := c.Param("*")
+		commandPath = strings.TrimPrefix(commandPath, "/")
+
+		command, err := getRepositoryCommand(repository, commandPath)
+		if err != nil {
+			log.Debug().
+				Str("commandPath", commandPath).
+				Str("basePath", basePath).
+				Msg("could not find command")
+			return err
+		}
+
+		return gch.ServeDataTablesFragment(c, command, NewDataTablesPaths(basePath, commandPath))
 	})
 
 	server.Group.GET(basePath+"/download/*", func(c echo.Context) error {
@@ -312,15 +489,10 @@ func (gch *GenericCommandHandler) ServeRepository(server *parka.Server, basePath
 		} else {
 			nodes = append(nodes, renderNode.Children...)
 		}
-		err = templ.Execute(c.Response(), utils.H{
+		return gch.renderIndex(c, templ, utils.H{
 			"nodes": nodes,
 			"path":  basePath,
 		})
-		if err != nil {
-			return err
-		}
-
-		return nil
 	})
 
 	server.Group.GET(basePath+"/commands/*", func(c echo.Context) error {
@@ -351,40 +523,138 @@ func (gch *GenericCommandHandler) ServeRepository(server *parka.Server, basePath
 		} else {
 			nodes = append(nodes, renderNode.Children...)
 		}
-		err = templ.Execute(c.Response(), utils.H{
+		return gch.renderIndex(c, templ, utils.H{
 			"nodes": nodes,
 			"path":  basePath,
 		})
-		if err != nil {
-			return err
-		}
-
-		return nil
 	})
 
 	return nil
 }
 
+// renderIndex renders the command index page, replacing it with an error page if the template fails.
+func (gch *GenericCommandHandler) renderIndex(c echo.Context, templ *template.Template, data utils.H) error {
+	w := render.NewBufferedResponseWriter(c, http.StatusOK, render.DefaultMaxBufferSize)
+	err := templ.Execute(w, data)
+	if err != nil {
+		return render.HandleRenderError(c, err, gch.DevMode, gch.TemplateLookup)
+	}
+	return w.Flush()
+}
+
+// hasOptionsSources returns true if the form layout populates inputs from options sources.
+// Options sources are only served for repositories, whose commands they are looked up in.
+func (gch *GenericCommandHandler) hasOptionsSources() bool {
+	return gch.optionsLookup != nil && gch.FormLayout != nil && len(gch.FormLayout.OptionsSources) > 0
+}
+
+// serveOptions registers the endpoint serving the options of the form layout options sources
+// under basePath/options, if there are any.
+func (gch *GenericCommandHandler) serveOptions(server *parka.Server, basePath string) {
+	if !gch.hasOptionsSources() {
+		return
+	}
+	handler := options_handler.NewQueryHandler(gch.FormLayout, gch.optionsLookup, options_handler.WithProvider(gch.optionsProvider))
+	server.Group.GET(basePath+"/options", handler.Handle)
+}
+
+// computeOptionsURL returns the URL of the options endpoint, or an empty string if there are no options sources.
+func (gch *GenericCommandHandler) computeOptionsURL() string {
+	if !gch.hasOptionsSources() {
+		return ""
+	}
+	return gch.BasePath + "/options"
+}
+
+// DataTablesPaths are the paths of the endpoints used by the datatables page of a command.
+type DataTablesPaths struct {
+	// Data is the JSON data endpoint, used by charts
+	Data string
+	// Download is the prefix of the download links
+	Download string
+	// Fragment renders the results of the command, used for live updates
+	Fragment string
+	// Rows serves the pages of rows of a virtualized table
+	Rows string
+}
+
+// NewDataTablesPaths returns the endpoint paths of the command at commandPath, which is empty
+// for a single command route.
+func NewDataTablesPaths(basePath string, commandPath string) DataTablesPaths {
+	suffix := ""
+	if commandPath != "" {
+		suffix = "/" + commandPath
+	}
+	return DataTablesPaths{
+		Data:     basePath + "/data" + suffix,
+		Download: basePath + "/download" + suffix,
+		Fragment: basePath + "/fragment" + suffix,
+		Rows:     basePath + "/rows" + suffix,
+	}
+}
+
 // computeDataTablesOptions returns the options used for DataTables handlers
-func (gch *GenericCommandHandler) computeDataTablesOptions() []datatables.QueryHandlerOption {
+func (gch *GenericCommandHandler) computeDataTablesOptions(paths DataTablesPaths) []datatables.QueryHandlerOption {
+	fragmentPath := ""
+	if gch.LiveUpdates {
+		fragmentPath = paths.Fragment
+	}
+	rowsPath := ""
+	if gch.Virtualize {
+		rowsPath = paths.Rows
+	}
 	return []datatables.QueryHandlerOption{
-		datatables.WithMiddlewares(gch.preMiddlewares...),
-		datatables.WithMiddlewares(gch.middlewares...),
-		datatables.WithMiddlewares(gch.postMiddlewares...),
+		datatables.WithLiveUpdates(fragmentPath, gch.AutoRefresh),
+		datatables.WithPaging(rowsPath, gch.PageSize),
+		datatables.WithDataURL(paths.Data),
+		datatables.WithColumnFormats(gch.resolvedColumns),
+		datatables.WithMiddlewares(gch.computeMiddlewares()...),
+		datatables.WithRequestParameters(gch.RequestParameters),
+		datatables.WithFormLayout(gch.FormLayout),
+		datatables.WithOptionsURL(gch.computeOptionsURL()),
 		datatables.WithTemplateLookup(gch.TemplateLookup),
 		datatables.WithTemplateName(gch.TemplateName),
 		datatables.WithAdditionalData(gch.AdditionalData),
 		datatables.WithStreamRows(gch.Stream),
 		datatables.WithWhitelistedLayers(gch.WhitelistedLayers...),
+		datatables.WithLiveReload(gch.LiveReload),
+	}
+}
+
+// computePagingOptions returns the options used for the rows endpoint of virtualized tables.
+// The table never requests more than PageSize rows at once, so larger pages are clamped.
+func (gch *GenericCommandHandler) computePagingOptions() []paging.QueryHandlerOption {
+	maxPageSize := gch.PageSize
+	if maxPageSize <= 0 {
+		maxPageSize = paging.DefaultPageSize
+	}
+	return []paging.QueryHandlerOption{
+		paging.WithMaxPageSize(maxPageSize),
+		paging.WithMiddlewares(gch.computeMiddlewares()...),
+		paging.WithRequestParameters(gch.RequestParameters),
+		paging.WithWhitelistedLayers(gch.WhitelistedLayers...),
+		paging.WithResultCache(gch.pagingCache),
+	}
+}
+
+// computeFormOptions returns the options used for form layout handlers
+func (gch *GenericCommandHandler) computeFormOptions() []form.QueryHandlerOption {
+	return []form.QueryHandlerOption{
+		form.WithMiddlewares(gch.computeMiddlewares()...),
+		form.WithRequestParameters(gch.RequestParameters),
+		form.WithWhitelistedLayers(gch.WhitelistedLayers...),
+		form.WithFormLayout(gch.FormLayout),
+		form.WithOptionsURL(gch.computeOptionsURL()),
+		form.WithOptionsProvider(gch.optionsProvider, gch.optionsLookup),
+		form.WithColumnFormats(gch.resolvedColumns),
 	}
 }
 
 // computeJSONOptions returns the options used for JSON handlers
 func (gch *GenericCommandHandler) computeJSONOptions() []json.QueryHandlerOption {
 	return []json.QueryHandlerOption{
-		json.WithMiddlewares(gch.preMiddlewares...),
-		json.WithMiddlewares(gch.middlewares...),
-		json.WithMiddlewares(gch.postMiddlewares...),
+		json.WithMiddlewares(gch.computeMiddlewares()...),
+		json.WithRequestParameters(gch.RequestParameters),
 		json.WithWhitelistedLayers(gch.WhitelistedLayers...),
 	}
 }
@@ -392,9 +662,8 @@ func (gch *GenericCommandHandler) computeJSONOptions() []json.QueryHandlerOption
 // computeTextOptions returns the options used for text handlers
 func (gch *GenericCommandHandler) computeTextOptions() []text.QueryHandlerOption {
 	return []text.QueryHandlerOption{
-		text.WithMiddlewares(gch.preMiddlewares...),
-		text.WithMiddlewares(gch.middlewares...),
-		text.WithMiddlewares(gch.postMiddlewares...),
+		text.WithMiddlewares(gch.computeMiddlewares()...),
+		text.WithRequestParameters(gch.RequestParameters),
 		text.WithWhitelistedLayers(gch.WhitelistedLayers...),
 	}
 }
@@ -402,9 +671,8 @@ func (gch *GenericCommandHandler) computeTextOptions() []text.QueryHandlerOption
 // computeSSEOptions returns the options used for SSE handlers
 func (gch *GenericCommandHandler) computeSSEOptions() []sse.QueryHandlerOption {
 	return []sse.QueryHandlerOption{
-		sse.WithMiddlewares(gch.preMiddlewares...),
-		sse.WithMiddlewares(gch.middlewares...),
-		sse.WithMiddlewares(gch.postMiddlewares...),
+		sse.WithMiddlewares(gch.computeMiddlewares()...),
+		sse.WithRequestParameters(gch.RequestParameters),
 		sse.WithWhitelistedLayers(gch.WhitelistedLayers...),
 	}
 }
@@ -412,9 +680,8 @@ func (gch *GenericCommandHandler) computeSSEOptions() []sse.QueryHandlerOption {
 // computeOutputFileOptions returns the options used for output file handlers
 func (gch *GenericCommandHandler) computeOutputFileOptions() []output_file.QueryHandlerOption {
 	return []output_file.QueryHandlerOption{
-		output_file.WithMiddlewares(gch.preMiddlewares...),
-		output_file.WithMiddlewares(gch.middlewares...),
-		output_file.WithMiddlewares(gch.postMiddlewares...),
+		output_file.WithMiddlewares(gch.computeMiddlewares()...),
+		output_file.WithRequestParameters(gch.RequestParameters),
 		output_file.WithWhitelistedLayers(gch.WhitelistedLayers...),
 	}
 }
@@ -432,14 +699,39 @@ func (gch *GenericCommandHandler) ServeText(c echo.Context, command cmds.Command
 	return text.CreateQueryHandler(command, gch.computeTextOptions()...)(c)
 }
 
+// ServeLayout returns the computed form layout of the command as JSON, see form.QueryHandler.
+func (gch *GenericCommandHandler) ServeLayout(c echo.Context, command cmds.Command) error {
+	return form.CreateFormHandler(command, gch.computeFormOptions()...)(c)
+}
+
 func (gch *GenericCommandHandler) ServeStreaming(c echo.Context, command cmds.Command) error {
 	return sse.CreateQueryHandler(command, gch.computeSSEOptions()...)(c)
 }
 
-func (gch *GenericCommandHandler) ServeDataTables(c echo.Context, command cmds.Command, downloadPath string) error {
+func (gch *GenericCommandHandler) ServeDataTables(c echo.Context, command cmds.Command, paths DataTablesPaths) error {
+	switch v := command.(type) {
+	case cmds.GlazeCommand:
+		return datatables.CreateDataTablesHandler(v, gch.BasePath, paths.Download, gch.computeDataTablesOptions(paths)...)(c)
+	default:
+		return c.JSON(http.StatusInternalServerError, utils.H{"error": "command is not a glazed command"})
+	}
+}
+
+// ServeDataTablesFragment renders only the results of the datatables page, used for live updates.
+func (gch *GenericCommandHandler) ServeDataTablesFragment(c echo.Context, command cmds.Command, paths DataTablesPaths) error {
+	switch v := command.(type) {
+	case cmds.GlazeCommand:
+		return datatables.CreateDataTablesFragmentHandler(v, gch.BasePath, paths.Download, gch.computeDataTablesOptions(paths)...)(c)
+	default:
+		return c.JSON(http.StatusInternalServerError, utils.H{"error": "command is not a glazed command"})
+	}
+}
+
+// ServeRows returns a page of sorted and filtered rows as JSON, used by virtualized tables.
+func (gch *GenericCommandHandler) ServeRows(c echo.Context, command cmds.Command) error {
 	switch v := command.(type) {
 	case cmds.GlazeCommand:
-		return datatables.CreateDataTablesHandler(v, gch.BasePath, downloadPath, gch.computeDataTablesOptions()...)(c)
+		return paging.CreatePagingHandler(v, gch.computePagingOptions()...)(c)
 	default:
 		return c.JSON(http.StatusInternalServerError, utils.H{"error": "command is not a glazed command"})
 	}
@@ -0,0 +1,302 @@
+// Package proxy provides a handler that forwards all requests under a route prefix
+// to an upstream HTTP server or unix socket.
+//
+// The proxy is mounted on the parka server group like every other handler, which means
+// that requests go through the same middlewares (logging, auth, gzip, ...) as the other routes.
+//
+// It supports:
+// - stripping the route prefix and rewriting the forwarded path with regular expressions
+// - injecting and removing request headers
+// - a timeout for the upstream response headers and for establishing the connection
+// - streaming request and response bodies (the response is flushed immediately)
+// - WebSocket and other protocol upgrades, which are handled by httputil.ReverseProxy
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type pathRewrite struct {
+	from *regexp.Regexp
+	to   string
+}
+
+type ProxyHandler struct {
+	// Upstream is the URL requests are forwarded to. For unix sockets, the host is ignored.
+	Upstream *url.URL
+	// SocketPath is set when forwarding to a unix socket.
+	SocketPath string
+
+	StripPrefix   bool
+	PreserveHost  bool
+	Headers       map[string]string
+	RemoveHeaders []string
+
+	Timeout     time.Duration
+	DialTimeout time.Duration
+
+	rewrites []pathRewrite
+	// Transport can be overridden, for example in tests. If nil, a transport is created from the
+	// timeouts and socket configuration.
+	Transport http.RoundTripper
+}
+
+type ProxyHandlerOption func(handler *ProxyHandler) error
+
+func WithUpstream(upstream string) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		if strings.HasPrefix(upstream, "unix://") {
+			handler.SocketPath = strings.TrimPrefix(upstream, "unix://")
+			if handler.SocketPath == "" {
+				return errors.Errorf("invalid unix socket upstream: %s", upstream)
+			}
+			handler.Upstream = &url.URL{Scheme: "http", Host: "unix"}
+			return nil
+		}
+
+		u, err := url.Parse(upstream)
+		if err != nil {
+			return errors.Wrapf(err, "invalid proxy upstream %s", upstream)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("unsupported proxy upstream scheme %s", u.Scheme)
+		}
+		handler.Upstream = u
+		handler.SocketPath = ""
+		return nil
+	}
+}
+
+func WithStripPrefix(stripPrefix bool) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		handler.StripPrefix = stripPrefix
+		return nil
+	}
+}
+
+func WithPreserveHost(preserveHost bool) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		handler.PreserveHost = preserveHost
+		return nil
+	}
+}
+
+// WithPathRewrite adds a regular expression rewrite of the forwarded path.
+// Rewrites are applied in order, after the prefix has been stripped.
+func WithPathRewrite(from string, to string) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		re, err := regexp.Compile(from)
+		if err != nil {
+			return errors.Wrapf(err, "invalid path rewrite %s", from)
+		}
+		handler.rewrites = append(handler.rewrites, pathRewrite{from: re, to: to})
+		return nil
+	}
+}
+
+// WithHeaders sets the given headers on every forwarded request, overriding
+// headers sent by the client.
+func WithHeaders(headers map[string]string) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		if handler.Headers == nil {
+			handler.Headers = map[string]string{}
+		}
+		for k, v := range headers {
+			handler.Headers[k] = v
+		}
+		return nil
+	}
+}
+
+func WithRemoveHeaders(headers ...string) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		handler.RemoveHeaders = append(handler.RemoveHeaders, headers...)
+		return nil
+	}
+}
+
+func WithTimeout(timeout time.Duration) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		handler.Timeout = timeout
+		return nil
+	}
+}
+
+func WithDialTimeout(timeout time.Duration) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		handler.DialTimeout = timeout
+		return nil
+	}
+}
+
+func WithTransport(transport http.RoundTripper) ProxyHandlerOption {
+	return func(handler *ProxyHandler) error {
+		handler.Transport = transport
+		return nil
+	}
+}
+
+func NewProxyHandler(options ...ProxyHandlerOption) (*ProxyHandler, error) {
+	handler := &ProxyHandler{
+		StripPrefix: true,
+		Headers:     map[string]string{},
+		DialTimeout: 30 * time.Second,
+	}
+	for _, option := range options {
+		err := option(handler)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if handler.Upstream == nil {
+		return nil, errors.New("no proxy upstream configured")
+	}
+
+	return handler, nil
+}
+
+func NewProxyHandlerFromConfig(p *config.Proxy, options ...ProxyHandlerOption) (*ProxyHandler, error) {
+	headers := map[string]string{}
+	for k, v := range p.Headers {
+		headers[k] = fmt.Sprintf("%v", v)
+	}
+
+	configOptions := []ProxyHandlerOption{
+		WithUpstream(p.Upstream),
+		WithPreserveHost(p.PreserveHost),
+		WithHeaders(headers),
+		WithRemoveHeaders(p.RemoveHeaders...),
+	}
+	if p.StripPrefix != nil {
+		configOptions = append(configOptions, WithStripPrefix(*p.StripPrefix))
+	}
+	for _, rewrite := range p.PathRewrites {
+		configOptions = append(configOptions, WithPathRewrite(rewrite.From, rewrite.To))
+	}
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy timeout %s", p.Timeout)
+		}
+		configOptions = append(configOptions, WithTimeout(timeout))
+	}
+	if p.DialTimeout != "" {
+		timeout, err := time.ParseDuration(p.DialTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy dial timeout %s", p.DialTimeout)
+		}
+		configOptions = append(configOptions, WithDialTimeout(timeout))
+	}
+
+	// options passed from code are applied last, so that they can override the config file
+	return NewProxyHandler(append(configOptions, options...)...)
+}
+
+func (p *ProxyHandler) createTransport() http.RoundTripper {
+	if p.Transport != nil {
+		return p.Transport
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   p.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = p.Timeout
+	if p.SocketPath != "" {
+		socketPath := p.SocketPath
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	} else {
+		transport.DialContext = dialer.DialContext
+	}
+
+	return transport
+}
+
+// rewritePath computes the path that is forwarded to the upstream, given the incoming
+// request path and the prefix the proxy is mounted under.
+func (p *ProxyHandler) rewritePath(path string, prefix string) string {
+	if p.StripPrefix && prefix != "" {
+		path = strings.TrimPrefix(path, prefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	for _, rewrite := range p.rewrites {
+		path = rewrite.from.ReplaceAllString(path, rewrite.to)
+	}
+
+	return path
+}
+
+// CreateReverseProxy returns the httputil.ReverseProxy forwarding requests mounted under prefix.
+// prefix is the full URL path prefix, including the root path of the server.
+func (p *ProxyHandler) CreateReverseProxy(prefix string) *httputil.ReverseProxy {
+	upstream := p.Upstream
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Path = p.rewritePath(r.In.URL.Path, prefix)
+			r.Out.URL.RawPath = ""
+			r.SetURL(upstream)
+			r.SetXForwarded()
+
+			if p.PreserveHost {
+				r.Out.Host = r.In.Host
+			}
+			for _, h := range p.RemoveHeaders {
+				r.Out.Header.Del(h)
+			}
+			for k, v := range p.Headers {
+				r.Out.Header.Set(k, v)
+			}
+		},
+		Transport: p.createTransport(),
+		// flush immediately, so that streaming responses (SSE, chunked downloads) are passed through
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Error().Err(err).
+				Str("upstream", upstream.String()).
+				Str("path", r.URL.Path).
+				Msg("proxy error")
+			status := http.StatusBadGateway
+			var netErr net.Error
+			if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+				status = http.StatusGatewayTimeout
+			}
+			w.WriteHeader(status)
+		},
+	}
+}
+
+func (p *ProxyHandler) Serve(server_ *server.Server, path string) error {
+	path = strings.TrimSuffix(path, "/")
+
+	proxy := p.CreateReverseProxy(server_.RootPath + path)
+	handler := echo.WrapHandler(proxy)
+
+	if path != "" {
+		server_.Group.Any(path, handler)
+	}
+	server_.Group.Any(path+"/*", handler)
+
+	return nil
+}
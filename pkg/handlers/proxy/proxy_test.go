@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-Query", r.URL.RawQuery)
+		w.Header().Set("X-Upstream-Token", r.Header.Get("X-Token"))
+		w.Header().Set("X-Upstream-Cookie", r.Header.Get("Cookie"))
+		_, _ = w.Write([]byte("upstream"))
+	}))
+}
+
+func serveProxy(t *testing.T, p *config.Proxy, path string) *httptest.Server {
+	require.NoError(t, p.ExpandPaths())
+	handler, err := NewProxyHandlerFromConfig(p)
+	require.NoError(t, err)
+
+	s, err := server.NewServer()
+	require.NoError(t, err)
+	require.NoError(t, handler.Serve(s, path))
+
+	return httptest.NewServer(s)
+}
+
+func get(t *testing.T, url string) *http.Response {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	return resp
+}
+
+func TestProxyStripsPrefix(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	s := serveProxy(t, &config.Proxy{Upstream: upstream.URL + "/base"}, "/legacy/")
+	defer s.Close()
+
+	resp := get(t, s.URL+"/legacy/foo/bar?x=1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/base/foo/bar", resp.Header.Get("X-Upstream-Path"))
+	assert.Equal(t, "x=1", resp.Header.Get("X-Upstream-Query"))
+
+	resp = get(t, s.URL+"/legacy")
+	assert.Equal(t, "/base/", resp.Header.Get("X-Upstream-Path"))
+}
+
+func TestProxyKeepsPrefix(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	stripPrefix := false
+	s := serveProxy(t, &config.Proxy{
+		Upstream:    upstream.URL,
+		StripPrefix: &stripPrefix,
+	}, "/legacy")
+	defer s.Close()
+
+	resp := get(t, s.URL+"/legacy/foo")
+	assert.Equal(t, "/legacy/foo", resp.Header.Get("X-Upstream-Path"))
+}
+
+func TestProxyRewritesPath(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	s := serveProxy(t, &config.Proxy{
+		Upstream: upstream.URL,
+		PathRewrites: []config.PathRewrite{
+			{From: "^/v1/(.*)$", To: "/api/v2/$1"},
+		},
+	}, "/legacy")
+	defer s.Close()
+
+	resp := get(t, s.URL+"/legacy/v1/users")
+	assert.Equal(t, "/api/v2/users", resp.Header.Get("X-Upstream-Path"))
+}
+
+func TestProxyInjectsAndRemovesHeaders(t *testing.T) {
+	upstream := newUpstream()
+	defer upstream.Close()
+
+	err := os.Setenv("PARKA_PROXY_TEST_TOKEN", "secret")
+	require.NoError(t, err)
+
+	s := serveProxy(t, &config.Proxy{
+		Upstream: upstream.URL,
+		Headers: map[string]interface{}{
+			"X-Token": map[string]interface{}{"_env": "PARKA_PROXY_TEST_TOKEN"},
+		},
+		RemoveHeaders: []string{"Cookie"},
+	}, "/legacy")
+	defer s.Close()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/legacy/", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Token", "client")
+	req.Header.Set("Cookie", "session=1234")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, "secret", resp.Header.Get("X-Upstream-Token"))
+	assert.Equal(t, "", resp.Header.Get("X-Upstream-Cookie"))
+}
+
+func TestProxyUpstreamDown(t *testing.T) {
+	upstream := newUpstream()
+	url := upstream.URL
+	upstream.Close()
+
+	s := serveProxy(t, &config.Proxy{Upstream: url}, "/legacy")
+	defer s.Close()
+
+	resp := get(t, s.URL+"/legacy/foo")
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestProxyInvalidUpstream(t *testing.T) {
+	_, err := NewProxyHandler(WithUpstream("ftp://example.com"))
+	assert.Error(t, err)
+
+	_, err = NewProxyHandler()
+	assert.Error(t, err)
+}
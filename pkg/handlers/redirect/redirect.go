@@ -0,0 +1,115 @@
+package redirect
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// RedirectHandler redirects all requests matching its path to a target URL.
+// The target can reference path segments captured by the route path, see config.Redirect.
+//
+// Like the targets of rewrite rules, targets starting with `/` are relative to the root path of the server.
+// Absolute URLs are used as is.
+type RedirectHandler struct {
+	Target        string
+	StatusCode    int
+	PreserveQuery bool
+	// RootPath is prepended to targets starting with `/`. It is set to the root path of the server by Serve.
+	RootPath string
+}
+
+type RedirectHandlerOption func(handler *RedirectHandler)
+
+func WithStatusCode(statusCode int) RedirectHandlerOption {
+	return func(handler *RedirectHandler) {
+		handler.StatusCode = statusCode
+	}
+}
+
+func WithPreserveQuery(preserveQuery bool) RedirectHandlerOption {
+	return func(handler *RedirectHandler) {
+		handler.PreserveQuery = preserveQuery
+	}
+}
+
+func NewRedirectHandler(target string, options ...RedirectHandlerOption) *RedirectHandler {
+	handler := &RedirectHandler{
+		Target:        target,
+		StatusCode:    http.StatusFound,
+		PreserveQuery: true,
+	}
+	for _, option := range options {
+		option(handler)
+	}
+	return handler
+}
+
+func NewRedirectHandlerFromConfig(r *config.Redirect, options ...RedirectHandlerOption) *RedirectHandler {
+	configOptions := []RedirectHandlerOption{
+		WithStatusCode(r.StatusCode),
+	}
+	if r.PreserveQuery != nil {
+		configOptions = append(configOptions, WithPreserveQuery(*r.PreserveQuery))
+	}
+
+	return NewRedirectHandler(r.Target, append(configOptions, options...)...)
+}
+
+// ComputeTarget expands the target with the given captured path parameters and
+// merges the request query string into it, if PreserveQuery is set. The parameters
+// of the target take precedence over the ones of the request.
+func (r *RedirectHandler) ComputeTarget(params map[string]string, query url.Values) (string, error) {
+	target := utils.ExpandPathTemplate(r.Target, params)
+	if strings.HasPrefix(target, "/") {
+		target = r.RootPath + target
+	}
+	if !r.PreserveQuery || len(query) == 0 {
+		return target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid redirect target %s", target)
+	}
+	u.RawQuery = utils.MergeTargetQuery(u.Query(), query).Encode()
+
+	return u.String(), nil
+}
+
+func (r *RedirectHandler) Handle(c echo.Context) error {
+	params := map[string]string{}
+	for i, name := range c.ParamNames() {
+		params[name] = c.ParamValues()[i]
+	}
+	params[utils.WildcardParam] = strings.TrimPrefix(params[utils.WildcardParam], "/")
+
+	target, err := r.ComputeTarget(params, c.QueryParams())
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(r.StatusCode, target)
+}
+
+// Serve registers the redirect under path, which is matched like the path of a rewrite rule
+// (see utils.PathPattern): exactly, unless it ends with a wildcard, in which case everything
+// below path is redirected as well, including path itself without the trailing slash.
+func (r *RedirectHandler) Serve(server_ *server.Server, path string) error {
+	r.RootPath = server_.RootPath
+	if strings.HasSuffix(path, "/*") {
+		prefix := strings.TrimSuffix(path, "/*")
+		if prefix != "" {
+			server_.Group.Any(prefix, r.Handle)
+		}
+	}
+	server_.Group.Any(path, r.Handle)
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package redirect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-go-golems/parka/pkg/handlers/config"
+	"github.com/go-go-golems/parka/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name       string
+		rootPath   string
+		path       string
+		redirect   config.Redirect
+		request    string
+		statusCode int
+		location   string
+	}{
+		{
+			name:       "prefix",
+			path:       "/reports/*",
+			redirect:   config.Redirect{Target: "/analytics/{*}", StatusCode: http.StatusMovedPermanently},
+			request:    "/reports/sales/q1?year=2024",
+			statusCode: http.StatusMovedPermanently,
+			location:   "/analytics/sales/q1?year=2024",
+		},
+		{
+			name:       "prefix root",
+			path:       "/reports/*",
+			redirect:   config.Redirect{Target: "/analytics/{*}"},
+			request:    "/reports",
+			statusCode: http.StatusFound,
+			location:   "/analytics/",
+		},
+		{
+			name:       "captured segments",
+			path:       "/reports/:year/*",
+			redirect:   config.Redirect{Target: "/analytics/{*}?year={year}"},
+			request:    "/reports/2023/sales?format=csv",
+			statusCode: http.StatusFound,
+			location:   "/analytics/sales?format=csv&year=2023",
+		},
+		{
+			name:       "exact",
+			path:       "/old",
+			redirect:   config.Redirect{Target: "/new"},
+			request:    "/old",
+			statusCode: http.StatusFound,
+			location:   "/new",
+		},
+		{
+			name:       "exact does not match below",
+			path:       "/old",
+			redirect:   config.Redirect{Target: "/new"},
+			request:    "/old/sub",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "target query takes precedence",
+			path:       "/old",
+			redirect:   config.Redirect{Target: "/new?source=old"},
+			request:    "/old?source=x&y=1",
+			statusCode: http.StatusFound,
+			location:   "/new?source=old&y=1",
+		},
+		{
+			name:       "drop query",
+			path:       "/old",
+			redirect:   config.Redirect{Target: "https://example.com/new", PreserveQuery: new(bool)},
+			request:    "/old?x=1",
+			statusCode: http.StatusFound,
+			location:   "https://example.com/new",
+		},
+		{
+			name:       "root path",
+			rootPath:   "/app",
+			path:       "/reports/*",
+			redirect:   config.Redirect{Target: "/analytics/{*}"},
+			request:    "/app/reports/sales?year=2024",
+			statusCode: http.StatusFound,
+			location:   "/app/analytics/sales?year=2024",
+		},
+		{
+			name:       "root path absolute target",
+			rootPath:   "/app",
+			path:       "/old",
+			redirect:   config.Redirect{Target: "https://example.com/new"},
+			request:    "/app/old",
+			statusCode: http.StatusFound,
+			location:   "https://example.com/new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.redirect
+			require.NoError(t, r.ExpandPaths())
+
+			s, err := server.NewServer(server.WithRootPath(tt.rootPath))
+			require.NoError(t, err)
+			require.NoError(t, NewRedirectHandlerFromConfig(&r).Serve(s, tt.path))
+
+			server_ := httptest.NewServer(s)
+			defer server_.Close()
+
+			client := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+			resp, err := client.Get(server_.URL + tt.request)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+		})
+	}
+}
+
+func TestRedirectInvalidStatusCode(t *testing.T) {
+	r := &config.Redirect{Target: "/foo", StatusCode: http.StatusOK}
+	assert.Error(t, r.ExpandPaths())
+}
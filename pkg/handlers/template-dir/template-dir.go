@@ -1,11 +1,14 @@
 package template_dir
 
 import (
+	"context"
 	"github.com/go-go-golems/glazed/pkg/cmds/loaders"
 	"github.com/go-go-golems/parka/pkg/handlers/config"
 	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/render/commands"
 	"github.com/go-go-golems/parka/pkg/server"
 	"github.com/pkg/errors"
+	"html/template"
 	"io/fs"
 	"path/filepath"
 	"strings"
@@ -15,15 +18,35 @@ import (
 // deals with devmode / reloading
 
 type TemplateDirHandler struct {
-	fs                       fs.FS
-	LocalDirectory           string
+	fs             fs.FS
+	LocalDirectory string
+	// localPath is the absolute path of the directory on disk, if it was set using WithLocalDirectory.
+	// It is watched for changes when alwaysReload is set.
+	localPath                string
 	IndexTemplateName        string
 	MarkdownBaseTemplateName string
 	rendererOptions          []render.RendererOption
 	renderer                 *render.Renderer
 	alwaysReload             bool
+	commandRunner            *commands.Runner
+	// TemplateLookup is the lookup for the templates of the directory, created by NewTemplateDirHandlerFromConfig.
+	TemplateLookup render.TemplateLookup
+	// dataDirectory is the path of the data files, relative to the local directory, see WithDataDirectory.
+	dataDirectory string
+	// DataDirectory holds the data files passed to the templates as `.Data`, created by NewTemplateDirHandlerFromConfig
+	// when the directory is on disk. It is watched for changes when alwaysReload is set.
+	DataDirectory *render.DataDirectory
+	// PageTree is the tree of the pages passed to the templates as `.Site`, created by NewTemplateDirHandlerFromConfig.
+	// It is also served as `sitemap.xml` and `rss.xml`.
+	PageTree *render.PageTree
+	baseURL  string
+	// layouts renders the pages into their layouts, see WithLayouts.
+	layouts bool
 }
 
+// DefaultDataDirectory is the directory of the data files of a template directory.
+const DefaultDataDirectory = "data"
+
 type TemplateDirHandlerOption func(handler *TemplateDirHandler) error
 
 func WithDefaultFS(fs fs.FS, localPath string) TemplateDirHandlerOption {
@@ -50,6 +73,41 @@ func WithAppendRendererOptions(rendererOptions ...render.RendererOption) Templat
 	}
 }
 
+// WithCommandRunner makes the commands of runner available to the templates,
+// through template functions and command blocks in markdown pages.
+func WithCommandRunner(runner *commands.Runner) TemplateDirHandlerOption {
+	return func(handler *TemplateDirHandler) error {
+		handler.commandRunner = runner
+		return nil
+	}
+}
+
+// WithDataDirectory sets the directory of the YAML, JSON and CSV files passed to the templates as `.Data`.
+// Relative paths are relative to the local directory.
+func WithDataDirectory(dataDirectory string) TemplateDirHandlerOption {
+	return func(handler *TemplateDirHandler) error {
+		handler.dataDirectory = dataDirectory
+		return nil
+	}
+}
+
+// WithBaseURL sets the scheme and host of the absolute URLs of the sitemap and the RSS feed.
+func WithBaseURL(baseURL string) TemplateDirHandlerOption {
+	return func(handler *TemplateDirHandler) error {
+		handler.baseURL = baseURL
+		return nil
+	}
+}
+
+// WithLayouts renders the pages into the `_layout.tmpl.html` of their nearest ancestor directory,
+// and hides the files and directories starting with `_`. See render.LayoutTemplateName.
+func WithLayouts(layouts bool) TemplateDirHandlerOption {
+	return func(handler *TemplateDirHandler) error {
+		handler.layouts = layouts
+		return nil
+	}
+}
+
 func WithLocalDirectory(localPath string) TemplateDirHandlerOption {
 	return func(handler *TemplateDirHandler) error {
 		if localPath != "" {
@@ -66,6 +124,7 @@ func WithLocalDirectory(localPath string) TemplateDirHandlerOption {
 			if err != nil {
 				return err
 			}
+			handler.localPath = p
 		}
 
 		return nil
@@ -86,6 +145,9 @@ func NewTemplateDirHandler(options ...TemplateDirHandlerOption) (*TemplateDirHan
 func NewTemplateDirHandlerFromConfig(td *config.TemplateDir, options ...TemplateDirHandlerOption) (*TemplateDirHandler, error) {
 	handler := &TemplateDirHandler{
 		IndexTemplateName: td.IndexTemplateName,
+		dataDirectory:     td.DataDirectory,
+		baseURL:           td.BaseURL,
+		layouts:           td.Layouts,
 	}
 	err := WithLocalDirectory(td.LocalDirectory)(handler)
 	if err != nil {
@@ -98,27 +160,41 @@ func NewTemplateDirHandlerFromConfig(td *config.TemplateDir, options ...Template
 			return nil, err
 		}
 	}
-	templateLookup := render.NewLookupTemplateFromFS(
-		render.WithFS(handler.fs),
-		render.WithBaseDir(handler.LocalDirectory),
-		render.WithPatterns(
-			"**/*.tmpl.md",
-			"**/*.md",
-			"**/*.tmpl.html",
-			"**/*.html",
-		),
-		render.WithAlwaysReload(handler.alwaysReload),
-	)
-	err = templateLookup.Reload()
-
+	templateLookup, err := handler.createTemplateLookup()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to load local template")
 	}
+	handler.TemplateLookup = templateLookup
+
 	rendererOptions := append(
 		handler.rendererOptions,
 		render.WithPrependTemplateLookups(templateLookup),
 		render.WithIndexTemplateName(handler.IndexTemplateName),
 	)
+	if handler.commandRunner != nil {
+		rendererOptions = append(rendererOptions,
+			render.WithMarkdownExtensions(handler.commandRunner.MarkdownExtension()),
+			render.WithRequestFuncs(handler.commandRunner.FuncMap),
+		)
+	}
+	if handler.localPath != "" {
+		dataDirectory := handler.dataDirectory
+		if dataDirectory == "" {
+			dataDirectory = DefaultDataDirectory
+		}
+		if !filepath.IsAbs(dataDirectory) {
+			dataDirectory = filepath.Join(handler.localPath, dataDirectory)
+		}
+		handler.DataDirectory, err = render.NewDataDirectory(dataDirectory)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load data files")
+		}
+		rendererOptions = append(rendererOptions, render.WithDataDirectory(handler.DataDirectory))
+	}
+	if pl, ok := templateLookup.(render.PageListLookup); ok {
+		handler.PageTree = render.NewPageTree(pl, render.WithPageTreeBaseURL(handler.baseURL))
+		rendererOptions = append(rendererOptions, render.WithPageTree(handler.PageTree))
+	}
 	r, err := render.NewRenderer(rendererOptions...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to load local template")
@@ -128,8 +204,56 @@ func NewTemplateDirHandlerFromConfig(td *config.TemplateDir, options ...Template
 	return handler, nil
 }
 
+var templatePatterns = []string{
+	"**/*.tmpl.md",
+	"**/*.md",
+	"**/*.tmpl.html",
+	"**/*.html",
+}
+
+// createTemplateLookup loads the templates of the directory. When alwaysReload is set and the
+// directory is on disk, it is watched and the templates that change are reloaded.
+//
+// With layouts, pages are rendered into the `_layout.tmpl.html` of their nearest ancestor directory,
+// see render.LayoutTemplateName.
+func (td *TemplateDirHandler) createTemplateLookup() (render.TemplateLookup, error) {
+	var funcs template.FuncMap
+	if td.commandRunner != nil {
+		funcs = td.commandRunner.FuncMap(context.Background())
+	}
+
+	if td.alwaysReload && td.localPath != "" {
+		return render.NewLookupTemplateFromWatchedDirectory(
+			td.localPath,
+			render.WithWatchedPatterns(templatePatterns...),
+			render.WithWatchedFuncs(funcs),
+			render.WithWatchedLayouts(td.layouts),
+		)
+	}
+
+	templateLookup := render.NewLookupTemplateFromFS(
+		render.WithFS(td.fs),
+		render.WithBaseDir(td.LocalDirectory),
+		render.WithPatterns(templatePatterns...),
+		render.WithAlwaysReload(td.alwaysReload),
+		render.WithFuncs(funcs),
+		render.WithLayouts(td.layouts),
+	)
+	err := templateLookup.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return templateLookup, nil
+}
+
 func (td *TemplateDirHandler) Serve(server *server.Server, path string) error {
 	path = strings.TrimSuffix(path, "/")
+	if td.PageTree != nil {
+		// the links of the navigation, the sitemap and the feed include the root path of the server
+		td.PageTree.BasePath = server.RootPath + path
+		server.Group.GET(path+"/"+render.SitemapName, td.PageTree.SitemapHandler())
+		server.Group.GET(path+"/"+render.FeedName, td.PageTree.FeedHandler())
+	}
 	server.Group.GET(path+"/*", td.renderer.WithTemplateDirHandler(nil))
 	return nil
 }
@@ -1,10 +1,12 @@
 package template
 
 import (
+	"context"
 	"io/fs"
 
 	"github.com/go-go-golems/parka/pkg/handlers/config"
 	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/render/commands"
 	"github.com/go-go-golems/parka/pkg/server"
 )
 
@@ -14,6 +16,7 @@ type TemplateHandler struct {
 	rendererOptions []render.RendererOption
 	renderer        *render.Renderer
 	alwaysReload    bool
+	commandRunner   *commands.Runner
 	// TODO(manuel, 2023-06-20) Allow to pass in additional data from code, not just config file
 }
 
@@ -33,6 +36,14 @@ func WithAlwaysReload(alwaysReload bool) TemplateHandlerOption {
 	}
 }
 
+// WithCommandRunner makes the commands of runner available to the template,
+// through template functions and command blocks in markdown.
+func WithCommandRunner(runner *commands.Runner) TemplateHandlerOption {
+	return func(handler *TemplateHandler) {
+		handler.commandRunner = runner
+	}
+}
+
 func WithAppendRendererOptions(rendererOptions ...render.RendererOption) TemplateHandlerOption {
 	return func(handler *TemplateHandler) {
 		handler.rendererOptions = append(handler.rendererOptions, rendererOptions...)
@@ -60,6 +71,9 @@ func NewTemplateHandlerFromConfig(t *config.Template, options ...TemplateHandler
 	// the template name used to lookup the template is the template file path. We do need to specify
 	// a template name because we are also using the lookup to get the base template to render markdown files.
 	templateLookup := render.NewLookupTemplateFromFile(handler.TemplateFile, handler.TemplateFile)
+	if handler.commandRunner != nil {
+		templateLookup.Funcs = handler.commandRunner.FuncMap(context.Background())
+	}
 	// TODO(manuel, 2024-05-09) In dev mode, we want to watch the template file and reload when it changes
 	err := templateLookup.Reload()
 	if err != nil {
@@ -69,6 +83,12 @@ func NewTemplateHandlerFromConfig(t *config.Template, options ...TemplateHandler
 	rendererOptions := append(handler.rendererOptions,
 		render.WithPrependTemplateLookups(templateLookup),
 	)
+	if handler.commandRunner != nil {
+		rendererOptions = append(rendererOptions,
+			render.WithMarkdownExtensions(handler.commandRunner.MarkdownExtension()),
+			render.WithRequestFuncs(handler.commandRunner.FuncMap),
+		)
+	}
 	// TODO(manuel, 2023-06-20) We need to pass the base template renderer to render out markdown
 	r, err := render.NewRenderer(rendererOptions...)
 	if err != nil {
@@ -0,0 +1,359 @@
+package columns
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// DefaultDateLayout is the layout used for date columns without a layout.
+const DefaultDateLayout = "2006-01-02 15:04"
+
+// Columns maps column names to their presentation rules.
+type Columns map[string]*Column
+
+// Column describes how the cells of a column are presented in the HTML and datatables output.
+type Column struct {
+	Format *Format `yaml:"format,omitempty" json:"format,omitempty"`
+	// Classes are added to the cells whose value matches their conditions.
+	Classes []*ClassRule `yaml:"classes,omitempty" json:"classes,omitempty"`
+	// Link turns the cells into links to another command.
+	Link *Link `yaml:"link,omitempty" json:"link,omitempty"`
+}
+
+// Format formats the values of number and date columns.
+type Format struct {
+	// Type is `number`, `percent` (numbers multiplied by 100) or `date`.
+	Type string `yaml:"type" json:"type"`
+	// Decimals is the number of decimals of numbers, by default up to 3 decimals are shown.
+	Decimals *int `yaml:"decimals,omitempty" json:"decimals,omitempty"`
+	// Locale is a BCP 47 language tag, for example `de-DE`, used for the decimal and grouping separators.
+	Locale string `yaml:"locale,omitempty" json:"locale,omitempty"`
+	// Layout is the Go time layout of dates, see DefaultDateLayout.
+	Layout string `yaml:"layout,omitempty" json:"layout,omitempty"`
+	// TimeZone is the IANA time zone dates are converted to, for example `Europe/Berlin`.
+	TimeZone string `yaml:"timeZone,omitempty" json:"timeZone,omitempty"`
+	Prefix   string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Suffix   string `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+
+	printer  *message.Printer
+	location *time.Location
+}
+
+// ClassRule adds Class to the cells matching all of its conditions.
+// The numeric conditions only match numeric values.
+type ClassRule struct {
+	Class  string      `yaml:"class" json:"class"`
+	Gt     *float64    `yaml:"gt,omitempty" json:"gt,omitempty"`
+	Gte    *float64    `yaml:"gte,omitempty" json:"gte,omitempty"`
+	Lt     *float64    `yaml:"lt,omitempty" json:"lt,omitempty"`
+	Lte    *float64    `yaml:"lte,omitempty" json:"lte,omitempty"`
+	Equals interface{} `yaml:"equals,omitempty" json:"equals,omitempty"`
+}
+
+// Link links a cell to the datatables page of another command, filling its parameters from the row.
+type Link struct {
+	// Command is the path of a command of the same command directory, for example `customers/orders`,
+	// or an absolute path starting with `/`.
+	Command string `yaml:"command" json:"command"`
+	// Parameters maps the parameters of the linked command to the columns they are filled from.
+	Parameters map[string]string `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	// URL is the resolved URL of the linked page, without query string, see Columns.Resolve.
+	URL string `yaml:"-" json:"url,omitempty"`
+}
+
+// Cell is a formatted cell.
+type Cell struct {
+	Text    string
+	Classes []string
+	Href    string
+}
+
+func (c *Columns) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for name, column := range *c {
+		if column == nil {
+			continue
+		}
+		if f := column.Format; f != nil {
+			switch f.Type {
+			case "number", "percent", "date":
+			default:
+				return errors.Errorf("unknown format type %s for column %s, expected number, percent or date", f.Type, name)
+			}
+			if f.Decimals != nil && *f.Decimals < 0 {
+				return errors.Errorf("invalid decimals %d for column %s", *f.Decimals, name)
+			}
+			if f.Locale != "" {
+				if _, err := language.Parse(f.Locale); err != nil {
+					return errors.Wrapf(err, "invalid locale %s for column %s", f.Locale, name)
+				}
+			}
+			if f.TimeZone != "" {
+				if _, err := time.LoadLocation(f.TimeZone); err != nil {
+					return errors.Wrapf(err, "invalid time zone %s for column %s", f.TimeZone, name)
+				}
+			}
+		}
+		for _, rule := range column.Classes {
+			if rule.Class == "" {
+				return errors.Errorf("class rule without class for column %s", name)
+			}
+		}
+		if column.Link != nil && column.Link.Command == "" {
+			return errors.Errorf("link without command for column %s", name)
+		}
+	}
+	return nil
+}
+
+// Resolve returns a copy of the columns ready for formatting, with the URLs of the links resolved.
+// Relative link commands are resolved against linkBase, for example `/reports/datatables`.
+func (c Columns) Resolve(linkBase string) (Columns, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := Columns{}
+	for name, column := range c {
+		if column == nil {
+			continue
+		}
+		column_ := *column
+		if column.Format != nil {
+			f := *column.Format
+			f.printer = message.NewPrinter(language.Make(f.Locale))
+			f.location = time.UTC
+			if f.TimeZone != "" {
+				// already checked by Validate
+				f.location, _ = time.LoadLocation(f.TimeZone)
+			}
+			column_.Format = &f
+		}
+		if column.Link != nil {
+			link := *column.Link
+			if strings.HasPrefix(link.Command, "/") {
+				link.URL = link.Command
+			} else {
+				link.URL = strings.TrimSuffix(linkBase, "/") + "/" + strings.TrimPrefix(link.Command, "/")
+			}
+			column_.Link = &link
+		}
+		ret[name] = &column_
+	}
+
+	return ret, nil
+}
+
+// FormatCell formats the value of column in row. Values of columns without rules are rendered as is.
+func (c Columns) FormatCell(column string, value interface{}, row types.Row) Cell {
+	col, ok := c[column]
+	if !ok || col == nil {
+		return Cell{Text: valueToString(value)}
+	}
+
+	ret := Cell{Text: col.Format.FormatValue(value)}
+	for _, rule := range col.Classes {
+		if rule.Matches(value) {
+			ret.Classes = append(ret.Classes, rule.Class)
+		}
+	}
+	if col.Link != nil && value != nil {
+		ret.Href = col.Link.Href(row)
+	}
+
+	return ret
+}
+
+// FormatValue formats a number or date value. Values that can't be converted are rendered as is.
+func (f *Format) FormatValue(value interface{}) string {
+	if f == nil || value == nil {
+		return valueToString(value)
+	}
+
+	switch f.Type {
+	case "number", "percent":
+		v, ok := toFloat(value)
+		if !ok {
+			return valueToString(value)
+		}
+		if f.Type == "percent" {
+			v *= 100
+		}
+		options := []number.Option{}
+		if f.Decimals != nil {
+			options = append(options, number.MinFractionDigits(*f.Decimals), number.MaxFractionDigits(*f.Decimals))
+		}
+		printer := f.printer
+		if printer == nil {
+			printer = message.NewPrinter(language.Make(f.Locale))
+		}
+		s := printer.Sprint(number.Decimal(v, options...))
+		if f.Type == "percent" {
+			s += "%"
+		}
+		return f.Prefix + s + f.Suffix
+
+	case "date":
+		t, ok := toTime(value)
+		if !ok {
+			return valueToString(value)
+		}
+		location := f.location
+		if location == nil {
+			location = time.UTC
+		}
+		layout := f.Layout
+		if layout == "" {
+			layout = DefaultDateLayout
+		}
+		return f.Prefix + t.In(location).Format(layout) + f.Suffix
+	}
+
+	return valueToString(value)
+}
+
+// Matches returns true if value matches all the conditions of the rule.
+func (r *ClassRule) Matches(value interface{}) bool {
+	if r.Equals != nil && valueToString(r.Equals) != valueToString(value) {
+		return false
+	}
+	if r.Gt == nil && r.Gte == nil && r.Lt == nil && r.Lte == nil {
+		return r.Equals != nil
+	}
+
+	v, ok := toFloat(value)
+	if !ok {
+		return false
+	}
+	return (r.Gt == nil || v > *r.Gt) &&
+		(r.Gte == nil || v >= *r.Gte) &&
+		(r.Lt == nil || v < *r.Lt) &&
+		(r.Lte == nil || v <= *r.Lte)
+}
+
+// Href returns the URL of the linked page for row. Parameters whose column is missing from the row are left out.
+func (l *Link) Href(row types.Row) string {
+	names := []string{}
+	for name := range l.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	query := url.Values{}
+	for _, name := range names {
+		v, ok := row.Get(l.Parameters[name])
+		if !ok || v == nil {
+			continue
+		}
+		query.Set(name, valueToString(v))
+	}
+
+	u := l.URL
+	if u == "" {
+		u = l.Command
+	}
+	if len(query) == 0 {
+		return u
+	}
+	return u + "?" + query.Encode()
+}
+
+// HTML renders the cell as the content of a table cell.
+func (c Cell) HTML() template.HTML {
+	text := template.HTMLEscapeString(c.Text)
+	if c.Href != "" {
+		text = fmt.Sprintf(`<a href="%s">%s</a>`, template.HTMLEscapeString(c.Href), text)
+	}
+	return template.HTML(text) // #nosec G203
+}
+
+func valueToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v_ := v.(type) {
+	case int:
+		return float64(v_), true
+	case int8:
+		return float64(v_), true
+	case int16:
+		return float64(v_), true
+	case int32:
+		return float64(v_), true
+	case int64:
+		return float64(v_), true
+	case uint:
+		return float64(v_), true
+	case uint8:
+		return float64(v_), true
+	case uint16:
+		return float64(v_), true
+	case uint32:
+		return float64(v_), true
+	case uint64:
+		return float64(v_), true
+	case float32:
+		return float64(v_), true
+	case float64:
+		return v_, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v_), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch v_ := v.(type) {
+	case time.Time:
+		return v_, true
+	case *time.Time:
+		if v_ == nil {
+			return time.Time{}, false
+		}
+		return *v_, true
+	case string:
+		for _, layout := range dateLayouts {
+			t, err := time.Parse(layout, v_)
+			if err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
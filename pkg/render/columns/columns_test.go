@@ -0,0 +1,119 @@
+package columns
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testColumns = `
+amount:
+  format: {type: number, decimals: 2, locale: de-DE, suffix: " €"}
+  classes:
+    - {class: negative, lt: 0}
+    - {class: highlight, gte: 1000}
+share:
+  format: {type: percent, decimals: 1}
+created_at:
+  format: {type: date, layout: "02.01.2006 15:04", timeZone: Europe/Berlin}
+status:
+  classes:
+    - {class: highlight, equals: overdue}
+customer_id:
+  link:
+    command: customers/orders
+    parameters:
+      customer: customer_id
+      region: region
+`
+
+func TestFormatCell(t *testing.T) {
+	var columns Columns
+	require.NoError(t, yaml.Unmarshal([]byte(testColumns), &columns))
+	resolved, err := columns.Resolve("/reports/datatables")
+	require.NoError(t, err)
+
+	row := types.NewRow(
+		types.MRP("customer_id", 42),
+		types.MRP("region", "EU"),
+	)
+
+	tests := []struct {
+		name     string
+		column   string
+		value    interface{}
+		expected Cell
+	}{
+		{name: "plain", column: "other", value: 3.5, expected: Cell{Text: "3.5"}},
+		{name: "nil", column: "amount", value: nil, expected: Cell{Text: ""}},
+		{name: "number with locale", column: "amount", value: 1234.5,
+			expected: Cell{Text: "1.234,50 €", Classes: []string{"highlight"}}},
+		{name: "negative number", column: "amount", value: -3,
+			expected: Cell{Text: "-3,00 €", Classes: []string{"negative"}}},
+		{name: "number string", column: "amount", value: "12.345", expected: Cell{Text: "12,35 €"}},
+		{name: "not a number", column: "amount", value: "n/a", expected: Cell{Text: "n/a"}},
+		{name: "percent", column: "share", value: 0.256, expected: Cell{Text: "25.6%"}},
+		{name: "date string in time zone", column: "created_at", value: "2024-03-05T23:30:00Z",
+			expected: Cell{Text: "06.03.2024 00:30"}},
+		{name: "time value", column: "created_at", value: time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC),
+			expected: Cell{Text: "01.07.2024 12:00"}},
+		{name: "equals class", column: "status", value: "overdue",
+			expected: Cell{Text: "overdue", Classes: []string{"highlight"}}},
+		{name: "link", column: "customer_id", value: 42,
+			expected: Cell{Text: "42", Href: "/reports/datatables/customers/orders?customer=42&region=EU"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, resolved.FormatCell(tt.column, tt.value, row))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns string
+	}{
+		{name: "unknown format", columns: `a: {format: {type: money}}`},
+		{name: "invalid locale", columns: `a: {format: {type: number, locale: "not a locale!"}}`},
+		{name: "invalid time zone", columns: `a: {format: {type: date, timeZone: Mars/Olympus}}`},
+		{name: "class without name", columns: `a: {classes: [{gt: 1}]}`},
+		{name: "link without command", columns: `a: {link: {parameters: {id: a}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var columns Columns
+			require.NoError(t, yaml.Unmarshal([]byte(tt.columns), &columns))
+			assert.Error(t, columns.Validate())
+		})
+	}
+}
+
+func TestHTMLRowFormatter(t *testing.T) {
+	columns, err := Columns{
+		"id":   {Link: &Link{Command: "/customers", Parameters: map[string]string{"id": "id"}}},
+		"name": {Classes: []*ClassRule{{Class: "highlight", Equals: "<b>"}}},
+	}.Resolve("")
+	require.NoError(t, err)
+
+	f := NewHTMLRowFormatter(columns)
+	buf := &bytes.Buffer{}
+	for _, name := range []string{"<b>", "alice"} {
+		err = f.OutputRow(context.Background(), types.NewRow(types.MRP("id", 1), types.MRP("name", name)), buf)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t,
+		"<tr><th>id</th><th>name</th></tr>\n"+
+			`<tr><td><a href="/customers?id=1">1</a></td><td class="highlight">&lt;b&gt;</td></tr>`+"\n"+
+			`<tr><td><a href="/customers?id=1">1</a></td><td>alice</td></tr>`+"\n",
+		buf.String())
+}
@@ -0,0 +1,72 @@
+package columns
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/formatters"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// HTMLRowFormatter renders rows as HTML table rows, applying the presentation rules of the columns.
+// Like the html table formatter of glazed, the first row is preceded by a header row.
+type HTMLRowFormatter struct {
+	columns          Columns
+	hasOutputHeaders bool
+}
+
+var _ formatters.RowOutputFormatter = (*HTMLRowFormatter)(nil)
+
+func NewHTMLRowFormatter(columns Columns) *HTMLRowFormatter {
+	return &HTMLRowFormatter{
+		columns: columns,
+	}
+}
+
+func (h *HTMLRowFormatter) RegisterTableMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (h *HTMLRowFormatter) RegisterRowMiddlewares(mw *middlewares.TableProcessor) error {
+	return nil
+}
+
+func (h *HTMLRowFormatter) ContentType() string {
+	return "text/html"
+}
+
+func (h *HTMLRowFormatter) Close(ctx context.Context, w io.Writer) error {
+	return nil
+}
+
+func (h *HTMLRowFormatter) OutputRow(ctx context.Context, row types.Row, w io.Writer) error {
+	sb := strings.Builder{}
+	if !h.hasOutputHeaders {
+		sb.WriteString("<tr>")
+		for _, field := range types.GetFields(row) {
+			sb.WriteString("<th>" + template.HTMLEscapeString(field) + "</th>")
+		}
+		sb.WriteString("</tr>\n")
+		h.hasOutputHeaders = true
+	}
+
+	sb.WriteString("<tr>")
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		cell := h.columns.FormatCell(pair.Key, pair.Value, row)
+		if len(cell.Classes) > 0 {
+			sb.WriteString(fmt.Sprintf(`<td class="%s">`, template.HTMLEscapeString(strings.Join(cell.Classes, " "))))
+		} else {
+			sb.WriteString("<td>")
+		}
+		sb.WriteString(string(cell.HTML()))
+		sb.WriteString("</td>")
+	}
+	sb.WriteString("</tr>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
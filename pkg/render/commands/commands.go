@@ -0,0 +1,407 @@
+// Package commands lets templates and markdown pages embed the results of glazed commands.
+//
+// A Runner executes the commands of a repository with a time limit, caching their results.
+// It provides template functions returning the rows of a command, or rendering them as an HTML table
+// or chart, as well as a goldmark extension rendering `parka-command` fenced code blocks.
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers"
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTimeout is the time limit of a command.
+	DefaultTimeout = 30 * time.Second
+	// DefaultCacheDuration is how long the results of a command are cached.
+	DefaultCacheDuration = time.Minute
+	// DefaultCacheSize is the maximum number of cached results, one per command and parameters.
+	DefaultCacheSize = 64
+	// ChartsScriptPath is the script drawing the charts, served with the parka static files.
+	ChartsScriptPath = "/dist/charts.js"
+)
+
+// Runner runs the commands of a repository for templates and markdown pages.
+type Runner struct {
+	repository    *repositories.Repository
+	timeout       time.Duration
+	cacheDuration time.Duration
+	cacheSize     int
+	now           func() time.Time
+	// assetPrefix is prepended to the paths of the parka static files
+	assetPrefix string
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	table   *types.Table
+	expires time.Time
+}
+
+type RunnerOption func(*Runner)
+
+// WithTimeout sets the time limit of a command. A zero timeout disables the limit.
+func WithTimeout(timeout time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.timeout = timeout
+	}
+}
+
+// WithCacheDuration sets how long results are cached. A zero duration disables caching.
+func WithCacheDuration(duration time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.cacheDuration = duration
+	}
+}
+
+// WithCacheSize sets the maximum number of results kept in the cache. The results expiring first are evicted.
+func WithCacheSize(size int) RunnerOption {
+	return func(r *Runner) {
+		r.cacheSize = size
+	}
+}
+
+// WithAssetPrefix sets the prefix of the URLs of the parka static files, such as the script drawing
+// the charts. This is the root path of the server, if it has one.
+func WithAssetPrefix(prefix string) RunnerOption {
+	return func(r *Runner) {
+		r.assetPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithClock sets the function used to get the current time, for testing.
+func WithClock(now func() time.Time) RunnerOption {
+	return func(r *Runner) {
+		r.now = now
+	}
+}
+
+func NewRunner(repository *repositories.Repository, options ...RunnerOption) *Runner {
+	r := &Runner{
+		repository:    repository,
+		timeout:       DefaultTimeout,
+		cacheDuration: DefaultCacheDuration,
+		cacheSize:     DefaultCacheSize,
+		now:           time.Now,
+		cache:         map[string]*cacheEntry{},
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Run runs the command at commandPath in the repository, for example `sales/revenue`.
+// parameters maps `param` (in the default layer) or `layer.param` to values, strings being parsed
+// like query parameters.
+func (r *Runner) Run(ctx context.Context, commandPath string, parameters map[string]interface{}) (*types.Table, error) {
+	b, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid parameters for command %s", commandPath)
+	}
+	key := commandPath + "|" + string(b)
+
+	if table_, ok := r.getCached(key); ok {
+		return table_, nil
+	}
+
+	cmd, err := r.getCommand(commandPath)
+	if err != nil {
+		return nil, err
+	}
+	glazeCommand, ok := cmd.(cmds.GlazeCommand)
+	if !ok {
+		return nil, errors.Errorf("command %s is not a glazed command", commandPath)
+	}
+
+	description := cmd.Description()
+	values_ := map[string]map[string]interface{}{}
+	for target, v := range parameters {
+		sectionSlug, parameter := parka_middlewares.ParseParameterTarget(target)
+		section, ok := description.Schema.Get(sectionSlug)
+		if !ok {
+			return nil, errors.Errorf("unknown layer %s for command %s", sectionSlug, commandPath)
+		}
+		if _, ok := section.GetDefinitions().Get(parameter); !ok {
+			return nil, errors.Errorf("unknown parameter %s for command %s", target, commandPath)
+		}
+		if _, ok := values_[sectionSlug]; !ok {
+			values_[sectionSlug] = map[string]interface{}{}
+		}
+		values_[sectionSlug][parameter] = v
+	}
+
+	parsedValues := values.New()
+	err = sources.Execute(description.Schema.Clone(), parsedValues,
+		sources.FromMap(values_, fields.WithSource("template")),
+		sources.FromDefaults(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	gp, err := handlers.CreateTableProcessorWithOutput(parsedValues, "table", "ascii")
+	if err != nil {
+		return nil, err
+	}
+	// the null table middleware keeps the rows in the processor's table
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	err = glazeCommand.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+	if err == nil {
+		err = gp.Close(ctx)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, errors.Errorf("command %s timed out after %s", commandPath, r.timeout)
+		}
+		return nil, err
+	}
+
+	table_ := gp.GetTable()
+	r.setCached(key, table_)
+
+	return table_, nil
+}
+
+func (r *Runner) getCached(key string) (*types.Table, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if !r.now().Before(entry.expires) {
+		delete(r.cache, key)
+		return nil, false
+	}
+	return entry.table, true
+}
+
+func (r *Runner) setCached(key string, table_ *types.Table) {
+	if r.cacheDuration <= 0 || r.cacheSize <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	delete(r.cache, key)
+	// drop expired entries, so that the cache doesn't grow with the parameters seen over time
+	for k, entry := range r.cache {
+		if !now.Before(entry.expires) {
+			delete(r.cache, k)
+		}
+	}
+	for len(r.cache) >= r.cacheSize {
+		oldestKey := ""
+		var oldest time.Time
+		for k, entry := range r.cache {
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = k, entry.expires
+			}
+		}
+		delete(r.cache, oldestKey)
+	}
+	r.cache[key] = &cacheEntry{table: table_, expires: now.Add(r.cacheDuration)}
+}
+
+func (r *Runner) getCommand(commandPath string) (cmds.Command, error) {
+	commands := r.repository.CollectCommands(strings.Split(strings.Trim(commandPath, "/"), "/"), false)
+	if len(commands) == 0 {
+		return nil, errors.Errorf("command %s not found", commandPath)
+	}
+	if len(commands) > 1 {
+		return nil, errors.Errorf("command path %s is ambiguous", commandPath)
+	}
+	return commands[0], nil
+}
+
+// FuncMap returns the template functions running commands with the context ctx:
+//
+//   - `command "path" ...parameters` returns the rows of the command, as maps from column to value
+//   - `commandTable "path" ...parameters` renders the rows as an HTML table
+//   - `commandChart chart "path" ...parameters` renders the rows as a chart, chart being a dict
+//     with the fields of a datatables chart (`type`, `x`, `y`, ...)
+//
+// Parameters are given as a dict, or as alternating names and values.
+// The first chart is preceded by ChartsScript, so the functions are meant to be bound to the request
+// each page is rendered for, see render.WithRequestFuncs.
+func (r *Runner) FuncMap(ctx context.Context) template.FuncMap {
+	chartsScript := false
+	return template.FuncMap{
+		"command": func(commandPath string, parameters ...interface{}) ([]map[string]interface{}, error) {
+			table_, err := r.runWithArgs(ctx, commandPath, parameters)
+			if err != nil {
+				return nil, err
+			}
+			ret := []map[string]interface{}{}
+			for _, row := range table_.Rows {
+				m := map[string]interface{}{}
+				for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+					m[pair.Key] = pair.Value
+				}
+				ret = append(ret, m)
+			}
+			return ret, nil
+		},
+		"commandTable": func(commandPath string, parameters ...interface{}) (template.HTML, error) {
+			table_, err := r.runWithArgs(ctx, commandPath, parameters)
+			if err != nil {
+				return "", err
+			}
+			return RenderTable(table_, nil, 0)
+		},
+		"commandChart": func(chart map[string]interface{}, commandPath string, parameters ...interface{}) (template.HTML, error) {
+			charts, err := datatables.ParseCharts([]interface{}{chart})
+			if err != nil {
+				return "", err
+			}
+			table_, err := r.runWithArgs(ctx, commandPath, parameters)
+			if err != nil {
+				return "", err
+			}
+			chart_, err := RenderChart(charts[0], table_)
+			if err != nil {
+				return "", err
+			}
+			if !chartsScript {
+				chartsScript = true
+				chart_ = template.HTML(r.ChartsScript()) + chart_ // #nosec G203
+			}
+			return chart_, nil
+		},
+	}
+}
+
+func (r *Runner) runWithArgs(ctx context.Context, commandPath string, args []interface{}) (*types.Table, error) {
+	parameters, err := parseParameters(args)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid parameters for command %s", commandPath)
+	}
+	return r.Run(ctx, commandPath, parameters)
+}
+
+// parseParameters converts the parameters passed to the template functions, either a single dict
+// or alternating names and values.
+func parseParameters(args []interface{}) (map[string]interface{}, error) {
+	if len(args) == 1 {
+		if m, ok := args[0].(map[string]interface{}); ok {
+			return m, nil
+		}
+	}
+	if len(args)%2 != 0 {
+		return nil, errors.New("expected a dict or alternating parameter names and values")
+	}
+
+	ret := map[string]interface{}{}
+	for i := 0; i < len(args); i += 2 {
+		name, ok := args[i].(string)
+		if !ok {
+			return nil, errors.Errorf("parameter name %v is not a string", args[i])
+		}
+		ret[name] = args[i+1]
+	}
+	return ret, nil
+}
+
+// RenderTable renders the rows of table_ as an HTML table, applying the presentation rules of columns_.
+// If limit is positive, only the first limit rows are rendered.
+func RenderTable(table_ *types.Table, columns_ columns.Columns, limit int) (template.HTML, error) {
+	rows := table_.Rows
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<table class="parka-command">` + "\n")
+	formatter := columns.NewHTMLRowFormatter(columns_)
+	for _, row := range rows {
+		err := formatter.OutputRow(context.Background(), row, buf)
+		if err != nil {
+			return "", err
+		}
+	}
+	buf.WriteString("</table>\n")
+
+	return template.HTML(buf.String()), nil // #nosec G203
+}
+
+// ChartClass is the class of the elements holding the charts rendered by RenderChart.
+const ChartClass = "parka-command-chart"
+
+// drawCharts replaces the elements rendered by RenderChart with the charts they hold, once the page is loaded.
+const drawCharts = `(function () {
+  function draw() {
+    document.querySelectorAll("pre.` + ChartClass + `").forEach(function (el) {
+      var data = JSON.parse(el.textContent);
+      var div = document.createElement("div");
+      div.className = "` + ChartClass + `";
+      el.replaceWith(div);
+      parkaCharts.render(div, data.chart, data.rows);
+    });
+  }
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", draw);
+  } else {
+    draw();
+  }
+})();`
+
+// ChartsScript loads ChartsScriptPath and draws the charts rendered by RenderChart.
+// It only needs to be added once to a page.
+func (r *Runner) ChartsScript() string {
+	return fmt.Sprintf("<script src=\"%s\"></script>\n<script>%s</script>\n",
+		template.HTMLEscapeString(r.assetPrefix+ChartsScriptPath), drawCharts)
+}
+
+// RenderChart renders the rows of table_ as a chart, drawn in the browser by ChartsScript.
+//
+// The chart and its rows are rendered as JSON in a hidden `pre` element, which is kept when sanitizing
+// the page, unlike scripts.
+func RenderChart(chart *datatables.Chart, table_ *types.Table) (template.HTML, error) {
+	rows := table_.Rows
+	if rows == nil {
+		rows = []types.Row{}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"chart": chart,
+		"rows":  rows,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(fmt.Sprintf( // #nosec G203
+		"<pre class=\"%s\" style=\"display: none\">%s</pre>\n",
+		ChartClass, template.HTMLEscapeString(string(data)))), nil
+}
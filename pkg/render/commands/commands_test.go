@@ -0,0 +1,244 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/helpers/templating"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCommand counts how often it is run, and blocks until the context is done if slow is set.
+type testCommand struct {
+	*utils.TestGlazedCommand
+	runs int
+	slow bool
+}
+
+func (c *testCommand) RunIntoGlazeProcessor(ctx context.Context, parsedValues *values.Values, gp middlewares.Processor) error {
+	c.runs++
+	if c.slow {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.TestGlazedCommand.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+}
+
+func newTestRunner(t *testing.T, options ...RunnerOption) (*Runner, *testCommand) {
+	orders, err := utils.NewTestGlazedCommand(
+		cmds.WithName("orders"),
+		cmds.WithParents("sales"),
+		cmds.WithFlags(fields.New("region", fields.TypeString, fields.WithDefault("all"))),
+	)
+	require.NoError(t, err)
+	slow, err := utils.NewTestGlazedCommand(cmds.WithName("slow"), cmds.WithParents("sales"))
+	require.NoError(t, err)
+
+	cmd := &testCommand{TestGlazedCommand: orders}
+	r := repositories.NewRepository()
+	r.Add(cmd, &testCommand{TestGlazedCommand: slow, slow: true})
+
+	return NewRunner(r, options...), cmd
+}
+
+func TestFuncMap(t *testing.T) {
+	tests := []struct {
+		name          string
+		template      string
+		expected      []string
+		expectedError bool
+	}{
+		{
+			name:     "rows",
+			template: `{{ range command "sales/orders" "region" "us" }}{{ .region }}-{{ .test }};{{ end }}`,
+			expected: []string{"us-0;us-1;us-2;"},
+		},
+		{
+			name:     "parameters as dict",
+			template: `{{ len (command "sales/orders" (dict "region" "eu")) }}`,
+			expected: []string{"3"},
+		},
+		{
+			name:     "table",
+			template: `{{ commandTable "sales/orders" }}`,
+			expected: []string{`<table class="parka-command">`, "<th>region</th>", "<td>test-2</td>", "<td>all</td>"},
+		},
+		{
+			name:     "chart",
+			template: `{{ commandChart (dict "type" "bar" "x" "test2" "y" "test") "sales/orders" }}`,
+			expected: []string{
+				`<script src="/root/dist/charts.js"></script>`,
+				`<pre class="parka-command-chart" style="display: none">` +
+					`{&#34;chart&#34;:{&#34;type&#34;:&#34;bar&#34;,&#34;x&#34;:&#34;test2&#34;,&#34;y&#34;:[&#34;test&#34;]},` +
+					`&#34;rows&#34;:[{&#34;test&#34;:0,&#34;test2&#34;:&#34;test-0&#34;`,
+			},
+		},
+		{name: "unknown parameter", template: `{{ command "sales/orders" "country" "fr" }}`, expectedError: true},
+		{name: "unknown command", template: `{{ command "sales/unknown" }}`, expectedError: true},
+		{name: "odd parameters", template: `{{ command "sales/orders" "region" }}`, expectedError: true},
+		{name: "invalid chart", template: `{{ commandChart (dict "type" "radar") "sales/orders" }}`, expectedError: true},
+	}
+
+	runner, _ := newTestRunner(t, WithAssetPrefix("/root/"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := templating.CreateHTMLTemplate("test").Funcs(runner.FuncMap(context.Background())).Parse(tt.template)
+			require.NoError(t, err)
+
+			buf := &bytes.Buffer{}
+			err = tmpl.Execute(buf, nil)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			for _, expected := range tt.expected {
+				assert.Contains(t, buf.String(), expected)
+			}
+		})
+	}
+}
+
+func TestFuncMapCharts(t *testing.T) {
+	runner, _ := newTestRunner(t)
+	tmpl, err := templating.CreateHTMLTemplate("test").Funcs(runner.FuncMap(context.Background())).Parse(
+		`{{ commandChart (dict "type" "bar" "x" "test2" "y" "test") "sales/orders" }}` +
+			`{{ commandChart (dict "type" "line" "x" "test2" "y" "test") "sales/orders" }}`)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, tmpl.Execute(buf, nil))
+	// the charts script is only loaded once per page
+	assert.Equal(t, 1, strings.Count(buf.String(), `<script src="/dist/charts.js"></script>`))
+	assert.Equal(t, 2, strings.Count(buf.String(), `<pre class="parka-command-chart"`))
+}
+
+func TestFuncMapContext(t *testing.T) {
+	runner, _ := newTestRunner(t, WithTimeout(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tmpl, err := templating.CreateHTMLTemplate("test").Funcs(runner.FuncMap(ctx)).Parse(`{{ command "sales/slow" }}`)
+	require.NoError(t, err)
+	err = tmpl.Execute(&bytes.Buffer{}, nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRunnerCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	runner, cmd := newTestRunner(t, WithClock(func() time.Time { return now }))
+
+	ctx := context.Background()
+	_, err := runner.Run(ctx, "sales/orders", map[string]interface{}{"region": "us"})
+	require.NoError(t, err)
+	_, err = runner.Run(ctx, "sales/orders", map[string]interface{}{"region": "us"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, cmd.runs)
+
+	_, err = runner.Run(ctx, "sales/orders", map[string]interface{}{"region": "eu"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, cmd.runs)
+
+	now = now.Add(DefaultCacheDuration)
+	_, err = runner.Run(ctx, "sales/orders", map[string]interface{}{"region": "us"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cmd.runs)
+}
+
+func TestRunnerCacheSize(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	runner, cmd := newTestRunner(t, WithCacheSize(2), WithClock(func() time.Time { return now }))
+
+	ctx := context.Background()
+	run := func(region string) {
+		_, err := runner.Run(ctx, "sales/orders", map[string]interface{}{"region": region})
+		require.NoError(t, err)
+	}
+
+	run("us")
+	now = now.Add(time.Second)
+	run("eu")
+	now = now.Add(time.Second)
+	run("apac")
+	// the oldest result is evicted
+	assert.Len(t, runner.cache, 2)
+	run("eu")
+	assert.Equal(t, 3, cmd.runs)
+	run("us")
+	assert.Equal(t, 4, cmd.runs)
+	assert.Len(t, runner.cache, 2)
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	runner, _ := newTestRunner(t, WithTimeout(10*time.Millisecond))
+
+	_, err := runner.Run(context.Background(), "sales/slow", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestMarkdownExtension(t *testing.T) {
+	runner, _ := newTestRunner(t)
+
+	markdown := "# Orders\n\n" +
+		"```parka-command\ncommand: sales/orders\nparameters:\n  region: us\nlimit: 2\n```\n\n" +
+		"```parka-command\ncommand: sales/unknown\n```\n\n" +
+		"```parka-command\ncommand: sales/orders\ndisplay: chart\nchart: { type: line, x: test, y: test }\n```\n\n" +
+		"```yaml\ncommand: sales/orders\n```\n"
+
+	engine, err := render.NewMarkdownEngine(render.WithMarkdownEngineExtensions(runner.MarkdownExtension()))
+	require.NoError(t, err)
+	html, err := engine.Render(context.Background(), markdown)
+	require.NoError(t, err)
+
+	assert.Contains(t, html, "<h1>Orders</h1>")
+	assert.Contains(t, html, "<td>test-1</td>")
+	assert.NotContains(t, html, "<td>test-2</td>")
+	assert.Contains(t, html, `<div class="alert alert-danger parka-command-error"><strong>Error</strong>command sales/unknown not found</div>`)
+	assert.Contains(t, html, `<pre class="parka-command-chart" style="display: none">`)
+	assert.Equal(t, 1, strings.Count(html, `<script src="/dist/charts.js"></script>`))
+	// other code blocks are left alone
+	assert.Contains(t, html, "<pre")
+	assert.Contains(t, html, "command")
+}
+
+func TestMarkdownExtensionSanitized(t *testing.T) {
+	runner, _ := newTestRunner(t)
+	engine, err := render.NewMarkdownEngine(
+		render.WithMarkdownSanitizer(true),
+		render.WithMarkdownEngineExtensions(runner.MarkdownExtension()),
+	)
+	require.NoError(t, err)
+
+	html, err := engine.Render(context.Background(),
+		"```parka-command\ncommand: sales/orders\ndisplay: chart\nchart: { type: line, x: test, y: test }\n```\n")
+	require.NoError(t, err)
+
+	// the charts are kept by the sanitizer, and the script drawing them is added afterwards
+	assert.Contains(t, html, `<pre class="parka-command-chart" style="display: none">`)
+	assert.Contains(t, html, `<script src="/dist/charts.js"></script>`)
+}
+
+func TestMarkdownExtensionContext(t *testing.T) {
+	runner, _ := newTestRunner(t, WithTimeout(0))
+	engine, err := render.NewMarkdownEngine(render.WithMarkdownEngineExtensions(runner.MarkdownExtension()))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	html, err := engine.Render(ctx, "```parka-command\ncommand: sales/slow\n```\n")
+	require.NoError(t, err)
+	assert.Contains(t, html, "context canceled")
+}
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"strings"
+
+	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/go-go-golems/parka/pkg/render/columns"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
+)
+
+// BlockLanguage is the language of the fenced code blocks rendered as command results.
+const BlockLanguage = "parka-command"
+
+// Block is the content of a `parka-command` fenced code block:
+//
+//	```parka-command
+//	command: sales/revenue
+//	parameters:
+//	  from: 2024-01-01
+//	display: chart
+//	chart: { type: line, x: day, y: revenue }
+//	```
+type Block struct {
+	Command string `yaml:"command"`
+	// Parameters maps `param` or `layer.param` to values.
+	Parameters map[string]interface{} `yaml:"parameters,omitempty"`
+	// Display is `table` (the default) or `chart`.
+	Display string            `yaml:"display,omitempty"`
+	Chart   *datatables.Chart `yaml:"chart,omitempty"`
+	// Limit is the maximum number of rows of tables, all rows are shown by default.
+	Limit   int             `yaml:"limit,omitempty"`
+	Columns columns.Columns `yaml:"columns,omitempty"`
+}
+
+// ParseBlock parses and validates the content of a command block.
+func ParseBlock(b []byte) (*Block, error) {
+	ret := &Block{}
+	err := yaml.Unmarshal(b, ret)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid command block")
+	}
+	if ret.Command == "" {
+		return nil, errors.New("command block without command")
+	}
+
+	switch ret.Display {
+	case "", "table":
+		ret.Display = "table"
+	case "chart":
+		if ret.Chart == nil {
+			return nil, errors.Errorf("chart block for %s has no chart", ret.Command)
+		}
+		err = ret.Chart.Validate()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unknown display %s for command block %s, expected table or chart", ret.Display, ret.Command)
+	}
+
+	err = ret.Columns.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// RenderBlock runs the command of block and renders its results.
+func (r *Runner) RenderBlock(ctx context.Context, block *Block) (template.HTML, error) {
+	table_, err := r.Run(ctx, block.Command, block.Parameters)
+	if err != nil {
+		return "", err
+	}
+
+	if block.Display == "chart" {
+		return RenderChart(block.Chart, table_)
+	}
+
+	// links are resolved relative to the page
+	columns_, err := block.Columns.Resolve(".")
+	if err != nil {
+		return "", err
+	}
+	return RenderTable(table_, columns_, block.Limit)
+}
+
+// KindCommandBlock is the kind of the nodes replacing `parka-command` fenced code blocks.
+var KindCommandBlock = ast.NewNodeKind("CommandBlock")
+
+// commandBlock is the node replacing a `parka-command` fenced code block, holding its content
+// and the context of the request the page is rendered for.
+type commandBlock struct {
+	ast.BaseBlock
+	content []byte
+	ctx     context.Context
+}
+
+func (n *commandBlock) Kind() ast.NodeKind {
+	return KindCommandBlock
+}
+
+func (n *commandBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Content": string(n.content)}, nil)
+}
+
+// MarkdownExtension returns a goldmark extension rendering `parka-command` fenced code blocks
+// with the results of their command. Errors are rendered in place of the results, so that they
+// don't prevent the rest of the page from rendering.
+//
+// The commands are run with the context of the request, see render.RequestContext, and the
+// ChartsScript is added to the pages with charts.
+func (r *Runner) MarkdownExtension() goldmark.Extender {
+	return &markdownExtension{runner: r}
+}
+
+type markdownExtension struct {
+	runner *Runner
+}
+
+// PageScript returns the ChartsScript if the page has charts that are not drawn yet,
+// see render.PageScripter.
+func (e *markdownExtension) PageScript(html string) string {
+	if !strings.Contains(html, `<pre class="`+ChartClass+`"`) || strings.Contains(html, ChartsScriptPath+`"`) {
+		return ""
+	}
+	return e.runner.ChartsScript()
+}
+
+func (e *markdownExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&blockTransformer{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&blockRenderer{runner: e.runner}, 100)))
+}
+
+type blockTransformer struct{}
+
+func (t *blockTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	blocks := []*ast.FencedCodeBlock{}
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if fcb, ok := n.(*ast.FencedCodeBlock); ok && string(fcb.Language(source)) == BlockLanguage {
+			blocks = append(blocks, fcb)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, fcb := range blocks {
+		content := bytes.Buffer{}
+		lines := fcb.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			content.Write(line.Value(source))
+		}
+		fcb.Parent().ReplaceChild(fcb.Parent(), fcb, &commandBlock{
+			content: content.Bytes(),
+			ctx:     render.RequestContext(pc),
+		})
+	}
+}
+
+type blockRenderer struct {
+	runner *Runner
+}
+
+func (br *blockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindCommandBlock, br.render)
+}
+
+func (br *blockRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	cb := n.(*commandBlock)
+	block, err := ParseBlock(cb.content)
+	var html template.HTML
+	if err == nil {
+		html, err = br.runner.RenderBlock(cb.ctx, block)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to render command block")
+		_, _ = w.WriteString(`<div class="alert alert-danger parka-command-error"><strong>Error</strong>` +
+			template.HTMLEscapeString(err.Error()) + "</div>\n")
+		return ast.WalkSkipChildren, nil
+	}
+
+	_, _ = w.WriteString(string(html))
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,233 @@
+package render
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-go-golems/clay/pkg/watcher"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// DataDirectory loads the YAML, JSON and CSV files of a directory, which the Renderer
+// exposes to the templates as `.Data`, see WithDataDirectory.
+//
+// Each file is available under its path relative to the directory, without extension:
+// `data/team.yaml` is `.Data.team`, and `data/kpi/thresholds.json` is `.Data.kpi.thresholds`.
+// CSV files are lists of rows mapping the column names of the header to the values, like the
+// results of commands, with numbers converted to int64 or float64.
+//
+// When a file fails to load while watching, the last good version of the file is kept.
+type DataDirectory struct {
+	directory string
+
+	mu sync.Mutex
+	// files are the loaded values of the files, keyed by their path relative to the directory
+	files map[string]interface{}
+	data  map[string]interface{}
+}
+
+var dataFileExtensions = []string{".yaml", ".yml", ".json", ".csv"}
+
+// NewDataDirectory loads the data files of directory. A missing directory has no data.
+func NewDataDirectory(directory string) (*DataDirectory, error) {
+	dir, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &DataDirectory{
+		directory: dir,
+		files:     map[string]interface{}{},
+		data:      map[string]interface{}{},
+	}
+	err = ret.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Directory returns the absolute path of the directory.
+func (d *DataDirectory) Directory() string {
+	return d.directory
+}
+
+// Data returns the values of the data files. It must not be modified.
+func (d *DataDirectory) Data() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.data
+}
+
+// Reload loads all the data files again. If a file fails to load, its last good version is kept
+// and the error is returned once the other files are loaded.
+func (d *DataDirectory) Reload() error {
+	files := []string{}
+	err := filepath.WalkDir(d.directory, func(p string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == d.directory {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.IsDir() && isDataFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous := d.files
+	d.files = map[string]interface{}{}
+	var loadErr error
+	for _, p := range files {
+		name, _ := d.relativeName(p)
+		v, err := loadDataFile(p)
+		if err != nil {
+			log.Warn().Err(err).Str("file", p).Msg("Failed to load data file, keeping the last good version")
+			if loadErr == nil {
+				loadErr = err
+			}
+			if v_, ok := previous[name]; ok {
+				d.files[name] = v_
+			}
+			continue
+		}
+		d.files[name] = v
+	}
+	d.data = buildData(d.files)
+
+	return loadErr
+}
+
+// Watch reloads the data files when they change, until ctx is done.
+func (d *DataDirectory) Watch(ctx context.Context) error {
+	if _, err := os.Stat(d.directory); err != nil {
+		log.Warn().Err(err).Str("directory", d.directory).Msg("Not watching data directory")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	reload := func(p string) error {
+		log.Debug().Str("file", p).Msg("Reloading data files")
+		// errors are logged, and the last good versions kept
+		_ = d.Reload()
+		return nil
+	}
+	w := watcher.NewWatcher(
+		watcher.WithPaths(d.directory),
+		watcher.WithWriteCallback(reload),
+		watcher.WithRemoveCallback(reload),
+	)
+
+	return w.Run(ctx)
+}
+
+func (d *DataDirectory) relativeName(p string) (string, bool) {
+	rel, err := filepath.Rel(d.directory, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func isDataFile(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	for _, e := range dataFileExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func loadDataFile(p string) (interface{}, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret interface{}
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &ret)
+	case ".json":
+		err = json.Unmarshal(b, &ret)
+	case ".csv":
+		ret, err = parseCSVRows(string(b))
+	default:
+		return nil, errors.Errorf("unsupported data file %s", p)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load data file %s", p)
+	}
+	return ret, nil
+}
+
+// parseCSVRows returns the rows of a CSV file with a header, as maps from column name to value.
+func parseCSVRows(s string) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(strings.NewReader(s)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]interface{}{}
+	if len(records) == 0 {
+		return rows, nil
+	}
+	header := records[0]
+	for _, record := range records[1:] {
+		row := map[string]interface{}{}
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = parseCSVValue(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseCSVValue(s string) interface{} {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// buildData nests the values of the files by directory, keyed by file name without extension.
+func buildData(files map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for name, v := range files {
+		parts := strings.Split(strings.TrimSuffix(name, path.Ext(name)), "/")
+		m := ret
+		for _, dir := range parts[:len(parts)-1] {
+			sub, ok := m[dir].(map[string]interface{})
+			if !ok {
+				sub = map[string]interface{}{}
+				m[dir] = sub
+			}
+			m = sub
+		}
+		m[parts[len(parts)-1]] = v
+	}
+	return ret
+}
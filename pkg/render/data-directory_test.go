@@ -0,0 +1,164 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected map[string]interface{}
+		err      bool
+	}{
+		{
+			name:     "empty",
+			files:    map[string]string{},
+			expected: map[string]interface{}{},
+		},
+		{
+			name: "yaml and json",
+			files: map[string]string{
+				"team.yaml":  "- name: ana\n  role: ops\n",
+				"site.yml":   "title: Reports\n",
+				"kpi.json":   `{"threshold": 0.5}`,
+				"README.txt": "not data",
+			},
+			expected: map[string]interface{}{
+				"team": []interface{}{map[string]interface{}{"name": "ana", "role": "ops"}},
+				"site": map[string]interface{}{"title": "Reports"},
+				"kpi":  map[string]interface{}{"threshold": 0.5},
+			},
+		},
+		{
+			name: "csv",
+			files: map[string]string{
+				"sales.csv": "region,units,revenue\nnorth,12,1.5\nsouth,,n/a\n",
+			},
+			expected: map[string]interface{}{
+				"sales": []map[string]interface{}{
+					{"region": "north", "units": int64(12), "revenue": 1.5},
+					{"region": "south", "units": "", "revenue": "n/a"},
+				},
+			},
+		},
+		{
+			name: "subdirectories",
+			files: map[string]string{
+				"kpi/thresholds.json": `{"churn": 3}`,
+				"kpi/2024/q1.yaml":    "revenue: 10\n",
+			},
+			expected: map[string]interface{}{
+				"kpi": map[string]interface{}{
+					"thresholds": map[string]interface{}{"churn": float64(3)},
+					"2024": map[string]interface{}{
+						"q1": map[string]interface{}{"revenue": 10},
+					},
+				},
+			},
+		},
+		{
+			name:  "invalid file",
+			files: map[string]string{"broken.json": `{`},
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplateFiles(t, dir, tt.files)
+			d, err := NewDataDirectory(dir)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, d.Data())
+		})
+	}
+}
+
+func TestDataDirectoryMissing(t *testing.T) {
+	d, err := NewDataDirectory(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, d.Data())
+}
+
+func TestDataDirectoryReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{
+		"site.yaml": "title: Reports\n",
+		"team.yaml": "lead: ana\n",
+	})
+	d, err := NewDataDirectory(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site.yaml"), []byte("title: Dashboards\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team.yaml"), []byte("lead: [\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.json"), []byte(`[1]`), 0644))
+
+	// the invalid file keeps its last good version
+	assert.Error(t, d.Reload())
+	assert.Equal(t, map[string]interface{}{
+		"site": map[string]interface{}{"title": "Dashboards"},
+		"team": map[string]interface{}{"lead": "ana"},
+		"new":  []interface{}{float64(1)},
+	}, d.Data())
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "team.yaml")))
+	require.NoError(t, d.Reload())
+	assert.NotContains(t, d.Data(), "team")
+}
+
+func TestRendererData(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{
+		"site.yaml": "title: Reports\n",
+		"sales.csv": "region,units\nnorth,12\nsouth,3\n",
+	})
+	d, err := NewDataDirectory(dir)
+	require.NoError(t, err)
+
+	fs := fstest.MapFS{
+		"base.tmpl.html": {Data: []byte(`<title>{{ .Data.site.title }}</title>{{ .markdown }}`)},
+		"sales.tmpl.html": {Data: []byte(
+			`{{ range .Data.sales }}<td>{{ .region }}: {{ .units }}</td>{{ end }}`,
+		)},
+		"notes.md": {Data: []byte("{{ len .Data.sales }} regions\n")},
+	}
+	r, err := NewRenderer(
+		WithAppendTemplateLookups(NewLookupTemplateFromFS(WithFS(fs), WithPatterns("*.md", "*.tmpl.html"))),
+		WithMarkdownBaseTemplateName("base.tmpl.html"),
+		WithDataDirectory(d),
+	)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/*", r.WithTemplateDirHandler(nil))
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/sales", expected: `<td>north: 12</td><td>south: 3</td>`},
+		{path: "/notes", expected: "<title>Reports</title><p>2 regions</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expected, resp.Body.String())
+		})
+	}
+}
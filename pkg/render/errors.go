@@ -0,0 +1,219 @@
+package render
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultMaxBufferSize is the size up to which rendered pages are buffered, see BufferedResponseWriter.
+const DefaultMaxBufferSize = 4 << 20
+
+// BufferedResponseWriter buffers a rendered page before sending it, so that an error
+// happening while rendering can still be turned into an error page with the right status code.
+//
+// Pages larger than maxSize are streamed: once the buffer is full, it is sent along with
+// the rest of the page, and errors can only be reported inside the page, see HandleRenderError.
+type BufferedResponseWriter struct {
+	c       echo.Context
+	status  int
+	maxSize int
+	buf     bytes.Buffer
+}
+
+// NewBufferedResponseWriter creates a writer buffering up to maxSize bytes of the response of c,
+// sent with status when flushed. If maxSize is not positive, the response is not buffered.
+func NewBufferedResponseWriter(c echo.Context, status int, maxSize int) *BufferedResponseWriter {
+	return &BufferedResponseWriter{
+		c:       c,
+		status:  status,
+		maxSize: maxSize,
+	}
+}
+
+func (w *BufferedResponseWriter) Write(p []byte) (int, error) {
+	if !w.c.Response().Committed && w.buf.Len()+len(p) <= w.maxSize {
+		return w.buf.Write(p)
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return 0, err
+	}
+	return w.c.Response().Write(p)
+}
+
+// Flush sends the headers and the buffered content.
+func (w *BufferedResponseWriter) Flush() error {
+	if !w.c.Response().Committed {
+		w.c.Response().WriteHeader(w.status)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.c.Response().Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// RequestID returns the ID of the request, as set by the request ID middleware of the server.
+// If the request has no ID, one is generated and set on the response.
+func RequestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	if id := c.Request().Header.Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+	if !c.Response().Committed {
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+	}
+	return id
+}
+
+// TemplateSourceLookup is implemented by template lookups that can return the source of
+// their template files, which is used to show an excerpt of the failing template on error pages.
+type TemplateSourceLookup interface {
+	TemplateSource(name string) (string, bool)
+}
+
+// RenderError describes an error that happened while rendering a page.
+type RenderError struct {
+	RequestID string
+	Message   string
+	// Template, Line and Column are the location of the error, if it happened in a template
+	Template string
+	Line     int
+	Column   int
+	// Excerpt are the lines of the template surrounding Line
+	Excerpt []ExcerptLine
+}
+
+type ExcerptLine struct {
+	Number    int
+	Text      string
+	Highlight bool
+}
+
+// excerptContext is the number of lines shown before and after the failing line
+const excerptContext = 3
+
+var templateLocationRegexp = regexp.MustCompile(`template: ?([^:\s]+):(\d+)(?::(\d+))?:`)
+
+// NewRenderError extracts the location of err from its message, if it is a template error,
+// and looks up an excerpt of the template in lookups.
+func NewRenderError(err error, requestID string, lookups ...TemplateLookup) *RenderError {
+	ret := &RenderError{
+		RequestID: requestID,
+		Message:   err.Error(),
+	}
+
+	m := templateLocationRegexp.FindStringSubmatch(ret.Message)
+	if m == nil {
+		return ret
+	}
+	ret.Template = m[1]
+	ret.Line, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		ret.Column, _ = strconv.Atoi(m[3])
+	}
+
+	for _, lookup := range lookups {
+		sl, ok := lookup.(TemplateSourceLookup)
+		if !ok {
+			continue
+		}
+		source, ok := sl.TemplateSource(ret.Template)
+		if !ok {
+			continue
+		}
+
+		lines := strings.Split(source, "\n")
+		for i := max(ret.Line-excerptContext, 1); i <= min(ret.Line+excerptContext, len(lines)); i++ {
+			ret.Excerpt = append(ret.Excerpt, ExcerptLine{
+				Number:    i,
+				Text:      lines[i-1],
+				Highlight: i == ret.Line,
+			})
+		}
+		break
+	}
+
+	return ret
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Internal Server Error</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+.highlight { background: #ffdce0; display: block; }
+.request-id { color: #666; }
+</style>
+</head>
+<body>
+<h1>Internal Server Error</h1>
+{{ if .DevMode -}}
+<p class="message">{{ .Error.Message }}</p>
+{{ if .Error.Template }}<p class="location"><code>{{ .Error.Template }}:{{ .Error.Line }}{{ if .Error.Column }}:{{ .Error.Column }}{{ end }}</code></p>{{ end }}
+{{ if .Error.Excerpt }}<pre class="excerpt">{{ range .Error.Excerpt }}<span{{ if .Highlight }} class="highlight"{{ end }}>{{ printf "%4d" .Number }}  {{ .Text }}</span>
+{{ end }}</pre>{{ end }}
+{{- else -}}
+<p>Something went wrong while rendering this page.</p>
+{{- end }}
+<p class="request-id">Request ID: {{ .Error.RequestID }}</p>
+</body>
+</html>
+`))
+
+// HandleRenderError logs err with the ID of the request, and reports it to the browser.
+// If the response has not been sent yet, it is replaced by a 500 error page, showing the
+// location of the error and an excerpt of the template in dev mode. Otherwise, an error block
+// is appended to the page that has been streamed so far.
+func HandleRenderError(c echo.Context, err error, devMode bool, lookups ...TemplateLookup) error {
+	requestID := RequestID(c)
+	log.Error().Err(err).
+		Str("request_id", requestID).
+		Str("url", c.Request().URL.String()).
+		Bool("streaming", c.Response().Committed).
+		Msg("Failed to render page")
+
+	if c.Response().Committed {
+		_, err = io.WriteString(c.Response(), StreamingErrorBlock(requestID))
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusInternalServerError)
+	return errorPageTemplate.Execute(c.Response(), map[string]interface{}{
+		"DevMode": devMode,
+		"Error":   NewRenderError(err, requestID, lookups...),
+	})
+}
+
+// StreamingErrorBlock is the HTML appended to a page that fails after it has started streaming.
+// Closing the elements that might still be open is left to the browser.
+func StreamingErrorBlock(requestID string) string {
+	return fmt.Sprintf(
+		`<div class="alert alert-danger parka-render-error" role="alert">`+
+			`An error occurred while rendering this page (request ID: %s).</div>`+"\n",
+		template.HTMLEscapeString(requestID),
+	)
+}
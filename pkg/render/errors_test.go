@@ -0,0 +1,175 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRendererErrorPages(t *testing.T) {
+	fs := fstest.MapFS{
+		"templates/ok.tmpl.html": {Data: []byte("<p>{{ .title }}</p>\n")},
+		"templates/broken.tmpl.html": {Data: []byte(
+			"<h1>{{ .title }}</h1>\n<ul>\n{{ index .items 5 }}\n</ul>\n",
+		)},
+		"templates/large.tmpl.html": {Data: []byte(
+			"{{ range .items }}<p>{{ . }}</p>{{ end }}{{ index .items 5 }}",
+		)},
+	}
+
+	tests := []struct {
+		name          string
+		page          string
+		options       []RendererOption
+		status        int
+		contains      []string
+		doesntContain []string
+	}{
+		{
+			name:     "ok",
+			page:     "ok",
+			status:   http.StatusOK,
+			contains: []string{"<p>Title</p>"},
+		},
+		{
+			name:          "broken",
+			page:          "broken",
+			status:        http.StatusInternalServerError,
+			contains:      []string{"Internal Server Error", "Request ID: test-id"},
+			doesntContain: []string{"<h1>Title</h1>", "broken.tmpl.html", "index out of range"},
+		},
+		{
+			name:    "broken in dev mode",
+			page:    "broken",
+			options: []RendererOption{WithDevMode(true)},
+			status:  http.StatusInternalServerError,
+			contains: []string{
+				"index out of range",
+				"<code>broken.tmpl.html:3:3</code>",
+				`<span class="highlight">   3  {{ index .items 5 }}</span>`,
+				"   1  &lt;h1&gt;",
+				"Request ID: test-id",
+			},
+			doesntContain: []string{"<h1>Title</h1>"},
+		},
+		{
+			name:    "streamed",
+			page:    "large",
+			options: []RendererOption{WithMaxBufferSize(8)},
+			status:  http.StatusOK,
+			contains: []string{
+				"<p>a</p><p>b</p>",
+				`<div class="alert alert-danger parka-render-error" role="alert">`,
+				"request ID: test-id",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := NewLookupTemplateFromFS(
+				WithFS(fs),
+				WithBaseDir("templates/"),
+				WithPatterns("**/*.tmpl.html"),
+			)
+			options := append([]RendererOption{
+				WithAppendTemplateLookups(lookup),
+				WithMarkdownBaseTemplateName("ok.tmpl.html"),
+			}, tt.options...)
+			r, err := NewRenderer(options...)
+			require.NoError(t, err)
+
+			e := echo.New()
+			e.GET("/*", r.WithTemplateDirHandler(map[string]interface{}{
+				"title": "Title",
+				"items": []string{"a", "b"},
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.page, nil)
+			req.Header.Set(echo.HeaderXRequestID, "test-id")
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.status, resp.Code)
+			for _, s := range tt.contains {
+				assert.Contains(t, resp.Body.String(), s)
+			}
+			for _, s := range tt.doesntContain {
+				assert.NotContains(t, resp.Body.String(), s)
+			}
+		})
+	}
+}
+
+func TestNewRenderError(t *testing.T) {
+	lookup := NewLookupTemplateFromFS(
+		WithFS(fstest.MapFS{
+			"page.html": {Data: []byte(strings.Repeat("line\n", 9) + "line 10")},
+		}),
+		WithPatterns("*.html"),
+	)
+
+	tests := []struct {
+		name     string
+		err      error
+		template string
+		line     int
+		column   int
+		excerpt  []int
+	}{
+		{
+			name: "no location",
+			err:  errors.New("failed"),
+		},
+		{
+			name:     "execution error",
+			err:      errors.Wrap(errors.New(`template: page.html:5:3: executing "page.html" at <.x>: failed`), "error executing template"),
+			template: "page.html",
+			line:     5,
+			column:   3,
+			excerpt:  []int{2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			name:     "escaping error at the end of the file",
+			err:      errors.New(`html/template:page.html:10: no such template "missing"`),
+			template: "page.html",
+			line:     10,
+			excerpt:  []int{7, 8, 9, 10},
+		},
+		{
+			name:     "unknown template",
+			err:      errors.New(`template: other.html:1:1: failed`),
+			template: "other.html",
+			line:     1,
+			column:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := NewRenderError(tt.err, "id", lookup)
+			assert.Equal(t, tt.err.Error(), re.Message)
+			assert.Equal(t, tt.template, re.Template)
+			assert.Equal(t, tt.line, re.Line)
+			assert.Equal(t, tt.column, re.Column)
+
+			lines := []int{}
+			for _, l := range re.Excerpt {
+				lines = append(lines, l.Number)
+				assert.Equal(t, l.Number == tt.line, l.Highlight)
+			}
+			if tt.excerpt == nil {
+				assert.Empty(t, lines)
+			} else {
+				assert.Equal(t, tt.excerpt, lines)
+			}
+		})
+	}
+}
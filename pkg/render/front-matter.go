@@ -0,0 +1,141 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Page describes a page rendered by the Renderer, from the YAML front matter of its template:
+//
+//	---
+//	title: Quarterly report
+//	description: Revenue and churn for the last quarter
+//	layout: reports/_layout.tmpl.html
+//	date: 2024-04-01
+//	draft: true
+//	owner: finance
+//	---
+//	# {{ .Page.Title }}
+//
+// The page is passed to the page template, the base template and the layouts as `.Page`.
+// Pages without front matter have an empty Page.
+type Page struct {
+	// Name is the name of the template file of the page.
+	Name string `yaml:"-"`
+
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	// Layout is the template the page is rendered into. It replaces the markdown base template
+	// of markdown pages, and the `_layout.tmpl.html` of the directory when layouts are enabled.
+	Layout string    `yaml:"layout"`
+	Date   time.Time `yaml:"date"`
+	// Draft pages are only served in dev mode.
+	Draft bool `yaml:"draft"`
+	// Hidden pages are served, but not listed in the navigation of the site.
+	Hidden bool `yaml:"hidden"`
+	// Weight orders the pages in the navigation, lighter pages first.
+	Weight int `yaml:"weight"`
+
+	// Params are all the values of the front matter, including the ones above,
+	// for example `.Page.Params.owner`.
+	Params map[string]interface{} `yaml:"-"`
+
+	// Heading is the text of the first heading of the page, `# ...` in markdown or `<h1>` in HTML.
+	// It is empty if the heading is computed by the template.
+	Heading string `yaml:"-"`
+}
+
+// PageLookup is implemented by template lookups that parse the front matter of their templates.
+type PageLookup interface {
+	// LookupPage returns the page of the first of the given templates that exists.
+	LookupPage(name ...string) (*Page, bool)
+}
+
+const frontMatterDelimiter = "---"
+
+// ParseFrontMatter splits source into the page described by its front matter and the template body.
+// The front matter is replaced by a template comment spanning the same lines, so that the line numbers
+// of template errors still match the file. The Heading of the page is taken from the body.
+func ParseFrontMatter(name string, source string) (*Page, string, error) {
+	page := &Page{
+		Name:   name,
+		Params: map[string]interface{}{},
+	}
+
+	lines := strings.SplitAfter(source, "\n")
+	if len(lines) == 0 || strings.TrimRight(lines[0], "\r\n") != frontMatterDelimiter {
+		page.Heading = firstHeading(name, source)
+		return page, source, nil
+	}
+
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], "\r\n") == frontMatterDelimiter {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return nil, "", errors.Errorf("front matter of %s is not closed", name)
+	}
+
+	frontMatter := strings.Join(lines[1:end], "")
+	err := yaml.Unmarshal([]byte(frontMatter), page)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "invalid front matter in %s", name)
+	}
+	err = yaml.Unmarshal([]byte(frontMatter), &page.Params)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "invalid front matter in %s", name)
+	}
+	if page.Params == nil {
+		page.Params = map[string]interface{}{}
+	}
+
+	rest := strings.Join(lines[end+1:], "")
+	page.Heading = firstHeading(name, rest)
+	body := "{{/*" + strings.Repeat("\n", end+1) + "*/}}" + rest
+	return page, body, nil
+}
+
+var (
+	htmlHeadingRegexp = regexp.MustCompile(`(?is)<h1[^>]*>(.*?)</h1>`)
+	htmlTagRegexp     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// firstHeading returns the text of the first level 1 heading of the markdown or HTML body,
+// or an empty string if there is none, or if it contains template actions.
+func firstHeading(name string, body string) string {
+	heading := ""
+	if strings.HasSuffix(name, ".md") {
+		fenced := false
+		for _, line := range strings.Split(body, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+				fenced = !fenced
+				continue
+			}
+			if !fenced && strings.HasPrefix(line, "# ") {
+				heading = strings.TrimSpace(line[2:])
+				// remove the optional closing sequence, `# Title #`
+				if i := strings.LastIndex(heading, " #"); i != -1 && strings.Trim(heading[i:], " #") == "" {
+					heading = strings.TrimSpace(heading[:i])
+				}
+				break
+			}
+		}
+	} else if m := htmlHeadingRegexp.FindStringSubmatch(body); m != nil {
+		heading = html.UnescapeString(htmlTagRegexp.ReplaceAllString(m[1], ""))
+		heading = strings.Join(strings.Fields(heading), " ")
+	}
+
+	if strings.Contains(heading, "{{") {
+		return ""
+	}
+	return heading
+}
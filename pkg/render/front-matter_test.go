@@ -0,0 +1,187 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected *Page
+		body     string
+		err      bool
+	}{
+		{
+			name:     "no front matter",
+			source:   "# Title\n",
+			expected: &Page{Name: "page.md", Params: map[string]interface{}{}, Heading: "Title"},
+			body:     "# Title\n",
+		},
+		{
+			name:   "front matter",
+			source: "---\ntitle: Report\ndate: 2024-04-01\ndraft: true\nweight: 2\nowner: finance\n---\n# {{ .Page.Title }}\n",
+			expected: &Page{
+				Name:   "page.md",
+				Title:  "Report",
+				Date:   time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+				Draft:  true,
+				Weight: 2,
+				Params: map[string]interface{}{
+					"title":  "Report",
+					"date":   time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+					"draft":  true,
+					"weight": 2,
+					"owner":  "finance",
+				},
+			},
+			// the front matter is commented out so that line numbers match the file
+			body: "{{/*\n\n\n\n\n\n\n*/}}# {{ .Page.Title }}\n",
+		},
+		{
+			name:     "empty front matter",
+			source:   "---\n---\n<p>body</p>",
+			expected: &Page{Name: "page.md", Params: map[string]interface{}{}},
+			body:     "{{/*\n\n*/}}<p>body</p>",
+		},
+		{
+			name:     "windows line endings",
+			source:   "---\r\ntitle: Report\r\n---\r\nbody",
+			expected: &Page{Name: "page.md", Title: "Report", Params: map[string]interface{}{"title": "Report"}},
+			body:     "{{/*\n\n\n*/}}body",
+		},
+		{
+			name:   "unclosed front matter",
+			source: "---\ntitle: Report\n",
+			err:    true,
+		},
+		{
+			name:   "invalid yaml",
+			source: "---\ntitle: [\n---\n",
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, body, err := ParseFrontMatter("page.md", tt.source)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, page)
+			assert.Equal(t, tt.body, body)
+		})
+	}
+}
+
+func TestFirstHeading(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{name: "page.md", body: "intro\n# Report\n## Details\n", expected: "Report"},
+		{name: "page.md", body: "# C# notes #\n", expected: "C# notes"},
+		{name: "page.tmpl.md", body: "```\n# comment\n```\n# Report\n", expected: "Report"},
+		{name: "page.md", body: "## Details\n", expected: ""},
+		{name: "page.md", body: "# {{ .Page.Title }}\n", expected: ""},
+		{name: "page.html", body: `<h1 class="title">Sales &amp; <em>churn</em></h1>`, expected: "Sales & churn"},
+		{name: "page.tmpl.html", body: "<H1>\n  Report\n</H1>", expected: "Report"},
+		{name: "page.html", body: "<h2>Report</h2>", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.body, func(t *testing.T) {
+			assert.Equal(t, tt.expected, firstHeading(tt.name, tt.body))
+		})
+	}
+}
+
+func TestRendererFrontMatter(t *testing.T) {
+	fs := fstest.MapFS{
+		"base.tmpl.html":  {Data: []byte(`<title>{{ .Page.Title }}</title>{{ .markdown }}`)},
+		"other.tmpl.html": {Data: []byte(`<h1>{{ .Page.Description }}</h1>{{ .markdown }}`)},
+		"report.md": {Data: []byte(
+			"---\ntitle: Report\nowner: finance\n---\nOwned by {{ .Page.Params.owner }}\n",
+		)},
+		"styled.md": {Data: []byte("---\nlayout: other.tmpl.html\ndescription: Styled\n---\ntext\n")},
+		"draft.md":  {Data: []byte("---\ndraft: true\n---\ndraft\n")},
+		"page.tmpl.html": {Data: []byte(
+			"---\ntitle: Page\n---\n<p>{{ .Page.Title }} {{ .Page.Name }}</p>",
+		)},
+	}
+
+	tests := []struct {
+		path     string
+		devMode  bool
+		status   int
+		expected string
+	}{
+		{
+			path:     "/report",
+			status:   http.StatusOK,
+			expected: "<title>Report</title><p>Owned by finance</p>\n",
+		},
+		{
+			path:     "/styled",
+			status:   http.StatusOK,
+			expected: "<h1>Styled</h1><p>text</p>\n",
+		},
+		{
+			path:     "/page",
+			status:   http.StatusOK,
+			expected: "<p>Page page.tmpl.html</p>",
+		},
+		{
+			path:   "/draft",
+			status: http.StatusNotFound,
+		},
+		{
+			path:     "/draft",
+			devMode:  true,
+			status:   http.StatusOK,
+			expected: "<title></title><p>draft</p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r, err := NewRenderer(
+				WithAppendTemplateLookups(NewLookupTemplateFromFS(
+					WithFS(fs),
+					WithPatterns("*.md", "*.tmpl.html"),
+				)),
+				WithMarkdownBaseTemplateName("base.tmpl.html"),
+				WithDevMode(tt.devMode),
+			)
+			require.NoError(t, err)
+
+			e := echo.New()
+			e.GET("/*", func(c echo.Context) error {
+				err := r.WithTemplateDirHandler(nil)(c)
+				if _, ok := err.(*utils.NoPageFoundError); ok {
+					return echo.ErrNotFound
+				}
+				return err
+			})
+
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.status, resp.Code)
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, resp.Body.String())
+			}
+		})
+	}
+}
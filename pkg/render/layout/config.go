@@ -0,0 +1,153 @@
+package layout
+
+import (
+	"time"
+
+	glazed_layout "github.com/go-go-golems/glazed/pkg/cmds/layout"
+	"github.com/pkg/errors"
+)
+
+// FormLayout describes the form rendered for a command from the parka config file,
+// so that the form can be customized without modifying the command itself.
+// If sections are set, they take precedence over the layout defined by the command.
+type FormLayout struct {
+	Sections []*FormSection `yaml:"sections,omitempty"`
+
+	// OptionsSources maps fields, given as `field` or `section.field`, to a command
+	// providing the options of the field, see OptionsSource.
+	OptionsSources map[string]*OptionsSource `yaml:"optionsSources,omitempty"`
+	// Validation maps fields, given as `field` or `section.field`, to additional validation constraints.
+	Validation map[string]*Validation `yaml:"validation,omitempty"`
+}
+
+// OptionsSource populates the options of a form input by running another glazed command
+// of the same repository. Each row returned by the command is an option.
+type OptionsSource struct {
+	// Command is the path of the command in the repository, for example `customers/active`.
+	Command string `yaml:"command"`
+	// ValueColumn and LabelColumn are the columns of the rows used as option value and label.
+	// LabelColumn defaults to ValueColumn.
+	ValueColumn string `yaml:"value"`
+	LabelColumn string `yaml:"label,omitempty"`
+	// Parameters are passed to the command's default section.
+	Parameters map[string]interface{} `yaml:"parameters,omitempty"`
+	// SearchParameter is the parameter of the command that receives the text typed by the user.
+	// If empty, the command is run once and its options are filtered by label.
+	SearchParameter string `yaml:"searchParameter,omitempty"`
+	// Limit is the maximum number of options returned, 100 if not set.
+	Limit int `yaml:"limit,omitempty"`
+	// CacheDuration is how long the options are cached, one minute if not set. Use a negative duration
+	// to disable caching.
+	CacheDuration time.Duration `yaml:"cacheDuration,omitempty"`
+}
+
+// GetOptionsSource returns the options source configured for a field, looked up by qualified
+// `section.field` name first, and by plain field name next. It also returns the key under which the source
+// was found.
+func (f *FormLayout) GetOptionsSource(sectionSlug string, name string) (string, *OptionsSource, bool) {
+	if f == nil {
+		return "", nil, false
+	}
+	for _, key := range []string{sectionSlug + "." + name, name} {
+		if source, ok := f.OptionsSources[key]; ok {
+			return key, source, true
+		}
+	}
+	return "", nil, false
+}
+
+// GetValidation returns the validation constraints configured for a field, looked up like GetOptionsSource.
+func (f *FormLayout) GetValidation(sectionSlug string, name string) (*Validation, bool) {
+	if f == nil {
+		return nil, false
+	}
+	for _, key := range []string{sectionSlug + "." + name, name} {
+		if validation, ok := f.Validation[key]; ok {
+			return validation, true
+		}
+	}
+	return nil, false
+}
+
+// Validate checks that all options sources reference a command and a value column,
+// and that validation constraints use a known item type.
+func (f *FormLayout) Validate() error {
+	if f == nil {
+		return nil
+	}
+	for key, source := range f.OptionsSources {
+		if source == nil || source.Command == "" {
+			return errors.Errorf("options source for %s has no command", key)
+		}
+		if source.ValueColumn == "" {
+			return errors.Errorf("options source for %s has no value column", key)
+		}
+	}
+	for key, validation := range f.Validation {
+		if validation == nil {
+			continue
+		}
+		switch validation.ItemType {
+		case "", "int", "float", "date":
+		default:
+			return errors.Errorf("invalid item type %s in validation for %s", validation.ItemType, key)
+		}
+	}
+	return nil
+}
+
+// FormSection is a section of a FormLayout.
+//
+// Inputs are configured like in a glazed layout, and reference fields either as `field`
+// or as `section.field`. Unqualified names are looked up in Section first, if set.
+//
+// If Rows is empty and Section is set, the section renders all the fields of that command
+// section (or only those listed in Fields), FieldsPerRow per row. This can be used to expose
+// a selection of glazed fields, for example `fields` and `sort-columns`, as part of the form.
+type FormSection struct {
+	Title       string `yaml:"title,omitempty"`
+	Description string `yaml:"description,omitempty"`
+
+	Section      string               `yaml:"section,omitempty"`
+	Fields       []string             `yaml:"fields,omitempty"`
+	FieldsPerRow int                  `yaml:"fieldsPerRow,omitempty"`
+	Rows         []*glazed_layout.Row `yaml:"rows,omitempty"`
+
+	// Collapsible sections are rendered as a disclosure widget. Collapsed sections are collapsible
+	// and closed by default, which is useful for "advanced" options.
+	Collapsible bool `yaml:"collapsible,omitempty"`
+	Collapsed   bool `yaml:"collapsed,omitempty"`
+
+	Style   string `yaml:"style,omitempty"`
+	Classes string `yaml:"classes,omitempty"`
+}
+
+// SectionSlugs returns the slugs of the command sections explicitly referenced by the layout,
+// either through FormSection.Section or through qualified input names.
+func (f *FormLayout) SectionSlugs() []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	add := func(slug string) {
+		if slug != "" && !seen[slug] {
+			seen[slug] = true
+			ret = append(ret, slug)
+		}
+	}
+
+	if f == nil {
+		return ret
+	}
+
+	for _, section := range f.Sections {
+		add(section.Section)
+		for _, row := range section.Rows {
+			for _, input := range row.Inputs {
+				if slug, _, ok := splitQualifiedName(input.Name); ok {
+					add(slug)
+				}
+			}
+		}
+	}
+
+	return ret
+}
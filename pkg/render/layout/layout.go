@@ -1,9 +1,15 @@
 package layout
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	glazed_layout "github.com/go-go-golems/glazed/pkg/cmds/layout"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/parka/pkg/glazed/middlewares"
 	"github.com/pkg/errors"
 )
 
@@ -12,17 +18,22 @@ import (
 
 // Layout might look at first similar to glazed_layout.Layout, but it is actually
 // the parsed and computed version used to render an HTML form.
+//
+// It is also served as JSON, so that other frontends can render the same forms.
 type Layout struct {
-	Sections []*Section
+	Sections []*Section `json:"sections"`
 }
 
 type Section struct {
-	Title            string
-	ShortDescription string
-	LongDescription  string
-	Style            string
-	Classes          string
-	Rows             []Row
+	Title            string `json:"title,omitempty"`
+	ShortDescription string `json:"shortDescription,omitempty"`
+	LongDescription  string `json:"longDescription,omitempty"`
+	Style            string `json:"style,omitempty"`
+	Classes          string `json:"classes,omitempty"`
+	// Collapsible sections are rendered as a disclosure widget, which is closed if Collapsed is set.
+	Collapsible bool  `json:"collapsible,omitempty"`
+	Collapsed   bool  `json:"collapsed,omitempty"`
+	Rows        []Row `json:"rows"`
 }
 
 type SectionOption func(*Section)
@@ -46,41 +57,89 @@ func WithSectionLongDescription(desc string) SectionOption {
 }
 
 type Row struct {
-	Inputs  []Input
-	Style   string
-	Classes string
+	Inputs  []Input `json:"inputs"`
+	Style   string  `json:"style,omitempty"`
+	Classes string  `json:"classes,omitempty"`
 }
 
 type Input struct {
-	Name string
-
-	Label   string
-	Options []Option
-	Default interface{}
-	Help    string
+	// Name is the name under which the input is submitted as query parameter.
+	Name string `json:"name"`
+	// Section and Field identify the command parameter of the input.
+	Section  string `json:"section"`
+	Field    string `json:"field"`
+	Required bool   `json:"required,omitempty"`
+
+	Label   string      `json:"label,omitempty"`
+	Options []Option    `json:"options,omitempty"`
+	Default interface{} `json:"default,omitempty"`
+	Help    string      `json:"help,omitempty"`
 
 	// this can be used to customizes the HTML output
 	// see https://github.com/go-go-golems/parka/issues/28
-	CSS      string
-	Id       string
-	Classes  string
-	Template string
-	Type     string
+	CSS      string `json:"css,omitempty"`
+	Id       string `json:"id,omitempty"`
+	Classes  string `json:"classes,omitempty"`
+	Template string `json:"template,omitempty"`
+	Type     string `json:"type"`
+
+	// Validation contains the constraints checked client-side before submitting the form.
+	Validation *Validation `json:"validation,omitempty"`
+
+	// OptionsURL is set if the options of the input are loaded from an options source,
+	// and returns the options matching the `q` query parameter as JSON.
+	OptionsURL string `json:"optionsUrl,omitempty"`
 
-	ParameterDefinition *fields.Definition
+	ParameterDefinition *fields.Definition `json:"-"`
 
-	Value interface{}
+	Value interface{} `json:"value,omitempty"`
 }
 
 type Option struct {
-	Label string
-	Value interface{}
+	Label string      `json:"label"`
+	Value interface{} `json:"value"`
+}
+
+type computeLayoutOptions struct {
+	formLayout *FormLayout
+	optionsURL string
+}
+
+type ComputeLayoutOption func(*computeLayoutOptions)
+
+// WithFormLayout overrides the layout of the command with a layout configured in the parka config file.
+func WithFormLayout(formLayout *FormLayout) ComputeLayoutOption {
+	return func(o *computeLayoutOptions) {
+		o.formLayout = formLayout
+	}
+}
+
+// WithOptionsURL sets the URL of the endpoint serving the options of the inputs
+// that have an options source, see FormLayout.OptionsSources.
+func WithOptionsURL(url string) ComputeLayoutOption {
+	return func(o *computeLayoutOptions) {
+		o.optionsURL = url
+	}
+}
+
+// layoutBuilder holds the state shared while computing the inputs of a layout.
+type layoutBuilder struct {
+	schema       *schema.Schema
+	parsedValues *values.Values
+	queryNames   map[string]map[string]string
+	options      *computeLayoutOptions
 }
 
 func ComputeLayout(
 	cmd cmds.Command,
 	parsedValues *values.Values,
+	options ...ComputeLayoutOption,
 ) (*Layout, error) {
+	options_ := &computeLayoutOptions{}
+	for _, option := range options {
+		option(options_)
+	}
+
 	description := cmd.Description()
 
 	layout := description.Layout
@@ -90,13 +149,40 @@ func ComputeLayout(
 	}
 
 	defaultSectionValues := parsedValues.DefaultSectionValues()
+	b := &layoutBuilder{
+		schema:       description.Schema,
+		parsedValues: parsedValues,
+		// fields with the same name in multiple sections are submitted using their qualified section.field name
+		queryNames: middlewares.ComputeQueryParameterNames(description.Schema),
+		options:    options_,
+	}
 
-	if len(layout) == 0 {
+	if options_.formLayout != nil && len(options_.formLayout.Sections) > 0 {
+		for _, formSection := range options_.formLayout.Sections {
+			section, err := b.computeFormSection(formSection)
+			if err != nil {
+				return nil, err
+			}
+			ret.Sections = append(ret.Sections, section)
+		}
+	} else if len(layout) == 0 {
 		pds := defaultSectionValues.Section.GetDefinitions()
 		flagSection := NewSectionFromParameterDefinitions(
 			pds, defaultSectionValues.Fields.ToMap(),
 			WithSectionTitle("All flags and arguments"),
 		)
+		for _, row := range flagSection.Rows {
+			for i := range row.Inputs {
+				row.Inputs[i].Section = schema.DefaultSlug
+				row.Inputs[i].OptionsURL = b.computeOptionsURL(schema.DefaultSlug, row.Inputs[i].Name)
+				if validation, ok := b.options.formLayout.GetValidation(schema.DefaultSlug, row.Inputs[i].Name); ok {
+					row.Inputs[i].Validation.Merge(validation)
+				}
+				if name, ok := b.queryNames[schema.DefaultSlug][row.Inputs[i].Name]; ok {
+					row.Inputs[i].Name = name
+				}
+			}
+		}
 		ret.Sections = append(ret.Sections, flagSection)
 
 		// This code would add a section for all layers, in the form.
@@ -113,9 +199,6 @@ func ComputeLayout(
 		//	ret.Sections = append(ret.Sections, section)
 		//}
 	} else {
-		allParameterDefinitions := cmd.Description().Schema.GetAllDefinitions()
-		values := parsedValues.GetDataMap()
-
 		for _, section_ := range layout {
 			section := &Section{
 				Title:            section_.Title,
@@ -123,83 +206,260 @@ func ComputeLayout(
 				Style:            section_.Style,
 				Classes:          section_.Classes,
 			}
-			for _, row_ := range section_.Rows {
-				row := Row{
-					Inputs:  []Input{},
-					Style:   row_.Style,
-					Classes: row_.Classes,
-				}
+			rows, err := b.computeRows(schema.DefaultSlug, section_.Rows)
+			if err != nil {
+				return nil, err
+			}
+			section.Rows = rows
 
-				for _, input_ := range row_.Inputs {
-					pd, ok := allParameterDefinitions.Get(input_.Name)
-					if !ok {
-						return nil, errors.Errorf("parameter %s not found", input_.Name)
-					}
-					value, ok := values[input_.Name]
-					if !ok {
-						value = nil
-					}
-
-					var options []Option
-					if len(input_.Options) > 0 {
-						for _, option := range input_.Options {
-							options = append(options, Option{
-								Label: option.Label,
-								Value: option.Value,
-							})
-						}
-					} else {
-						options = choicesToOptions(pd.Choices)
-					}
-
-					type_ := string(pd.Type)
-					if input_.InputType != "" {
-						type_ = input_.InputType
-					}
-					default_ := interface{}(nil)
-					if pd.Default != nil {
-						default_ = *pd.Default
-					}
-					if input_.DefaultValue != nil {
-						default_ = input_.DefaultValue
-					}
-
-					help_ := pd.Help
-					if input_.Help != "" {
-						help_ = input_.Help
-					}
-
-					label_ := pd.Help
-					if input_.Label != "" {
-						label_ = input_.Label
-					}
-
-					row.Inputs = append(row.Inputs, Input{
-						Name:                input_.Name,
-						Label:               label_,
-						Value:               value,
-						Type:                type_,
-						ParameterDefinition: pd,
-						Options:             options,
-						Default:             default_,
-						Help:                help_,
-						CSS:                 input_.CSS,
-						Id:                  input_.Id,
-						Classes:             input_.Classes,
-						Template:            input_.Template,
-					})
-				}
+			ret.Sections = append(ret.Sections, section)
+		}
+	}
+
+	return ret, nil
+}
+
+// computeFormSection computes a form section configured in the config file, see FormSection.
+func (b *layoutBuilder) computeFormSection(formSection *FormSection) (*Section, error) {
+	section := &Section{
+		Title:            formSection.Title,
+		ShortDescription: formSection.Description,
+		Style:            formSection.Style,
+		Classes:          formSection.Classes,
+		Collapsible:      formSection.Collapsible || formSection.Collapsed,
+		Collapsed:        formSection.Collapsed,
+	}
+
+	preferredSection := schema.DefaultSlug
+	if formSection.Section != "" {
+		preferredSection = formSection.Section
+	}
+
+	if len(formSection.Rows) > 0 {
+		rows, err := b.computeRows(preferredSection, formSection.Rows)
+		if err != nil {
+			return nil, err
+		}
+		section.Rows = rows
+		return section, nil
+	}
 
-				section.Rows = append(section.Rows, row)
+	if formSection.Section == "" {
+		return nil, errors.Errorf("form section %s needs either rows or a section", formSection.Title)
+	}
+	schemaSection, ok := b.schema.Get(formSection.Section)
+	if !ok {
+		return nil, errors.Errorf("section %s not found", formSection.Section)
+	}
+	if section.Title == "" {
+		section.Title = schemaSection.GetName()
+	}
+	if section.ShortDescription == "" {
+		section.ShortDescription = schemaSection.GetDescription()
+	}
+
+	pds := []*fields.Definition{}
+	if len(formSection.Fields) > 0 {
+		for _, name := range formSection.Fields {
+			pd, ok := schemaSection.GetDefinitions().Get(name)
+			if !ok {
+				return nil, errors.Errorf("parameter %s.%s not found", formSection.Section, name)
 			}
+			pds = append(pds, pd)
+		}
+	} else {
+		schemaSection.GetDefinitions().ForEach(func(pd *fields.Definition) {
+			pds = append(pds, pd)
+		})
+	}
 
-			ret.Sections = append(ret.Sections, section)
+	fieldsPerRow := formSection.FieldsPerRow
+	if fieldsPerRow <= 0 {
+		fieldsPerRow = 3
+	}
+
+	currentRow := Row{}
+	for _, pd := range pds {
+		input, err := b.newInput(schemaSection.GetSlug(), pd, &glazed_layout.Input{Name: pd.Name})
+		if err != nil {
+			return nil, err
+		}
+		currentRow.Inputs = append(currentRow.Inputs, input)
+		if len(currentRow.Inputs) == fieldsPerRow {
+			section.Rows = append(section.Rows, currentRow)
+			currentRow = Row{}
 		}
 	}
+	if len(currentRow.Inputs) > 0 {
+		section.Rows = append(section.Rows, currentRow)
+	}
+
+	return section, nil
+}
+
+// computeRows computes the rows of a glazed layout section. Unqualified input names
+// are looked up in preferredSection first.
+func (b *layoutBuilder) computeRows(preferredSection string, rows_ []*glazed_layout.Row) ([]Row, error) {
+	ret := []Row{}
+	for _, row_ := range rows_ {
+		row := Row{
+			Inputs:  []Input{},
+			Style:   row_.Style,
+			Classes: row_.Classes,
+		}
+
+		for _, input_ := range row_.Inputs {
+			sectionSlug, pd, ok := findParameterDefinition(b.schema, preferredSection, input_.Name)
+			if !ok {
+				return nil, errors.Errorf("parameter %s not found", input_.Name)
+			}
+			input, err := b.newInput(sectionSlug, pd, input_)
+			if err != nil {
+				return nil, err
+			}
+			row.Inputs = append(row.Inputs, input)
+		}
+
+		ret = append(ret, row)
+	}
 
 	return ret, nil
 }
 
+// newInput computes the input for the field pd, using the overrides of the layout input input_.
+func (b *layoutBuilder) newInput(sectionSlug string, pd *fields.Definition, input_ *glazed_layout.Input) (Input, error) {
+	var value interface{}
+	if v, ok := b.parsedValues.GetField(sectionSlug, pd.Name); ok {
+		value = v.Value
+	}
+
+	var options []Option
+	if len(input_.Options) > 0 {
+		for _, option := range input_.Options {
+			options = append(options, Option{
+				Label: option.Label,
+				Value: option.Value,
+			})
+		}
+	} else {
+		options = choicesToOptions(pd.Choices)
+	}
+
+	type_ := string(pd.Type)
+	if input_.InputType != "" {
+		type_ = input_.InputType
+	}
+	default_ := interface{}(nil)
+	if pd.Default != nil {
+		default_ = *pd.Default
+	}
+	if input_.DefaultValue != nil {
+		default_ = input_.DefaultValue
+	}
+
+	help_ := pd.Help
+	if input_.Help != "" {
+		help_ = input_.Help
+	}
+	if help_ == "" {
+		help_ = pd.Name
+	}
+
+	label_ := help_
+	if input_.Label != "" {
+		label_ = input_.Label
+	}
+
+	name := pd.Name
+	if n, ok := b.queryNames[sectionSlug][pd.Name]; ok {
+		name = n
+	}
+
+	validation := NewValidationFromDefinition(pd)
+	inputValidation, err := NewValidationFromMap(input_.Validation)
+	if err != nil {
+		return Input{}, errors.Wrapf(err, "invalid validation for input %s", input_.Name)
+	}
+	validation.Merge(inputValidation)
+	if v, ok := b.options.formLayout.GetValidation(sectionSlug, pd.Name); ok {
+		validation.Merge(v)
+	}
+
+	return Input{
+		Name:                name,
+		Section:             sectionSlug,
+		Field:               pd.Name,
+		Required:            pd.Required,
+		Label:               label_,
+		Value:               value,
+		Type:                type_,
+		ParameterDefinition: pd,
+		Options:             options,
+		Default:             default_,
+		Help:                help_,
+		CSS:                 input_.CSS,
+		Id:                  input_.Id,
+		Classes:             input_.Classes,
+		Template:            input_.Template,
+		Validation:          validation,
+		OptionsURL:          b.computeOptionsURL(sectionSlug, pd.Name),
+	}, nil
+}
+
+// computeOptionsURL returns the URL from which the options of the field can be loaded,
+// or an empty string if the field has no options source.
+func (b *layoutBuilder) computeOptionsURL(sectionSlug string, name string) string {
+	if b.options.optionsURL == "" {
+		return ""
+	}
+	key, _, ok := b.options.formLayout.GetOptionsSource(sectionSlug, name)
+	if !ok {
+		return ""
+	}
+	return b.options.optionsURL + "?source=" + url.QueryEscape(key)
+}
+
+// splitQualifiedName splits a `section.field` name.
+func splitQualifiedName(name string) (string, string, bool) {
+	if idx := strings.Index(name, "."); idx != -1 {
+		return name[:idx], name[idx+1:], true
+	}
+	return "", name, false
+}
+
+// findParameterDefinition looks up a parameter referenced by a layout input, either as `section.field`
+// or as a plain field name. Plain names are looked up in preferredSection first, and then in the
+// other sections in order.
+func findParameterDefinition(schema_ *schema.Schema, preferredSection string, name string) (string, *fields.Definition, bool) {
+	if slug, field, ok := splitQualifiedName(name); ok {
+		if section, ok := schema_.Get(slug); ok {
+			if pd, ok := section.GetDefinitions().Get(field); ok {
+				return section.GetSlug(), pd, true
+			}
+		}
+	}
+
+	if section, ok := schema_.Get(preferredSection); ok {
+		if pd, ok := section.GetDefinitions().Get(name); ok {
+			return preferredSection, pd, true
+		}
+	}
+
+	var ret *fields.Definition
+	slug := ""
+	schema_.ForEach(func(_ string, section schema.Section) {
+		if ret != nil {
+			return
+		}
+		if pd, ok := section.GetDefinitions().Get(name); ok {
+			ret = pd
+			slug = section.GetSlug()
+		}
+	})
+
+	return slug, ret, ret != nil
+}
+
 func choicesToOptions(choices []string) []Option {
 	options := []Option{}
 	for _, choice := range choices {
@@ -237,11 +497,16 @@ func NewSectionFromParameterDefinitions(
 			help = pd.Name
 		}
 		input := Input{
-			Name:    name,
-			Value:   value,
-			Type:    string(pd.Type),
-			Help:    help,
-			Options: choicesToOptions(pd.Choices),
+			Name:                name,
+			Field:               pd.Name,
+			Required:            pd.Required,
+			ParameterDefinition: pd,
+			Value:               value,
+			Type:                string(pd.Type),
+			Label:               help,
+			Help:                help,
+			Options:             choicesToOptions(pd.Choices),
+			Validation:          NewValidationFromDefinition(pd),
 		}
 		if pd.Default != nil {
 			input.Default = *pd.Default
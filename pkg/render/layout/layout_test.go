@@ -0,0 +1,209 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	glazed_layout "github.com/go-go-golems/glazed/pkg/cmds/layout"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCommand(t *testing.T, options ...cmds.CommandDescriptionOption) *cmds.CommandDescription {
+	paginationSection, err := schema.NewSection("pagination", "Pagination",
+		schema.WithFields(
+			fields.New("limit", fields.TypeInteger),
+			fields.New("offset", fields.TypeInteger),
+		))
+	require.NoError(t, err)
+
+	options = append([]cmds.CommandDescriptionOption{
+		cmds.WithFlags(
+			fields.New("limit", fields.TypeInteger),
+			fields.New("name", fields.TypeString),
+		),
+		cmds.WithSections(paginationSection),
+	}, options...)
+
+	return cmds.NewCommandDescription("test", options...)
+}
+
+func inputNames(l *Layout) []string {
+	ret := []string{}
+	for _, section := range l.Sections {
+		for _, row := range section.Rows {
+			for _, input := range row.Inputs {
+				ret = append(ret, input.Name)
+			}
+		}
+	}
+	return ret
+}
+
+func TestComputeLayoutQualifiesCollidingNames(t *testing.T) {
+	cmd := newTestCommand(t)
+	parsedValues, err := cmd.Schema.InitializeFromDefaults()
+	require.NoError(t, err)
+
+	l, err := ComputeLayout(cmd, parsedValues)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default.limit", "name"}, inputNames(l))
+}
+
+func TestComputeLayoutWithQualifiedInputs(t *testing.T) {
+	cmd := newTestCommand(t, cmds.WithLayout(&glazed_layout.Layout{
+		Sections: []*glazed_layout.Section{
+			{
+				Title: "Query",
+				Rows: []*glazed_layout.Row{
+					{
+						Inputs: []*glazed_layout.Input{
+							{Name: "name"},
+							{Name: "limit"},
+							{Name: "pagination.limit"},
+							{Name: "offset"},
+						},
+					},
+				},
+			},
+		},
+	}))
+	parsedValues, err := cmd.Schema.InitializeFromDefaults()
+	require.NoError(t, err)
+
+	l, err := ComputeLayout(cmd, parsedValues)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "default.limit", "pagination.limit", "offset"}, inputNames(l))
+
+	cmd = newTestCommand(t, cmds.WithLayout(&glazed_layout.Layout{
+		Sections: []*glazed_layout.Section{
+			{Rows: []*glazed_layout.Row{{Inputs: []*glazed_layout.Input{{Name: "pagination.unknown"}}}}},
+		},
+	}))
+	_, err = ComputeLayout(cmd, parsedValues)
+	assert.Error(t, err)
+}
+
+func TestComputeLayoutWithFormLayout(t *testing.T) {
+	cmd := newTestCommand(t)
+	parsedValues, err := cmd.Schema.InitializeFromDefaults()
+	require.NoError(t, err)
+
+	formLayout := &FormLayout{
+		Sections: []*FormSection{
+			{
+				Title: "Query",
+				Rows: []*glazed_layout.Row{
+					{
+						Inputs: []*glazed_layout.Input{
+							{Name: "name", Label: "Customer name", InputType: "textarea"},
+						},
+					},
+				},
+			},
+			{
+				Section:   "pagination",
+				Fields:    []string{"offset", "limit"},
+				Collapsed: true,
+			},
+			{
+				Title:   "Limit",
+				Section: "pagination",
+				Rows: []*glazed_layout.Row{
+					{Inputs: []*glazed_layout.Input{{Name: "limit"}}},
+				},
+			},
+		},
+	}
+
+	l, err := ComputeLayout(cmd, parsedValues, WithFormLayout(formLayout))
+	require.NoError(t, err)
+	require.Len(t, l.Sections, 3)
+	assert.Equal(t, []string{"name", "offset", "pagination.limit", "pagination.limit"}, inputNames(l))
+
+	name := l.Sections[0].Rows[0].Inputs[0]
+	assert.Equal(t, "Customer name", name.Label)
+	assert.Equal(t, "textarea", name.Type)
+	assert.False(t, l.Sections[0].Collapsible)
+
+	assert.Equal(t, "Pagination", l.Sections[1].Title)
+	assert.True(t, l.Sections[1].Collapsible)
+	assert.True(t, l.Sections[1].Collapsed)
+
+	assert.Equal(t, []string{"pagination"}, formLayout.SectionSlugs())
+
+	_, err = ComputeLayout(cmd, parsedValues, WithFormLayout(&FormLayout{
+		Sections: []*FormSection{{Section: "pagination", Fields: []string{"unknown"}}},
+	}))
+	assert.Error(t, err)
+}
+
+func TestComputeLayoutWithOptionsSources(t *testing.T) {
+	cmd := newTestCommand(t)
+	parsedValues, err := cmd.Schema.InitializeFromDefaults()
+	require.NoError(t, err)
+
+	formLayout := &FormLayout{
+		OptionsSources: map[string]*OptionsSource{
+			"name": {Command: "customers/active", ValueColumn: "id"},
+		},
+	}
+	require.NoError(t, formLayout.Validate())
+
+	l, err := ComputeLayout(cmd, parsedValues, WithFormLayout(formLayout), WithOptionsURL("/commands/options"))
+	require.NoError(t, err)
+	require.Len(t, l.Sections, 1)
+	inputs := l.Sections[0].Rows[0].Inputs
+	assert.Equal(t, "", inputs[0].OptionsURL)
+	assert.Equal(t, "/commands/options?source=name", inputs[1].OptionsURL)
+
+	formLayout.OptionsSources["name"].ValueColumn = ""
+	assert.Error(t, formLayout.Validate())
+}
+
+func TestComputeLayoutValidation(t *testing.T) {
+	cmd := cmds.NewCommandDescription("test",
+		cmds.WithFlags(
+			fields.New("ids", fields.TypeIntegerList, fields.WithRequired(true)),
+			fields.New("count", fields.TypeInteger),
+			fields.New("verbose", fields.TypeBool, fields.WithRequired(true)),
+		),
+		cmds.WithLayout(&glazed_layout.Layout{
+			Sections: []*glazed_layout.Section{
+				{
+					Rows: []*glazed_layout.Row{
+						{
+							Inputs: []*glazed_layout.Input{
+								{Name: "ids", Validation: map[string]interface{}{"maxItems": 3}},
+								{Name: "count", Validation: map[string]interface{}{"min": 1, "max": 10}},
+								{Name: "verbose"},
+							},
+						},
+					},
+				},
+			},
+		}),
+	)
+	parsedValues, err := cmd.Schema.InitializeFromDefaults()
+	require.NoError(t, err)
+
+	formLayout := &FormLayout{
+		Validation: map[string]*Validation{
+			"default.count": {Max: "5"},
+		},
+	}
+	require.NoError(t, formLayout.Validate())
+
+	l, err := ComputeLayout(cmd, parsedValues, WithFormLayout(formLayout))
+	require.NoError(t, err)
+	inputs := l.Sections[0].Rows[0].Inputs
+
+	assert.Equal(t, &Validation{Required: true, ItemType: "int", MaxItems: 3}, inputs[0].Validation)
+	assert.Equal(t, &Validation{Step: "1", Min: "1", Max: "5"}, inputs[1].Validation)
+	assert.Equal(t, &Validation{}, inputs[2].Validation)
+
+	formLayout.Validation["count"] = &Validation{ItemType: "uuid"}
+	assert.Error(t, formLayout.Validate())
+}
@@ -0,0 +1,111 @@
+package layout
+
+import (
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Validation describes the constraints of a form input. The default templates render them
+// as HTML5 validation attributes, and check list and date inputs with a small JS validator.
+//
+// Constraints are derived from the field definition, and can be extended in the route config,
+// either through the `validation` of a layout input, or through FormLayout.Validation.
+type Validation struct {
+	Required bool `yaml:"required,omitempty" json:"required,omitempty"`
+	// Min and Max are numbers for numeric inputs, and YYYY-MM-DD dates for date inputs.
+	Min  string `yaml:"min,omitempty" json:"min,omitempty"`
+	Max  string `yaml:"max,omitempty" json:"max,omitempty"`
+	Step string `yaml:"step,omitempty" json:"step,omitempty"`
+
+	MinLength int `yaml:"minLength,omitempty" json:"minLength,omitempty"`
+	MaxLength int `yaml:"maxLength,omitempty" json:"maxLength,omitempty"`
+	// Pattern is a regular expression the whole value has to match.
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+
+	// MinItems and MaxItems constrain the number of values of list inputs.
+	MinItems int `yaml:"minItems,omitempty" json:"minItems,omitempty"`
+	MaxItems int `yaml:"maxItems,omitempty" json:"maxItems,omitempty"`
+	// ItemType is the type of the comma separated values of list and date inputs: `int`, `float` or `date`.
+	ItemType string `yaml:"itemType,omitempty" json:"itemType,omitempty"`
+}
+
+// NewValidationFromDefinition derives the validation constraints of a field from its definition.
+func NewValidationFromDefinition(pd *fields.Definition) *Validation {
+	ret := &Validation{
+		// a required checkbox would have to be checked, which is not what a required bool means
+		Required: pd.Required && pd.Type != fields.TypeBool,
+	}
+
+	switch pd.Type {
+	case fields.TypeInteger:
+		ret.Step = "1"
+	case fields.TypeFloat:
+		ret.Step = "any"
+	case fields.TypeIntegerList:
+		ret.ItemType = "int"
+	case fields.TypeFloatList:
+		ret.ItemType = "float"
+	case fields.TypeDate:
+		ret.ItemType = "date"
+	default:
+	}
+
+	return ret
+}
+
+// NewValidationFromMap converts the validation map of a glazed layout input.
+func NewValidationFromMap(m map[string]interface{}) (*Validation, error) {
+	ret := &Validation{}
+	if len(m) == 0 {
+		return ret, nil
+	}
+
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(b, ret)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid validation")
+	}
+
+	return ret, nil
+}
+
+// Merge overrides the constraints of v with the constraints set in other.
+func (v *Validation) Merge(other *Validation) {
+	if other == nil {
+		return
+	}
+	if other.Required {
+		v.Required = true
+	}
+	if other.Min != "" {
+		v.Min = other.Min
+	}
+	if other.Max != "" {
+		v.Max = other.Max
+	}
+	if other.Step != "" {
+		v.Step = other.Step
+	}
+	if other.MinLength != 0 {
+		v.MinLength = other.MinLength
+	}
+	if other.MaxLength != 0 {
+		v.MaxLength = other.MaxLength
+	}
+	if other.Pattern != "" {
+		v.Pattern = other.Pattern
+	}
+	if other.MinItems != 0 {
+		v.MinItems = other.MinItems
+	}
+	if other.MaxItems != 0 {
+		v.MaxItems = other.MaxItems
+	}
+	if other.ItemType != "" {
+		v.ItemType = other.ItemType
+	}
+}
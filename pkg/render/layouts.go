@@ -0,0 +1,120 @@
+package render
+
+import (
+	"html/template"
+	"path"
+	"strings"
+	"text/template/parse"
+)
+
+// Layouts are a convention of template directories to share the structure of their pages:
+//
+//   - the HTML pages of a directory are rendered into the `_layout.tmpl.html` of the nearest
+//     ancestor directory (the directory of the page itself included)
+//   - the content of the page outside of its `{{ define }}` blocks becomes the `content` block of
+//     the layout, and the blocks it defines override the `{{ block }}` defaults of the layout
+//   - the templates in the `_partials/` folder at the root of the directory are available to every
+//     template, under their path, for example `{{ template "_partials/nav.tmpl.html" . }}`
+//   - markdown pages are rendered into the layout too, the HTML of the markdown being the `content` block
+//   - files and directories starting with `_` are not served as pages
+//   - pages that are complete HTML documents (starting with `<!DOCTYPE` or `<html>`) don't use a layout
+//
+// Layouts are enabled with WithLayouts for LookupTemplateFromFS and WithWatchedLayouts
+// for LookupTemplateFromWatchedDirectory.
+const (
+	LayoutTemplateName = "_layout.tmpl.html"
+	PartialsDirectory  = "_partials"
+	ContentBlockName   = "content"
+)
+
+// markdownContentSource is the content block of markdown pages rendered into a layout.
+// The HTML of the markdown is passed as the `markdown` field of the data.
+const markdownContentSource = `{{ .markdown }}`
+
+// LayoutLookup is implemented by the template lookups supporting layouts.
+type LayoutLookup interface {
+	// LookupMarkdownLayout returns the layout of the markdown page name, rendering the `markdown`
+	// field of the data as its content block, or nil if the page has no layout.
+	LookupMarkdownLayout(name string) (*template.Template, error)
+}
+
+// isHiddenTemplate returns true if one of the path elements of name starts with `_`.
+func isHiddenTemplate(name string) bool {
+	for _, p := range strings.Split(name, "/") {
+		if strings.HasPrefix(p, "_") {
+			return true
+		}
+	}
+	return false
+}
+
+func isPartial(name string) bool {
+	return strings.HasPrefix(name, PartialsDirectory+"/")
+}
+
+// usesLayout returns true if name is a HTML page that can be rendered into a layout.
+func usesLayout(name string, source string) bool {
+	if !strings.HasSuffix(name, ".html") || isHiddenTemplate(name) {
+		return false
+	}
+	start := strings.TrimSpace(source)
+	// skip the front matter, see ParseFrontMatter
+	if strings.HasPrefix(start, "{{/*") {
+		if i := strings.Index(start, "*/}}"); i != -1 {
+			start = strings.TrimSpace(start[i+len("*/}}"):])
+		}
+	}
+	start = strings.ToLower(start)
+	return !strings.HasPrefix(start, "<!doctype") && !strings.HasPrefix(start, "<html")
+}
+
+// findLayout returns the layout of the nearest ancestor directory of the page name.
+func findLayout(name string, exists func(name string) bool) (string, bool) {
+	dir := path.Dir(name)
+	for {
+		layout := path.Join(dir, LayoutTemplateName)
+		if exists(layout) {
+			return layout, true
+		}
+		if dir == "." || dir == "/" {
+			return "", false
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// addLayout parses the layout and then the page into tmpl, so that the blocks defined by the page
+// override the ones of the layout, and makes the content of the page the content block.
+// It returns the layout template, which renders the page.
+func addLayout(tmpl *template.Template, layout string, layoutSource string, page string, pageSource string) (*template.Template, error) {
+	ret, err := tmpl.New(layout).Parse(layoutSource)
+	if err != nil {
+		return nil, err
+	}
+	p, err := tmpl.New(page).Parse(pageSource)
+	if err != nil {
+		return nil, err
+	}
+	if p.Tree != nil && !isEmptyTree(p.Tree.Root) {
+		_, err = tmpl.AddParseTree(ContentBlockName, p.Tree)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// isEmptyTree returns true if the template only contains whitespace, once its {{ define }} blocks are removed.
+func isEmptyTree(root *parse.ListNode) bool {
+	if root == nil {
+		return true
+	}
+	for _, n := range root.Nodes {
+		t, ok := n.(*parse.TextNode)
+		if !ok || strings.TrimSpace(string(t.Text)) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var layoutsFS = fstest.MapFS{
+	"_layout.tmpl.html": {Data: []byte(
+		`<title>{{ block "title" . }}Site{{ end }}</title>{{ template "_partials/nav.tmpl.html" . }}` +
+			`<main>{{ block "content" . }}{{ end }}</main>`,
+	)},
+	"_partials/nav.tmpl.html":  {Data: []byte(`<nav>{{ .section }}</nav>`)},
+	"about.tmpl.html":          {Data: []byte(`{{ define "title" }}About{{ end }}<p>About us</p>`)},
+	"index.tmpl.html":          {Data: []byte(`<p>Home</p>`)},
+	"blocks.tmpl.html":         {Data: []byte(`{{ define "title" }}Blocks{{ end }}`)},
+	"full.html":                {Data: []byte("<!DOCTYPE html>\n<html>Full</html>")},
+	"blog/_layout.tmpl.html":   {Data: []byte(`<div class="blog">{{ block "content" . }}{{ end }}</div>`)},
+	"blog/2024/post.tmpl.html": {Data: []byte(`<p>Post</p>`)},
+	"blog/notes.md":            {Data: []byte(`# Notes`)},
+	"special.tmpl.html":        {Data: []byte("---\nlayout: blog/_layout.tmpl.html\n---\n<p>Special</p>")},
+	"full-page.html":           {Data: []byte("---\ntitle: Full\n---\n<html>Full</html>")},
+}
+
+var layoutsPatterns = []string{"**/*.tmpl.html", "**/*.html", "**/*.md"}
+
+// layoutLookups returns the lookups supporting layouts, loading layoutsFS.
+func layoutLookups(t *testing.T) map[string]TemplateLookup {
+	dir := t.TempDir()
+	require.NoError(t, os.CopyFS(dir, layoutsFS))
+	watched, err := NewLookupTemplateFromWatchedDirectory(dir,
+		WithWatchedPatterns(layoutsPatterns...),
+		WithWatchedLayouts(true),
+	)
+	require.NoError(t, err)
+
+	return map[string]TemplateLookup{
+		"fs": NewLookupTemplateFromFS(
+			WithFS(layoutsFS),
+			WithPatterns(layoutsPatterns...),
+			WithLayouts(true),
+		),
+		"watched": watched,
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		notFound bool
+	}{
+		{
+			name:     "about.tmpl.html",
+			expected: `<title>About</title><nav>root</nav><main><p>About us</p></main>`,
+		},
+		{
+			// the blocks of other pages don't leak
+			name:     "index.tmpl.html",
+			expected: `<title>Site</title><nav>root</nav><main><p>Home</p></main>`,
+		},
+		{
+			name:     "blocks.tmpl.html",
+			expected: `<title>Blocks</title><nav>root</nav><main></main>`,
+		},
+		{
+			name:     "full.html",
+			expected: "<!DOCTYPE html>\n<html>Full</html>",
+		},
+		{
+			// the nearest layout is used
+			name:     "blog/2024/post.tmpl.html",
+			expected: `<div class="blog"><p>Post</p></div>`,
+		},
+		{
+			// the front matter selects the layout
+			name:     "special.tmpl.html",
+			expected: `<div class="blog"><p>Special</p></div>`,
+		},
+		{
+			name:     "full-page.html",
+			expected: "<html>Full</html>",
+		},
+		{name: "_layout.tmpl.html", notFound: true},
+		{name: "blog/_layout.tmpl.html", notFound: true},
+		{name: "_partials/nav.tmpl.html", notFound: true},
+	}
+
+	for lookupName, lookup := range layoutLookups(t) {
+		for _, tt := range tests {
+			t.Run(lookupName+"/"+tt.name, func(t *testing.T) {
+				tmpl, err := lookup.Lookup(tt.name)
+				if tt.notFound {
+					assert.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+
+				buf := &bytes.Buffer{}
+				require.NoError(t, tmpl.Execute(buf, map[string]interface{}{"section": "root"}))
+				assert.Equal(t, tt.expected, buf.String())
+			})
+		}
+
+		t.Run(lookupName+"/markdown", func(t *testing.T) {
+			ll, ok := lookup.(LayoutLookup)
+			require.True(t, ok)
+
+			tmpl, err := ll.LookupMarkdownLayout("blog/notes.md")
+			require.NoError(t, err)
+			require.NotNil(t, tmpl)
+			buf := &bytes.Buffer{}
+			require.NoError(t, tmpl.Execute(buf, map[string]interface{}{"markdown": template.HTML("<h1>Notes</h1>")}))
+			assert.Equal(t, `<div class="blog"><h1>Notes</h1></div>`, buf.String())
+
+			tmpl, err = ll.LookupMarkdownLayout("missing.md")
+			require.NoError(t, err)
+			assert.Nil(t, tmpl)
+		})
+	}
+}
+
+func TestLayoutsDisabled(t *testing.T) {
+	lookup := NewLookupTemplateFromFS(WithFS(layoutsFS), WithPatterns(layoutsPatterns...))
+
+	tmpl, err := lookup.Lookup("index.tmpl.html")
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	require.NoError(t, tmpl.Execute(buf, nil))
+	assert.Equal(t, `<p>Home</p>`, buf.String())
+
+	_, err = lookup.Lookup("_layout.tmpl.html")
+	assert.NoError(t, err)
+
+	tmpl, err = lookup.LookupMarkdownLayout("blog/notes.md")
+	require.NoError(t, err)
+	assert.Nil(t, tmpl)
+}
+
+func TestRendererMarkdownLayout(t *testing.T) {
+	lookup := NewLookupTemplateFromFS(WithFS(layoutsFS), WithPatterns(layoutsPatterns...), WithLayouts(true))
+	r, err := NewRenderer(WithAppendTemplateLookups(lookup))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/*", r.WithTemplateDirHandler(map[string]interface{}{"section": "root"}))
+
+	tests := []struct {
+		path     string
+		status   int
+		expected string
+	}{
+		{path: "/blog/notes", status: http.StatusOK, expected: `<div class="blog"><h1>Notes</h1>` + "\n</div>"},
+		{path: "/", status: http.StatusOK, expected: `<title>Site</title><nav>root</nav><main><p>Home</p></main>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.status, resp.Code)
+			assert.Equal(t, tt.expected, resp.Body.String())
+		})
+	}
+}
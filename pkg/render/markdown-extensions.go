@@ -0,0 +1,315 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// MermaidScriptPath is the script drawing the mermaid diagrams, served with the parka static files.
+// It loads the mermaid library bundled next to it, see pkg/server/web/package.json.
+const MermaidScriptPath = "/dist/mermaid.js"
+
+const (
+	tocMinLevel = 2
+	tocMaxLevel = 3
+)
+
+var (
+	KindAdmonition = ast.NewNodeKind("Admonition")
+	KindTOC        = ast.NewNodeKind("TOC")
+	KindMermaid    = ast.NewNodeKind("Mermaid")
+)
+
+// Admonition is a blockquote starting with `[!NOTE]`, rendered as a `div.admonition`.
+type Admonition struct {
+	ast.BaseBlock
+	// AdmonitionType is the lowercase type of the admonition, for example `note`.
+	AdmonitionType string
+}
+
+func (n *Admonition) Kind() ast.NodeKind {
+	return KindAdmonition
+}
+
+func (n *Admonition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Type": n.AdmonitionType}, nil)
+}
+
+type tocHeading struct {
+	level int
+	id    string
+	text  string
+}
+
+// TOC is the table of contents of the page, replacing a `[TOC]` paragraph.
+type TOC struct {
+	ast.BaseBlock
+	headings []tocHeading
+}
+
+func (n *TOC) Kind() ast.NodeKind {
+	return KindTOC
+}
+
+func (n *TOC) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// Mermaid is a `mermaid` code block, drawn in the browser.
+type Mermaid struct {
+	ast.BaseBlock
+}
+
+func (n *Mermaid) Kind() ast.NodeKind {
+	return KindMermaid
+}
+
+func (n *Mermaid) IsRaw() bool {
+	return true
+}
+
+func (n *Mermaid) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// markdownExtension adds the heading anchors, the table of contents, the admonitions
+// and the mermaid diagrams of the MarkdownEngine.
+type markdownExtension struct {
+	headingAnchors bool
+	toc            bool
+	admonitions    bool
+	mermaid        bool
+}
+
+func (e *markdownExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 100)))
+}
+
+var admonitionRegexp = regexp.MustCompile(`^\[!(NOTE|TIP|IMPORTANT|WARNING|CAUTION)\]$`)
+
+func (e *markdownExtension) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+
+	headings := []*ast.Heading{}
+	blockquotes := []*ast.Blockquote{}
+	paragraphs := []*ast.Paragraph{}
+	codeBlocks := []*ast.FencedCodeBlock{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			headings = append(headings, n)
+		case *ast.Blockquote:
+			blockquotes = append(blockquotes, n)
+		case *ast.Paragraph:
+			paragraphs = append(paragraphs, n)
+		case *ast.FencedCodeBlock:
+			codeBlocks = append(codeBlocks, n)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	if e.toc {
+		tocHeadings := []tocHeading{}
+		for _, h := range headings {
+			id, ok := headingID(h)
+			if !ok || h.Level < tocMinLevel || h.Level > tocMaxLevel {
+				continue
+			}
+			tocHeadings = append(tocHeadings, tocHeading{
+				level: h.Level,
+				id:    id,
+				text:  nodeText(h, source),
+			})
+		}
+		for _, p := range paragraphs {
+			if p.Lines().Len() != 1 {
+				continue
+			}
+			line := p.Lines().At(0)
+			if strings.EqualFold(string(bytes.TrimSpace(line.Value(source))), "[TOC]") {
+				p.Parent().ReplaceChild(p.Parent(), p, &TOC{headings: tocHeadings})
+			}
+		}
+	}
+
+	if e.headingAnchors {
+		for _, h := range headings {
+			id, ok := headingID(h)
+			if !ok {
+				continue
+			}
+			link := ast.NewLink()
+			link.Destination = []byte("#" + id)
+			link.SetAttributeString("class", []byte("anchor"))
+			link.AppendChild(link, ast.NewString([]byte("#")))
+			h.AppendChild(h, link)
+		}
+	}
+
+	if e.admonitions {
+		for _, bq := range blockquotes {
+			transformAdmonition(bq, source)
+		}
+	}
+
+	if e.mermaid {
+		for _, cb := range codeBlocks {
+			if string(cb.Language(source)) != "mermaid" {
+				continue
+			}
+			m := &Mermaid{}
+			m.SetLines(cb.Lines())
+			cb.Parent().ReplaceChild(cb.Parent(), cb, m)
+		}
+	}
+}
+
+// transformAdmonition replaces the blockquote bq with an admonition if its first line is `[!TYPE]`.
+func transformAdmonition(bq *ast.Blockquote, source []byte) {
+	p, ok := bq.FirstChild().(*ast.Paragraph)
+	if !ok || p.Lines().Len() == 0 {
+		return
+	}
+	first := p.Lines().At(0)
+	m := admonitionRegexp.FindSubmatch(bytes.TrimSpace(first.Value(source)))
+	if m == nil {
+		return
+	}
+
+	// remove the `[!TYPE]` marker
+	for c := p.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		t, ok := c.(*ast.Text)
+		if !ok || t.Segment.Start >= first.Stop {
+			break
+		}
+		p.RemoveChild(p, c)
+		c = next
+	}
+	if p.ChildCount() == 0 {
+		bq.RemoveChild(bq, p)
+	}
+
+	a := &Admonition{AdmonitionType: strings.ToLower(string(m[1]))}
+	for c := bq.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		a.AppendChild(a, c)
+		c = next
+	}
+	bq.Parent().ReplaceChild(bq.Parent(), bq, a)
+}
+
+// headingID returns the id generated for the heading h.
+func headingID(h *ast.Heading) (string, bool) {
+	id, ok := h.AttributeString("id")
+	if !ok {
+		return "", false
+	}
+	b, ok := id.([]byte)
+	return string(b), ok
+}
+
+// nodeText returns the text of the inline children of n.
+func nodeText(n ast.Node, source []byte) string {
+	buf := &bytes.Buffer{}
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			buf.Write(c.Segment.Value(source))
+			if c.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(c.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
+
+func (e *markdownExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindAdmonition, e.renderAdmonition)
+	reg.Register(KindTOC, e.renderTOC)
+	reg.Register(KindMermaid, e.renderMermaid)
+}
+
+func (e *markdownExtension) renderAdmonition(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*Admonition)
+	if entering {
+		title := strings.ToUpper(n.AdmonitionType[:1]) + n.AdmonitionType[1:]
+		_, _ = fmt.Fprintf(w, "<div class=\"admonition admonition-%s\">\n<p class=\"admonition-title\">%s</p>\n",
+			n.AdmonitionType, title)
+	} else {
+		_, _ = w.WriteString("</div>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (e *markdownExtension) renderTOC(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*TOC)
+	if len(n.headings) == 0 {
+		return ast.WalkSkipChildren, nil
+	}
+
+	_, _ = w.WriteString("<nav class=\"toc\">\n")
+	depth := 0
+	for _, h := range n.headings {
+		level := h.level - tocMinLevel + 1
+		switch {
+		case depth == 0:
+			_, _ = w.WriteString("<ul>\n")
+			depth = 1
+		case level > depth:
+			for ; depth < level; depth++ {
+				_, _ = w.WriteString("\n<ul>\n")
+			}
+		default:
+			_, _ = w.WriteString("</li>\n")
+			for ; depth > level && depth > 1; depth-- {
+				_, _ = w.WriteString("</ul>\n</li>\n")
+			}
+		}
+		_, _ = fmt.Fprintf(w, "<li><a href=\"#%s\">%s</a>", html.EscapeString(h.id), html.EscapeString(h.text))
+	}
+	_, _ = w.WriteString("</li>\n")
+	for ; depth > 1; depth-- {
+		_, _ = w.WriteString("</ul>\n</li>\n")
+	}
+	_, _ = w.WriteString("</ul>\n</nav>\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+func (e *markdownExtension) renderMermaid(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString("<pre class=\"mermaid\">")
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		_, _ = w.WriteString(html.EscapeString(string(line.Value(source))))
+	}
+	_, _ = w.WriteString("</pre>\n")
+	return ast.WalkSkipChildren, nil
+}
@@ -2,45 +2,342 @@ package render
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"sync"
+
 	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/pkg/errors"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
 	html2 "github.com/yuin/goldmark/renderer/html"
-	"html/template"
+	"github.com/yuin/goldmark/text"
 )
 
-func RenderMarkdownTemplateToHTML(t *template.Template, data interface{}) (string, error) {
-	buf := new(bytes.Buffer)
-	err := t.Execute(buf, data)
-	if err != nil {
-		return "", err
+// DefaultHighlightStyle is the chroma style used to highlight code blocks.
+const DefaultHighlightStyle = "monokai"
+
+// MarkdownEngine renders markdown to HTML. It is built once from its options, and can be
+// used concurrently.
+//
+// On top of tables and code highlighting, it supports:
+//   - heading anchors, and a table of contents replacing a `[TOC]` paragraph
+//   - footnotes, definition lists and task lists
+//   - typographic replacements of quotes and dashes
+//   - admonitions, written as GitHub alerts: a blockquote starting with `[!NOTE]`, `[!TIP]`,
+//     `[!IMPORTANT]`, `[!WARNING]` or `[!CAUTION]`
+//   - mermaid diagrams in `mermaid` code blocks, drawn in the browser by MermaidScriptPath
+//   - sanitizing the HTML, for pages written by less trusted authors
+type MarkdownEngine struct {
+	highlightStyle  string
+	lineNumbers     bool
+	headingAnchors  bool
+	toc             bool
+	footnotes       bool
+	definitionLists bool
+	taskLists       bool
+	typographer     bool
+	admonitions     bool
+	mermaid         bool
+	sanitize        bool
+	extensions      []goldmark.Extender
+	// assetPrefix is prepended to the paths of the parka static files, such as MermaidScriptPath
+	assetPrefix string
+
+	markdown  goldmark.Markdown
+	sanitizer *bluemonday.Policy
+}
+
+type MarkdownOption func(e *MarkdownEngine)
+
+// WithMarkdownHighlightStyle sets the chroma style used to highlight code blocks, see https://xyproto.github.io/splash/docs/.
+func WithMarkdownHighlightStyle(style string) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.highlightStyle = style
 	}
-	rendered := buf.String()
+}
 
-	return RenderMarkdownToHTML(rendered)
+// WithMarkdownLineNumbers shows line numbers in highlighted code blocks. On by default.
+func WithMarkdownLineNumbers(lineNumbers bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.lineNumbers = lineNumbers
+	}
+}
+
+// WithMarkdownHeadingAnchors gives an id to the headings, and appends a `#` link to them.
+func WithMarkdownHeadingAnchors(headingAnchors bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.headingAnchors = headingAnchors
+	}
+}
+
+// WithMarkdownTOC replaces a paragraph containing only `[TOC]` with the table of contents of the page,
+// linking to the level 2 and 3 headings. Headings get an id.
+func WithMarkdownTOC(toc bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.toc = toc
+	}
+}
+
+// WithMarkdownFootnotes enables `[^1]` footnotes. Off by default.
+func WithMarkdownFootnotes(footnotes bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.footnotes = footnotes
+	}
+}
+
+// WithMarkdownDefinitionLists enables definition lists. Off by default.
+func WithMarkdownDefinitionLists(definitionLists bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.definitionLists = definitionLists
+	}
 }
 
-func RenderMarkdownToHTML(rendered string) (string, error) {
-	engine := goldmark.New(
-		goldmark.WithExtensions(
-			// add tables
-			extension.NewTable(),
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("monokai"),
-				highlighting.WithFormatOptions(
-					html.WithLineNumbers(true),
-				),
+// WithMarkdownTaskLists enables `- [x]` task lists. Off by default.
+func WithMarkdownTaskLists(taskLists bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.taskLists = taskLists
+	}
+}
+
+// WithMarkdownTypographer replaces quotes, dashes and ellipses with their typographic version.
+func WithMarkdownTypographer(typographer bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.typographer = typographer
+	}
+}
+
+// WithMarkdownAdmonitions renders `> [!NOTE]` blockquotes as admonitions. Off by default.
+func WithMarkdownAdmonitions(admonitions bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.admonitions = admonitions
+	}
+}
+
+// WithMarkdownMermaid renders `mermaid` code blocks as diagrams. Off by default.
+func WithMarkdownMermaid(mermaid bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.mermaid = mermaid
+	}
+}
+
+// WithMarkdownAssetPrefix sets the prefix of the URLs of the parka static files, such as the script drawing
+// the mermaid diagrams. This is the root path of the server the pages are served by.
+func WithMarkdownAssetPrefix(prefix string) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.assetPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithMarkdownSanitizer removes scripts, event handlers and other unsafe HTML from the rendered markdown.
+// The scripts of the extensions, see PageScripter, are added after sanitizing.
+func WithMarkdownSanitizer(sanitize bool) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.sanitize = sanitize
+	}
+}
+
+// WithMarkdownEngineExtensions adds goldmark extensions.
+func WithMarkdownEngineExtensions(extensions ...goldmark.Extender) MarkdownOption {
+	return func(e *MarkdownEngine) {
+		e.extensions = append(e.extensions, extensions...)
+	}
+}
+
+func NewMarkdownEngine(options ...MarkdownOption) (*MarkdownEngine, error) {
+	e := &MarkdownEngine{
+		highlightStyle: DefaultHighlightStyle,
+		lineNumbers:    true,
+	}
+	for _, o := range options {
+		o(e)
+	}
+
+	if _, ok := styles.Registry[e.highlightStyle]; !ok {
+		return nil, errors.Errorf("unknown highlight style %s", e.highlightStyle)
+	}
+
+	extensions := []goldmark.Extender{
+		extension.NewTable(),
+		highlighting.NewHighlighting(
+			highlighting.WithStyle(e.highlightStyle),
+			highlighting.WithFormatOptions(
+				html.WithLineNumbers(e.lineNumbers),
 			),
 		),
+	}
+	if e.footnotes {
+		extensions = append(extensions, extension.Footnote)
+	}
+	if e.definitionLists {
+		extensions = append(extensions, extension.DefinitionList)
+	}
+	if e.taskLists {
+		extensions = append(extensions, extension.TaskList)
+	}
+	if e.typographer {
+		extensions = append(extensions, extension.Typographer)
+	}
+	extensions = append(extensions, &markdownExtension{
+		headingAnchors: e.headingAnchors,
+		toc:            e.toc,
+		admonitions:    e.admonitions,
+		mermaid:        e.mermaid,
+	})
+	extensions = append(extensions, e.extensions...)
+
+	parserOptions := []parser.Option{}
+	if e.headingAnchors || e.toc {
+		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
+	}
+
+	e.markdown = goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
 		goldmark.WithRendererOptions(
 			html2.WithUnsafe()))
 
+	if e.sanitize {
+		e.sanitizer = newMarkdownSanitizer()
+	}
+
+	return e, nil
+}
+
+// Render renders the markdown source to HTML. ctx is the context of the request the page is rendered for,
+// which extensions get with RequestContext.
+func (e *MarkdownEngine) Render(ctx context.Context, source string) (string, error) {
+	src := []byte(source)
+	pc := parser.NewContext()
+	pc.Set(requestContextKey, ctx)
+	doc := e.markdown.Parser().Parse(text.NewReader(src), parser.WithContext(pc))
+
 	buf := new(bytes.Buffer)
-	err := engine.Convert([]byte(rendered), buf)
+	err := e.markdown.Renderer().Render(buf, src, doc)
+	if err != nil {
+		return "", err
+	}
+
+	ret := buf.String()
+	if e.sanitizer != nil {
+		ret = e.sanitizer.Sanitize(ret)
+	}
+	if e.mermaid && hasNode(doc, KindMermaid) {
+		ret += e.MermaidScript()
+	}
+	for _, extension := range e.extensions {
+		if ps, ok := extension.(PageScripter); ok {
+			ret += ps.PageScript(ret)
+		}
+	}
+
+	return ret, nil
+}
+
+// MermaidScript loads MermaidScriptPath, which draws the mermaid diagrams of the page.
+func (e *MarkdownEngine) MermaidScript() string {
+	return fmt.Sprintf("<script src=\"%s\"></script>\n", template.HTMLEscapeString(e.assetPrefix+MermaidScriptPath))
+}
+
+// RenderTemplate executes the markdown template t and renders the result to HTML.
+func (e *MarkdownEngine) RenderTemplate(ctx context.Context, t *template.Template, data interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	err := t.Execute(buf, data)
 	if err != nil {
 		return "", err
 	}
 
-	return buf.String(), nil
+	return e.Render(ctx, buf.String())
+}
+
+// requestContextKey holds the context of the request in the goldmark parser context, see RequestContext.
+var requestContextKey = parser.NewContextKey()
+
+// RequestContext returns the context of the request a markdown page is rendered for, for the
+// extensions running code while rendering the page, such as commands.
+func RequestContext(pc parser.Context) context.Context {
+	if ctx, ok := pc.Get(requestContextKey).(context.Context); ok && ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// PageScripter is implemented by the goldmark extensions whose content is drawn in the browser,
+// like the mermaid diagrams. The script is appended to the rendered HTML after sanitizing it,
+// so that these extensions also work on sanitized pages.
+type PageScripter interface {
+	// PageScript returns the script drawing the content of the rendered HTML,
+	// or an empty string if there is nothing to draw.
+	PageScript(html string) string
+}
+
+// newMarkdownSanitizer allows the HTML of user generated content, and the classes and styles
+// of the extensions and the code highlighting.
+func newMarkdownSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowStyling()
+	p.AllowElements("nav")
+	p.AllowStyles(
+		"color", "background-color", "font-weight", "font-style", "text-decoration",
+		"white-space", "display", "padding", "margin", "margin-right", "width", "border", "border-spacing",
+	).OnElements("span", "pre", "code", "div", "table", "tr", "td")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+func hasNode(doc ast.Node, kind ast.NodeKind) bool {
+	found := false
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && n.Kind() == kind {
+			found = true
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
+}
+
+var defaultMarkdownEngine = sync.OnceValue(func() *MarkdownEngine {
+	e, err := NewMarkdownEngine()
+	if err != nil {
+		panic(err)
+	}
+	return e
+})
+
+// RenderMarkdownTemplateToHTML executes the markdown template t and renders the result to HTML.
+// extensions are added to the default goldmark extensions.
+func RenderMarkdownTemplateToHTML(t *template.Template, data interface{}, extensions ...goldmark.Extender) (string, error) {
+	buf := new(bytes.Buffer)
+	err := t.Execute(buf, data)
+	if err != nil {
+		return "", err
+	}
+	rendered := buf.String()
+
+	return RenderMarkdownToHTML(rendered, extensions...)
+}
+
+// RenderMarkdownToHTML renders markdown with the default MarkdownEngine.
+// If extensions are given, an engine is built for them.
+func RenderMarkdownToHTML(rendered string, extensions ...goldmark.Extender) (string, error) {
+	engine := defaultMarkdownEngine()
+	if len(extensions) > 0 {
+		var err error
+		engine, err = NewMarkdownEngine(WithMarkdownEngineExtensions(extensions...))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return engine.Render(context.Background(), rendered)
 }
@@ -0,0 +1,188 @@
+package render
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownEngine(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     []MarkdownOption
+		source      string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "defaults",
+			source:   "# Title\n\n| a | b |\n|---|---|\n| 1 | 2 |\n",
+			contains: []string{"<h1>Title</h1>", "<table>", "<td>1</td>"},
+		},
+		{
+			name:     "heading anchors",
+			options:  []MarkdownOption{WithMarkdownHeadingAnchors(true)},
+			source:   "## Getting started\n",
+			contains: []string{`<h2 id="getting-started">Getting started<a href="#getting-started" class="anchor">#</a></h2>`},
+		},
+		{
+			name:    "toc",
+			options: []MarkdownOption{WithMarkdownTOC(true)},
+			source:  "# Title\n\n[TOC]\n\n## One\n\n### One.a\n\n## Two\n",
+			contains: []string{`<nav class="toc">
+<ul>
+<li><a href="#one">One</a>
+<ul>
+<li><a href="#onea">One.a</a></li>
+</ul>
+</li>
+<li><a href="#two">Two</a></li>
+</ul>
+</nav>
+`},
+			notContains: []string{"[TOC]", `href="#title"`},
+		},
+		{
+			name:        "toc disabled",
+			source:      "[TOC]\n\n## One\n",
+			contains:    []string{"<p>[TOC]</p>", "<h2>One</h2>"},
+			notContains: []string{"<nav"},
+		},
+		{
+			name:    "admonition",
+			options: []MarkdownOption{WithMarkdownAdmonitions(true)},
+			source:  "> [!WARNING]\n> Mind the **gap**.\n",
+			contains: []string{`<div class="admonition admonition-warning">
+<p class="admonition-title">Warning</p>
+<p>Mind the <strong>gap</strong>.</p>
+</div>`},
+			notContains: []string{"<blockquote>", "[!WARNING]"},
+		},
+		{
+			name:        "plain blockquote",
+			options:     []MarkdownOption{WithMarkdownAdmonitions(true)},
+			source:      "> [!UNKNOWN]\n> quoted\n",
+			contains:    []string{"<blockquote>"},
+			notContains: []string{"admonition"},
+		},
+		{
+			name:     "admonitions off by default",
+			source:   "> [!NOTE]\n> quoted\n",
+			contains: []string{"<blockquote>\n<p>[!NOTE]\nquoted</p>\n</blockquote>"},
+		},
+		{
+			name:     "mermaid",
+			options:  []MarkdownOption{WithMarkdownMermaid(true)},
+			source:   "```mermaid\ngraph TD\n  A --> B\n```\n",
+			contains: []string{"<pre class=\"mermaid\">graph TD\n  A --&gt; B\n</pre>\n", `<script src="/dist/mermaid.js"></script>`},
+		},
+		{
+			name:     "mermaid script under the root path",
+			options:  []MarkdownOption{WithMarkdownMermaid(true), WithMarkdownAssetPrefix("/app/")},
+			source:   "```mermaid\ngraph TD\n```\n",
+			contains: []string{`<script src="/app/dist/mermaid.js"></script>`},
+		},
+		{
+			name:        "no mermaid script without diagrams",
+			options:     []MarkdownOption{WithMarkdownMermaid(true)},
+			source:      "```go\nfmt.Println()\n```\n",
+			notContains: []string{MermaidScriptPath},
+		},
+		{
+			name:        "mermaid off by default",
+			source:      "```mermaid\ngraph TD\n```\n",
+			notContains: []string{`class="mermaid"`, MermaidScriptPath},
+		},
+		{
+			name:     "footnotes",
+			options:  []MarkdownOption{WithMarkdownFootnotes(true)},
+			source:   "A claim[^1].\n\n[^1]: A source.\n",
+			contains: []string{`class="footnotes"`, "A source."},
+		},
+		{
+			name:     "definition lists",
+			options:  []MarkdownOption{WithMarkdownDefinitionLists(true)},
+			source:   "Term\n: Definition\n",
+			contains: []string{"<dl>\n<dt>Term</dt>\n<dd>Definition</dd>\n</dl>"},
+		},
+		{
+			name:     "task lists",
+			options:  []MarkdownOption{WithMarkdownTaskLists(true)},
+			source:   "- [x] done\n- [ ] todo\n",
+			contains: []string{`<input checked="" disabled="" type="checkbox"> done`},
+		},
+		{
+			name:   "extensions off by default",
+			source: "A claim[^1].\n\n[^1]: A source.\n\nTerm\n: Definition\n\n- [x] done\n",
+			contains: []string{
+				"<p>A claim[^1].</p>",
+				"<p>Term\n: Definition</p>",
+				"<li>[x] done</li>",
+			},
+			notContains: []string{"footnotes", "<dl>", "checkbox"},
+		},
+		{
+			name:     "typographer",
+			options:  []MarkdownOption{WithMarkdownTypographer(true)},
+			source:   "\"quoted\" -- dash\n",
+			contains: []string{"&ldquo;quoted&rdquo; &ndash; dash"},
+		},
+		{
+			name:     "unsafe html is kept",
+			source:   "<script>alert(1)</script>\n\n<b onclick=\"x()\">bold</b>\n",
+			contains: []string{"<script>alert(1)</script>", "onclick"},
+		},
+		{
+			name: "sanitizer",
+			options: []MarkdownOption{
+				WithMarkdownSanitizer(true),
+				WithMarkdownTOC(true),
+				WithMarkdownAdmonitions(true),
+				WithMarkdownTaskLists(true),
+				WithMarkdownMermaid(true),
+			},
+			source: "[TOC]\n\n## One\n\n<script>alert(1)</script>\n\n<b onclick=\"x()\">bold</b>\n\n" +
+				"> [!TIP]\n> tip\n\n- [x] done\n\n```mermaid\ngraph TD\n```\n",
+			contains: []string{
+				"<b>bold</b>",
+				`<div class="admonition admonition-tip">`,
+				`<nav class="toc">`,
+				`<input checked="" disabled="" type="checkbox"`,
+				`<pre class="mermaid">`,
+				// the mermaid script is added after sanitizing
+				`<script src="/dist/mermaid.js"></script>`,
+			},
+			notContains: []string{"alert(1)", "onclick"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewMarkdownEngine(tt.options...)
+			require.NoError(t, err)
+			html, err := e.Render(context.Background(), tt.source)
+			require.NoError(t, err)
+			for _, s := range tt.contains {
+				assert.Contains(t, html, s)
+			}
+			for _, s := range tt.notContains {
+				assert.NotContains(t, html, s)
+			}
+		})
+	}
+}
+
+func TestMarkdownEngineHighlightStyle(t *testing.T) {
+	_, err := NewMarkdownEngine(WithMarkdownHighlightStyle("no-such-style"))
+	assert.Error(t, err)
+
+	e, err := NewMarkdownEngine(WithMarkdownHighlightStyle("github"), WithMarkdownLineNumbers(false))
+	require.NoError(t, err)
+	html, err := e.Render(context.Background(), "```go\nfunc main() {}\n```\n")
+	require.NoError(t, err)
+	// github has a white background, monokai a dark one
+	assert.Contains(t, html, "background-color:#fff")
+	assert.NotContains(t, html, "user-select:none")
+}
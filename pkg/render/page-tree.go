@@ -0,0 +1,452 @@
+package render
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PageListLookup is implemented by the template lookups that can list their pages.
+type PageListLookup interface {
+	// ListPages returns the pages of all the templates of the lookup.
+	ListPages() []*Page
+}
+
+// pageExtensions are the extensions of the templates that are pages, in the order the Renderer looks them up.
+var pageExtensions = []string{".tmpl.md", ".md", ".tmpl.html", ".html"}
+
+// PageNode is a page or a directory of a PageTree.
+type PageNode struct {
+	// Page is the page of the node. For directories, it is their index page, or nil if they don't have one.
+	Page *Page
+	// Title is the title of the front matter, the first heading of the page, or the file name.
+	Title string
+	// URL is the path the page is served at. The URL of directories ends with a `/`.
+	URL       string
+	Weight    int
+	IsSection bool
+	// Children are the pages and subdirectories of a directory, sorted by weight and title.
+	// Hidden pages are not listed.
+	Children []*PageNode
+
+	parent *PageNode
+}
+
+// Parent returns the directory of the node, or nil for the root.
+func (n *PageNode) Parent() *PageNode {
+	return n.parent
+}
+
+// PageTree builds the tree of the pages of a template lookup, to render the navigation of a site,
+// its breadcrumbs, its sitemap and its feed.
+//
+// The tree mirrors the directories of the templates. The `index` page of a directory is the page of
+// the directory node, and templates starting with `_` (layouts, partials) are left out.
+// The tree is built from the current templates every time, so that it follows the reloads of the lookup.
+type PageTree struct {
+	lookup PageListLookup
+	// BasePath is the path the pages are served under, for example `/docs`.
+	BasePath string
+	// BaseURL is the scheme and host used for the absolute URLs of the sitemap and the feed,
+	// for example `https://example.com`. If empty, the URL of the request is used.
+	BaseURL string
+}
+
+type PageTreeOption func(t *PageTree)
+
+// WithPageTreeBasePath sets the path the pages are served under.
+func WithPageTreeBasePath(basePath string) PageTreeOption {
+	return func(t *PageTree) {
+		t.BasePath = basePath
+	}
+}
+
+// WithPageTreeBaseURL sets the scheme and host of the absolute URLs of the sitemap and the feed.
+func WithPageTreeBaseURL(baseURL string) PageTreeOption {
+	return func(t *PageTree) {
+		t.BaseURL = baseURL
+	}
+}
+
+func NewPageTree(lookup PageListLookup, options ...PageTreeOption) *PageTree {
+	ret := &PageTree{
+		lookup: lookup,
+	}
+	for _, o := range options {
+		o(ret)
+	}
+	return ret
+}
+
+// Root returns the root of the tree. Draft pages are only included if drafts is set.
+func (t *PageTree) Root(drafts bool) *PageNode {
+	root, _ := t.build(drafts)
+	return root
+}
+
+// Site returns the tree of the pages, with page as the current page.
+func (t *PageTree) Site(page *Page, drafts bool) *Site {
+	root, nodes := t.build(drafts)
+	ret := &Site{Root: root}
+	if page != nil {
+		ret.Current = nodes[page.Name]
+	}
+	return ret
+}
+
+// build returns the root of the tree, and all the nodes of pages by template name, hidden pages included.
+func (t *PageTree) build(drafts bool) (*PageNode, map[string]*PageNode) {
+	// the Renderer serves the first page it finds for a URL
+	pages := map[string]*Page{}
+	priorities := map[string]int{}
+	for _, page := range t.lookup.ListPages() {
+		if isHiddenTemplate(page.Name) || (page.Draft && !drafts) {
+			continue
+		}
+		u, priority, ok := pageURL(page.Name)
+		if !ok {
+			continue
+		}
+		if p, ok := priorities[u]; ok && p <= priority {
+			continue
+		}
+		pages[u] = page
+		priorities[u] = priority
+	}
+
+	urls := make([]string, 0, len(pages))
+	for u := range pages {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	root := &PageNode{URL: t.url("/"), IsSection: true, Title: "Home"}
+	sections := map[string]*PageNode{"/": root}
+	var section func(u string) *PageNode
+	section = func(u string) *PageNode {
+		if s, ok := sections[u]; ok {
+			return s
+		}
+		dir := strings.TrimSuffix(u, "/")
+		parent := section(sectionURL(path.Dir(dir)))
+		s := &PageNode{
+			URL:       t.url(u),
+			IsSection: true,
+			Title:     humanizeName(path.Base(dir)),
+			parent:    parent,
+		}
+		parent.Children = append(parent.Children, s)
+		sections[u] = s
+		return s
+	}
+
+	nodes := map[string]*PageNode{}
+	for _, u := range urls {
+		page := pages[u]
+		var n *PageNode
+		if strings.HasSuffix(u, "/") {
+			n = section(u)
+		} else {
+			parent := section(sectionURL(path.Dir(u)))
+			n = &PageNode{URL: t.url(u), parent: parent}
+			if !page.Hidden {
+				parent.Children = append(parent.Children, n)
+			}
+		}
+		n.Page = page
+		n.Weight = page.Weight
+		n.Title = pageTitle(page, n.Title)
+		nodes[page.Name] = n
+	}
+
+	pruneSections(root)
+	sortNodes(root)
+
+	return root, nodes
+}
+
+// URLs returns the URLs of all the published pages, hidden pages included, sorted.
+func (t *PageTree) URLs() []string {
+	_, nodes := t.build(false)
+	ret := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		ret = append(ret, n.URL)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sectionURL returns the URL of the directory dir, ending with a `/`.
+func sectionURL(dir string) string {
+	if dir == "/" {
+		return dir
+	}
+	return dir + "/"
+}
+
+func (t *PageTree) url(u string) string {
+	return strings.TrimSuffix(t.BasePath, "/") + u
+}
+
+// pruneSections removes the hidden directories and the directories without pages from the tree.
+func pruneSections(n *PageNode) bool {
+	children := []*PageNode{}
+	for _, c := range n.Children {
+		if !c.IsSection || pruneSections(c) {
+			children = append(children, c)
+		}
+	}
+	n.Children = children
+
+	if n.Page != nil {
+		return !n.Page.Hidden
+	}
+	return len(n.Children) > 0
+}
+
+func sortNodes(n *PageNode) {
+	sort.SliceStable(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.Weight != b.Weight {
+			return a.Weight < b.Weight
+		}
+		if !strings.EqualFold(a.Title, b.Title) {
+			return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+		}
+		return a.URL < b.URL
+	})
+	for _, c := range n.Children {
+		sortNodes(c)
+	}
+}
+
+// pageURL returns the URL of the template name, relative to the directory, and the priority
+// of the template when several templates have the same URL, lower being first.
+func pageURL(name string) (string, int, bool) {
+	for i, ext := range pageExtensions {
+		if !strings.HasSuffix(name, ext) {
+			continue
+		}
+		base := strings.TrimSuffix(name, ext)
+		if path.Base(base) == "index" {
+			dir := path.Dir(base)
+			if dir == "." {
+				return "/", i, true
+			}
+			return "/" + dir + "/", i, true
+		}
+		return "/" + base, i, true
+	}
+	return "", 0, false
+}
+
+func pageTitle(page *Page, defaultTitle string) string {
+	if page.Title != "" {
+		return page.Title
+	}
+	if page.Heading != "" {
+		return page.Heading
+	}
+	if defaultTitle != "" {
+		return defaultTitle
+	}
+	u, _, _ := pageURL(page.Name)
+	return humanizeName(path.Base(u))
+}
+
+// humanizeName turns a file name like `getting-started` into `Getting started`.
+func humanizeName(name string) string {
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// Site is passed to the templates as `.Site` by the Renderer, see WithPageTree.
+//
+//	<nav>
+//	{{ range .Site.Root.Children }}
+//	  <a href="{{ .URL }}" {{ if $.Site.IsActive . }}class="active"{{ end }}>{{ .Title }}</a>
+//	{{ end }}
+//	</nav>
+//	{{ range .Site.Breadcrumbs }} / <a href="{{ .URL }}">{{ .Title }}</a>{{ end }}
+type Site struct {
+	Root *PageNode
+	// Current is the node of the rendered page, or nil if it is not part of the tree.
+	Current *PageNode
+}
+
+// Breadcrumbs returns the nodes from the root to the current page.
+func (s *Site) Breadcrumbs() []*PageNode {
+	ret := []*PageNode{}
+	for n := s.Current; n != nil; n = n.parent {
+		ret = append([]*PageNode{n}, ret...)
+	}
+	return ret
+}
+
+// IsActive returns true if n is the current page or one of its directories.
+func (s *Site) IsActive(n *PageNode) bool {
+	for c := s.Current; c != nil; c = c.parent {
+		if c == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Pages returns all the listed pages of the tree, in the order of the navigation.
+func (s *Site) Pages() []*PageNode {
+	return listPages(s.Root, []*PageNode{})
+}
+
+func listPages(n *PageNode, ret []*PageNode) []*PageNode {
+	if n.Page != nil {
+		ret = append(ret, n)
+	}
+	for _, c := range n.Children {
+		ret = listPages(c, ret)
+	}
+	return ret
+}
+
+const (
+	SitemapName = "sitemap.xml"
+	FeedName    = "rss.xml"
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// WriteSitemap writes the sitemap of the pages, drafts excluded. baseURL is prepended to their URL.
+func (t *PageTree) WriteSitemap(w io.Writer, baseURL string) error {
+	_, nodes := t.build(false)
+
+	urlSet := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, n := range nodes {
+		u := sitemapURL{Loc: baseURL + n.URL}
+		if !n.Page.Date.IsZero() {
+			u.LastMod = n.Page.Date.Format("2006-01-02")
+		}
+		urlSet.URLs = append(urlSet.URLs, u)
+	}
+	sort.Slice(urlSet.URLs, func(i, j int) bool { return urlSet.URLs[i].Loc < urlSet.URLs[j].Loc })
+
+	return writeXML(w, urlSet)
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description,omitempty"`
+}
+
+// WriteFeed writes the RSS feed of the listed pages that have a date, newest first.
+// baseURL is prepended to their URL.
+func (t *PageTree) WriteFeed(w io.Writer, baseURL string) error {
+	root, nodes := t.build(false)
+
+	channel := rssChannel{
+		Title: root.Title,
+		Link:  baseURL + root.URL,
+	}
+	if root.Page != nil {
+		channel.Description = root.Page.Description
+	}
+
+	dated := []*PageNode{}
+	for _, n := range nodes {
+		if !n.Page.Date.IsZero() && !n.Page.Hidden {
+			dated = append(dated, n)
+		}
+	}
+	sort.Slice(dated, func(i, j int) bool {
+		a, b := dated[i].Page.Date, dated[j].Page.Date
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return dated[i].URL < dated[j].URL
+	})
+	for _, n := range dated {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       n.Title,
+			Link:        baseURL + n.URL,
+			GUID:        baseURL + n.URL,
+			PubDate:     n.Page.Date.Format(time.RFC1123Z),
+			Description: n.Page.Description,
+		})
+	}
+
+	return writeXML(w, rss{Version: "2.0", Channel: channel})
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// baseURL returns the BaseURL of the tree, or the scheme and host of the request.
+func (t *PageTree) baseURL(c echo.Context) string {
+	if t.BaseURL != "" {
+		return strings.TrimSuffix(t.BaseURL, "/")
+	}
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+// SitemapHandler serves the sitemap of the pages, see WriteSitemap.
+func (t *PageTree) SitemapHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationXMLCharsetUTF8)
+		c.Response().WriteHeader(http.StatusOK)
+		return t.WriteSitemap(c.Response(), t.baseURL(c))
+	}
+}
+
+// FeedHandler serves the RSS feed of the pages, see WriteFeed.
+func (t *PageTree) FeedHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "application/rss+xml; charset=UTF-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return t.WriteFeed(c.Response(), t.baseURL(c))
+	}
+}
@@ -0,0 +1,273 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pageTreeFS = fstest.MapFS{
+	"index.md":           {Data: []byte("---\ntitle: Reports\ndescription: All reports\n---\n# Welcome\n")},
+	"about.tmpl.html":    {Data: []byte(`<h1>About us</h1>`)},
+	"getting-started.md": {Data: []byte("Read this first.\n")},
+	"faq.md":             {Data: []byte("# FAQ\n")},
+	"faq.html":           {Data: []byte(`<h1>Other FAQ</h1>`)},
+	"blog/index.md":      {Data: []byte("---\nweight: 1\n---\n# Blog\n")},
+	"blog/first.md":      {Data: []byte("---\ndate: 2024-01-02\n---\n# First post\n")},
+	"blog/second.md":     {Data: []byte("---\ndate: 2024-03-01\ndescription: The second one\n---\n# Second post\n")},
+	"blog/draft.md":      {Data: []byte("---\ndraft: true\ndate: 2024-05-01\n---\n# Draft\n")},
+	"guides/setup.md":    {Data: []byte("---\nweight: -1\n---\n# Setup\n")},
+	"guides/usage.md":    {Data: []byte("# Usage\n")},
+	"legal/imprint.md":   {Data: []byte("---\nhidden: true\n---\n# Imprint\n")},
+	"_layout.tmpl.html": {Data: []byte(
+		`{{ template "_partials/nav.tmpl.html" . }}<main>{{ block "content" . }}{{ end }}</main>`,
+	)},
+	"_partials/nav.tmpl.html": {Data: []byte(
+		`<nav>{{ range .Site.Root.Children }}[{{ if $.Site.IsActive . }}*{{ end }}{{ .Title }}]{{ end }}</nav>` +
+			`{{ range .Site.Breadcrumbs }}/{{ .Title }}{{ end }}`,
+	)},
+}
+
+// outline renders the tree as one line per node, indented by depth.
+func outline(n *PageNode, depth int) string {
+	ret := fmt.Sprintf("%s%s %s\n", strings.Repeat("  ", depth), n.Title, n.URL)
+	for _, c := range n.Children {
+		ret += outline(c, depth+1)
+	}
+	return ret
+}
+
+func newPageTreeLookup() *LookupTemplateFromFS {
+	return NewLookupTemplateFromFS(
+		WithFS(pageTreeFS),
+		WithPatterns("**/*.md", "**/*.tmpl.html", "**/*.html"),
+		WithLayouts(true),
+	)
+}
+
+func TestPageTree(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.CopyFS(dir, pageTreeFS))
+	watched, err := NewLookupTemplateFromWatchedDirectory(dir,
+		WithWatchedPatterns("**/*.md", "**/*.tmpl.html", "**/*.html"),
+		WithWatchedLayouts(true),
+	)
+	require.NoError(t, err)
+	lookups := map[string]PageListLookup{
+		"fs":      newPageTreeLookup(),
+		"watched": watched,
+	}
+
+	tests := []struct {
+		name     string
+		drafts   bool
+		expected string
+	}{
+		{
+			name: "published",
+			expected: `Reports /reports/
+  About us /reports/about
+  FAQ /reports/faq
+  Getting started /reports/getting-started
+  Guides /reports/guides/
+    Setup /reports/guides/setup
+    Usage /reports/guides/usage
+  Blog /reports/blog/
+    First post /reports/blog/first
+    Second post /reports/blog/second
+`,
+		},
+		{
+			name:   "drafts",
+			drafts: true,
+			expected: `Reports /reports/
+  About us /reports/about
+  FAQ /reports/faq
+  Getting started /reports/getting-started
+  Guides /reports/guides/
+    Setup /reports/guides/setup
+    Usage /reports/guides/usage
+  Blog /reports/blog/
+    Draft /reports/blog/draft
+    First post /reports/blog/first
+    Second post /reports/blog/second
+`,
+		},
+	}
+
+	for lookupName, lookup := range lookups {
+		tree := NewPageTree(lookup, WithPageTreeBasePath("/reports/"))
+		for _, tt := range tests {
+			t.Run(lookupName+"/"+tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.expected, outline(tree.Root(tt.drafts), 0))
+			})
+		}
+	}
+}
+
+func TestPageTreeSite(t *testing.T) {
+	lookup := newPageTreeLookup()
+	tree := NewPageTree(lookup)
+
+	tests := []struct {
+		page        string
+		breadcrumbs []string
+		active      []string
+	}{
+		{page: "index.md", breadcrumbs: []string{"Reports"}, active: []string{}},
+		{page: "blog/first.md", breadcrumbs: []string{"Reports", "Blog", "First post"}, active: []string{"Blog"}},
+		{page: "blog/index.md", breadcrumbs: []string{"Reports", "Blog"}, active: []string{"Blog"}},
+		// hidden pages are not listed, but have breadcrumbs
+		{page: "legal/imprint.md", breadcrumbs: []string{"Reports", "Legal", "Imprint"}, active: []string{}},
+		{page: "missing.md", breadcrumbs: []string{}, active: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			page, ok := lookup.LookupPage(tt.page)
+			if !ok {
+				page = &Page{Name: tt.page}
+			}
+			site := tree.Site(page, false)
+
+			breadcrumbs := []string{}
+			for _, n := range site.Breadcrumbs() {
+				breadcrumbs = append(breadcrumbs, n.Title)
+			}
+			assert.Equal(t, tt.breadcrumbs, breadcrumbs)
+
+			active := []string{}
+			for _, n := range site.Root.Children {
+				if site.IsActive(n) {
+					active = append(active, n.Title)
+				}
+			}
+			assert.Equal(t, tt.active, active)
+		})
+	}
+
+	pages := []string{}
+	for _, n := range tree.Site(nil, false).Pages() {
+		pages = append(pages, n.URL)
+	}
+	assert.Equal(t, []string{
+		"/", "/about", "/faq", "/getting-started", "/guides/setup", "/guides/usage",
+		"/blog/", "/blog/first", "/blog/second",
+	}, pages)
+}
+
+func TestPageTreeSitemapAndFeed(t *testing.T) {
+	tree := NewPageTree(newPageTreeLookup(), WithPageTreeBasePath("/reports"))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, tree.WriteSitemap(buf, "https://example.com"))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://example.com/reports/</loc>
+  </url>
+  <url>
+    <loc>https://example.com/reports/about</loc>
+  </url>
+  <url>
+    <loc>https://example.com/reports/blog/</loc>
+  </url>
+  <url>
+    <loc>https://example.com/reports/blog/first</loc>
+    <lastmod>2024-01-02</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/reports/blog/second</loc>
+    <lastmod>2024-03-01</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/reports/faq</loc>
+  </url>
+  <url>
+    <loc>https://example.com/reports/getting-started</loc>
+  </url>
+  <url>
+    <loc>https://example.com/reports/guides/setup</loc>
+  </url>
+  <url>
+    <loc>https://example.com/reports/guides/usage</loc>
+  </url>
+  <url>
+    <loc>https://example.com/reports/legal/imprint</loc>
+  </url>
+</urlset>
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, tree.WriteFeed(buf, "https://example.com"))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Reports</title>
+    <link>https://example.com/reports/</link>
+    <description>All reports</description>
+    <item>
+      <title>Second post</title>
+      <link>https://example.com/reports/blog/second</link>
+      <guid>https://example.com/reports/blog/second</guid>
+      <pubDate>Fri, 01 Mar 2024 00:00:00 +0000</pubDate>
+      <description>The second one</description>
+    </item>
+    <item>
+      <title>First post</title>
+      <link>https://example.com/reports/blog/first</link>
+      <guid>https://example.com/reports/blog/first</guid>
+      <pubDate>Tue, 02 Jan 2024 00:00:00 +0000</pubDate>
+    </item>
+  </channel>
+</rss>
+`, buf.String())
+}
+
+func TestRendererSite(t *testing.T) {
+	lookup := newPageTreeLookup()
+	tree := NewPageTree(lookup)
+	r, err := NewRenderer(WithAppendTemplateLookups(lookup), WithPageTree(tree))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/"+SitemapName, tree.SitemapHandler())
+	e.GET("/*", r.WithTemplateDirHandler(nil))
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{
+			path:     "/about",
+			expected: `<nav>[*About us][FAQ][Getting started][Guides][Blog]</nav>/Reports/About us<main><h1>About us</h1></main>`,
+		},
+		{
+			path:     "/blog/first",
+			expected: "<nav>[About us][FAQ][Getting started][Guides][*Blog]</nav>/Reports/Blog/First post<main><h1>First post</h1>\n</main>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expected, resp.Body.String())
+		})
+	}
+
+	resp := httptest.NewRecorder()
+	e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, echo.MIMEApplicationXMLCharsetUTF8, resp.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, resp.Body.String(), "<loc>http://example.com/blog/first</loc>")
+}
@@ -1,14 +1,17 @@
 package render
 
 import (
+	"context"
 	"html/template"
 	"net/http"
 	"strings"
 
+	"github.com/go-go-golems/parka/pkg/server/livereload"
 	"github.com/go-go-golems/parka/pkg/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"github.com/yuin/goldmark"
 )
 
 // Renderer is a struct that is able to lookup a page name and render it.
@@ -51,6 +54,33 @@ type Renderer struct {
 	MarkdownBaseTemplateName string
 
 	IndexTemplateName string
+
+	// MarkdownExtensions are added to the goldmark extensions used to render markdown pages.
+	MarkdownExtensions []goldmark.Extender
+	// Markdown renders the markdown pages. It is built by NewRenderer from the markdown options
+	// and MarkdownExtensions.
+	Markdown        *MarkdownEngine
+	markdownOptions []MarkdownOption
+
+	// LiveReload appends the live reload script to the rendered HTML pages, see pkg/server/livereload.
+	LiveReload bool
+
+	// MaxBufferSize is the size up to which pages are buffered before being sent, so that
+	// rendering errors result in an error page. Larger pages are streamed, see BufferedResponseWriter.
+	MaxBufferSize int
+
+	// DevMode shows the details of rendering errors on error pages.
+	DevMode bool
+
+	// DataDirectory holds the data files passed to every template as `.Data`.
+	DataDirectory *DataDirectory
+
+	// PageTree is passed to the templates of the pages as `.Site`, for their navigation.
+	PageTree *PageTree
+
+	// RequestFuncs returns template functions bound to the context of a request, for example
+	// the functions running commands of pkg/render/commands, see WithRequestFuncs.
+	RequestFuncs func(ctx context.Context) template.FuncMap
 }
 
 type RendererOption func(r *Renderer) error
@@ -103,6 +133,78 @@ func WithAppendTemplateLookups(lookups ...TemplateLookup) RendererOption {
 	}
 }
 
+// WithMarkdownExtensions adds goldmark extensions used when rendering markdown pages,
+// for example the command blocks of pkg/render/commands.
+func WithMarkdownExtensions(extensions ...goldmark.Extender) RendererOption {
+	return func(r *Renderer) error {
+		r.MarkdownExtensions = append(r.MarkdownExtensions, extensions...)
+		return nil
+	}
+}
+
+// WithMarkdownOptions configures the engine rendering markdown pages, see MarkdownEngine.
+func WithMarkdownOptions(options ...MarkdownOption) RendererOption {
+	return func(r *Renderer) error {
+		r.markdownOptions = append(r.markdownOptions, options...)
+		return nil
+	}
+}
+
+// WithLiveReload makes the rendered HTML pages reload themselves when the files
+// they are rendered from change. The live reload endpoint needs to be served, see pkg/server/livereload.
+func WithLiveReload(liveReload bool) RendererOption {
+	return func(r *Renderer) error {
+		r.LiveReload = liveReload
+		return nil
+	}
+}
+
+// WithMaxBufferSize sets the size up to which pages are buffered before being sent.
+// A size of 0 streams pages as they are rendered.
+func WithMaxBufferSize(size int) RendererOption {
+	return func(r *Renderer) error {
+		r.MaxBufferSize = size
+		return nil
+	}
+}
+
+// WithDevMode shows the error message, the template location and an excerpt
+// of the failing template on error pages.
+func WithDevMode(devMode bool) RendererOption {
+	return func(r *Renderer) error {
+		r.DevMode = devMode
+		return nil
+	}
+}
+
+// WithDataDirectory passes the data files of d to every template as `.Data`.
+func WithDataDirectory(d *DataDirectory) RendererOption {
+	return func(r *Renderer) error {
+		r.DataDirectory = d
+		return nil
+	}
+}
+
+// WithPageTree passes the tree of the pages to the templates as `.Site`, see Site.
+func WithPageTree(tree *PageTree) RendererOption {
+	return func(r *Renderer) error {
+		r.PageTree = tree
+		return nil
+	}
+}
+
+// WithRequestFuncs binds template functions to the context of each request, so that for example commands
+// run from templates are canceled with their request. The functions must be given to the template lookups
+// as well, so that the templates can be parsed.
+//
+// The templates are cloned for each request to bind the functions, see bindRequestFuncs.
+func WithRequestFuncs(funcs func(ctx context.Context) template.FuncMap) RendererOption {
+	return func(r *Renderer) error {
+		r.RequestFuncs = funcs
+		return nil
+	}
+}
+
 func WithIndexTemplateName(name string) RendererOption {
 	return func(r *Renderer) error {
 		r.IndexTemplateName = name
@@ -121,16 +223,38 @@ func WithReplaceTemplateLookups(lookups ...TemplateLookup) RendererOption {
 func NewRenderer(opts ...RendererOption) (*Renderer, error) {
 	r := &Renderer{
 		IndexTemplateName: "index",
+		MaxBufferSize:     DefaultMaxBufferSize,
+	}
+
+	err := r.Configure(opts...)
+	if err != nil {
+		return nil, err
 	}
 
+	return r, nil
+}
+
+// Configure applies options to the renderer and rebuilds its markdown engine. This is used
+// to configure a renderer that was already created, for example the default renderer of the server
+// from the defaults of a config file. It must not be called while the renderer is serving requests.
+func (r *Renderer) Configure(opts ...RendererOption) error {
 	for _, opt := range opts {
 		err := opt(r)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	return r, nil
+	markdownOptions := []MarkdownOption{}
+	markdownOptions = append(markdownOptions, r.markdownOptions...)
+	markdownOptions = append(markdownOptions, WithMarkdownEngineExtensions(r.MarkdownExtensions...))
+	markdown, err := NewMarkdownEngine(markdownOptions...)
+	if err != nil {
+		return err
+	}
+	r.Markdown = markdown
+
+	return nil
 }
 
 // LookupTemplate will iterate through the template lookups until it finds one of the
@@ -163,11 +287,17 @@ func (r *Renderer) LookupTemplate(name ...string) (*template.Template, error) {
 // either page.html or page.tmpl.html and serve it as a template, passing it the given data.
 // page.html is served as a plain HTML file, while page.tmpl.html is served as a template.
 //
-// NOTE(manuel, 2023-06-21)
-// Render renders directly into the http.ResponseWriter, which means that an error in the template
-// rendering will not be able to update the headers, as those will have already been sent.
-// This could lead to partial writes with an error code of 200 if there is an error rendering the template,
-// not sure if that's exactly what we want.
+// The YAML front matter of the page is passed to the templates as `.Page`, see Page.
+// Its layout replaces the markdown base template, and draft pages are only rendered in dev mode.
+// The files of the data directory are passed to the templates as `.Data`, see DataDirectory,
+// and the tree of the pages as `.Site`, see Site.
+//
+// If the template lookups support layouts (see LayoutLookup), markdown pages are rendered into the
+// layout of their directory instead of the base template, and get the data as well.
+//
+// Pages are buffered up to MaxBufferSize, so that an error while executing the template results
+// in a 500 error page instead of a truncated page with a 200 status. When a larger page fails,
+// an error block is appended to the part that has already been sent, see HandleRenderError.
 func (r *Renderer) Render(
 	c echo.Context,
 	templateName string,
@@ -176,6 +306,9 @@ func (r *Renderer) Render(
 	// first, merge the data we want to pass to the templates, with the data passed in overridding
 	// the data in the renderer
 	data_ := map[string]interface{}{}
+	if r.DataDirectory != nil {
+		data_["Data"] = r.DataDirectory.Data()
+	}
 	for k, v := range r.Data {
 		data_[k] = v
 	}
@@ -185,61 +318,185 @@ func (r *Renderer) Render(
 
 	// TODO(manuel, 2023-05-26) Don't render plain files as templates
 	// See https://github.com/go-go-golems/parka/issues/47
-	t, err := r.LookupTemplate(templateName+".tmpl.md", templateName+".md", templateName)
+	markdownNames := []string{templateName + ".tmpl.md", templateName + ".md", templateName}
+	t, err := r.LookupTemplate(markdownNames...)
 	if err != nil {
 		return errors.Wrap(err, "error looking up template")
 	}
 
-	baseTemplate, err := r.LookupTemplate(r.MarkdownBaseTemplateName)
+	baseTemplateName := r.MarkdownBaseTemplateName
+	if t != nil {
+		page := r.lookupPage(t.Name(), markdownNames...)
+		if page.Draft && !r.DevMode {
+			return &utils.NoPageFoundError{Page: templateName}
+		}
+		r.addPageData(data_, page)
+		if page.Layout != "" {
+			baseTemplateName = page.Layout
+		}
+	}
+
+	baseTemplate, err := r.LookupTemplate(baseTemplateName)
 	if err != nil {
 		return errors.Wrap(err, "error looking up base template")
 	}
 
-	if baseTemplate == nil {
+	// markdown pages in a directory with a layout are rendered into it instead of the base template
+	var layout *template.Template
+	if t != nil {
+		layout, err = r.lookupMarkdownLayout(t.Name())
+		if err != nil {
+			return errors.Wrap(err, "error looking up layout")
+		}
+	}
+
+	t = r.bindRequestFuncs(c, t)
+	baseTemplate = r.bindRequestFuncs(c, baseTemplate)
+	layout = r.bindRequestFuncs(c, layout)
+
+	w := NewBufferedResponseWriter(c, http.StatusOK, r.MaxBufferSize)
+
+	if baseTemplate == nil && layout == nil {
 		// no base template to render the markdown to HTML, so just return the markdown
 		c.Response().Header().Set("Content-Type", "text/plain")
-		c.Response().WriteHeader(http.StatusOK)
 
-		err := t.Execute(c.Response(), data)
+		err := t.Execute(w, data_)
 		if err != nil {
-			return errors.Wrap(err, "error executing template")
+			return r.handleRenderError(c, errors.Wrap(err, "error executing template"))
 		}
 
-		return nil
+		return w.Flush()
 	}
 
 	if t != nil {
-		markdown, err := RenderMarkdownTemplateToHTML(t, nil)
+		markdown, err := r.Markdown.RenderTemplate(c.Request().Context(), t, data_)
 		if err != nil {
-			return errors.Wrap(err, "error rendering markdown")
+			return r.handleRenderError(c, errors.Wrap(err, "error rendering markdown"))
 		}
 
-		c.Response().WriteHeader(http.StatusOK)
-		err = baseTemplate.Execute(
-			c.Response(),
-			map[string]interface{}{
-				"markdown": template.HTML(markdown), // #nosec G203
-			})
-		if err != nil {
-			return errors.Wrap(err, "error executing base template")
+		if layout != nil {
+			layoutData := map[string]interface{}{}
+			for k, v := range data_ {
+				layoutData[k] = v
+			}
+			layoutData["markdown"] = template.HTML(markdown) // #nosec G203
+
+			err = layout.Execute(w, layoutData)
+			if err != nil {
+				return r.handleRenderError(c, errors.Wrap(err, "error executing layout"))
+			}
+		} else {
+			err = baseTemplate.Execute(
+				w,
+				map[string]interface{}{
+					"markdown": template.HTML(markdown), // #nosec G203
+					"Page":     data_["Page"],
+					"Data":     data_["Data"],
+					"Site":     data_["Site"],
+				})
+			if err != nil {
+				return r.handleRenderError(c, errors.Wrap(err, "error executing base template"))
+			}
 		}
 	} else {
-		t, err = r.LookupTemplate(templateName+".tmpl.html", templateName+".html")
+		htmlNames := []string{templateName + ".tmpl.html", templateName + ".html"}
+		t, err = r.LookupTemplate(htmlNames...)
 		if err != nil {
 			return errors.Wrap(err, "error looking up template")
 		}
 		if t == nil {
 			return &utils.NoPageFoundError{Page: templateName}
 		}
+		t = r.bindRequestFuncs(c, t)
+		page := r.lookupPage(t.Name(), htmlNames...)
+		if page.Draft && !r.DevMode {
+			return &utils.NoPageFoundError{Page: templateName}
+		}
+		r.addPageData(data_, page)
 
-		c.Response().WriteHeader(http.StatusOK)
+		err := t.Execute(w, data_)
+		if err != nil {
+			return r.handleRenderError(c, errors.Wrap(err, "error executing template"))
+		}
+	}
 
-		err := t.Execute(c.Response(), data)
+	if r.LiveReload {
+		// browsers move content following the end of the document into the body
+		_, err = w.Write([]byte(livereload.Script(c)))
 		if err != nil {
-			return errors.Wrap(err, "error executing template")
+			return errors.Wrap(err, "error writing live reload script")
 		}
 	}
-	return nil
+
+	return w.Flush()
+}
+
+// lookupPage returns the front matter of the first of the given templates found in
+// the template lookups, see PageLookup. Templates without front matter get an empty page.
+func (r *Renderer) lookupPage(templateName string, names ...string) *Page {
+	for _, lookup := range r.TemplateLookups {
+		pl, ok := lookup.(PageLookup)
+		if !ok {
+			continue
+		}
+		if page, ok := pl.LookupPage(names...); ok {
+			return page
+		}
+	}
+	return &Page{
+		Name:   templateName,
+		Params: map[string]interface{}{},
+	}
+}
+
+// addPageData adds the page and the tree of the pages to the data passed to the templates.
+func (r *Renderer) addPageData(data map[string]interface{}, page *Page) {
+	data["Page"] = page
+	if r.PageTree != nil {
+		data["Site"] = r.PageTree.Site(page, r.DevMode)
+	}
+}
+
+// lookupMarkdownLayout returns the layout of the markdown page name from the first
+// template lookup that has one, see LayoutLookup.
+func (r *Renderer) lookupMarkdownLayout(name string) (*template.Template, error) {
+	for _, lookup := range r.TemplateLookups {
+		ll, ok := lookup.(LayoutLookup)
+		if !ok {
+			continue
+		}
+		t, err := ll.LookupMarkdownLayout(name)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+// bindRequestFuncs returns a clone of t using the RequestFuncs bound to the context of the request c.
+//
+// html/template can't clone templates once they have been executed, so the templates of the lookups are
+// only executed through their clones. Templates that have been executed elsewhere, for example the
+// default templates shared with other handlers, are returned as they are and keep the functions they
+// were parsed with.
+func (r *Renderer) bindRequestFuncs(c echo.Context, t *template.Template) *template.Template {
+	if t == nil || r.RequestFuncs == nil {
+		return t
+	}
+	clone, err := t.Clone()
+	if err != nil {
+		log.Debug().Err(err).Str("template", t.Name()).Msg("could not bind template to the request")
+		return t
+	}
+	return clone.Funcs(r.RequestFuncs(c.Request().Context()))
+}
+
+// handleRenderError replaces the buffered page with an error page, see HandleRenderError.
+func (r *Renderer) handleRenderError(c echo.Context, err error) error {
+	return HandleRenderError(c, err, r.DevMode, r.TemplateLookups...)
 }
 
 func (r *Renderer) WithTemplateHandler(templateName string, data map[string]interface{}) echo.HandlerFunc {
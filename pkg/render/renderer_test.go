@@ -0,0 +1,70 @@
+package render
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userKey struct{}
+
+func TestRendererRequestFuncs(t *testing.T) {
+	funcs := func(ctx context.Context) template.FuncMap {
+		return template.FuncMap{
+			"user": func() string {
+				user, _ := ctx.Value(userKey{}).(string)
+				return user
+			},
+		}
+	}
+	lookup := NewLookupTemplateFromFS(
+		WithFS(fstest.MapFS{
+			"base.tmpl.html":  {Data: []byte(`<main>{{ .markdown }}</main>`)},
+			"index.tmpl.html": {Data: []byte(`<p>{{ user }}</p>`)},
+			"notes.tmpl.md":   {Data: []byte(`# Notes of {{ user }}`)},
+		}),
+		WithPatterns("**/*.tmpl.html", "**/*.tmpl.md"),
+		WithFuncs(funcs(context.Background())),
+	)
+	require.NoError(t, lookup.Reload())
+	r, err := NewRenderer(
+		WithAppendTemplateLookups(lookup),
+		WithMarkdownBaseTemplateName("base.tmpl.html"),
+		WithRequestFuncs(funcs),
+	)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/*", r.WithTemplateDirHandler(nil), func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := context.WithValue(c.Request().Context(), userKey{}, c.QueryParam("user"))
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	})
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/?user=alice", expected: `<p>alice</p>`},
+		{path: "/?user=bob", expected: `<p>bob</p>`},
+		{path: "/notes?user=alice", expected: "<main><h1>Notes of alice</h1>\n</main>"},
+		{path: "/notes?user=bob", expected: "<main><h1>Notes of bob</h1>\n</main>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expected, resp.Body.String())
+		})
+	}
+}
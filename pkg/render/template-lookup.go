@@ -9,10 +9,14 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/go-go-golems/glazed/pkg/helpers/templating"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 )
 
 // TemplateLookup is an interface for objects that can lookup a template by name.
@@ -38,6 +42,8 @@ type LookupTemplateFromFile struct {
 	File string
 	// The templateName to respond to, if empty, all templates request will return the file content.
 	TemplateName string
+	// Funcs are additional functions made available to the template.
+	Funcs template.FuncMap
 }
 
 func NewLookupTemplateFromFile(file string, templateName string) *LookupTemplateFromFile {
@@ -56,7 +62,11 @@ func (l *LookupTemplateFromFile) Lookup(name ...string) (*template.Template, err
 	for _, name_ := range name {
 		if l.TemplateName == "" || l.TemplateName == name_ {
 			templateName := path.Base(l.File)
-			t, err := templating.CreateHTMLTemplate(templateName).Parse(string(b))
+			_, source, err := ParseFrontMatter(templateName, string(b))
+			if err != nil {
+				return nil, err
+			}
+			t, err := templating.CreateHTMLTemplate(templateName).Funcs(l.Funcs).Parse(source)
 			if err != nil {
 				return nil, err
 			}
@@ -68,10 +78,40 @@ func (l *LookupTemplateFromFile) Lookup(name ...string) (*template.Template, err
 	return nil, errors.Errorf("template %s not found", name)
 }
 
+// LookupPage returns the front matter of the file, if one of the given names matches.
+func (l *LookupTemplateFromFile) LookupPage(name ...string) (*Page, bool) {
+	for _, name_ := range name {
+		if l.TemplateName == "" || l.TemplateName == name_ {
+			b, err := os.ReadFile(l.File)
+			if err != nil {
+				return nil, false
+			}
+			page, _, err := ParseFrontMatter(path.Base(l.File), string(b))
+			if err != nil {
+				return nil, false
+			}
+			return page, true
+		}
+	}
+	return nil, false
+}
+
 func (l *LookupTemplateFromFile) Reload(name ...string) error {
 	return nil
 }
 
+// TemplateSource returns the content of the file, which is parsed under its base name.
+func (l *LookupTemplateFromFile) TemplateSource(name string) (string, bool) {
+	if name != path.Base(l.File) {
+		return "", false
+	}
+	b, err := os.ReadFile(l.File)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
 // LookupTemplateFromDirectory will load a template at runtime. This is useful
 // for testing local changes to templates without having to recompile the app.
 type LookupTemplateFromDirectory struct {
@@ -138,7 +178,11 @@ func (l *LookupTemplateFromDirectory) Lookup(name ...string) (*template.Template
 			}
 
 			templateName := strings.TrimPrefix(fileName, dir)
-			t, err := templating.CreateHTMLTemplate(templateName).Parse(string(b))
+			_, source, err := ParseFrontMatter(templateName, string(b))
+			if err != nil {
+				return nil, err
+			}
+			t, err := templating.CreateHTMLTemplate(templateName).Parse(source)
 			if err != nil {
 				return nil, err
 			}
@@ -167,7 +211,19 @@ type LookupTemplateFromFS struct {
 	baseDir      string
 	patterns     []string
 	alwaysReload bool
+	funcs        template.FuncMap
 	tmpl         *template.Template
+
+	layouts bool
+	// base is the unexecuted template set the layouts are cloned from, as html/template
+	// templates can't be cloned once they have been executed
+	base *template.Template
+	// mu protects the pages, the sources and layoutCache, which holds the pages rendered into their layout
+	mu          sync.Mutex
+	layoutCache map[string]*template.Template
+	pages       map[string]*Page
+	// sources are the templates of the files, without their front matter
+	sources map[string]string
 }
 
 // Example usage:
@@ -188,6 +244,26 @@ func WithAlwaysReload(alwaysReload bool) LookupTemplateFromFSOption {
 	}
 }
 
+// WithFuncs makes additional functions available to the templates.
+func WithFuncs(funcs template.FuncMap) LookupTemplateFromFSOption {
+	return func(l *LookupTemplateFromFS) {
+		if l.funcs == nil {
+			l.funcs = template.FuncMap{}
+		}
+		for k, v := range funcs {
+			l.funcs[k] = v
+		}
+	}
+}
+
+// WithLayouts renders the HTML and markdown pages into the `_layout.tmpl.html` of their nearest
+// ancestor directory, and hides the templates starting with `_`. See LayoutTemplateName.
+func WithLayouts(layouts bool) LookupTemplateFromFSOption {
+	return func(l *LookupTemplateFromFS) {
+		l.layouts = layouts
+	}
+}
+
 func WithFS(_fs fs.FS) LookupTemplateFromFSOption {
 	return func(l *LookupTemplateFromFS) {
 		l._fs = _fs
@@ -223,10 +299,24 @@ func NewLookupTemplateFromFS(options ...LookupTemplateFromFSOption) *LookupTempl
 // Reload all templates from the fs / basedir. This ignores the partial reload, so
 // depending on your setup, be mindful of the performance impact.
 func (l *LookupTemplateFromFS) Reload(name ...string) error {
-	tmpl, err := LoadTemplateFS(l._fs, l.baseDir, l.patterns...)
+	tmpl, sources, pages, err := loadTemplateFS(l._fs, l.baseDir, l.funcs, l.patterns...)
 	if err != nil {
 		return err
 	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pages = pages
+	l.sources = sources
+	if l.layouts {
+		l.base = tmpl
+		l.layoutCache = map[string]*template.Template{}
+		tmpl, err = tmpl.Clone()
+		if err != nil {
+			return err
+		}
+	}
 	l.tmpl = tmpl
 	return nil
 }
@@ -248,22 +338,192 @@ func (l *LookupTemplateFromFS) Lookup(name ...string) (*template.Template, error
 	}
 
 	for _, n := range name {
+		if l.layouts && isHiddenTemplate(n) {
+			continue
+		}
 		t := l.tmpl.Lookup(n)
-		if t != nil {
-			return t, nil
+		if t == nil {
+			continue
+		}
+
+		if l.layouts {
+			source, ok := l.source(n)
+			if ok && usesLayout(n, source) {
+				layout, err := l.lookupLayout(n, n, source)
+				if err != nil {
+					return nil, err
+				}
+				if layout != nil {
+					return layout, nil
+				}
+			}
 		}
+
+		return t, nil
 	}
 
 	return nil, errors.New("template not found")
 }
 
-// LoadTemplateFS will load a template from a fs.FS.
-func LoadTemplateFS(_fs fs.FS, baseDir string, patterns ...string) (*template.Template, error) {
-	tmpl := templating.CreateHTMLTemplate("")
-	err := templating.ParseHTMLFS(tmpl, _fs, patterns, baseDir)
+// LookupMarkdownLayout returns the layout of the markdown page name, if layouts are enabled.
+func (l *LookupTemplateFromFS) LookupMarkdownLayout(name string) (*template.Template, error) {
+	if !l.layouts || l.tmpl == nil || l.tmpl.Lookup(name) == nil {
+		return nil, nil
+	}
+	return l.lookupLayout("markdown:"+name, name, markdownContentSource)
+}
+
+// lookupLayout returns the page rendered into its layout, cached under key, or nil if it has no layout.
+func (l *LookupTemplateFromFS) lookupLayout(key string, page string, pageSource string) (*template.Template, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t, ok := l.layoutCache[key]; ok {
+		return t, nil
+	}
+
+	exists := func(name string) bool {
+		_, ok := l.sources[name]
+		return ok
+	}
+	var layout string
+	if p, ok := l.pages[page]; ok && p.Layout != "" {
+		if !exists(p.Layout) {
+			return nil, errors.Errorf("layout %s of %s not found", p.Layout, page)
+		}
+		layout = p.Layout
+	} else {
+		layout, ok = findLayout(page, exists)
+		if !ok {
+			l.layoutCache[key] = nil
+			return nil, nil
+		}
+	}
+	layoutSource := l.sources[layout]
+
+	tmpl, err := l.base.Clone()
 	if err != nil {
 		return nil, err
 	}
+	t, err := addLayout(tmpl, layout, layoutSource, page, pageSource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to render %s into layout %s", page, layout)
+	}
+	l.layoutCache[key] = t
+
+	return t, nil
+}
+
+// LookupPage returns the front matter of the first of the given templates that exists.
+func (l *LookupTemplateFromFS) LookupPage(name ...string) (*Page, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, n := range name {
+		if l.layouts && isHiddenTemplate(n) {
+			continue
+		}
+		if p, ok := l.pages[n]; ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// ListPages returns the pages of the templates, sorted by name.
+func (l *LookupTemplateFromFS) ListPages() []*Page {
+	if l.tmpl == nil {
+		err := l.Reload()
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to load templates")
+			return []*Page{}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ret := []*Page{}
+	for _, p := range l.pages {
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func (l *LookupTemplateFromFS) source(name string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.sources[name]
+	return s, ok
+}
+
+// TemplateSource returns the content of the file the template name was parsed from.
+func (l *LookupTemplateFromFS) TemplateSource(name string) (string, bool) {
+	file := path.Join(l.baseDir, name)
+	if !fs.ValidPath(file) {
+		return "", false
+	}
+	b, err := fs.ReadFile(l._fs, file)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// LoadTemplateFS will load a template from a fs.FS.
+func LoadTemplateFS(_fs fs.FS, baseDir string, patterns ...string) (*template.Template, error) {
+	tmpl, _, _, err := loadTemplateFS(_fs, baseDir, nil, patterns...)
+	return tmpl, err
+}
+
+// loadTemplateFS parses the files of _fs matching the patterns into a template set, naming each
+// template after its path relative to baseDir. It returns the template sources without their front matter,
+// and the pages described by the front matter, keyed by template name.
+func loadTemplateFS(
+	_fs fs.FS,
+	baseDir string,
+	funcs template.FuncMap,
+	patterns ...string,
+) (*template.Template, map[string]string, map[string]*Page, error) {
+	files := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		pattern = filepath.Join(baseDir, pattern)
+		err := doublestar.GlobWalk(_fs, pattern, func(p string, d fs.DirEntry) error {
+			if strings.HasPrefix(p, baseDir) && !seen[p] {
+				seen[p] = true
+				files = append(files, p)
+			}
+			return nil
+		}, doublestar.WithFilesOnly())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	tmpl := templating.CreateHTMLTemplate("").Funcs(funcs)
+	sources := map[string]string{}
+	pages := map[string]*Page{}
+	for _, file := range files {
+		b, err := fs.ReadFile(_fs, file)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "failed to read template %s", file)
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(file, baseDir), "/")
+		page, source, err := ParseFrontMatter(name, string(b))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		_, err = tmpl.New(name).Parse(source)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "failed to parse template %s", file)
+		}
+		sources[name] = source
+		pages[name] = page
+	}
 
-	return tmpl, nil
+	return tmpl, sources, pages, nil
 }
@@ -0,0 +1,806 @@
+package render
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template/parse"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/go-go-golems/clay/pkg/watcher"
+	"github.com/go-go-golems/glazed/pkg/helpers/templating"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateError is a template file that failed to parse or compile.
+type TemplateError struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// DefaultWatchSettleDelay is how long a file has to stay unchanged after a write before it is reloaded.
+const DefaultWatchSettleDelay = 100 * time.Millisecond
+
+// DevTemplateErrorsPath is the path of the dev mode endpoint listing the template errors.
+const DevTemplateErrorsPath = "/_parka/template-errors"
+
+// TemplateErrorReporter is implemented by template lookups that keep serving
+// the last good templates when a file fails to parse, and report the failures instead.
+type TemplateErrorReporter interface {
+	TemplateErrors() []TemplateError
+}
+
+// LookupTemplateFromWatchedDirectory loads the templates of a directory once, and
+// watches the directory to reload the templates that changed.
+//
+// Each file is parsed on its own to find out the templates it defines and the templates
+// it references. A lookup compiles the requested file together with the files defining the
+// templates it (transitively) references, and caches the result. When a file changes, only the
+// compiled templates that include it are recompiled.
+//
+// When a file fails to parse, the last good version of the file keeps being served and
+// the error is reported through TemplateErrors.
+//
+// Writes are debounced: a file is reloaded once it stayed unchanged for the settle delay.
+// A reload that finds the file empty, or defining fewer templates than before, is most likely
+// reading a file that is still being written, and is only accepted if the file still has the same
+// content after another settle delay.
+//
+// The directory is only watched while Watch is running.
+type LookupTemplateFromWatchedDirectory struct {
+	directory   string
+	patterns    []string
+	funcs       template.FuncMap
+	layouts     bool
+	settleDelay time.Duration
+
+	mu       sync.Mutex
+	files    map[string]*watchedTemplateFile
+	compiled map[string]*compiledTemplate
+	// pending are the reloads waiting for their file to settle
+	pending map[string]*time.Timer
+}
+
+type watchedTemplateFile struct {
+	// source is the last version of the file that parsed successfully, without its front matter
+	source  string
+	page    *Page
+	defines []string
+	refs    []string
+	// err is the error of the last parse, if it failed
+	err error
+	// unsettled is the content of a reload that looked truncated, see LookupTemplateFromWatchedDirectory
+	unsettled *string
+}
+
+type compiledTemplate struct {
+	tmpl  *template.Template
+	files map[string]bool
+	// stale is set when one of files changed, the template is recompiled on the next lookup
+	stale bool
+	// err is the error of the last compilation, if it failed
+	err error
+}
+
+type LookupTemplateFromWatchedDirectoryOption func(*LookupTemplateFromWatchedDirectory)
+
+// WithWatchedPatterns sets the doublestar patterns of the template files, relative to the directory.
+// Per default, all *.html files are loaded.
+func WithWatchedPatterns(patterns ...string) LookupTemplateFromWatchedDirectoryOption {
+	return func(l *LookupTemplateFromWatchedDirectory) {
+		l.patterns = patterns
+	}
+}
+
+// WithWatchedFuncs makes additional functions available to the templates.
+func WithWatchedFuncs(funcs template.FuncMap) LookupTemplateFromWatchedDirectoryOption {
+	return func(l *LookupTemplateFromWatchedDirectory) {
+		if l.funcs == nil {
+			l.funcs = template.FuncMap{}
+		}
+		for k, v := range funcs {
+			l.funcs[k] = v
+		}
+	}
+}
+
+// WithWatchedLayouts renders the HTML and markdown pages into the `_layout.tmpl.html` of their nearest
+// ancestor directory, and hides the templates starting with `_`. See LayoutTemplateName.
+func WithWatchedLayouts(layouts bool) LookupTemplateFromWatchedDirectoryOption {
+	return func(l *LookupTemplateFromWatchedDirectory) {
+		l.layouts = layouts
+	}
+}
+
+// WithWatchSettleDelay sets how long a file has to stay unchanged after a write before it is reloaded.
+// Per default, DefaultWatchSettleDelay is used.
+func WithWatchSettleDelay(delay time.Duration) LookupTemplateFromWatchedDirectoryOption {
+	return func(l *LookupTemplateFromWatchedDirectory) {
+		l.settleDelay = delay
+	}
+}
+
+// NewLookupTemplateFromWatchedDirectory creates a lookup for the templates in directory.
+// The templates are named after their path relative to directory.
+func NewLookupTemplateFromWatchedDirectory(
+	directory string,
+	options ...LookupTemplateFromWatchedDirectoryOption,
+) (*LookupTemplateFromWatchedDirectory, error) {
+	dir, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &LookupTemplateFromWatchedDirectory{
+		directory:   dir,
+		patterns:    []string{"**/*.html"},
+		settleDelay: DefaultWatchSettleDelay,
+		files:       map[string]*watchedTemplateFile{},
+		compiled:    map[string]*compiledTemplate{},
+		pending:     map[string]*time.Timer{},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+
+	err = ret.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Reload rescans the directory and reparses all the templates.
+// Files that fail to parse are reported through TemplateErrors, and don't make Reload fail.
+func (l *LookupTemplateFromWatchedDirectory) Reload(_ ...string) error {
+	info, err := os.Stat(l.directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.Errorf("%s is not a directory", l.directory)
+	}
+
+	names := []string{}
+	err = filepath.WalkDir(l.directory, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name, ok := l.templateName(p)
+		if ok {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// keep the last good version of the files that still exist
+	previous := l.files
+	l.files = map[string]*watchedTemplateFile{}
+	for _, name := range names {
+		if f, ok := previous[name]; ok {
+			l.files[name] = f
+		}
+		l.loadFile(name)
+	}
+	for name, c := range l.compiled {
+		if _, ok := l.files[name]; !ok {
+			delete(l.compiled, name)
+			continue
+		}
+		c.stale = true
+	}
+
+	return nil
+}
+
+// Lookup returns the first of the given templates that exists. Names are either
+// the path of a template file relative to the directory, or the name of a template
+// defined with {{ define }}.
+func (l *LookupTemplateFromWatchedDirectory) Lookup(name ...string) (*template.Template, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, n := range name {
+		if l.layouts && isHiddenTemplate(n) {
+			continue
+		}
+		file, ok := l.resolve(n)
+		if !ok {
+			continue
+		}
+
+		if file == n {
+			if layout, ok := l.layoutOf(n); ok {
+				return l.compileLayout("layout:"+n, layout, n, l.files[n].source)
+			}
+		}
+
+		tmpl, err := l.compile(file)
+		if err != nil {
+			return nil, err
+		}
+		if t := tmpl.Lookup(n); t != nil {
+			return t, nil
+		}
+	}
+
+	return nil, errors.New("template not found")
+}
+
+// LookupMarkdownLayout returns the layout of the markdown page name, if layouts are enabled.
+func (l *LookupTemplateFromWatchedDirectory) LookupMarkdownLayout(name string) (*template.Template, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.layouts {
+		return nil, nil
+	}
+	f, ok := l.files[name]
+	if !ok {
+		return nil, nil
+	}
+	layout, ok := l.pageLayout(name, f)
+	if !ok {
+		return nil, nil
+	}
+	return l.compileLayout("markdown:"+name, layout, name, markdownContentSource)
+}
+
+// LookupPage returns the front matter of the first of the given templates that exists.
+func (l *LookupTemplateFromWatchedDirectory) LookupPage(name ...string) (*Page, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, n := range name {
+		if l.layouts && isHiddenTemplate(n) {
+			continue
+		}
+		if f, ok := l.files[n]; ok && f.page != nil {
+			return f.page, true
+		}
+	}
+	return nil, false
+}
+
+// ListPages returns the pages of the templates of the directory, sorted by name.
+func (l *LookupTemplateFromWatchedDirectory) ListPages() []*Page {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ret := []*Page{}
+	for _, f := range l.files {
+		if f.page != nil {
+			ret = append(ret, f.page)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// TemplateErrors returns the files that currently fail to parse or compile, sorted by file.
+func (l *LookupTemplateFromWatchedDirectory) TemplateErrors() []TemplateError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	errs := map[string]string{}
+	for name, c := range l.compiled {
+		if c.err != nil {
+			errs[name] = c.err.Error()
+		}
+	}
+	// parse errors are more helpful than the compilation errors they might cause
+	for name, f := range l.files {
+		if f.err != nil {
+			errs[name] = f.err.Error()
+		}
+	}
+
+	ret := []TemplateError{}
+	for name, err := range errs {
+		ret = append(ret, TemplateError{File: name, Error: err})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].File < ret[j].File
+	})
+	return ret
+}
+
+// TemplateSource returns the last version of the file that parsed successfully,
+// which is the one the compiled templates are executing.
+func (l *LookupTemplateFromWatchedDirectory) TemplateSource(name string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.files[name]
+	if !ok || f.source == "" {
+		return "", false
+	}
+	return f.source, true
+}
+
+// Watch watches the directory and reloads the changed templates, until ctx is done.
+func (l *LookupTemplateFromWatchedDirectory) Watch(ctx context.Context) error {
+	masks := []string{}
+	for _, pattern := range l.patterns {
+		masks = append(masks, filepath.Join(l.directory, pattern))
+	}
+
+	w := watcher.NewWatcher(
+		watcher.WithPaths(l.directory),
+		watcher.WithMask(masks...),
+		watcher.WithWriteCallback(func(path string) error {
+			name, ok := l.templateName(path)
+			if !ok {
+				return nil
+			}
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.scheduleLoad(name)
+			return nil
+		}),
+		watcher.WithRemoveCallback(func(path string) error {
+			// removed directories don't match the patterns, but the files below them need to be removed
+			name, ok := l.relativeName(path)
+			if !ok {
+				return nil
+			}
+			log.Debug().Str("template", name).Msg("Removing template")
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.removeFile(name)
+			return nil
+		}),
+	)
+
+	err := w.Run(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, t := range l.pending {
+		t.Stop()
+		delete(l.pending, name)
+	}
+
+	return err
+}
+
+// scheduleLoad reloads the file name once it stayed unchanged for the settle delay,
+// postponing the pending reload if there is one. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) scheduleLoad(name string) {
+	if t, ok := l.pending[name]; ok {
+		t.Reset(l.settleDelay)
+		return
+	}
+	l.pending[name] = time.AfterFunc(l.settleDelay, func() {
+		l.settledLoad(name)
+	})
+}
+
+// settledLoad reloads the file name after it settled. A file that looks truncated is
+// only loaded if it still has the same content after another settle delay.
+func (l *LookupTemplateFromWatchedDirectory) settledLoad(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.pending, name)
+
+	b, err := os.ReadFile(filepath.Join(l.directory, filepath.FromSlash(name)))
+	if err != nil {
+		// the file is being replaced or was removed, the next event reloads it
+		log.Debug().Err(err).Str("template", name).Msg("Failed to read template")
+		return
+	}
+
+	f, ok := l.files[name]
+	if ok && l.looksTruncated(name, f, string(b)) {
+		if f.unsettled == nil || *f.unsettled != string(b) {
+			content := string(b)
+			f.unsettled = &content
+			log.Debug().Str("template", name).Msg("Template looks truncated, waiting for it to settle")
+			l.scheduleLoad(name)
+			return
+		}
+	}
+
+	log.Debug().Str("template", name).Msg("Reloading template")
+	l.loadContent(name, string(b))
+}
+
+// looksTruncated returns true if content is empty or defines fewer templates than the
+// last good version of the file f. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) looksTruncated(name string, f *watchedTemplateFile, content string) bool {
+	if f.defines == nil {
+		return false
+	}
+	if strings.TrimSpace(content) == "" {
+		return true
+	}
+	_, source, err := ParseFrontMatter(name, content)
+	if err != nil {
+		return false
+	}
+	defines, _, err := l.parseFile(name, source)
+	if err != nil {
+		// parse errors keep the last good version anyway
+		return false
+	}
+	for _, d := range f.defines {
+		if !slices.Contains(defines, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateName returns the name of the template file at path, and whether it matches the patterns.
+func (l *LookupTemplateFromWatchedDirectory) templateName(path string) (string, bool) {
+	rel, ok := l.relativeName(path)
+	if !ok {
+		return "", false
+	}
+	for _, pattern := range l.patterns {
+		if ok, _ := doublestar.Match(pattern, rel); ok {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// relativeName returns the slash separated path of path relative to the directory,
+// and whether path is inside the directory.
+func (l *LookupTemplateFromWatchedDirectory) relativeName(path string) (string, bool) {
+	rel, err := filepath.Rel(l.directory, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// loadFile (re)parses the file name and marks the compiled templates that include it as stale.
+// If the file fails to parse, its last good version is kept. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) loadFile(name string) {
+	b, err := os.ReadFile(filepath.Join(l.directory, filepath.FromSlash(name)))
+	if err != nil {
+		l.fileFor(name).err = err
+		log.Warn().Err(err).Str("template", name).Msg("Failed to load template, keeping the last good version")
+		return
+	}
+	l.loadContent(name, string(b))
+}
+
+// fileFor returns the file name, adding it if it is not known yet. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) fileFor(name string) *watchedTemplateFile {
+	f, ok := l.files[name]
+	if !ok {
+		f = &watchedTemplateFile{}
+		l.files[name] = f
+	}
+	return f
+}
+
+// loadContent parses content as the new version of the file name, see loadFile. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) loadContent(name string, content string) {
+	f := l.fileFor(name)
+	f.unsettled = nil
+
+	page, source, err := ParseFrontMatter(name, content)
+	if err == nil {
+		var defines, refs []string
+		defines, refs, err = l.parseFile(name, source)
+		if err == nil {
+			// a changed layout in the front matter changes the templates compiled for the file
+			definesChanged := !slices.Equal(f.defines, defines) || f.page == nil || f.page.Layout != page.Layout
+			f.source, f.page, f.defines, f.refs = source, page, defines, refs
+			f.err = nil
+
+			// a file (re)defining templates can change the templates resolved by any other file
+			l.invalidate(name, definesChanged)
+			return
+		}
+	}
+
+	log.Warn().Err(err).Str("template", name).Msg("Failed to load template, keeping the last good version")
+	f.err = err
+}
+
+// removeFile forgets the file name, and marks the compiled templates that include it as stale.
+// Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) removeFile(name string) {
+	// a removed directory removes all the files below it
+	for n, t := range l.pending {
+		if n == name || strings.HasPrefix(n, name+"/") {
+			t.Stop()
+			delete(l.pending, n)
+		}
+	}
+	for n := range l.files {
+		if n == name || strings.HasPrefix(n, name+"/") {
+			delete(l.files, n)
+			delete(l.compiled, n)
+			l.invalidate(n, true)
+		}
+	}
+}
+
+func (l *LookupTemplateFromWatchedDirectory) invalidate(name string, all bool) {
+	for _, c := range l.compiled {
+		if all || c.files[name] {
+			c.stale = true
+		}
+	}
+}
+
+// parseFile parses the source of a single file, returning the names of the templates it defines
+// and of the templates it references.
+func (l *LookupTemplateFromWatchedDirectory) parseFile(name string, source string) ([]string, []string, error) {
+	t, err := templating.CreateHTMLTemplate(name).Funcs(l.funcs).Parse(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defines := []string{}
+	refs := map[string]bool{}
+	for _, t_ := range t.Templates() {
+		defines = append(defines, t_.Name())
+		if t_.Tree != nil {
+			collectTemplateReferences(t_.Tree.Root, refs)
+		}
+	}
+	sort.Strings(defines)
+
+	refs_ := []string{}
+	for ref := range refs {
+		refs_ = append(refs_, ref)
+	}
+	sort.Strings(refs_)
+
+	return defines, refs_, nil
+}
+
+func collectTemplateReferences(node parse.Node, refs map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateReferences(child, refs)
+		}
+	case *parse.TemplateNode:
+		refs[n.Name] = true
+	case *parse.IfNode:
+		collectTemplateReferences(n.List, refs)
+		collectTemplateReferences(n.ElseList, refs)
+	case *parse.RangeNode:
+		collectTemplateReferences(n.List, refs)
+		collectTemplateReferences(n.ElseList, refs)
+	case *parse.WithNode:
+		collectTemplateReferences(n.List, refs)
+		collectTemplateReferences(n.ElseList, refs)
+	}
+}
+
+// resolve returns the file defining the template name. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) resolve(name string) (string, bool) {
+	if f, ok := l.files[name]; ok && f.defines != nil {
+		return name, true
+	}
+
+	// several files may define the same template, the first one in lexical order is used
+	// (the requested file itself still takes precedence when compiling, see compileFiles)
+	files := make([]string, 0, len(l.files))
+	for file := range l.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		for _, d := range l.files[file].defines {
+			if d == name {
+				return file, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// compile returns the compiled template of the file name, recompiling it if it is stale.
+// If the compilation fails, the last good compiled template is returned if there is one.
+// Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) compile(name string) (*template.Template, error) {
+	return l.cached(name, func() (*template.Template, map[string]bool, error) {
+		files := l.dependencies(name)
+		tmpl, err := l.compileFiles(name, files)
+		return tmpl, files, err
+	})
+}
+
+// compileLayout returns the page rendered into its layout, compiled with the partials, and cached under key.
+// Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) compileLayout(
+	key string,
+	layout string,
+	page string,
+	pageSource string,
+) (*template.Template, error) {
+	return l.cached(key, func() (*template.Template, map[string]bool, error) {
+		if !l.exists(layout) {
+			return nil, map[string]bool{page: true}, errors.Errorf("layout %s of %s not found", layout, page)
+		}
+		start := []string{layout, page}
+		for file := range l.files {
+			if isPartial(file) {
+				start = append(start, file)
+			}
+		}
+		files := l.dependencies(start...)
+
+		tmpl := templating.CreateHTMLTemplate("").Funcs(l.funcs)
+		err := l.parseFiles(tmpl, files, layout, page)
+		if err != nil {
+			return nil, files, err
+		}
+		t, err := addLayout(tmpl, layout, l.files[layout].source, page, pageSource)
+		if err != nil {
+			return nil, files, errors.Wrapf(err, "failed to render %s into layout %s", page, layout)
+		}
+		return t, files, nil
+	})
+}
+
+// cached returns the template cached under key, compiling it if it is missing or stale.
+// If the compilation fails, the last good compiled template is returned if there is one.
+// Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) cached(
+	key string,
+	compile func() (*template.Template, map[string]bool, error),
+) (*template.Template, error) {
+	c, ok := l.compiled[key]
+	if ok && !c.stale {
+		if c.tmpl == nil {
+			return nil, c.err
+		}
+		return c.tmpl, nil
+	}
+
+	tmpl, files, err := compile()
+	if !ok {
+		c = &compiledTemplate{}
+		l.compiled[key] = c
+	}
+	c.stale = false
+	c.err = err
+	if err != nil {
+		// the files are kept, so that fixing any of them triggers a recompilation
+		if c.files == nil {
+			c.files = files
+		}
+		log.Warn().Err(err).Str("template", key).Msg("Failed to compile template, keeping the last good version")
+		if c.tmpl == nil {
+			return nil, err
+		}
+		return c.tmpl, nil
+	}
+	c.tmpl = tmpl
+	c.files = files
+
+	return tmpl, nil
+}
+
+// dependencies returns the given files and the files defining the templates they reference, transitively.
+// Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) dependencies(names ...string) map[string]bool {
+	files := map[string]bool{}
+	queue := []string{}
+	for _, name := range names {
+		if !files[name] {
+			files[name] = true
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		f := l.files[queue[0]]
+		queue = queue[1:]
+		for _, ref := range f.refs {
+			file, ok := l.resolve(ref)
+			if ok && !files[file] {
+				files[file] = true
+				queue = append(queue, file)
+			}
+		}
+	}
+	return files
+}
+
+// layoutOf returns the layout of the HTML page name, if layouts are enabled. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) layoutOf(name string) (string, bool) {
+	f, ok := l.files[name]
+	if !l.layouts || !ok || !usesLayout(name, f.source) {
+		return "", false
+	}
+	return l.pageLayout(name, f)
+}
+
+// pageLayout returns the layout set in the front matter of the file, or the nearest layout.
+// Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) pageLayout(name string, f *watchedTemplateFile) (string, bool) {
+	if f.page != nil && f.page.Layout != "" {
+		return f.page.Layout, true
+	}
+	return findLayout(name, l.exists)
+}
+
+// exists returns true if the file name parsed successfully at least once. Must be called with mu held.
+func (l *LookupTemplateFromWatchedDirectory) exists(name string) bool {
+	f, ok := l.files[name]
+	return ok && f.defines != nil
+}
+
+// parseFiles parses the files into tmpl in lexical order, skipping the excluded ones.
+func (l *LookupTemplateFromWatchedDirectory) parseFiles(tmpl *template.Template, files map[string]bool, exclude ...string) error {
+	names := []string{}
+	for file := range files {
+		if !slices.Contains(exclude, file) {
+			names = append(names, file)
+		}
+	}
+	sort.Strings(names)
+
+	for _, file := range names {
+		_, err := tmpl.New(file).Parse(l.files[file].source)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse template %s", file)
+		}
+	}
+	return nil
+}
+
+func (l *LookupTemplateFromWatchedDirectory) compileFiles(name string, files map[string]bool) (*template.Template, error) {
+	tmpl := templating.CreateHTMLTemplate(name).Funcs(l.funcs)
+
+	err := l.parseFiles(tmpl, files, name)
+	if err != nil {
+		return nil, err
+	}
+	// the requested file is parsed last, so that its definitions take precedence
+	_, err = tmpl.Parse(l.files[name].source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse template %s", name)
+	}
+
+	return tmpl, nil
+}
+
+// NewTemplateErrorsHandler returns a handler listing the template errors of reporters as JSON.
+// It is meant to be served in dev mode, see DevTemplateErrorsPath.
+func NewTemplateErrorsHandler(reporters ...TemplateErrorReporter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		errs := []TemplateError{}
+		for _, r := range reporters {
+			errs = append(errs, r.TemplateErrors()...)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"errors": errs,
+		})
+	}
+}
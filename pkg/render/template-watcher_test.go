@@ -0,0 +1,177 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplateFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func executeLookup(l TemplateLookup, name string) (string, error) {
+	tmpl, err := l.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, nil)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func TestLookupTemplateFromWatchedDirectory_Lookup(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{
+		"partials/header.html":  `{{ define "header" }}<h1>{{ template "title" }}</h1>{{ end }}`,
+		"partials/title.html":   `{{ define "title" }}Parka{{ end }}`,
+		"page.html":             `{{ template "header" }}page`,
+		"section/override.html": `{{ define "title" }}Override{{ end }}{{ template "header" }}`,
+		"notes.txt":             `not a template`,
+	})
+
+	l, err := NewLookupTemplateFromWatchedDirectory(dir)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		expected      string
+		expectedError bool
+	}{
+		{name: "page.html", expected: "<h1>Parka</h1>page"},
+		{name: "header", expected: "<h1>Parka</h1>"},
+		{name: "section/override.html", expected: "<h1>Override</h1>"},
+		{name: "notes.txt", expectedError: true},
+		{name: "missing.html", expectedError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := executeLookup(l, tt.name)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, s)
+		})
+	}
+}
+
+func TestLookupTemplateFromWatchedDirectory_Watch(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{
+		"header.html": `{{ define "header" }}v1{{ end }}`,
+		"page.html":   `{{ template "header" }}-page`,
+		"other.html":  `other`,
+	})
+
+	// the files are rewritten more often than the default settle delay below
+	l, err := NewLookupTemplateFromWatchedDirectory(dir, WithWatchSettleDelay(10*time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = l.Watch(ctx)
+	}()
+
+	s, err := executeLookup(l, "page.html")
+	require.NoError(t, err)
+	assert.Equal(t, "v1-page", s)
+	_, err = executeLookup(l, "other.html")
+	require.NoError(t, err)
+
+	// the files are rewritten until the change is picked up, because the watcher starts asynchronously
+	require.Eventually(t, func() bool {
+		writeTemplateFiles(t, dir, map[string]string{"header.html": `{{ define "header" }}v2{{ end }}`})
+		s, err := executeLookup(l, "page.html")
+		return err == nil && s == "v2-page"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// only the templates depending on the changed file are recompiled
+	l.mu.Lock()
+	assert.False(t, l.compiled["other.html"].stale)
+	l.mu.Unlock()
+
+	// a broken file keeps serving the last good version, and is reported
+	require.Eventually(t, func() bool {
+		writeTemplateFiles(t, dir, map[string]string{"header.html": `{{ define "header" }}{{ if }}{{ end }}`})
+		return len(l.TemplateErrors()) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	s, err = executeLookup(l, "page.html")
+	require.NoError(t, err)
+	assert.Equal(t, "v2-page", s)
+	errs := l.TemplateErrors()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "header.html", errs[0].File)
+
+	// fixing the file clears the error
+	require.Eventually(t, func() bool {
+		writeTemplateFiles(t, dir, map[string]string{"header.html": `{{ define "header" }}v3{{ end }}`})
+		s, err := executeLookup(l, "page.html")
+		return err == nil && s == "v3-page"
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Empty(t, l.TemplateErrors())
+
+	// new files are picked up
+	require.Eventually(t, func() bool {
+		writeTemplateFiles(t, dir, map[string]string{"sub/new.html": `new`})
+		s, err := executeLookup(l, "sub/new.html")
+		return err == nil && s == "new"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestLookupTemplateFromWatchedDirectory_Truncated(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expected      string
+		expectedError bool
+	}{
+		{name: "empty", content: "", expectedError: true},
+		{name: "fewer defines", content: `{{ define "header" }}v2{{ end }}`, expected: "v2-page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplateFiles(t, dir, map[string]string{
+				"header.html": `{{ define "header" }}v1{{ end }}{{ define "footer" }}footer{{ end }}`,
+				"page.html":   `{{ template "header" }}-page`,
+			})
+
+			// the retries are triggered by hand
+			l, err := NewLookupTemplateFromWatchedDirectory(dir, WithWatchSettleDelay(time.Hour))
+			require.NoError(t, err)
+
+			// a truncated read keeps the last good version
+			writeTemplateFiles(t, dir, map[string]string{"header.html": tt.content})
+			l.settledLoad("header.html")
+			s, err := executeLookup(l, "page.html")
+			require.NoError(t, err)
+			assert.Equal(t, "v1-page", s)
+
+			// the file still has the same content after it settled, so it is accepted
+			l.settledLoad("header.html")
+			s, err = executeLookup(l, "page.html")
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, s)
+		})
+	}
+}
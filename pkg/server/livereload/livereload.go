@@ -0,0 +1,251 @@
+// Package livereload reloads the pages open in the browser when the files they are
+// rendered from change, for use in dev mode.
+//
+// A LiveReload watches a set of files and directories (templates, static files, markdown
+// pages, command repositories), and notifies the browsers connected to its server-sent events
+// endpoint when one of them changes. Pages include Script to connect to the endpoint and
+// reload themselves.
+//
+// The endpoint is served with Register, usually on the Group of the server, so that the
+// scripts connect to it below the root path of the server.
+package livereload
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/watcher"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// Path is the path of the server-sent events endpoint, relative to the group it is registered on.
+const Path = "/_parka/livereload"
+
+// RouteName is the name of the endpoint route registered by Register, which URL looks up.
+const RouteName = "parka-livereload"
+
+const scriptTemplate = `<script>
+(function () {
+  if (!window.EventSource) { return; }
+  var connected = false;
+  var source = new EventSource("%s");
+  source.addEventListener("open", function () {
+    if (connected) { window.location.reload(); }
+    connected = true;
+  });
+  source.addEventListener("reload", function () { window.location.reload(); });
+})();
+</script>
+`
+
+// URL returns the URL of the live reload endpoint registered with Register, including the prefix of
+// the group it is registered on. Path is returned if the endpoint isn't registered.
+func URL(c echo.Context) string {
+	if u := c.Echo().Reverse(RouteName); u != "" {
+		return u
+	}
+	return Path
+}
+
+// Script returns the script connecting to the live reload endpoint and reloading the page when a file changes.
+// It also reloads the page when it reconnects after losing the connection, which happens
+// when the server is restarted.
+func Script(c echo.Context) string {
+	return fmt.Sprintf(scriptTemplate, template.JSEscapeString(URL(c)))
+}
+
+// DefaultDebounce is how long a LiveReload waits for more changes before notifying the browsers,
+// so that saving several files, or editors writing a file in several steps, reload the page once.
+const DefaultDebounce = 100 * time.Millisecond
+
+type LiveReload struct {
+	debounce time.Duration
+
+	mu      sync.Mutex
+	paths   []string
+	clients map[chan string]struct{}
+	timer   *time.Timer
+	changed string
+}
+
+type Option func(*LiveReload)
+
+// WithPaths adds files and directories to watch, directories being watched recursively.
+func WithPaths(paths ...string) Option {
+	return func(lr *LiveReload) {
+		lr.paths = append(lr.paths, paths...)
+	}
+}
+
+// WithDebounce sets how long to wait for more changes before notifying the browsers.
+func WithDebounce(debounce time.Duration) Option {
+	return func(lr *LiveReload) {
+		lr.debounce = debounce
+	}
+}
+
+func NewLiveReload(options ...Option) *LiveReload {
+	ret := &LiveReload{
+		debounce: DefaultDebounce,
+		clients:  map[chan string]struct{}{},
+	}
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+// AddPaths adds files and directories to watch. Paths that are already watched are skipped.
+// It has to be called before Watch.
+func (lr *LiveReload) AddPaths(paths ...string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		found := false
+		for _, p_ := range lr.paths {
+			if p_ == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			lr.paths = append(lr.paths, p)
+		}
+	}
+}
+
+// Paths returns the watched files and directories.
+func (lr *LiveReload) Paths() []string {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return append([]string{}, lr.paths...)
+}
+
+// Notify tells the connected browsers to reload, once no other change
+// has been notified for the debounce duration.
+func (lr *LiveReload) Notify(path string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.changed = path
+	if lr.timer != nil {
+		lr.timer.Stop()
+	}
+	lr.timer = time.AfterFunc(lr.debounce, lr.broadcast)
+}
+
+func (lr *LiveReload) broadcast() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	log.Debug().Str("path", lr.changed).Int("clients", len(lr.clients)).Msg("Reloading browsers")
+	for c := range lr.clients {
+		// clients that are still busy with a previous reload don't need another one
+		select {
+		case c <- lr.changed:
+		default:
+		}
+	}
+}
+
+func (lr *LiveReload) subscribe() chan string {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	c := make(chan string, 1)
+	lr.clients[c] = struct{}{}
+	return c
+}
+
+func (lr *LiveReload) unsubscribe(c chan string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	delete(lr.clients, c)
+}
+
+// Register serves the live reload endpoint at Path on g.
+func (lr *LiveReload) Register(g *echo.Group) {
+	g.GET(Path, lr.Handler()).Name = RouteName
+}
+
+// Handler serves the server-sent events endpoint, sending a `reload` event
+// with the changed path when a watched file changes.
+func (lr *LiveReload) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		events := lr.subscribe()
+		defer lr.unsubscribe(events)
+
+		w := c.Response()
+		rc := http.NewResponseController(w)
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		// reconnect quickly when the server restarts
+		_, err := fmt.Fprint(w, "retry: 1000\n\n")
+		if err != nil {
+			return nil
+		}
+		if err = rc.Flush(); err != nil {
+			return nil
+		}
+
+		ctx := c.Request().Context()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case path := <-events:
+				_, err = fmt.Fprintf(w, "event: reload\ndata: %s\n\n", path)
+				if err == nil {
+					err = rc.Flush()
+				}
+				if err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// Watch watches the paths and notifies the browsers of the changes, until ctx is done.
+func (lr *LiveReload) Watch(ctx context.Context) error {
+	paths := []string{}
+	for _, p := range lr.Paths() {
+		if _, err := os.Stat(p); err != nil {
+			log.Warn().Err(err).Str("path", p).Msg("Not watching path for live reload")
+			continue
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	notify := func(path string) error {
+		lr.Notify(path)
+		return nil
+	}
+	w := watcher.NewWatcher(
+		watcher.WithPaths(paths...),
+		watcher.WithWriteCallback(notify),
+		watcher.WithRemoveCallback(notify),
+	)
+
+	return w.Run(ctx)
+}
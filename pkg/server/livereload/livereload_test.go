@@ -0,0 +1,140 @@
+package livereload
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connect connects to the live reload endpoint, and returns a channel with the received events.
+func connect(t *testing.T, lr *LiveReload) <-chan string {
+	e := echo.New()
+	e.GET(Path, lr.Handler())
+	s := httptest.NewServer(e)
+	t.Cleanup(s.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+Path, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "retry: 1000\n", line)
+
+	events := make(chan string, 10)
+	go func() {
+		event := ""
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "\n" {
+				if event != "" {
+					events <- event
+				}
+				event = ""
+				continue
+			}
+			event += line
+		}
+	}()
+	return events
+}
+
+func TestLiveReloadNotify(t *testing.T) {
+	lr := NewLiveReload(WithDebounce(10 * time.Millisecond))
+	events := connect(t, lr)
+
+	// changes in quick succession reload the page once
+	lr.Notify("templates/index.tmpl.html")
+	lr.Notify("static/app.css")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "event: reload\ndata: static/app.css\n", event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event")
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %q", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLiveReloadWatch(t *testing.T) {
+	dir := t.TempDir()
+	lr := NewLiveReload(WithDebounce(10*time.Millisecond), WithPaths(dir))
+	lr.AddPaths(dir, filepath.Join(dir, "missing"))
+	assert.Len(t, lr.Paths(), 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = lr.Watch(ctx)
+	}()
+
+	events := connect(t, lr)
+
+	// the file is rewritten until the change is picked up, because the watcher starts asynchronously
+	deadline := time.After(5 * time.Second)
+	for {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "index.md"), []byte("# Index"), 0644))
+		select {
+		case event := <-events:
+			assert.True(t, strings.HasSuffix(event, "index.md\n"), event)
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no reload event")
+		}
+	}
+}
+
+func TestScriptURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		register bool
+		expected string
+	}{
+		{name: "root", prefix: "", register: true, expected: "/_parka/livereload"},
+		{name: "root path", prefix: "/parka", register: true, expected: "/parka/_parka/livereload"},
+		{name: "not registered", prefix: "/parka", register: false, expected: Path},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			g := e.Group(tt.prefix)
+			if tt.register {
+				NewLiveReload().Register(g)
+			}
+			g.GET("/page", func(c echo.Context) error {
+				return c.HTML(http.StatusOK, Script(c))
+			})
+
+			resp := httptest.NewRecorder()
+			e.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tt.prefix+"/page", nil))
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Contains(t, resp.Body.String(), `new EventSource("`+tt.expected+`")`)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/go-go-golems/parka/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// RewriteRule internally rewrites the path of requests matching From to To, before
+// the request is routed. The client does not see the rewritten URL.
+//
+// From uses the route pattern syntax (`:name` for a path segment, a trailing `*` for the remainder),
+// To can reference the captured parameters as `{name}` and `{*}`.
+type RewriteRule struct {
+	From *utils.PathPattern
+	To   string
+}
+
+func NewRewriteRule(from string, to string) (*RewriteRule, error) {
+	pattern, err := utils.NewPathPattern(from)
+	if err != nil {
+		return nil, err
+	}
+	return &RewriteRule{
+		From: pattern,
+		To:   to,
+	}, nil
+}
+
+// Rewrite returns the rewritten URL if the path matches the rule.
+func (r *RewriteRule) Rewrite(u *url.URL) (*url.URL, bool) {
+	params, ok := r.From.Match(u.Path)
+	if !ok {
+		return nil, false
+	}
+
+	target, err := url.Parse(utils.ExpandPathTemplate(r.To, params))
+	if err != nil {
+		log.Warn().Err(err).Str("from", r.From.Pattern).Str("to", r.To).Msg("invalid rewrite target")
+		return nil, false
+	}
+
+	ret := *u
+	ret.Path = target.Path
+	ret.RawPath = ""
+	if target.RawQuery != "" {
+		ret.RawQuery = utils.MergeTargetQuery(target.Query(), u.Query()).Encode()
+	}
+
+	return &ret, true
+}
+
+// WithRewriteRules adds rewrite rules to the server. The rules are evaluated in order
+// before route matching, and the first matching rule wins.
+func WithRewriteRules(rules ...*RewriteRule) ServerOption {
+	return func(s *Server) error {
+		s.AddRewriteRules(rules...)
+		return nil
+	}
+}
+
+// AddRewriteRules adds rewrite rules to the server. Both the patterns and the targets of the rules
+// are relative to the RootPath of the server.
+func (s *Server) AddRewriteRules(rules ...*RewriteRule) {
+	s.rewriteRules = append(s.rewriteRules, rules...)
+}
+
+// rewriteMiddleware is registered as a Pre middleware, which means it runs before the router.
+func (s *Server) rewriteMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		u := *req.URL
+		if s.RootPath != "" {
+			switch {
+			case u.Path == s.RootPath:
+				u.Path = "/"
+			case strings.HasPrefix(u.Path, s.RootPath+"/"):
+				u.Path = strings.TrimPrefix(u.Path, s.RootPath)
+			default:
+				return next(c)
+			}
+		}
+
+		for _, rule := range s.rewriteRules {
+			rewritten, ok := rule.Rewrite(&u)
+			if !ok {
+				continue
+			}
+
+			log.Debug().
+				Str("from", req.URL.String()).
+				Str("to", rewritten.String()).
+				Msg("rewriting request")
+			rewritten.Path = s.RootPath + rewritten.Path
+			req.URL = rewritten
+			req.RequestURI = rewritten.RequestURI()
+			break
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rootPath string
+		from     string
+		to       string
+		request  string
+		expected string
+	}{
+		{"wildcard", "", "/reports/*", "/analytics/{*}", "/reports/sales/q1?year=2024", "/analytics/sales/q1?year=2024"},
+		{"wildcard root", "", "/reports/*", "/analytics/{*}", "/reports", "/analytics/"},
+		{"named segment", "", "/customers/:id", "/crm/{id}/overview", "/customers/42", "/crm/42/overview"},
+		{"target query", "", "/old", "/new?source=old", "/old?x=1", "/new?source=old&x=1"},
+		{"target query takes precedence", "", "/old", "/new?source=old", "/old?source=x&y=1", "/new?source=old&y=1"},
+		{"exact", "", "/old", "/new", "/old", "/new"},
+		{"exact does not match below", "", "/old", "/new", "/old/sub", "/old/sub"},
+		{"no match", "", "/reports/*", "/analytics/{*}", "/other/foo", "/other/foo"},
+		{"root path", "/app", "/reports/*", "/analytics/{*}", "/app/reports/foo", "/app/analytics/foo"},
+		{"root path itself", "/app", "/", "/home", "/app", "/app/home"},
+		{"root path only matches whole segments", "/app", "/lication/*", "/other/{*}", "/application/x", "/application/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := NewRewriteRule(tt.from, tt.to)
+			require.NoError(t, err)
+
+			s, err := NewServer(WithRootPath(tt.rootPath), WithRewriteRules(rule))
+			require.NoError(t, err)
+			s.router.GET("/*", func(c echo.Context) error {
+				return c.String(http.StatusOK, c.Request().URL.RequestURI())
+			})
+
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + tt.request)
+			require.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(body))
+		})
+	}
+}
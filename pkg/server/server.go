@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/fs"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-go-golems/parka/pkg/render"
@@ -41,6 +42,10 @@ type Server struct {
 	Port    uint16
 	Address string
 
+	rewriteRules []*RewriteRule
+
+	mountOnce sync.Once
+
 	// TODO(manuel, 2024-05-13) Probably add some logging config, some dev mode flag
 }
 
@@ -186,10 +191,13 @@ func NewServer(options ...ServerOption) (*Server, error) {
 	router.Logger = lecho.From(log.Logger)
 
 	router.Use(middleware.Recover())
+	// the request ID is used to correlate the logs with the error pages, see render.HandleRenderError
+	router.Use(middleware.RequestID())
 	// Custom middleware logger using zerolog
 	router.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
-		LogURI:    true,
-		LogStatus: true,
+		LogURI:       true,
+		LogStatus:    true,
+		LogRequestID: true,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
 			log.Info().
 				Str("URI", v.URI).
@@ -198,6 +206,7 @@ func NewServer(options ...ServerOption) (*Server, error) {
 				Str("path", v.URIPath).
 				Str("host", v.Host).
 				Str("remote_ip", v.RemoteIP).
+				Str("request_id", v.RequestID).
 				Dur("latency", time.Since(v.StartTime)).
 				Msg("request")
 
@@ -212,6 +221,9 @@ func NewServer(options ...ServerOption) (*Server, error) {
 		StaticPaths: []utils_fs.StaticPath{},
 	}
 
+	// rewrites need to happen before the router matches the request
+	router.Pre(s.rewriteMiddleware)
+
 	for _, option := range options {
 		err := option(s)
 		if err != nil {
@@ -222,6 +234,14 @@ func NewServer(options ...ServerOption) (*Server, error) {
 	// Mount all handlers and static paths under the configured root prefix
 	s.Group = s.router.Group(s.RootPath)
 
+	// the static files linked from the rendered markdown pages are served under the root prefix as well
+	if s.DefaultRenderer != nil && s.RootPath != "" {
+		err := s.DefaultRenderer.Configure(render.WithMarkdownOptions(render.WithMarkdownAssetPrefix(s.RootPath)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return s, nil
 }
 
@@ -229,18 +249,33 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
 
+// mountDefaultRoutes registers the static paths and the default renderer, which match the
+// requests that no other route matched. They are only registered once.
+func (s *Server) mountDefaultRoutes() {
+	s.mountOnce.Do(func() {
+		for _, path := range s.StaticPaths {
+			s.Group.StaticFS(path.UrlPath, path.FS)
+		}
+
+		// match all remaining paths to the templates
+		if s.DefaultRenderer != nil {
+			// TODO(manuel, 2024-05-08) I don't think we even need the explicit index mapping
+			//s.Group.GET("/", s.DefaultRenderer.WithTemplateHandler("index", nil))
+			s.Group.GET("/*", s.DefaultRenderer.WithTemplateDirHandler(nil))
+		}
+	})
+}
+
+// Handler returns the handler serving all the routes of the server, as Run does, without listening.
+// This is used to render the pages of the server in-process, for example to export them.
+func (s *Server) Handler() http.Handler {
+	s.mountDefaultRoutes()
+	return s.router
+}
+
 // Run will start the server and listen on the given address and port.
 func (s *Server) Run(ctx context.Context) error {
-	for _, path := range s.StaticPaths {
-		s.Group.StaticFS(path.UrlPath, path.FS)
-	}
-
-	// match all remaining paths to the templates
-	if s.DefaultRenderer != nil {
-		// TODO(manuel, 2024-05-08) I don't think we even need the explicit index mapping
-		//s.Group.GET("/", s.DefaultRenderer.WithTemplateHandler("index", nil))
-		s.Group.GET("/*", s.DefaultRenderer.WithTemplateDirHandler(nil))
-	}
+	s.mountDefaultRoutes()
 
 	addr := fmt.Sprintf("%s:%d", s.Address, s.Port)
 
@@ -52,3 +52,9 @@ func TestRunGlazedCommand(t *testing.T) {
 		assert.Equal(t, "test3-0", v_["test3"])
 	})
 }
+
+func TestDefaultRendererRootPath(t *testing.T) {
+	s, err := NewServer(WithDefaultParkaRenderer(), WithRootPath("/app"))
+	require.NoError(t, err)
+	assert.Contains(t, s.DefaultRenderer.Markdown.MermaidScript(), `src="/app/dist/mermaid.js"`)
+}
@@ -41,14 +41,152 @@ function createCheckbox(labelText, id, checked) {
     return [ rowDiv, checkbox];
 }
 
-function setupDataTables(columnDefs, data) {
+// The following functions apply the column presentation rules exported by parka (see columns.Column)
+// to ag-grid columns, mirroring the formatting done on the server for HTML rows.
+
+const MONTHS = ['January', 'February', 'March', 'April', 'May', 'June',
+    'July', 'August', 'September', 'October', 'November', 'December'];
+const WEEKDAYS = ['Sunday', 'Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday'];
+
+function toNumber(value) {
+    if (typeof value === 'number') {
+        return value;
+    }
+    if (typeof value === 'string' && value.trim() !== '' && !isNaN(Number(value))) {
+        return Number(value);
+    }
+    return null;
+}
+
+function toDate(value) {
+    if (typeof value !== 'string') {
+        return null;
+    }
+    // dates without time zone are UTC, like on the server
+    let s = value;
+    if (/^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}(:\d{2}(\.\d+)?)?$/.test(s)) {
+        s = s.replace(' ', 'T') + 'Z';
+    }
+    const t = Date.parse(s);
+    return isNaN(t) ? null : new Date(t);
+}
+
+// formatGoLayout formats date with a subset of the Go time layout tokens, in the given time zone
+function formatGoLayout(date, layout, timeZone) {
+    const parts = {};
+    new Intl.DateTimeFormat('en-US', {
+        timeZone: timeZone || 'UTC', hourCycle: 'h23',
+        year: 'numeric', month: 'numeric', day: 'numeric', hour: 'numeric', minute: 'numeric', second: 'numeric',
+    }).formatToParts(date).forEach((p) => parts[p.type] = Number(p.value));
+    const weekday = new Date(Date.UTC(parts.year, parts.month - 1, parts.day)).getUTCDay();
+    const pad = (n) => String(n).padStart(2, '0');
+    const hour12 = parts.hour % 12 === 0 ? 12 : parts.hour % 12;
+    const tokens = {
+        '2006': String(parts.year), 'January': MONTHS[parts.month - 1], 'Jan': MONTHS[parts.month - 1].slice(0, 3),
+        'Monday': WEEKDAYS[weekday], 'Mon': WEEKDAYS[weekday].slice(0, 3),
+        '01': pad(parts.month), '02': pad(parts.day), '15': pad(parts.hour), '03': pad(hour12),
+        '04': pad(parts.minute), '05': pad(parts.second), 'PM': parts.hour < 12 ? 'AM' : 'PM',
+    };
+    return layout.replace(/2006|January|Jan|Monday|Mon|01|02|15|03|04|05|PM/g, (token) => tokens[token]);
+}
+
+function formatCellValue(format, value) {
+    if (!format || value === null || value === undefined) {
+        return value === null || value === undefined ? '' : String(value);
+    }
+    if (format.type === 'number' || format.type === 'percent') {
+        let v = toNumber(value);
+        if (v === null) {
+            return String(value);
+        }
+        const options = {};
+        if (format.decimals !== undefined) {
+            options.minimumFractionDigits = format.decimals;
+            options.maximumFractionDigits = format.decimals;
+        }
+        if (format.type === 'percent') {
+            v *= 100;
+        }
+        const s = new Intl.NumberFormat(format.locale || 'en-US', options).format(v);
+        return (format.prefix || '') + s + (format.type === 'percent' ? '%' : '') + (format.suffix || '');
+    }
+    if (format.type === 'date') {
+        const d = toDate(value);
+        if (d === null) {
+            return String(value);
+        }
+        return (format.prefix || '') + formatGoLayout(d, format.layout || '2006-01-02 15:04', format.timeZone)
+            + (format.suffix || '');
+    }
+    return String(value);
+}
+
+function classRuleMatches(rule, value) {
+    if (rule.equals !== undefined && String(rule.equals) !== String(value)) {
+        return false;
+    }
+    const hasBounds = ['gt', 'gte', 'lt', 'lte'].some((k) => rule[k] !== undefined);
+    if (!hasBounds) {
+        return rule.equals !== undefined;
+    }
+    const v = toNumber(value);
+    return v !== null &&
+        (rule.gt === undefined || v > rule.gt) &&
+        (rule.gte === undefined || v >= rule.gte) &&
+        (rule.lt === undefined || v < rule.lt) &&
+        (rule.lte === undefined || v <= rule.lte);
+}
+
+function linkHref(link, data) {
+    const query = new URLSearchParams();
+    Object.keys(link.parameters || {}).sort().forEach((name) => {
+        const v = data[link.parameters[name]];
+        if (v !== null && v !== undefined) {
+            query.set(name, String(v));
+        }
+    });
+    const url = link.url || link.command;
+    const q = query.toString();
+    return q ? url + '?' + q : url;
+}
+
+// columnDef returns the ag-grid column definition of col, applying its presentation rules
+function columnDef(col, columnFormats) {
+    const def = {
+        headerName: col,
+        field: col,
+    };
+    const rules = (columnFormats || {})[col];
+    if (!rules) {
+        return def;
+    }
+    if (rules.format) {
+        def.valueFormatter = (params) => formatCellValue(rules.format, params.value);
+    }
+    if (rules.classes) {
+        def.cellClass = (params) => rules.classes
+            .filter((rule) => classRuleMatches(rule, params.value))
+            .map((rule) => rule.class);
+    }
+    if (rules.link) {
+        def.cellRenderer = (params) => {
+            if (!params.data || params.value === null || params.value === undefined) {
+                return params.valueFormatted !== undefined && params.valueFormatted !== null
+                    ? params.valueFormatted : '';
+            }
+            const a = document.createElement('a');
+            a.href = linkHref(rules.link, params.data);
+            a.textContent = params.valueFormatted !== undefined && params.valueFormatted !== null
+                ? params.valueFormatted : String(params.value);
+            return a;
+        };
+    }
+    return def;
+}
+
+function setupDataTables(columnDefs, data, columnFormats) {
     const gridOptions = {
-        columnDefs: columnDefs.map((col) => {
-            return {
-                headerName: col,
-                field: col,
-            };
-        }),
+        columnDefs: columnDefs.map((col) => columnDef(col, columnFormats)),
         rowData: data,
         defaultColDef: {
             editable: false,
@@ -74,4 +212,94 @@ function setupDataTables(columnDefs, data) {
         gridOptions.paginationPageSize = paginationCheckbox.checked ? 200 : undefined;
     });
     additionalWidgetsDiv.appendChild(rowDiv);
-}
\ No newline at end of file
+}
+
+// fetchRows loads the rows from start to end from the paging endpoint at pageURL.
+function fetchRows(pageURL, start, end, sortModel, filterModel) {
+    const url = new URL(pageURL, window.location.href);
+    url.searchParams.set('_start', start);
+    url.searchParams.set('_end', end);
+    if (sortModel && sortModel.length > 0) {
+        url.searchParams.set('_sort', JSON.stringify(sortModel));
+    }
+    if (filterModel && Object.keys(filterModel).length > 0) {
+        url.searchParams.set('_filter', JSON.stringify(filterModel));
+    }
+    return fetch(url).then((response) => {
+        if (!response.ok) {
+            return response.json()
+                .catch(() => ({}))
+                .then((body) => {
+                    throw new Error(body.message || response.statusText);
+                });
+        }
+        return response.json();
+    });
+}
+
+// setupVirtualizedDataTables renders the rows with the infinite row model of ag-grid, which only keeps
+// a bounded number of row blocks in memory and loads them from pageURL as the user scrolls.
+// Sorting and filtering are done by the server.
+//
+// The page doesn't contain any rows, the first block is loaded to get the columns of the result.
+// It is reused as long as the grid is neither sorted nor filtered. The command is run once by the paging
+// endpoint, which caches its result for the following blocks.
+function setupVirtualizedDataTables(pageURL, pageSize, columnFormats) {
+    const gridDiv = document.querySelector('#tableContainer');
+    fetchRows(pageURL, 0, pageSize)
+        .then((firstPage) => {
+            if (firstPage.lastRow === 0) {
+                return;
+            }
+            createVirtualizedGrid(gridDiv, firstPage, pageURL, pageSize, columnFormats);
+        })
+        .catch((err) => {
+            const error = document.createElement('div');
+            error.className = 'alert alert-danger results-errors';
+            const title = document.createElement('strong');
+            title.textContent = 'Error: ';
+            error.appendChild(title);
+            error.appendChild(document.createTextNode(err.message));
+            gridDiv.parentNode.insertBefore(error, gridDiv);
+        });
+}
+
+function createVirtualizedGrid(gridDiv, firstPage, pageURL, pageSize, columnFormats) {
+    const columnDefs = firstPage.columns || [];
+    const firstRows = firstPage.rows || [];
+    const isNumber = (col) => firstRows.length > 0 && typeof firstRows[0][col] === 'number';
+    const gridOptions = {
+        columnDefs: columnDefs.map((col) => {
+            return Object.assign(columnDef(col, columnFormats), {
+                filter: isNumber(col) ? 'agNumberColumnFilter' : 'agTextColumnFilter',
+            });
+        }),
+        defaultColDef: {
+            editable: false,
+            sortable: true,
+            resizable: true,
+        },
+        rowModelType: 'infinite',
+        cacheBlockSize: pageSize,
+        maxBlocksInCache: 10,
+        datasource: {
+            getRows: (params) => {
+                const sorted = params.sortModel.length > 0;
+                const filtered = Object.keys(params.filterModel).length > 0;
+                if (params.startRow === 0 && !sorted && !filtered) {
+                    params.successCallback(firstRows.slice(0, params.endRow), firstPage.lastRow);
+                    return;
+                }
+
+                fetchRows(pageURL, params.startRow, params.endRow, params.sortModel, params.filterModel)
+                    .then((page) => params.successCallback(page.rows, page.lastRow))
+                    .catch(() => params.failCallback());
+            },
+        },
+        onGridReady: (params) => {
+            params.columnApi.autoSizeAllColumns(false);
+        }
+    };
+
+    new agGrid.Grid(gridDiv, gridOptions);
+}
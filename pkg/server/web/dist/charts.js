@@ -0,0 +1,286 @@
+// charts.js renders simple SVG charts (line, bar, scatter and pie) from the rows of a command,
+// as returned by the /data endpoint: an array of objects keyed by column name.
+//
+// It has no dependencies, so that the datatables page can render charts without loading
+// a charting library from a CDN.
+
+// parkaCharts is declared with var and only defined once, so that the script can be included
+// several times in a page, for example by charts embedded in markdown pages.
+var parkaCharts = typeof parkaCharts !== 'undefined' ? parkaCharts : (function () {
+    const SVG_NS = 'http://www.w3.org/2000/svg';
+    const COLORS = ['#4e79a7', '#f28e2b', '#e15759', '#76b7b2', '#59a14f',
+        '#edc948', '#b07aa1', '#ff9da7', '#9c755f', '#bab0ac'];
+    const MARGIN = {top: 20, right: 20, bottom: 50, left: 60};
+    const DEFAULT_HEIGHT = 300;
+
+    function el(name, attributes, parent) {
+        const e = document.createElementNS(SVG_NS, name);
+        Object.entries(attributes || {}).forEach(([k, v]) => e.setAttribute(k, v));
+        if (parent) {
+            parent.appendChild(e);
+        }
+        return e;
+    }
+
+    function tooltip(e, text) {
+        el('title', {}, e).textContent = text;
+    }
+
+    function toNumber(v) {
+        if (typeof v === 'number') {
+            return v;
+        }
+        if (typeof v === 'string' && v.trim() !== '' && !isNaN(Number(v))) {
+            return Number(v);
+        }
+        return null;
+    }
+
+    function toTime(v) {
+        if (typeof v !== 'string' || !/^\d{4}-\d{2}-\d{2}/.test(v)) {
+            return null;
+        }
+        const t = Date.parse(v);
+        return isNaN(t) ? null : t;
+    }
+
+    // xScaleType returns `number`, `time` or `category` depending on the values of the x column
+    function xScaleType(values) {
+        if (values.length > 0 && values.every((v) => toNumber(v) !== null)) {
+            return 'number';
+        }
+        if (values.length > 0 && values.every((v) => toTime(v) !== null)) {
+            return 'time';
+        }
+        return 'category';
+    }
+
+    // buildSeries returns the series of points [{name, points: [{x, y, row}]}] of the chart
+    function buildSeries(spec, rows) {
+        if (spec.series) {
+            const bySeries = new Map();
+            rows.forEach((row) => {
+                const name = String(row[spec.series]);
+                if (!bySeries.has(name)) {
+                    bySeries.set(name, []);
+                }
+                bySeries.get(name).push({x: row[spec.x], y: toNumber(row[spec.y[0]]), row: row});
+            });
+            return Array.from(bySeries, ([name, points]) => ({name: name, points: points}));
+        }
+        return spec.y.map((column) => ({
+            name: column,
+            points: rows.map((row) => ({x: row[spec.x], y: toNumber(row[column]), row: row})),
+        }));
+    }
+
+    function niceTicks(min, max, count) {
+        if (min === max) {
+            min -= 1;
+            max += 1;
+        }
+        const rawStep = (max - min) / count;
+        const magnitude = Math.pow(10, Math.floor(Math.log10(rawStep)));
+        const step = [1, 2, 5, 10].map((m) => m * magnitude).find((s) => s >= rawStep);
+        const ticks = [];
+        for (let t = Math.floor(min / step) * step; t <= max + step / 2; t += step) {
+            ticks.push(Number(t.toPrecision(12)));
+        }
+        return ticks;
+    }
+
+    function formatTick(v, type) {
+        if (type === 'time') {
+            return new Date(v).toISOString().slice(0, 10);
+        }
+        return String(v);
+    }
+
+    function drawLegend(svg, series, width) {
+        if (series.length < 2) {
+            return;
+        }
+        let x = MARGIN.left;
+        series.forEach((s, i) => {
+            el('rect', {x: x, y: 4, width: 10, height: 10, fill: COLORS[i % COLORS.length]}, svg);
+            const text = el('text', {x: x + 14, y: 13, 'font-size': 11}, svg);
+            text.textContent = s.name;
+            x += 24 + 7 * s.name.length;
+            if (x > width - MARGIN.right) {
+                x = MARGIN.left;
+            }
+        });
+    }
+
+    function drawXYChart(svg, spec, rows, width, height) {
+        const series = buildSeries(spec, rows);
+        const points = series.flatMap((s) => s.points).filter((p) => p.y !== null);
+        if (points.length === 0) {
+            return;
+        }
+
+        const innerWidth = width - MARGIN.left - MARGIN.right;
+        const innerHeight = height - MARGIN.top - MARGIN.bottom;
+        const plot = el('g', {transform: `translate(${MARGIN.left},${MARGIN.top})`}, svg);
+
+        // y axis always starts at zero for bar charts
+        const ys = points.map((p) => p.y);
+        const yTicks = niceTicks(spec.type === 'bar' ? Math.min(0, ...ys) : Math.min(...ys), Math.max(...ys), 5);
+        const yMin = yTicks[0];
+        const yMax = yTicks[yTicks.length - 1];
+        const yPos = (v) => innerHeight - (v - yMin) / (yMax - yMin) * innerHeight;
+        yTicks.forEach((t) => {
+            el('line', {x1: 0, x2: innerWidth, y1: yPos(t), y2: yPos(t), stroke: '#eee'}, plot);
+            const label = el('text', {x: -6, y: yPos(t) + 4, 'text-anchor': 'end', 'font-size': 11}, plot);
+            label.textContent = formatTick(t, 'number');
+        });
+
+        const type = spec.type === 'bar' ? 'category' : xScaleType(points.map((p) => p.x));
+        let xPos, xTicks, bandWidth = 0;
+        if (type === 'category') {
+            const categories = Array.from(new Set(points.map((p) => String(p.x))));
+            bandWidth = innerWidth / categories.length;
+            const index = new Map(categories.map((c, i) => [c, i]));
+            xPos = (v) => (index.get(String(v)) + 0.5) * bandWidth;
+            // skip labels so that they don't overlap
+            const every = Math.ceil(categories.length / Math.max(1, Math.floor(innerWidth / 60)));
+            xTicks = categories.filter((_, i) => i % every === 0);
+        } else {
+            const convert = type === 'time' ? toTime : toNumber;
+            points.forEach((p) => p.xValue = convert(p.x));
+            const xs = points.map((p) => p.xValue);
+            const xMin = Math.min(...xs);
+            const xMax = Math.max(...xs);
+            const range = xMax - xMin || 1;
+            xPos = (v) => (convert(v) - xMin) / range * innerWidth;
+            xTicks = type === 'time'
+                ? [0, 1, 2, 3, 4].map((i) => new Date(xMin + range * i / 4).toISOString())
+                : niceTicks(xMin, xMax, 5).filter((t) => t >= xMin && t <= xMax);
+        }
+        xTicks.forEach((t) => {
+            const label = el('text', {
+                x: xPos(t), y: innerHeight + 16, 'text-anchor': 'middle', 'font-size': 11,
+            }, plot);
+            label.textContent = type === 'category' ? t : formatTick(type === 'time' ? Date.parse(t) : t, type);
+        });
+        el('line', {x1: 0, x2: innerWidth, y1: innerHeight, y2: innerHeight, stroke: '#999'}, plot);
+        el('line', {x1: 0, x2: 0, y1: 0, y2: innerHeight, stroke: '#999'}, plot);
+
+        series.forEach((s, i) => {
+            const color = COLORS[i % COLORS.length];
+            const valid = s.points.filter((p) => p.y !== null);
+            if (spec.type === 'line') {
+                if (type !== 'category') {
+                    valid.sort((a, b) => a.xValue - b.xValue);
+                }
+                el('polyline', {
+                    points: valid.map((p) => `${xPos(p.x)},${yPos(p.y)}`).join(' '),
+                    fill: 'none', stroke: color, 'stroke-width': 2,
+                }, plot);
+            }
+            if (spec.type === 'bar') {
+                const barWidth = bandWidth * 0.8 / series.length;
+                valid.forEach((p) => {
+                    const x = xPos(p.x) - bandWidth * 0.4 + i * barWidth;
+                    const y0 = yPos(Math.max(0, yMin));
+                    const rect = el('rect', {
+                        x: x, width: Math.max(1, barWidth - 1),
+                        y: Math.min(yPos(p.y), y0), height: Math.abs(y0 - yPos(p.y)), fill: color,
+                    }, plot);
+                    tooltip(rect, `${s.name}: ${p.x}, ${p.y}`);
+                });
+            } else {
+                valid.forEach((p) => {
+                    const circle = el('circle', {
+                        cx: xPos(p.x), cy: yPos(p.y), r: spec.type === 'scatter' ? 4 : 2.5, fill: color,
+                    }, plot);
+                    tooltip(circle, `${s.name}: ${p.x}, ${p.y}`);
+                });
+            }
+        });
+
+        drawLegend(svg, series, width);
+    }
+
+    function drawPieChart(svg, spec, rows, width, height) {
+        const totals = new Map();
+        rows.forEach((row) => {
+            const label = String(row[spec.x]);
+            const value = toNumber(row[spec.y[0]]);
+            if (value !== null && value > 0) {
+                totals.set(label, (totals.get(label) || 0) + value);
+            }
+        });
+        const sum = Array.from(totals.values()).reduce((a, b) => a + b, 0);
+        if (sum === 0) {
+            return;
+        }
+
+        const radius = Math.min(width / 2, height) / 2 - 10;
+        const cx = radius + 10;
+        const cy = height / 2;
+        let angle = -Math.PI / 2;
+        let i = 0;
+        totals.forEach((value, label) => {
+            const color = COLORS[i % COLORS.length];
+            const slice = value / sum * 2 * Math.PI;
+            let shape;
+            if (totals.size === 1) {
+                shape = el('circle', {cx: cx, cy: cy, r: radius, fill: color}, svg);
+            } else {
+                const x1 = cx + radius * Math.cos(angle);
+                const y1 = cy + radius * Math.sin(angle);
+                const x2 = cx + radius * Math.cos(angle + slice);
+                const y2 = cy + radius * Math.sin(angle + slice);
+                shape = el('path', {
+                    d: `M${cx},${cy} L${x1},${y1} A${radius},${radius} 0 ${slice > Math.PI ? 1 : 0} 1 ${x2},${y2} Z`,
+                    fill: color, stroke: '#fff',
+                }, svg);
+            }
+            tooltip(shape, `${label}: ${value} (${(value / sum * 100).toFixed(1)}%)`);
+
+            const legendY = 20 + i * 16;
+            if (legendY < height) {
+                el('rect', {x: 2 * radius + 40, y: legendY - 10, width: 10, height: 10, fill: color}, svg);
+                const text = el('text', {x: 2 * radius + 56, y: legendY, 'font-size': 11}, svg);
+                text.textContent = `${label} (${value})`;
+            }
+            angle += slice;
+            i++;
+        });
+    }
+
+    // render draws the chart described by spec into container
+    function render(container, spec, rows) {
+        const figure = document.createElement('figure');
+        figure.classList.add('chart');
+        container.appendChild(figure);
+        if (spec.title) {
+            const caption = document.createElement('figcaption');
+            caption.textContent = spec.title;
+            figure.appendChild(caption);
+        }
+
+        const width = container.clientWidth || 800;
+        const height = spec.height || DEFAULT_HEIGHT;
+        const svg = el('svg', {width: width, height: height, viewBox: `0 0 ${width} ${height}`});
+        figure.appendChild(svg);
+
+        if (spec.type === 'pie') {
+            drawPieChart(svg, spec, rows, width, height);
+        } else {
+            drawXYChart(svg, spec, rows, width, height);
+        }
+    }
+
+    // renderAll replaces the content of container with the charts described by specs
+    function renderAll(container, specs, rows) {
+        container.innerHTML = '';
+        (specs || []).forEach((spec) => render(container, spec, rows || []));
+    }
+
+    return {
+        render: render,
+        renderAll: renderAll,
+    };
+})();
@@ -0,0 +1,50 @@
+// mermaid.js draws the mermaid diagrams of markdown pages, rendered as <pre class="mermaid"> blocks.
+//
+// It loads the mermaid library from mermaid.min.js next to this script, so that both are served
+// under the root path of the server. The library is downloaded from the mermaid release pinned in
+// the `mermaid` script of package.json, by `npm run mermaid`. If the library can't be loaded, the source of the diagrams stays visible.
+
+// parkaMermaid is declared with var and only defined once, so that the script can be included
+// by several markdown blocks of the same page.
+var parkaMermaid = typeof parkaMermaid !== 'undefined' ? parkaMermaid : (function () {
+    const LIBRARY_PATH = new URL('mermaid.min.js', document.currentScript.src).href;
+
+    let loading = null;
+
+    function loadLibrary() {
+        if (typeof mermaid !== 'undefined') {
+            return Promise.resolve(mermaid);
+        }
+        if (loading === null) {
+            loading = new Promise((resolve, reject) => {
+                const script = document.createElement('script');
+                script.src = LIBRARY_PATH;
+                script.onload = () => resolve(mermaid);
+                script.onerror = () => reject(new Error('could not load ' + LIBRARY_PATH));
+                document.head.appendChild(script);
+            });
+        }
+        return loading;
+    }
+
+    function run() {
+        const nodes = document.querySelectorAll('pre.mermaid:not([data-processed])');
+        if (nodes.length === 0) {
+            return;
+        }
+        loadLibrary()
+            .then((m) => {
+                m.initialize({startOnLoad: false});
+                return m.run({nodes: nodes});
+            })
+            .catch((err) => console.warn('mermaid:', err));
+    }
+
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', run);
+    } else {
+        run();
+    }
+
+    return {run: run};
+})();
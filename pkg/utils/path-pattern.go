@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WildcardParam is the name under which the remainder matched by a trailing `*` is stored.
+// This matches the name echo uses for its wildcard parameter.
+const WildcardParam = "*"
+
+// PathPattern matches URL paths against a route pattern using the same syntax as the echo router:
+//   - `:name` matches a single path segment and captures it as name
+//   - a trailing `*` matches the rest of the path and captures it as WildcardParam
+//
+// For example, /reports/:year/* matches /reports/2024/sales/q1 with year=2024 and *=sales/q1.
+type PathPattern struct {
+	Pattern string
+	re      *regexp.Regexp
+	names   []string
+}
+
+var paramRegexp = regexp.MustCompile(`^:([A-Za-z_][A-Za-z0-9_-]*)$`)
+
+func NewPathPattern(pattern string) (*PathPattern, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+
+	segments := strings.Split(pattern, "/")
+	reStr := ""
+	names := []string{}
+
+	for i, segment := range segments {
+		if i == 0 {
+			continue
+		}
+		if segment == "*" {
+			if i != len(segments)-1 {
+				return nil, errors.Errorf("wildcard must be the last segment in %s", pattern)
+			}
+			// make the slash optional so that /foo/* also matches /foo
+			reStr += "(?:/(.*))?"
+			names = append(names, WildcardParam)
+			continue
+		}
+
+		reStr += "/"
+		if m := paramRegexp.FindStringSubmatch(segment); m != nil {
+			reStr += "([^/]+)"
+			names = append(names, m[1])
+			continue
+		}
+		if strings.Contains(segment, ":") || strings.Contains(segment, "*") {
+			return nil, errors.Errorf("invalid segment %s in %s", segment, pattern)
+		}
+		reStr += regexp.QuoteMeta(segment)
+	}
+
+	re, err := regexp.Compile("^" + reStr + "$")
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not compile path pattern %s", pattern)
+	}
+
+	return &PathPattern{
+		Pattern: pattern,
+		re:      re,
+		names:   names,
+	}, nil
+}
+
+// Match returns the captured parameters if path matches the pattern.
+func (p *PathPattern) Match(path string) (map[string]string, bool) {
+	m := p.re.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+
+	ret := map[string]string{}
+	for i, name := range p.names {
+		ret[name] = m[i+1]
+	}
+	return ret, true
+}
+
+var templateParamRegexp = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_-]*|\*)\}`)
+
+// ExpandPathTemplate replaces `{name}` placeholders in target with the captured parameters.
+// `{*}` is replaced with the wildcard remainder. Unknown placeholders are replaced with the empty string.
+// Duplicate slashes resulting from empty parameters are collapsed.
+func ExpandPathTemplate(target string, params map[string]string) string {
+	ret := templateParamRegexp.ReplaceAllStringFunc(target, func(s string) string {
+		return params[s[1:len(s)-1]]
+	})
+
+	// collapse the // left behind by empty parameters, but keep the scheme separator intact
+	prefix := ""
+	if idx := strings.Index(ret, "://"); idx != -1 {
+		prefix, ret = ret[:idx+3], ret[idx+3:]
+	}
+	for strings.Contains(ret, "//") {
+		ret = strings.ReplaceAll(ret, "//", "/")
+	}
+
+	return prefix + ret
+}
+
+// MergeTargetQuery adds the query parameters of a request to the query of a redirect or rewrite target.
+// The parameters set by the target take precedence over the ones of the request.
+func MergeTargetQuery(targetQuery url.Values, requestQuery url.Values) url.Values {
+	ret := url.Values{}
+	for k, v := range requestQuery {
+		ret[k] = v
+	}
+	for k, v := range targetQuery {
+		ret[k] = v
+	}
+	return ret
+}